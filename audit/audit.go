@@ -0,0 +1,94 @@
+package audit
+
+import (
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+// Action identifies the kind of event recorded in an audit Entry.
+type Action string
+
+const (
+	// ActionLogin is a login attempt, either creating a session or using HTTP
+	// Basic authentication.
+	ActionLogin Action = "login"
+	// ActionLogout is the end of a session.
+	ActionLogout Action = "logout"
+	// ActionPasswordChange is a change to a user's password.
+	ActionPasswordChange Action = "password"
+	// ActionUserCreate is the registration of a new user.
+	ActionUserCreate Action = "usercreate"
+	// ActionUserUpdate is a change to a user's account details.
+	ActionUserUpdate Action = "userupdate"
+	// ActionRecoveryLogin is an authentication attempt as the recovery admin.
+	ActionRecoveryLogin Action = "recovery"
+	// ActionAccessChange is a change to a user's access level.
+	ActionAccessChange Action = "access"
+	// ActionUserDisable is an administrator disabling a user's account.
+	ActionUserDisable Action = "disable"
+	// ActionUserEnable is an administrator re-enabling a user's account.
+	ActionUserEnable Action = "enable"
+	// ActionSessionRevoke is the revocation of one or more of a user's sessions.
+	ActionSessionRevoke Action = "revoke"
+	// ActionTwoFactorEnable is a user completing two-factor enrolment.
+	ActionTwoFactorEnable Action = "2faenable"
+	// ActionTwoFactorDisable is the removal of a user's two-factor
+	// authentication, by the user or an administrator.
+	ActionTwoFactorDisable Action = "2fadisable"
+	// ActionTokenCreate is the creation of a personal API token.
+	ActionTokenCreate Action = "tokencreate"
+	// ActionTokenRevoke is the revocation of a personal API token.
+	ActionTokenRevoke Action = "tokenrevoke"
+	// ActionEmailVerify is an attempt to verify a user's email address.
+	ActionEmailVerify Action = "emailverify"
+	// ActionGroupCreate is the creation of a group.
+	ActionGroupCreate Action = "groupcreate"
+	// ActionGroupUpdate is a change to a group's name or members.
+	ActionGroupUpdate Action = "groupupdate"
+	// ActionGroupDelete is the deletion of a group and its notes.
+	ActionGroupDelete Action = "groupdelete"
+)
+
+// Outcome indicates whether an audited action succeeded.
+type Outcome string
+
+const (
+	// OutcomeSuccess indicates the action was completed.
+	OutcomeSuccess Outcome = "success"
+	// OutcomeFailure indicates the action was attempted and failed or was denied.
+	OutcomeFailure Outcome = "failure"
+)
+
+// Entry is a single record in the audit log. Entries are never modified once
+// written.
+type Entry struct {
+	ID        uuid.UUID `json:"id" xml:"id,attr" bson:"_id"`
+	Time      time.Time `json:"time" xml:"time,attr" storm:"index"`
+	Actor     uuid.UUID `json:"actor" xml:"Actor" storm:"index"`
+	ActorName string    `json:"actorName,omitempty" xml:"ActorName,omitempty"`
+	SourceIP  string    `json:"sourceIP" xml:"SourceIP"`
+	Action    Action    `json:"action" xml:"action,attr" storm:"index"`
+	Target    uuid.UUID `json:"target" xml:"Target" storm:"index"`
+	Outcome   Outcome   `json:"outcome" xml:"outcome,attr"`
+	Detail    string    `json:"detail,omitempty" xml:"Detail,omitempty"`
+}
+
+// NewEntry creates a new audit Entry for the current time.
+func NewEntry(action Action, outcome Outcome) Entry {
+	return Entry{
+		ID:      uuid.NewV4(),
+		Time:    time.Now(),
+		Action:  action,
+		Outcome: outcome,
+	}
+}
+
+// OutcomeOf returns OutcomeFailure if the given error is non-nil, and
+// OutcomeSuccess otherwise.
+func OutcomeOf(err error) Outcome {
+	if err != nil {
+		return OutcomeFailure
+	}
+	return OutcomeSuccess
+}
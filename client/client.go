@@ -2,16 +2,24 @@ package client
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
 	"net/url"
 	"path"
+	"time"
 
 	"github.com/aprice/freenote/users"
 )
 
+// Default retry settings for idempotent requests.
+const (
+	DefaultMaxRetries = 3
+	DefaultRetryDelay = 250 * time.Millisecond
+)
+
 // Client interfaces with the REST API.
 type Client struct {
 	*http.Client
@@ -20,6 +28,12 @@ type Client struct {
 	Password string
 	Host     string
 
+	// MaxRetries is how many times idempotent requests are retried after a
+	// network error or temporary failure status.
+	MaxRetries int
+	// RetryDelay is the delay before the first retry; it doubles each retry.
+	RetryDelay time.Duration
+
 	User users.User
 }
 
@@ -29,10 +43,12 @@ func New(user, pass, host string) (*Client, error) {
 		return nil, errors.New("username, password, and host are required")
 	}
 	c := &Client{
-		Client:   new(http.Client),
-		Username: user,
-		Password: pass,
-		Host:     host,
+		Client:     new(http.Client),
+		Username:   user,
+		Password:   pass,
+		Host:       host,
+		MaxRetries: DefaultMaxRetries,
+		RetryDelay: DefaultRetryDelay,
 	}
 	err := c.Connect()
 	if err != nil {
@@ -43,16 +59,38 @@ func New(user, pass, host string) (*Client, error) {
 
 // Connect to the server and establish a session.
 func (c *Client) Connect() error {
-	return c.Call("GET", fmt.Sprintf("/users/%s", c.Username), "", nil, &c.User)
+	user, err := c.Me(context.Background())
+	if err != nil {
+		return err
+	}
+	c.User = user
+	return nil
+}
+
+// Me gets the authenticated user.
+func (c *Client) Me(ctx context.Context) (users.User, error) {
+	user := users.User{}
+	err := c.CallContext(ctx, "GET", fmt.Sprintf("/users/%s", url.PathEscape(c.Username)), "", nil, &user)
+	return user, err
 }
 
 // Get an arbitrary object or collection from a route and unmarshal it.
 func (c *Client) Get(route string, result interface{}) error {
-	return c.Call("GET", route, "", nil, result)
+	return c.CallContext(context.Background(), "GET", route, "", nil, result)
 }
 
 // Send an arbitrary payload to a route and unmarshal the response.
 func (c *Client) Send(method, route string, payload, result interface{}) error {
+	return c.SendContext(context.Background(), method, route, payload, result)
+}
+
+// SendContext sends an arbitrary payload to a route and unmarshals the
+// response, with a context.
+func (c *Client) SendContext(ctx context.Context, method, route string, payload, result interface{}) error {
+	return c.send(ctx, method, route, nil, payload, result)
+}
+
+func (c *Client) send(ctx context.Context, method, route string, header http.Header, payload, result interface{}) error {
 	var body []byte
 	var err error
 	if payload != nil {
@@ -61,34 +99,93 @@ func (c *Client) Send(method, route string, payload, result interface{}) error {
 			return err
 		}
 	}
-	return c.Call(method, route, "application/json", body, result)
+	return c.do(ctx, method, route, "application/json", header, body, result)
 }
 
 // Call a route with all parameters supplied by the caller. Basic HTTP executor.
 func (c *Client) Call(method, route, ctype string, payload []byte, result interface{}) error {
-	u, err := url.Parse(c.Host)
+	return c.CallContext(context.Background(), method, route, ctype, payload, result)
+}
+
+// CallContext calls a route with all parameters supplied by the caller, with a
+// context. Idempotent requests are retried with backoff after network errors
+// and temporary failures.
+func (c *Client) CallContext(ctx context.Context, method, route, ctype string, payload []byte, result interface{}) error {
+	return c.do(ctx, method, route, ctype, nil, payload, result)
+}
+
+func (c *Client) do(ctx context.Context, method, route, ctype string, header http.Header, payload []byte, result interface{}) error {
+	u, err := c.resolve(route)
 	if err != nil {
 		return err
 	}
-	u.Path = path.Join(u.Path, route)
+	delay := c.RetryDelay
+	for attempt := 0; ; attempt++ {
+		err = c.call(ctx, method, u, ctype, header, payload, result)
+		if err == nil || attempt >= c.MaxRetries || !idempotent(method) || !Temporary(err) {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+func (c *Client) call(ctx context.Context, method string, u *url.URL, ctype string, header http.Header, payload []byte, result interface{}) error {
 	req, err := http.NewRequest(method, u.String(), bytes.NewReader(payload))
 	if err != nil {
 		return err
 	}
+	req = req.WithContext(ctx)
+	for k, v := range header {
+		req.Header[k] = v
+	}
 	req.SetBasicAuth(c.Username, c.Password)
 	req.Header.Set("Accept", "application/json")
-	req.Header.Set("Content-Type", ctype)
+	if ctype != "" {
+		req.Header.Set("Content-Type", ctype)
+	}
 
 	res, err := c.Do(req)
 	defer CleanupResponse(res)
 	if err != nil {
 		return err
 	}
-	if res.StatusCode >= 300 {
-		return fmt.Errorf("request returned status %d: %s", res.StatusCode, res.Status)
+	if err = responseError(res); err != nil {
+		return err
 	}
-	if result == nil {
+	if result == nil || res.StatusCode == http.StatusNoContent {
 		return nil
 	}
 	return json.NewDecoder(res.Body).Decode(result)
 }
+
+func idempotent(method string) bool {
+	switch method {
+	case "GET", "HEAD", "OPTIONS", "PUT", "DELETE":
+		return true
+	}
+	return false
+}
+
+// resolve a route against the host. Routes may include a query string, and
+// absolute URLs (such as hypermedia links) are used as-is.
+func (c *Client) resolve(route string) (*url.URL, error) {
+	ref, err := url.Parse(route)
+	if err != nil {
+		return nil, err
+	}
+	if ref.IsAbs() {
+		return ref, nil
+	}
+	u, err := url.Parse(c.Host)
+	if err != nil {
+		return nil, err
+	}
+	u.Path = path.Join(u.Path, ref.Path)
+	u.RawQuery = ref.RawQuery
+	return u, nil
+}
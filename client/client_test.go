@@ -0,0 +1,147 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+
+	"github.com/aprice/freenote/notes"
+	"github.com/aprice/freenote/page"
+	"github.com/aprice/freenote/rest"
+	"github.com/aprice/freenote/users"
+)
+
+func testServer(t *testing.T, handler http.HandlerFunc) (*Client, func()) {
+	user := users.New("alice")
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if name, pass, ok := r.BasicAuth(); !ok || name != "alice" || pass != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Path == "/users/alice" {
+			json.NewEncoder(w).Encode(user)
+			return
+		}
+		handler(w, r)
+	}))
+	c, err := New("alice", "secret", svr.URL)
+	if err != nil {
+		svr.Close()
+		t.Fatal(err)
+	}
+	if c.User.ID != user.ID {
+		t.Errorf("Connected as %s, expected %s", c.User.ID, user.ID)
+	}
+	c.RetryDelay = time.Millisecond
+	return c, svr.Close
+}
+
+func TestNoteIterator(t *testing.T) {
+	all := make([]notes.Note, 25)
+	for i := range all {
+		all[i] = notes.Note{ID: uuid.NewV4(), Title: strconv.Itoa(i)}
+	}
+	var (
+		base   string
+		filter url.Values
+	)
+	c, done := testServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, "/notes") {
+			http.Error(w, "Bad path", http.StatusBadRequest)
+			return
+		}
+		p := page.Page{}
+		p.FromQueryString(r.URL, []string{"modified"})
+		query := url.Values{}
+		for k := range filter {
+			query.Set(k, r.URL.Query().Get(k))
+		}
+		if query.Encode() != filter.Encode() {
+			t.Errorf("Query lost: %s", r.URL.RawQuery)
+		}
+		end := p.Start + p.Length
+		if end > len(all) {
+			end = len(all)
+		}
+		p.HasMore = end < len(all)
+		payload := rest.DecorateNotes(all[p.Start:end], query.Encode(), nil, p, true, rest.UserURI(base, all[0].Owner))
+		json.NewEncoder(w).Encode(payload)
+	})
+	defer done()
+	base = c.Host
+
+	for _, tc := range []struct {
+		query  NoteQuery
+		filter url.Values
+	}{
+		{NoteQuery{Tag: "x", PageSize: 10}, url.Values{"tag": {"x"}}},
+		{NoteQuery{Folder: "/work/projects", PageSize: 10}, url.Values{"folder": {"work/projects"}}},
+	} {
+		filter = tc.filter
+		list, err := c.Notes(context.Background(), tc.query).All()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(list) != len(all) {
+			t.Fatalf("Got %d notes, expected %d", len(list), len(all))
+		}
+		for i := range list {
+			if list[i].ID != all[i].ID {
+				t.Errorf("Note %d is %s, expected %s", i, list[i].Title, all[i].Title)
+			}
+		}
+	}
+}
+
+func TestErrors(t *testing.T) {
+	attempts := 0
+	c, done := testServer(t, func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		code, _ := strconv.Atoi(r.URL.Query().Get("code"))
+		http.Error(w, "Nope", code)
+	})
+	defer done()
+	cases := []struct {
+		code     int
+		expected error
+	}{
+		{http.StatusNotFound, ErrNotFound},
+		{http.StatusConflict, ErrConflict},
+		{http.StatusPreconditionFailed, ErrConflict},
+		{http.StatusForbidden, ErrForbidden},
+	}
+	for _, tc := range cases {
+		if err := c.Get(fmt.Sprintf("/x?code=%d", tc.code), nil); err != tc.expected {
+			t.Errorf("Status %d returned %v, expected %v", tc.code, err, tc.expected)
+		}
+	}
+	err := c.Get("/x?code=400", nil)
+	if se, ok := err.(*StatusError); !ok || se.StatusCode != 400 || se.Message != "Nope" {
+		t.Errorf("Status 400 returned %#v", err)
+	}
+
+	// Temporary failures are retried, but only for idempotent methods.
+	attempts = 0
+	if err = c.Get("/x?code=503", nil); err == nil || attempts != c.MaxRetries+1 {
+		t.Errorf("GET made %d attempts, expected %d", attempts, c.MaxRetries+1)
+	}
+	attempts = 0
+	if err = c.Send("POST", "/x?code=503", nil, nil); err == nil || attempts != 1 {
+		t.Errorf("POST made %d attempts, expected 1", attempts)
+	}
+	attempts = 0
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err = c.CallContext(ctx, "GET", "/x?code=503", "", nil, nil); err == nil || attempts > 1 {
+		t.Errorf("Cancelled GET made %d attempts: %v", attempts, err)
+	}
+}
@@ -0,0 +1,74 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Errors returned for common response statuses, so callers can compare them
+// directly.
+var (
+	ErrUnauthorized = errors.New("authentication failed")
+	ErrForbidden    = errors.New("access denied")
+	ErrNotFound     = errors.New("not found")
+	ErrConflict     = errors.New("conflicting change")
+)
+
+// StatusError is returned for any other response with an error status.
+type StatusError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("request returned status %d: %s", e.StatusCode, e.Message)
+}
+
+// Temporary reports whether the request may succeed if retried.
+func (e *StatusError) Temporary() bool {
+	switch e.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// Temporary reports whether an error returned by the client is worth retrying:
+// a failure status that says so, or a network error that isn't due to the
+// context ending.
+func Temporary(err error) bool {
+	if se, ok := err.(*StatusError); ok {
+		return se.Temporary()
+	}
+	if ue, ok := err.(*url.Error); ok {
+		return ue.Err != context.Canceled && ue.Err != context.DeadlineExceeded
+	}
+	return false
+}
+
+// responseError returns the error for a response status, or nil for success.
+func responseError(res *http.Response) error {
+	switch {
+	case res.StatusCode < 300:
+		return nil
+	case res.StatusCode == http.StatusUnauthorized:
+		return ErrUnauthorized
+	case res.StatusCode == http.StatusForbidden:
+		return ErrForbidden
+	case res.StatusCode == http.StatusNotFound:
+		return ErrNotFound
+	case res.StatusCode == http.StatusConflict, res.StatusCode == http.StatusPreconditionFailed:
+		return ErrConflict
+	}
+	msg, _ := ioutil.ReadAll(io.LimitReader(res.Body, 512))
+	if len(msg) == 0 {
+		msg = []byte(http.StatusText(res.StatusCode))
+	}
+	return &StatusError{StatusCode: res.StatusCode, Message: strings.TrimSpace(string(msg))}
+}
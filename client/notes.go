@@ -0,0 +1,234 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+
+	"github.com/aprice/freenote/importer"
+	"github.com/aprice/freenote/notes"
+	"github.com/aprice/freenote/rest"
+)
+
+// NoteQuery filters and sorts a list of notes. The zero value lists all notes,
+// most recently modified first.
+type NoteQuery struct {
+	Folder        string
+	Tag           string
+	Text          string
+	ModifiedSince time.Time
+	// Sort is modified, created, or title.
+	Sort      string
+	Ascending bool
+	Start     int
+	// PageSize is the number of notes requested at a time.
+	PageSize int
+}
+
+func (q NoteQuery) values() url.Values {
+	v := url.Values{}
+	if q.Folder != "" {
+		v.Set("folder", strings.Trim(q.Folder, "/"))
+	}
+	if q.Tag != "" {
+		v.Set("tag", q.Tag)
+	}
+	if q.Text != "" {
+		v.Set("q", q.Text)
+	}
+	if !q.ModifiedSince.IsZero() {
+		v.Set("modifiedSince", q.ModifiedSince.Format(time.RFC3339))
+	}
+	if q.Sort != "" {
+		v.Set("sort", q.Sort)
+	}
+	if q.Ascending {
+		v.Set("order", "asc")
+	} else {
+		v.Set("order", "desc")
+	}
+	if q.Start > 0 {
+		v.Set("start", strconv.Itoa(q.Start))
+	}
+	if q.PageSize > 0 {
+		v.Set("length", strconv.Itoa(q.PageSize))
+	}
+	return v
+}
+
+// NotePage is a single page of a list of notes. Note bodies are truncated to
+// their first line.
+type NotePage struct {
+	Notes []notes.Note
+	Links rest.Links
+}
+
+// HasMore reports whether there is another page after this one.
+func (p NotePage) HasMore() bool {
+	_, ok := p.Links["next"]
+	return ok
+}
+
+// NotePage gets a single page of the user's notes matching a query.
+func (c *Client) NotePage(ctx context.Context, query NoteQuery) (NotePage, error) {
+	return c.notePage(ctx, fmt.Sprintf("/users/%s/notes/?%s", c.User.ID, query.values().Encode()))
+}
+
+func (c *Client) notePage(ctx context.Context, route string) (NotePage, error) {
+	var payload rest.DecoratedNotes
+	if err := c.CallContext(ctx, "GET", route, "", nil, &payload); err != nil {
+		return NotePage{}, err
+	}
+	page := NotePage{Notes: make([]notes.Note, len(payload.Notes)), Links: payload.Links}
+	for i, n := range payload.Notes {
+		page.Notes[i] = n.Note
+	}
+	return page, nil
+}
+
+// Notes lists all the user's notes matching a query, fetching pages as needed
+// by following next links. Note bodies are truncated to their first line.
+func (c *Client) Notes(ctx context.Context, query NoteQuery) *NoteIterator {
+	return &NoteIterator{
+		c:    c,
+		ctx:  ctx,
+		next: fmt.Sprintf("/users/%s/notes/?%s", c.User.ID, query.values().Encode()),
+	}
+}
+
+// NoteIterator steps through a list of notes. Call Next before each note,
+// including the first, and check Err once Next returns false:
+//
+//	it := c.Notes(ctx, client.NoteQuery{})
+//	for it.Next() {
+//		note := it.Note()
+//	}
+//	if err := it.Err(); err != nil {
+//	}
+type NoteIterator struct {
+	c    *Client
+	ctx  context.Context
+	next string
+	page []notes.Note
+	cur  notes.Note
+	err  error
+}
+
+// Next advances to the next note, returning false when there are no more or
+// an error occurred.
+func (it *NoteIterator) Next() bool {
+	for len(it.page) == 0 {
+		if it.next == "" || it.err != nil {
+			return false
+		}
+		page, err := it.c.notePage(it.ctx, it.next)
+		if err != nil {
+			it.err = err
+			return false
+		}
+		it.page, it.next = page.Notes, ""
+		if link, ok := page.Links["next"]; ok {
+			it.next = link.Href
+		}
+	}
+	it.cur, it.page = it.page[0], it.page[1:]
+	return true
+}
+
+// Note returns the current note.
+func (it *NoteIterator) Note() notes.Note {
+	return it.cur
+}
+
+// Err returns the error that stopped iteration, if any.
+func (it *NoteIterator) Err() error {
+	return it.err
+}
+
+// All collects every remaining note.
+func (it *NoteIterator) All() ([]notes.Note, error) {
+	var list []notes.Note
+	for it.Next() {
+		list = append(list, it.Note())
+	}
+	return list, it.Err()
+}
+
+// Note gets one of the user's notes.
+func (c *Client) Note(ctx context.Context, id uuid.UUID) (notes.Note, error) {
+	note := notes.Note{}
+	err := c.CallContext(ctx, "GET", c.noteRoute(id), "", nil, &note)
+	return note, err
+}
+
+// CreateNote creates a new note for the user, and returns it as saved.
+func (c *Client) CreateNote(ctx context.Context, note notes.Note) (notes.Note, error) {
+	note.Owner = c.User.ID
+	saved := notes.Note{}
+	err := c.SendContext(ctx, "POST", fmt.Sprintf("/users/%s/notes/", c.User.ID), &note, &saved)
+	return saved, err
+}
+
+// UpdateNote replaces one of the user's notes, or creates it if its ID is
+// unused, and returns it as saved.
+func (c *Client) UpdateNote(ctx context.Context, note notes.Note) (notes.Note, error) {
+	note.HTMLBody = ""
+	saved := notes.Note{}
+	err := c.SendContext(ctx, "PUT", c.noteRoute(note.ID), &note, &saved)
+	return saved, err
+}
+
+// UpdateNoteIfMatch replaces one of the user's notes only if its current
+// version has the given ETag, as returned by notes.Note.ETag for the version
+// it was based on. If the note has changed since, it returns ErrConflict.
+func (c *Client) UpdateNoteIfMatch(ctx context.Context, note notes.Note, etag string) (notes.Note, error) {
+	note.HTMLBody = ""
+	saved := notes.Note{}
+	err := c.send(ctx, "PUT", c.noteRoute(note.ID), http.Header{"If-Match": {etag}}, &note, &saved)
+	return saved, err
+}
+
+// DeleteNote deletes one of the user's notes.
+func (c *Client) DeleteNote(ctx context.Context, id uuid.UUID) error {
+	return c.CallContext(ctx, "DELETE", c.noteRoute(id), "", nil, nil)
+}
+
+// NoteURL returns the URL of one of the user's notes.
+func (c *Client) NoteURL(id uuid.UUID) string {
+	u, err := c.resolve(c.noteRoute(id))
+	if err != nil {
+		return c.Host + c.noteRoute(id)
+	}
+	return u.String()
+}
+
+func (c *Client) noteRoute(id uuid.UUID) string {
+	return fmt.Sprintf("/users/%s/notes/%s", c.User.ID, id)
+}
+
+var importContentTypes = map[importer.Format]string{
+	importer.FormatENEX:       "application/enex+xml",
+	importer.FormatSimplenote: "application/json",
+	importer.FormatMarkdown:   "application/zip",
+}
+
+// Import uploads an export from another application, creating a note for each
+// note in it. Notes that don't specify a folder are put in folder.
+func (c *Client) Import(ctx context.Context, format importer.Format, folder string, export []byte) (importer.Report, error) {
+	q := url.Values{}
+	q.Set("format", string(format))
+	if folder != "" {
+		q.Set("folder", folder)
+	}
+	report := importer.Report{}
+	err := c.CallContext(ctx, "POST",
+		fmt.Sprintf("/users/%s/import?%s", c.User.ID, q.Encode()),
+		importContentTypes[format], export, &report)
+	return report, err
+}
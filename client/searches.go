@@ -0,0 +1,56 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/aprice/freenote/rest"
+)
+
+// Searches lists the user's saved searches, with the number of notes each
+// matches.
+func (c *Client) Searches(ctx context.Context) ([]rest.DecoratedSearch, error) {
+	var payload rest.DecoratedSearches
+	err := c.CallContext(ctx, "GET", fmt.Sprintf("/users/%s/searches", c.User.ID), "", nil, &payload)
+	return payload.Searches, err
+}
+
+// SearchByName gets the user's saved search with the given name, ignoring
+// case. It returns ErrNotFound if there is none.
+func (c *Client) SearchByName(ctx context.Context, name string) (rest.DecoratedSearch, error) {
+	list, err := c.Searches(ctx)
+	if err != nil {
+		return rest.DecoratedSearch{}, err
+	}
+	for _, search := range list {
+		if strings.EqualFold(search.Name, name) {
+			return search, nil
+		}
+	}
+	return rest.DecoratedSearch{}, ErrNotFound
+}
+
+// SearchNotePage gets a single page of the notes matching a saved search. Only
+// the query's sorting and paging apply; if it has no Sort, the search's own
+// sort is used.
+func (c *Client) SearchNotePage(ctx context.Context, search rest.DecoratedSearch, query NoteQuery) (NotePage, error) {
+	v := url.Values{}
+	if query.Sort != "" {
+		v.Set("sort", query.Sort)
+		if query.Ascending {
+			v.Set("order", "asc")
+		} else {
+			v.Set("order", "desc")
+		}
+	}
+	if query.Start > 0 {
+		v.Set("start", strconv.Itoa(query.Start))
+	}
+	if query.PageSize > 0 {
+		v.Set("length", strconv.Itoa(query.PageSize))
+	}
+	return c.notePage(ctx, fmt.Sprintf("/users/%s/searches/%s/notes?%s", c.User.ID, search.ID, v.Encode()))
+}
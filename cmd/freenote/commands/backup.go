@@ -1,15 +1,16 @@
 package commands
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
 	"sync"
 
+	uuid "github.com/satori/go.uuid"
 	"github.com/spf13/cobra"
 
-	"github.com/aprice/freenote/notes"
-	"github.com/aprice/freenote/rest"
+	"github.com/aprice/freenote/client"
 )
 
 var (
@@ -28,7 +29,10 @@ var backupCmd = &cobra.Command{
 	Short: "Download all notes",
 	Long: `
 freenote backup will download all notes on the Freenote server and save them to
-local disk. Notes will be downloaded as markdown by default.`,
+local disk, one <id>.md file per note. Each file has YAML front matter holding
+the note's ID, title, folder, tags, and created and modified times, so the
+backup can be restored with freenote restore. With --html, only the rendered
+HTML body is saved, and the backup can't be restored.`,
 	Run: func(cmd *cobra.Command, args []string) {
 		var wg sync.WaitGroup
 		var err error
@@ -38,58 +42,48 @@ local disk. Notes will be downloaded as markdown by default.`,
 			ext = ".html"
 		}
 
-		var payload rest.DecoratedNotes
-
 		c, err := initClient()
 		if err != nil {
 			fmt.Println("failed to connect: ", err)
 			os.Exit(1)
 		}
-		ownerID := c.User.ID
-
-		url := fmt.Sprintf("/users/%s/notes/", ownerID)
-		for {
-			err = c.Get(url, &payload)
-			if err != nil {
-				fmt.Println("get note list failed: ", err)
-				os.Exit(1)
-			}
-			for _, note := range payload.Notes {
-				wg.Add(1)
-				go func(n rest.DecoratedNote) {
-					downloadFile := filepath.Join(path, n.ID.String()+ext)
-					f, err := os.OpenFile(downloadFile, os.O_CREATE, 0600)
-					if err != nil {
-						fmt.Println("failed to open ", downloadFile, ": ", err)
-						os.Exit(1)
-					}
-					defer f.Close()
-					note := new(notes.Note)
-					err = c.Get(n.Links["canonical"].Href, note)
-					if err != nil {
-						fmt.Println("get note failed: ", err)
-						os.Exit(1)
-					}
-					var body string
-					if backupHTML {
-						body = note.HTMLBody
-					} else {
-						body = note.Body
-					}
-					_, err = fmt.Fprint(f, body)
-					if err != nil {
-						fmt.Println("failed to write file: ", err)
-						os.Exit(1)
-					}
-					f.Close()
-				}(note)
-			}
+		ctx := context.Background()
 
-			if next, ok := payload.Links["next"]; !ok {
-				break
-			} else {
-				url = next.Href
-			}
+		it := c.Notes(ctx, client.NoteQuery{PageSize: 100})
+		for it.Next() {
+			wg.Add(1)
+			go func(id uuid.UUID) {
+				defer wg.Done()
+				downloadFile := filepath.Join(path, id.String()+ext)
+				f, err := os.OpenFile(downloadFile, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+				if err != nil {
+					fmt.Println("failed to open ", downloadFile, ": ", err)
+					os.Exit(1)
+				}
+				defer f.Close()
+				note, err := c.Note(ctx, id)
+				if err != nil {
+					fmt.Println("get note failed: ", err)
+					os.Exit(1)
+				}
+				var body []byte
+				if backupHTML {
+					body = []byte(note.HTMLBody)
+				} else if body, err = note.MarshalMarkdown(); err != nil {
+					fmt.Println("failed to encode note: ", err)
+					os.Exit(1)
+				}
+				_, err = f.Write(body)
+				if err != nil {
+					fmt.Println("failed to write file: ", err)
+					os.Exit(1)
+				}
+			}(it.Note().ID)
+		}
+		if err = it.Err(); err != nil {
+			fmt.Println("get note list failed: ", err)
+			os.Exit(1)
 		}
+		wg.Wait()
 	},
 }
@@ -3,12 +3,9 @@ package commands
 import (
 	"errors"
 	"fmt"
-	"net/url"
 	"os"
 
 	"github.com/spf13/cobra"
-
-	"github.com/aprice/freenote/notes"
 )
 
 var (
@@ -23,14 +20,15 @@ func init() {
 }
 
 var downloadCmd = &cobra.Command{
-	Use:   "download [noteID]",
+	Use:   "download [note]",
 	Short: "Download a note",
 	Long: `
 freenote download will download a note on the Freenote server and save it to
-local disk. Notes will be downloaded as markdown by default.`,
+local disk. Notes will be downloaded as markdown by default. The note can be
+given by ID, short ID, or a unique title prefix.`,
 	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
 		if len(args) != 1 {
-			return errors.New("You must provide a note ID to download")
+			return errors.New("You must provide a note to download")
 		}
 		return nil
 	},
@@ -38,25 +36,14 @@ local disk. Notes will be downloaded as markdown by default.`,
 		var err error
 		f := os.Stdout
 		if downloadFile != "" {
-			f, err = os.OpenFile(downloadFile, os.O_CREATE, 0600)
+			f, err = os.OpenFile(downloadFile, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
 			if err != nil {
 				fmt.Println("failed to open ", downloadFile, ": ", err)
 				os.Exit(1)
 			}
 			defer f.Close()
 		}
-		note := new(notes.Note)
-		c, err := initClient()
-		if err != nil {
-			fmt.Println("failed to connect: ", err)
-			os.Exit(1)
-		}
-		ownerID := c.User.ID
-		err = c.Get(fmt.Sprintf("/users/%s/notes/%s", ownerID, url.QueryEscape(args[0])), note)
-		if err != nil {
-			fmt.Println("get note failed: ", err)
-			os.Exit(1)
-		}
+		_, note := mustSelectNote(args[0])
 		var body string
 		if htmlExport {
 			body = note.HTMLBody
@@ -1,19 +1,21 @@
 package commands
 
 import (
+	"bufio"
+	"context"
 	"errors"
 	"fmt"
 	"io/ioutil"
-	"net/url"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/spf13/cobra"
 
+	"github.com/aprice/freenote/client"
 	"github.com/aprice/freenote/notes"
-	"github.com/aprice/freenote/rest"
 )
 
 var (
@@ -26,53 +28,32 @@ func init() {
 }
 
 var editCmd = &cobra.Command{
-	Use:   "edit [noteID]",
+	Use:   "edit [note]",
 	Short: "Edit a note",
 	Long: `
-freenote edit will download a note from the Freenote server for local editing.`,
+freenote edit will download a note from the Freenote server for local editing,
+and upload it when the editor exits. The note can be given by ID, short ID, or
+a unique title prefix. If the note was changed on the server in the meantime,
+the changes are merged line by line; if they conflict, the editor is reopened
+with both versions between conflict markers. If the upload fails, the edited
+file is kept.`,
 	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
 		if len(args) != 1 || len(args[0]) == 0 {
-			return errors.New("You must provide a note ID to edit")
+			return errors.New("You must provide a note to edit")
 		}
 		return nil
 	},
 	Run: func(cmd *cobra.Command, args []string) {
 		tmpDir := filepath.Join(os.TempDir(), "freenote")
-		err := os.MkdirAll(tmpDir, 0600)
+		err := os.MkdirAll(tmpDir, 0700)
 		if err != nil && err != os.ErrExist {
 			fmt.Println("failed to create temp dir ", tmpDir, ":", err)
 			os.Exit(1)
 		}
 
-		tmpFile := filepath.Join(tmpDir, args[0]+".md")
-		f, err := os.OpenFile(tmpFile, os.O_CREATE|os.O_TRUNC, 0600)
-		if err != nil {
-			fmt.Println("failed to open ", tmpFile, ":", err)
-			os.Exit(1)
-		}
-		defer os.Remove(tmpFile)
-
-		note := new(notes.Note)
-		c, err := initClient()
-		if err != nil {
-			fmt.Println("failed to connect: ", err)
-			os.Exit(1)
-		}
-		ownerID := c.User.ID
-		err = c.Get(fmt.Sprintf("/users/%s/notes/%s", ownerID, url.QueryEscape(args[0])), note)
-		if err != nil {
-			fmt.Println("get note failed: ", err)
-			os.Exit(1)
-		}
-		body := note.Body
-		_, err = fmt.Fprint(f, body)
-		if err != nil {
-			fmt.Println("failed to write file: ", err)
-			os.Exit(1)
-		}
-
-		err = f.Close()
-		if err != nil {
+		c, base := mustSelectNote(args[0])
+		tmpFile := filepath.Join(tmpDir, base.ID.String()+".md")
+		if err = ioutil.WriteFile(tmpFile, []byte(base.Body), 0600); err != nil {
 			fmt.Println("failed to write file: ", err)
 			os.Exit(1)
 		}
@@ -81,46 +62,92 @@ freenote edit will download a note from the Freenote server for local editing.`,
 			editor = getEditor()
 			if editor == "" {
 				fmt.Println("no editor set")
+				os.Remove(tmpFile)
 				os.Exit(1)
 			}
 		}
 
-		command := exec.Command(editor, tmpFile) // nolint: gas
-		command.Stderr = os.Stderr
-		command.Stdout = os.Stdout
-		command.Stdin = os.Stdin
-		err = command.Run()
-		if err != nil {
-			fmt.Println("editor returned error editing ", tmpFile, ":", err)
-			os.Exit(1)
-		}
+		ctx := context.Background()
+		body, edit, conflicted := base.Body, true, false
+		for {
+			if edit {
+				command := exec.Command(editor, tmpFile) // nolint: gas
+				command.Stderr = os.Stderr
+				command.Stdout = os.Stdout
+				command.Stdin = os.Stdin
+				err = command.Run()
+				if err != nil {
+					fmt.Println("editor returned error editing ", tmpFile, ":", err)
+					os.Exit(1)
+				}
+				bodyBytes, err := ioutil.ReadFile(tmpFile)
+				if err != nil {
+					fmt.Println("unable to read ", tmpFile, ":", err)
+					os.Exit(1)
+				}
+				body = string(bodyBytes)
+				if conflicted && hasConflictMarkers(body) {
+					fmt.Println("Unresolved conflicts remain, not uploaded. Your changes are saved in ", tmpFile)
+					os.Exit(1)
+				}
+			}
+			if body == base.Body {
+				fmt.Println("No changes.")
+				os.Remove(tmpFile)
+				return
+			}
 
-		bodyBytes, err := ioutil.ReadFile(tmpFile)
-		if err != nil {
-			fmt.Println("unable to read ", uploadFile, ":", err)
-			os.Exit(1)
-		}
-		note.Body = string(bodyBytes)
-		note.HTMLBody = ""
-		note.Modified = time.Now()
+			note := base
+			note.Body = body
+			note.Modified = time.Now()
+			saved, err := c.UpdateNoteIfMatch(ctx, note, base.ETag())
+			if err == nil {
+				os.Remove(tmpFile)
+				fmt.Println("Upload successful.")
+				fmt.Println(noteLine(saved))
+				return
+			}
+			var server notes.Note
+			if err == client.ErrConflict {
+				server, err = c.Note(ctx, base.ID)
+			}
+			if err != nil {
+				fmt.Println("note update failed: ", err)
+				fmt.Println("Your changes are saved in ", tmpFile)
+				os.Exit(1)
+			}
 
-		resPL := new(struct {
-			Links struct {
-				Canonical rest.Link `json:"canonical"`
-			} `json:"_links"`
-		})
-		c.Send("PUT",
-			fmt.Sprintf("/users/%s/notes/%s", ownerID, args[0]),
-			&note, resPL)
-		if err != nil {
-			fmt.Println("note upload failed: ", err)
-			os.Exit(1)
+			merged, clean := notes.Merge(base.Body, body, server.Body)
+			base, body = server, merged
+			if clean {
+				fmt.Println("The note was changed on the server; the changes were merged.")
+				edit = false
+				continue
+			}
+			if err = ioutil.WriteFile(tmpFile, []byte(merged), 0600); err != nil {
+				fmt.Println("failed to write file: ", err)
+				os.Exit(1)
+			}
+			fmt.Println("The note was changed on the server, and the changes conflict with yours.")
+			fmt.Print("Press Enter to resolve the conflicts in the editor.")
+			bufio.NewReader(os.Stdin).ReadString('\n')
+			edit, conflicted = true, true
 		}
-		fmt.Println("Upload successful.")
-		fmt.Println("Note URL: ", resPL.Links.Canonical.Href)
 	},
 }
 
+// hasConflictMarkers reports whether text still has a conflict marker line
+// written by notes.Merge.
+func hasConflictMarkers(text string) bool {
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if line == notes.ConflictLocal || line == notes.ConflictServer {
+			return true
+		}
+	}
+	return false
+}
+
 var possibleEditors = []string{
 	"editor",
 	"sensible-editor",
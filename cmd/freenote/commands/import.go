@@ -0,0 +1,95 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/aprice/freenote/importer"
+)
+
+var (
+	importFormat string
+	importFolder string
+)
+
+func init() {
+	importCmd.Flags().StringVar(&importFormat, "format", "", "import format: enex, simplenote, or markdown (default guess from file extension)")
+	importCmd.Flags().StringVar(&importFolder, "folder", "", "folder for notes that don't specify one (default notebook name for enex)")
+	rootCmd.AddCommand(importCmd)
+}
+
+var importFormatsByExt = map[string]importer.Format{
+	".enex": importer.FormatENEX,
+	".json": importer.FormatSimplenote,
+	".zip":  importer.FormatMarkdown,
+}
+
+var importCmd = &cobra.Command{
+	Use:   "import [file]",
+	Short: "Import notes from another application",
+	Long: `
+freenote import will upload an export from another note application to the
+Freenote server, creating a new note for each note in the export. Supported
+formats are Evernote (.enex), Simplenote (.json), and zip archives of markdown
+files with optional front matter (.zip).`,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 1 || len(args[0]) == 0 {
+			return errors.New("You must provide a file to import")
+		}
+		return nil
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		importFile := args[0]
+		ext := strings.ToLower(filepath.Ext(importFile))
+		format, err := importer.ParseFormat(importFormat, "")
+		if importFormat == "" {
+			format, err = importFormatsByExt[ext], nil
+			if format == "" {
+				err = importer.ErrUnknownFormat
+			}
+		}
+		if err != nil {
+			fmt.Println("unable to import ", importFile, ": ", err)
+			os.Exit(1)
+		}
+		folder := importFolder
+		if folder == "" && format == importer.FormatENEX {
+			folder = strings.TrimSuffix(filepath.Base(importFile), filepath.Ext(importFile))
+		}
+
+		body, err := ioutil.ReadFile(importFile)
+		if err != nil {
+			fmt.Println("unable to read ", importFile, ": ", err)
+			os.Exit(1)
+		}
+
+		c, err := initClient()
+		if err != nil {
+			fmt.Println("failed to connect: ", err)
+			os.Exit(1)
+		}
+		report, err := c.Import(context.Background(), format, folder, body)
+		if err != nil {
+			fmt.Println("import failed: ", err)
+			os.Exit(1)
+		}
+		for _, res := range report.Results {
+			if res.Error != "" {
+				fmt.Printf("FAILED %s: %s\n", res.Source, res.Error)
+			} else {
+				fmt.Printf("ok     %s -> %s\n", res.Source, res.ID)
+			}
+		}
+		fmt.Printf("Imported %d notes, %d failed.\n", report.Imported, report.Failed)
+		if report.Failed > 0 {
+			os.Exit(1)
+		}
+	},
+}
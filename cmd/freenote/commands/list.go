@@ -0,0 +1,108 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/aprice/freenote/client"
+)
+
+var (
+	listFolder string
+	listTag    string
+	listSince  string
+	listStart  int
+	listLength int
+	listSort   string
+	listOrder  string
+	listSearch string
+)
+
+func init() {
+	for _, cmd := range []*cobra.Command{listCmd, searchCmd} {
+		cmd.Flags().StringVar(&listFolder, "folder", "", "only notes in this folder")
+		cmd.Flags().StringVarP(&listTag, "tag", "t", "", "only notes with this tag")
+		cmd.Flags().StringVar(&listSince, "since", "", "only notes modified since this RFC3339 date, or this long ago (e.g. 48h)")
+		cmd.Flags().IntVar(&listStart, "start", 0, "index of the first note to show")
+		cmd.Flags().IntVarP(&listLength, "length", "n", 20, "number of notes to show")
+		cmd.Flags().StringVar(&listSort, "sort", "modified", "sort by modified, created, or title")
+		cmd.Flags().StringVar(&listOrder, "order", "", "sort order, asc or desc (default desc, or asc for title)")
+		rootCmd.AddCommand(cmd)
+	}
+	listCmd.Flags().StringVarP(&listSearch, "search", "s", "", "list the notes matching this saved search")
+}
+
+var listCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List notes",
+	Long: `
+freenote list will list notes on the Freenote server, most recently modified
+first, with the short ID used to select them in other commands. With --search,
+it lists the notes matching a saved search instead, in the search's order unless
+--sort is given.`,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		if listSearch != "" && (listFolder != "" || listTag != "" || listSince != "") {
+			return errors.New("--search can't be combined with --folder, --tag, or --since")
+		}
+		return nil
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		query := listQuery()
+		if listSearch != "" && !cmd.Flags().Changed("sort") {
+			query.Sort = ""
+		}
+		listNotes(query, listSearch)
+	},
+}
+
+var searchCmd = &cobra.Command{
+	Use:   "search [text]",
+	Short: "Search notes",
+	Long: `
+freenote search will list notes on the Freenote server matching a search query.
+Words match notes whose title or body contains them, ignoring case; queries can
+also use "quoted phrases", fields such as tag:work, folder:projects/alpha,
+title:"release notes", created:>2026-01-01, and modified:<7d, OR between terms,
+and - before a term to exclude notes matching it.`,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) == 0 {
+			return errors.New("You must provide text to search for")
+		}
+		return nil
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		query := listQuery()
+		query.Text = strings.Join(args, " ")
+		listNotes(query, "")
+	},
+}
+
+// listQuery builds a note query from the list flags.
+func listQuery() client.NoteQuery {
+	query := client.NoteQuery{
+		Folder:    listFolder,
+		Tag:       listTag,
+		Sort:      listSort,
+		Ascending: listOrder == "asc" || (listOrder == "" && listSort == "title"),
+		Start:     listStart,
+		PageSize:  listLength,
+	}
+	if listSince != "" {
+		since, err := time.Parse(time.RFC3339, listSince)
+		if err != nil {
+			d, derr := time.ParseDuration(listSince)
+			if derr != nil {
+				fmt.Println("invalid --since: ", err)
+				os.Exit(1)
+			}
+			since = time.Now().Add(-d)
+		}
+		query.ModifiedSince = since
+	}
+	return query
+}
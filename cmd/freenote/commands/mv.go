@@ -0,0 +1,48 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	mvFolder string
+	mvTitle  string
+)
+
+func init() {
+	mvCmd.Flags().StringVar(&mvFolder, "folder", "", "new folder (\"/\" for the top level)")
+	mvCmd.Flags().StringVar(&mvTitle, "title", "", "new title")
+	rootCmd.AddCommand(mvCmd)
+}
+
+var mvCmd = &cobra.Command{
+	Use:   "mv [note]",
+	Short: "Move or rename a note",
+	Long: `
+freenote mv will move a note to another folder, rename it, or both. The note can
+be given by ID, short ID, or a unique title prefix.`,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 1 || len(args[0]) == 0 {
+			return errors.New("You must provide a note to move")
+		}
+		if !cmd.Flags().Changed("folder") && mvTitle == "" {
+			return errors.New("You must provide a new --folder or --title")
+		}
+		return nil
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		c, note := mustSelectNote(args[0])
+		if cmd.Flags().Changed("folder") {
+			note.Folder = strings.Trim(mvFolder, "/")
+		}
+		if mvTitle != "" {
+			note.Title = mvTitle
+		}
+		saveNote(c, note)
+		fmt.Println("Moved to", noteLine(note))
+	},
+}
@@ -0,0 +1,124 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aprice/freenote/client"
+	"github.com/aprice/freenote/ids"
+	"github.com/aprice/freenote/notes"
+)
+
+// selectNote finds a note by ID, base64 short ID, or unique title prefix. An
+// exact title match wins over other notes with it as a prefix.
+func selectNote(ctx context.Context, c *client.Client, sel string) (notes.Note, error) {
+	if id, err := ids.ParseID(sel); err == nil {
+		if note, err := c.Note(ctx, id); err != client.ErrNotFound {
+			return note, err
+		}
+	}
+	prefix := strings.ToLower(sel)
+	var matches []notes.Note
+	it := c.Notes(ctx, client.NoteQuery{Sort: "title", Ascending: true, PageSize: 100})
+	for it.Next() {
+		n := it.Note()
+		title := strings.ToLower(n.Title)
+		if title == prefix {
+			matches = []notes.Note{n}
+			break
+		} else if strings.HasPrefix(title, prefix) {
+			matches = append(matches, n)
+		}
+	}
+	if err := it.Err(); err != nil {
+		return notes.Note{}, err
+	}
+	switch len(matches) {
+	case 0:
+		return notes.Note{}, fmt.Errorf("no note matches %q", sel)
+	case 1:
+		return c.Note(ctx, matches[0].ID)
+	default:
+		msg := fmt.Sprintf("%q matches %d notes, use an ID or a longer title:", sel, len(matches))
+		for _, n := range matches {
+			msg += "\n\t" + noteLine(n)
+		}
+		return notes.Note{}, errors.New(msg)
+	}
+}
+
+// mustSelectNote connects and selects a note, exiting on failure.
+func mustSelectNote(sel string) (*client.Client, notes.Note) {
+	c, err := initClient()
+	if err != nil {
+		fmt.Println("failed to connect: ", err)
+		os.Exit(1)
+	}
+	note, err := selectNote(context.Background(), c, sel)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	return c, note
+}
+
+// saveNote updates a note on the server, exiting on failure.
+func saveNote(c *client.Client, note notes.Note) {
+	note.Modified = time.Now()
+	if _, err := c.UpdateNote(context.Background(), note); err != nil {
+		fmt.Println("note update failed: ", err)
+		os.Exit(1)
+	}
+}
+
+// listNotes prints a page of notes matching a query, or the saved search with
+// the given name, and how to get the next.
+func listNotes(query client.NoteQuery, search string) {
+	c, err := initClient()
+	if err != nil {
+		fmt.Println("failed to connect: ", err)
+		os.Exit(1)
+	}
+	ctx := context.Background()
+	var page client.NotePage
+	if search == "" {
+		page, err = c.NotePage(ctx, query)
+	} else {
+		saved, serr := c.SearchByName(ctx, search)
+		if serr == client.ErrNotFound {
+			fmt.Printf("no saved search named %q\n", search)
+			os.Exit(1)
+		} else if serr != nil {
+			fmt.Println("get saved searches failed: ", serr)
+			os.Exit(1)
+		}
+		page, err = c.SearchNotePage(ctx, saved, query)
+	}
+	if err != nil {
+		fmt.Println("get note list failed: ", err)
+		os.Exit(1)
+	}
+	for _, n := range page.Notes {
+		fmt.Println(noteLine(n))
+	}
+	if page.HasMore() {
+		fmt.Printf("More notes available, use --start %d to see them.\n", query.Start+len(page.Notes))
+	}
+}
+
+// noteLine summarizes a note on one line, starting with its short ID.
+func noteLine(n notes.Note) string {
+	name := n.Title
+	if n.Folder != "" {
+		name = n.Folder + "/" + name
+	}
+	line := fmt.Sprintf("%s  %s  %s", ids.ToBase64(n.ID), n.Modified.Local().Format("2006-01-02 15:04"), name)
+	for _, tag := range n.Tags {
+		line += " #" + tag
+	}
+	return line
+}
@@ -0,0 +1,142 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+	"github.com/spf13/cobra"
+
+	"github.com/aprice/freenote/client"
+	"github.com/aprice/freenote/ids"
+	"github.com/aprice/freenote/notes"
+)
+
+var restoreOverwrite bool
+
+func init() {
+	restoreCmd.Flags().BoolVar(&restoreOverwrite, "overwrite", false, "replace notes that already exist, instead of skipping them")
+	rootCmd.AddCommand(restoreCmd)
+}
+
+var restoreCmd = &cobra.Command{
+	Use:   "restore [dir]",
+	Short: "Restore notes from a backup",
+	Long: `
+freenote restore will upload the notes in a directory written by freenote
+backup, keeping their IDs, titles, folders, tags, and times. Notes that already
+exist are skipped unless --overwrite is given. If a note's ID is taken by
+another user's note, it is restored with a new ID. Files without front matter,
+from older backups, are restored with the ID from their file name.`,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 1 || len(args[0]) == 0 {
+			return errors.New("You must provide a backup directory to restore")
+		}
+		return nil
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		dir := filepath.Clean(args[0])
+		var files []string
+		err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if path != dir && strings.HasPrefix(info.Name(), ".") {
+				if info.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if !info.IsDir() && strings.EqualFold(filepath.Ext(path), ".md") {
+				files = append(files, path)
+			}
+			return nil
+		})
+		if err != nil {
+			fmt.Println("unable to read ", dir, ": ", err)
+			os.Exit(1)
+		}
+
+		c, err := initClient()
+		if err != nil {
+			fmt.Println("failed to connect: ", err)
+			os.Exit(1)
+		}
+		ctx := context.Background()
+		counts := map[string]int{}
+		for _, path := range files {
+			outcome, note, err := restoreFile(ctx, c, path)
+			if err != nil {
+				outcome = "FAILED"
+				fmt.Printf("%-8s %s: %s\n", outcome, path, err)
+			} else {
+				fmt.Printf("%-8s %s\n", outcome, noteLine(note))
+			}
+			counts[outcome]++
+		}
+		fmt.Printf("Restored %d notes (%d created, %d replaced, %d with new IDs), %d skipped, %d failed.\n",
+			counts["created"]+counts["replaced"]+counts["new ID"],
+			counts["created"], counts["replaced"], counts["new ID"],
+			counts["skipped"], counts["FAILED"])
+		if counts["FAILED"] > 0 {
+			os.Exit(1)
+		}
+	},
+}
+
+// restoreFile restores one backup file, returning what was done and the note
+// as it now is on the server.
+func restoreFile(ctx context.Context, c *client.Client, path string) (string, notes.Note, error) {
+	body, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", notes.Note{}, err
+	}
+	note, err := notes.ParseMarkdown(body)
+	if err != nil {
+		return "", notes.Note{}, err
+	}
+	if front, _ := notes.SplitFrontMatter(body); front == nil {
+		if id, err := ids.ParseID(strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))); err == nil {
+			note.ID = id
+		}
+	}
+	if err = notes.ValidateFolder(note.Folder); err != nil {
+		return "", notes.Note{}, err
+	}
+	if note.Created.IsZero() {
+		note.Created = time.Now()
+	}
+	if note.Modified.IsZero() {
+		note.Modified = note.Created
+	}
+
+	if note.ID != uuid.Nil {
+		existing, err := c.Note(ctx, note.ID)
+		if err == nil && !restoreOverwrite {
+			return "skipped", existing, nil
+		} else if err != nil && err != client.ErrNotFound {
+			return "", notes.Note{}, err
+		}
+		// PUT creates the note if the ID is unused.
+		saved, perr := c.UpdateNote(ctx, note)
+		if perr == nil && err == nil {
+			return "replaced", saved, nil
+		} else if perr == nil {
+			return "created", saved, nil
+		} else if perr != client.ErrNotFound {
+			return "", notes.Note{}, perr
+		}
+		// The ID belongs to another user's note.
+		note.ID = uuid.Nil
+		saved, err = c.CreateNote(ctx, note)
+		return "new ID", saved, err
+	}
+	saved, err := c.CreateNote(ctx, note)
+	return "created", saved, err
+}
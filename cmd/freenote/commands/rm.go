@@ -0,0 +1,36 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	rootCmd.AddCommand(rmCmd)
+}
+
+var rmCmd = &cobra.Command{
+	Use:   "rm [note]",
+	Short: "Delete a note",
+	Long: `
+freenote rm will delete a note from the Freenote server. The note can be given
+by ID, short ID, or a unique title prefix.`,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 1 || len(args[0]) == 0 {
+			return errors.New("You must provide a note to delete")
+		}
+		return nil
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		c, note := mustSelectNote(args[0])
+		if err := c.DeleteNote(context.Background(), note.ID); err != nil {
+			fmt.Println("note delete failed: ", err)
+			os.Exit(1)
+		}
+		fmt.Println("Deleted", noteLine(note))
+	},
+}
@@ -15,7 +15,8 @@ var rootCmd = &cobra.Command{
 	Short: "Freenote is a CLI tool for interacting with the Freenote server",
 	Long: `
 A simple CLI tool to make working with Freenote from the command line or other
-applications easier. Add a macro to any editor to send your files to Freenote!
+applications easier. Use freenote watch to send your files to Freenote as you
+save them!
 ©2017 Adrian Price. http://github.com/aprice/freenote`,
 	Run: func(cmd *cobra.Command, args []string) {
 		cmd.HelpFunc()(cmd, args)
@@ -0,0 +1,45 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	showHTML bool
+)
+
+func init() {
+	showCmd.Flags().BoolVar(&showHTML, "html", false, "show HTML instead of markdown")
+	rootCmd.AddCommand(showCmd)
+}
+
+var showCmd = &cobra.Command{
+	Use:   "show [note]",
+	Short: "Show a note",
+	Long: `
+freenote show will print a note from the Freenote server as markdown with front
+matter. The note can be given by ID, short ID, or a unique title prefix.`,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 1 || len(args[0]) == 0 {
+			return errors.New("You must provide a note to show")
+		}
+		return nil
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		_, note := mustSelectNote(args[0])
+		if showHTML {
+			fmt.Println(note.HTMLBody)
+			return
+		}
+		content, err := note.MarshalMarkdown()
+		if err != nil {
+			fmt.Println("failed to format note: ", err)
+			os.Exit(1)
+		}
+		fmt.Println(string(content))
+	},
+}
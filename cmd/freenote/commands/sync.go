@@ -0,0 +1,135 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+	"github.com/spf13/cobra"
+
+	"github.com/aprice/freenote/client"
+	"github.com/aprice/freenote/notes"
+	"github.com/aprice/freenote/notesync"
+)
+
+var (
+	syncDryRun bool
+)
+
+func init() {
+	syncCmd.Flags().BoolVarP(&syncDryRun, "dry-run", "n", false, "show what would be done without changing anything")
+	rootCmd.AddCommand(syncCmd)
+}
+
+var syncCmd = &cobra.Command{
+	Use:   "sync [dir]",
+	Short: "Sync notes with a local directory",
+	Long: `
+freenote sync will keep a local directory in two-way sync with the Freenote
+server. Folders are directories, and notes are markdown files with front
+matter. New, changed, renamed, moved, and deleted files and notes are synced in
+both directions. If a note has changed on both sides, the server version is
+kept and the local version is saved as a conflict copy, which becomes a new note
+on the next sync. The last-synced state is kept in ` + notesync.StateFile + `
+in the directory.`,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 1 || len(args[0]) == 0 {
+			return errors.New("You must provide a directory to sync")
+		}
+		return nil
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		root := filepath.Clean(args[0])
+		if err := os.MkdirAll(root, 0700); err != nil {
+			fmt.Println("failed to create ", root, ": ", err)
+			os.Exit(1)
+		}
+		state, err := notesync.LoadState(root)
+		if err != nil {
+			fmt.Println("failed to read sync state: ", err)
+			os.Exit(1)
+		}
+		local, err := notesync.ScanDir(root)
+		if err != nil {
+			fmt.Println("failed to read ", root, ": ", err)
+			os.Exit(1)
+		}
+		c, err := initClient()
+		if err != nil {
+			fmt.Println("failed to connect: ", err)
+			os.Exit(1)
+		}
+		remote := syncRemote{c, context.Background()}
+		list, err := remote.List()
+		if err != nil {
+			fmt.Println("get note list failed: ", err)
+			os.Exit(1)
+		}
+
+		actions := notesync.Plan(state, local, list, time.Now())
+		if syncDryRun {
+			changes := 0
+			for _, a := range actions {
+				if syncVisible(a) {
+					changes++
+					fmt.Println(a)
+				}
+			}
+			fmt.Printf("%d changes planned.\n", changes)
+			return
+		}
+		synced, failed := 0, 0
+		notesync.Apply(root, &state, actions, remote, func(a notesync.Action, err error) {
+			if err != nil {
+				failed++
+				fmt.Printf("FAILED %s: %s\n", a, err)
+			} else if syncVisible(a) {
+				synced++
+				fmt.Println(a)
+			}
+		})
+		if err = state.Save(root); err != nil {
+			fmt.Println("failed to save sync state: ", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Synced %d changes, %d failed.\n", synced, failed)
+		if failed > 0 {
+			os.Exit(1)
+		}
+	},
+}
+
+// syncVisible returns false for actions that only update the sync state.
+func syncVisible(a notesync.Action) bool {
+	return a.Kind != notesync.KindTrack && a.Kind != notesync.KindForget
+}
+
+// syncRemote syncs with the notes of the client's user.
+type syncRemote struct {
+	c   *client.Client
+	ctx context.Context
+}
+
+func (r syncRemote) List() ([]notes.Note, error) {
+	return r.c.Notes(r.ctx, client.NoteQuery{Sort: "created", Ascending: true, PageSize: 100}).All()
+}
+
+func (r syncRemote) Get(id uuid.UUID) (notes.Note, error) {
+	return r.c.Note(r.ctx, id)
+}
+
+func (r syncRemote) Create(note notes.Note) (notes.Note, error) {
+	return r.c.CreateNote(r.ctx, note)
+}
+
+func (r syncRemote) Update(note notes.Note) (notes.Note, error) {
+	return r.c.UpdateNote(r.ctx, note)
+}
+
+func (r syncRemote) Delete(id uuid.UUID) error {
+	return r.c.DeleteNote(r.ctx, id)
+}
@@ -0,0 +1,78 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	tagCmd.AddCommand(tagAddCmd, tagRemoveCmd)
+	rootCmd.AddCommand(tagCmd)
+}
+
+var tagCmd = &cobra.Command{
+	Use:   "tag",
+	Short: "Add or remove note tags",
+	Run: func(cmd *cobra.Command, args []string) {
+		cmd.HelpFunc()(cmd, args)
+	},
+}
+
+var tagAddCmd = &cobra.Command{
+	Use:   "add [note] [tag...]",
+	Short: "Add tags to a note",
+	Long: `
+freenote tag add will add one or more tags to a note. The note can be given by
+ID, short ID, or a unique title prefix.`,
+	PersistentPreRunE: requireTagArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		c, note := mustSelectNote(args[0])
+		for _, tag := range args[1:] {
+			if !hasTag(note.Tags, tag) {
+				note.Tags = append(note.Tags, tag)
+			}
+		}
+		saveNote(c, note)
+		fmt.Println("Tagged", noteLine(note))
+	},
+}
+
+var tagRemoveCmd = &cobra.Command{
+	Use:     "remove [note] [tag...]",
+	Aliases: []string{"rm"},
+	Short:   "Remove tags from a note",
+	Long: `
+freenote tag remove will remove one or more tags from a note. The note can be
+given by ID, short ID, or a unique title prefix.`,
+	PersistentPreRunE: requireTagArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		c, note := mustSelectNote(args[0])
+		tags := note.Tags[:0]
+		for _, tag := range note.Tags {
+			if !hasTag(args[1:], tag) {
+				tags = append(tags, tag)
+			}
+		}
+		note.Tags = tags
+		saveNote(c, note)
+		fmt.Println("Tagged", noteLine(note))
+	},
+}
+
+func requireTagArgs(cmd *cobra.Command, args []string) error {
+	if len(args) < 2 || len(args[0]) == 0 {
+		return errors.New("You must provide a note and at least one tag")
+	}
+	return nil
+}
+
+func hasTag(tags []string, tag string) bool {
+	for _, t := range tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
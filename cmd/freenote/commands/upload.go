@@ -2,6 +2,7 @@ package commands
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -13,7 +14,6 @@ import (
 
 	"github.com/aprice/freenote/ids"
 	"github.com/aprice/freenote/notes"
-	"github.com/aprice/freenote/rest"
 )
 
 var (
@@ -83,35 +83,21 @@ be uploaded as new notes by default.`,
 			Owner:    ownerID,
 			Folder:   folder,
 		}
-		resPL := new(struct {
-			Links struct {
-				Canonical rest.Link `json:"canonical"`
-			} `json:"_links"`
-		})
+		ctx := context.Background()
 		if overWriteID != "" {
-			noteID, err := ids.ParseID(overWriteID)
-			if err != nil {
+			if n.ID, err = ids.ParseID(overWriteID); err != nil {
 				fmt.Println("could not parse ", overWriteID, " as ID: ", err)
 				os.Exit(1)
 			}
-			n.ID = noteID
-			c.Send("PUT",
-				fmt.Sprintf("/users/%s/notes/%s", ownerID, noteID),
-				&n, resPL)
-			if err != nil {
-				fmt.Println("note upload failed: ", err)
-				os.Exit(1)
-			}
+			n, err = c.UpdateNote(ctx, n)
 		} else {
-			c.Send("POST",
-				fmt.Sprintf("/users/%s/notes/", ownerID),
-				&n, resPL)
-			if err != nil {
-				fmt.Println("note upload failed: ", err)
-				os.Exit(1)
-			}
+			n, err = c.CreateNote(ctx, n)
+		}
+		if err != nil {
+			fmt.Println("note upload failed: ", err)
+			os.Exit(1)
 		}
 		fmt.Println("Upload successful.")
-		fmt.Println("Note URL: ", resPL.Links.Canonical.Href)
+		fmt.Println(noteLine(n))
 	},
 }
@@ -0,0 +1,198 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/spf13/cobra"
+
+	"github.com/aprice/freenote/client"
+	"github.com/aprice/freenote/notesync"
+)
+
+const (
+	watchRetryDelay    = 2 * time.Second
+	watchMaxRetryDelay = time.Minute
+)
+
+var watchDelay time.Duration
+
+func init() {
+	watchCmd.Flags().DurationVar(&watchDelay, "delay", time.Second, "how long a file must go unchanged before it's uploaded")
+	rootCmd.AddCommand(watchCmd)
+}
+
+var watchCmd = &cobra.Command{
+	Use:   "watch [dir|file]",
+	Short: "Upload markdown files as they're saved",
+	Long: `
+freenote watch will watch a directory tree, or a single file, and upload
+markdown files to the Freenote server whenever they're saved. A new file
+becomes a new note, titled and foldered by its path; after that, each save
+updates the same note. Files are matched to notes by the ID in their front
+matter, or by the ` + notesync.StateFile + ` file kept in the directory, which is
+shared with freenote sync. Uploads that fail due to network errors are retried.
+A note that has changed on the server since it was last uploaded or synced is
+not overwritten; use freenote sync to resolve it.`,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 1 || len(args[0]) == 0 {
+			return errors.New("You must provide a directory or file to watch")
+		}
+		return nil
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		target := filepath.Clean(args[0])
+		info, err := os.Stat(target)
+		if err != nil {
+			fmt.Println("unable to watch ", target, ": ", err)
+			os.Exit(1)
+		}
+		root, only := target, ""
+		if !info.IsDir() {
+			root, only = filepath.Dir(target), filepath.Base(target)
+			if !watchable(only) {
+				fmt.Println("unable to watch ", target, ": not a markdown file")
+				os.Exit(1)
+			}
+		}
+		state, err := notesync.LoadState(root)
+		if err != nil {
+			fmt.Println("failed to read sync state: ", err)
+			os.Exit(1)
+		}
+		c, err := initClient()
+		if err != nil {
+			fmt.Println("failed to connect: ", err)
+			os.Exit(1)
+		}
+		remote := syncRemote{c, context.Background()}
+
+		w, err := fsnotify.NewWatcher()
+		if err != nil {
+			fmt.Println("unable to watch ", target, ": ", err)
+			os.Exit(1)
+		}
+		defer w.Close()
+		if only != "" {
+			err = w.Add(root)
+		} else {
+			err = watchDirs(w, root)
+		}
+		if err != nil {
+			fmt.Println("unable to watch ", target, ": ", err)
+			os.Exit(1)
+		}
+		log.Printf("Watching %s for changes.", target)
+
+		// Each change to a file bumps its generation and schedules an upload
+		// after the delay; uploads scheduled before the latest change are
+		// dropped, so a burst of saves results in a single upload.
+		type upload struct {
+			name string
+			gen  int
+		}
+		due := make(chan upload)
+		gens := make(map[string]int)
+		retries := make(map[string]time.Duration)
+		schedule := func(name string, delay time.Duration) {
+			u := upload{name, gens[name]}
+			time.AfterFunc(delay, func() { due <- u })
+		}
+		for {
+			select {
+			case ev, ok := <-w.Events:
+				if !ok {
+					return
+				}
+				rel, err := filepath.Rel(root, ev.Name)
+				if err != nil {
+					continue
+				}
+				rel = filepath.ToSlash(rel)
+				if ev.Op&fsnotify.Create != 0 && only == "" && !hidden(rel) {
+					if info, err := os.Stat(ev.Name); err == nil && info.IsDir() {
+						if err = watchDirs(w, ev.Name); err != nil {
+							log.Printf("Unable to watch %s: %s", rel, err)
+						}
+						continue
+					}
+				}
+				if ev.Op&(fsnotify.Write|fsnotify.Create) == 0 || !watchable(rel) || (only != "" && rel != only) {
+					continue
+				}
+				gens[rel]++
+				delete(retries, rel)
+				schedule(rel, watchDelay)
+			case err, ok := <-w.Errors:
+				if !ok {
+					return
+				}
+				log.Println("Watch error: ", err)
+			case u := <-due:
+				if u.gen != gens[u.name] {
+					continue
+				}
+				note, uploaded, err := notesync.Push(root, &state, u.name, remote)
+				switch {
+				case err == nil && uploaded:
+					delete(retries, u.name)
+					log.Printf("Uploaded %s to %s", u.name, c.NoteURL(note.ID))
+					if err = state.Save(root); err != nil {
+						log.Println("Failed to save sync state: ", err)
+					}
+				case err == nil, os.IsNotExist(err):
+				case client.Temporary(err):
+					delay := retries[u.name] * 2
+					if delay == 0 {
+						delay = watchRetryDelay
+					} else if delay > watchMaxRetryDelay {
+						delay = watchMaxRetryDelay
+					}
+					retries[u.name] = delay
+					log.Printf("Upload of %s failed, retrying in %s: %s", u.name, delay, err)
+					schedule(u.name, delay)
+				default:
+					log.Printf("Upload of %s failed: %s", u.name, err)
+				}
+			}
+		}
+	},
+}
+
+// watchDirs adds a directory and every non-hidden directory under it.
+func watchDirs(w *fsnotify.Watcher, dir string) error {
+	return filepath.Walk(dir, func(name string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			return nil
+		}
+		if name != dir && strings.HasPrefix(info.Name(), ".") {
+			return filepath.SkipDir
+		}
+		return w.Add(name)
+	})
+}
+
+// watchable reports whether a slash-separated relative path is a markdown
+// file that isn't hidden or in a hidden directory.
+func watchable(rel string) bool {
+	return strings.EqualFold(filepath.Ext(rel), ".md") && !hidden(rel)
+}
+
+func hidden(rel string) bool {
+	for _, part := range strings.Split(rel, "/") {
+		if strings.HasPrefix(part, ".") {
+			return true
+		}
+	}
+	return false
+}
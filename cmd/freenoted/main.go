@@ -9,6 +9,7 @@ import (
 	flag "github.com/spf13/pflag"
 
 	"github.com/aprice/freenote/config"
+	"github.com/aprice/freenote/reminders"
 	"github.com/aprice/freenote/server"
 	"github.com/aprice/freenote/stats"
 	"github.com/aprice/freenote/users"
@@ -32,6 +33,7 @@ func main() {
 	if err != nil {
 		log.Println(err)
 	}
+	users.InitPasswordCost(conf)
 
 	if conf.RecoveryMode {
 		var pw string
@@ -47,10 +49,13 @@ func main() {
 		log.Fatal(err)
 	}
 	restServer.Start()
+	scheduler := reminders.NewScheduler(conf)
+	scheduler.Start()
 
 	stop := make(chan os.Signal, 1)
 	signal.Notify(stop, os.Interrupt)
 	<-stop
 
+	scheduler.Stop()
 	restServer.Stop()
 }
@@ -16,12 +16,26 @@ type Config struct {
 	CommonPasswordList string
 	CanonicalHTTPS     bool
 
+	// Argon2id password hashing cost: passes, memory in KiB, and threads.
+	// Existing passwords are rehashed on login when these change.
+	PasswordTime    uint32
+	PasswordMemory  uint32
+	PasswordThreads uint8
+
 	LetsEncryptHosts []string
 	CertFile         string
 	KeyFile          string
 
 	MailServer ConnectionInfo
 
+	OIDC OIDCConfig
+
+	// TrustedProxies lists the addresses or CIDR ranges of reverse proxies
+	// trusted to set X-Forwarded-Proto, X-Forwarded-For, and proxy
+	// authentication headers.
+	TrustedProxies []string
+	ProxyAuth      ProxyAuthConfig
+
 	Elastic  ConnectionInfo
 	Mongo    ConnectionInfo
 	Postgres ConnectionInfo
@@ -39,6 +53,43 @@ type ConnectionInfo struct {
 	Namespace string
 }
 
+// OIDCConfig configures login through an external OpenID Connect provider.
+// Login is enabled if Issuer is set.
+type OIDCConfig struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	Scopes       []string
+	// UsernameClaim is the claim used as the username for new users, with the
+	// domain removed from email addresses, and to link existing users if
+	// LinkByUsername is set: by its full value as a username, or if it's an
+	// email address, only if the provider has verified it (email_verified)
+	// and it's the verified email address of exactly one user. Defaults to
+	// preferred_username.
+	UsernameClaim  string
+	LinkByUsername bool
+	// Provision creates users on first login if no matching user exists.
+	Provision bool
+	// GroupsClaim is the claim listing the user's groups, and GroupAccess maps
+	// group names to access levels (guest, user, or admin). If any groups are
+	// mapped, only members of a mapped group can log in, and their access level
+	// is set to the highest of their groups on each login.
+	GroupsClaim string
+	GroupAccess map[string]string
+}
+
+// ProxyAuthConfig configures authentication by a trusted reverse proxy, which
+// passes the authenticated username in a header. It is enabled if Header is
+// set, and only honored for requests from TrustedProxies.
+type ProxyAuthConfig struct {
+	// Header holds the username, e.g. Remote-User or X-Forwarded-User.
+	Header string
+	// NameHeader optionally holds the display name for new users.
+	NameHeader string
+	// Provision creates users on first login if no matching user exists.
+	Provision bool
+}
+
 // NilConnection is an empty ConnectionInfo (zero value).
 var NilConnection = ConnectionInfo{}
 
@@ -0,0 +1,110 @@
+// Package dav serves a user's notes over WebDAV, as a tree of markdown files
+// with front matter. Folders are collections, and notes are Title.md files.
+package dav
+
+import (
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	uuid "github.com/satori/go.uuid"
+	"golang.org/x/net/webdav"
+
+	"github.com/aprice/freenote/store"
+)
+
+// Handler serves WebDAV requests for users' notes. Locks, and folders created
+// before any notes are saved in them, are kept in memory and shared between
+// requests, so a single Handler should be used for the life of the server.
+type Handler struct {
+	mu    sync.Mutex
+	locks map[uuid.UUID]webdav.LockSystem
+	dirs  map[uuid.UUID]map[string]bool
+}
+
+// NewHandler creates a new WebDAV Handler.
+func NewHandler() *Handler {
+	return &Handler{
+		locks: make(map[uuid.UUID]webdav.LockSystem),
+		dirs:  make(map[uuid.UUID]map[string]bool),
+	}
+}
+
+// Serve handles a WebDAV request for the notes owned by owner, with the
+// collection root at prefix. The caller is responsible for authentication and
+// authorization.
+func (h *Handler) Serve(w http.ResponseWriter, r *http.Request, ns store.NoteStore, owner uuid.UUID, prefix string) {
+	fs := &fileSystem{h: h, ns: ns, owner: owner}
+	if !checkIfMatch(w, r, fs, prefix) {
+		return
+	}
+	dh := &webdav.Handler{
+		Prefix:     prefix,
+		FileSystem: fs,
+		LockSystem: h.lockSystem(owner),
+	}
+	dh.ServeHTTP(w, r)
+}
+
+// lockSystem returns the lock system for a user. Lock names are paths within
+// the user's tree, so each user needs their own.
+func (h *Handler) lockSystem(owner uuid.UUID) webdav.LockSystem {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	ls, ok := h.locks[owner]
+	if !ok {
+		ls = webdav.NewMemLS()
+		h.locks[owner] = ls
+	}
+	return ls
+}
+
+// emptyDirs calls f with the set of folders a user has created that may not
+// contain any notes yet.
+func (h *Handler) emptyDirs(owner uuid.UUID, f func(dirs map[string]bool)) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	dirs, ok := h.dirs[owner]
+	if !ok {
+		dirs = make(map[string]bool)
+		h.dirs[owner] = dirs
+	}
+	f(dirs)
+}
+
+// checkIfMatch enforces If-Match on requests that modify a note, which the
+// webdav package leaves to the file system. It returns false if the request
+// failed the precondition and a response was sent.
+func checkIfMatch(w http.ResponseWriter, r *http.Request, fs *fileSystem, prefix string) bool {
+	im := r.Header.Get("If-Match")
+	if im == "" {
+		return true
+	}
+	switch r.Method {
+	case http.MethodPut, http.MethodDelete, "MOVE", "PROPPATCH":
+	default:
+		return true
+	}
+	name := strings.TrimPrefix(r.URL.Path, prefix)
+	fi, err := fs.Stat(r.Context(), name)
+	if err == nil && strings.TrimSpace(im) == "*" {
+		return true
+	}
+	if err == nil {
+		if et, ok := fi.(webdav.ETager); ok {
+			if etag, err := et.ETag(r.Context()); err == nil {
+				for _, candidate := range strings.Split(im, ",") {
+					if strings.TrimSpace(candidate) == etag {
+						return true
+					}
+				}
+			}
+		}
+	} else if !os.IsNotExist(err) {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return false
+	}
+	http.Error(w, http.StatusText(http.StatusPreconditionFailed), http.StatusPreconditionFailed)
+	return false
+}
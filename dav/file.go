@@ -0,0 +1,147 @@
+package dav
+
+import (
+	"context"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"golang.org/x/net/webdav"
+
+	"github.com/aprice/freenote/notes"
+)
+
+// file is an open folder or note. Notes opened for writing buffer their
+// content, and are parsed and saved when closed.
+type file struct {
+	info     *fileInfo
+	children []os.FileInfo
+	pos      int
+	content  *strings.Reader
+
+	fs   *fileSystem
+	note *notes.Note
+	buf  *strings.Builder
+}
+
+func (f *file) Close() error {
+	if f.buf == nil {
+		return nil
+	}
+	in := []byte(f.buf.String())
+	f.buf = nil
+	parsed, err := notes.ParseMarkdown(in)
+	if err != nil {
+		return err
+	}
+	// The file path determines the title and folder, so that saving a file
+	// doesn't move it. Front matter can still set tags and properties.
+	f.note.Body = parsed.Body
+	if front, _ := notes.SplitFrontMatter(in); front != nil {
+		f.note.Tags = parsed.Tags
+		f.note.Properties = parsed.Properties
+	}
+	return f.fs.save(f.note)
+}
+
+func (f *file) Read(p []byte) (int, error) {
+	if f.content == nil {
+		return 0, os.ErrInvalid
+	}
+	return f.content.Read(p)
+}
+
+func (f *file) Seek(offset int64, whence int) (int64, error) {
+	if f.content == nil {
+		return 0, os.ErrInvalid
+	}
+	return f.content.Seek(offset, whence)
+}
+
+func (f *file) Write(p []byte) (int, error) {
+	if f.buf == nil {
+		return 0, os.ErrPermission
+	}
+	return f.buf.Write(p)
+}
+
+func (f *file) Readdir(count int) ([]os.FileInfo, error) {
+	if !f.info.dir {
+		return nil, os.ErrInvalid
+	}
+	rest := f.children[f.pos:]
+	if count <= 0 {
+		f.pos = len(f.children)
+		return rest, nil
+	}
+	if len(rest) == 0 {
+		return nil, io.EOF
+	}
+	if count > len(rest) {
+		count = len(rest)
+	}
+	f.pos += count
+	return rest[:count], nil
+}
+
+func (f *file) Stat() (os.FileInfo, error) {
+	return f.info, nil
+}
+
+// fileInfo describes a folder or note. Notes provide their own ETag, so that
+// it only changes when the note is modified.
+type fileInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+	dir     bool
+	etag    string
+}
+
+func dirInfo(name string, modTime time.Time) *fileInfo {
+	return &fileInfo{name: path.Base("/" + name), modTime: modTime, dir: true}
+}
+
+func noteInfo(name string, note *notes.Note) *fileInfo {
+	var size int64
+	if content, err := note.MarshalMarkdown(); err == nil {
+		size = int64(len(content))
+	}
+	return &fileInfo{
+		name:    path.Base(name),
+		size:    size,
+		modTime: note.Modified,
+		etag:    note.ETag(),
+	}
+}
+
+func (fi *fileInfo) Name() string       { return fi.name }
+func (fi *fileInfo) Size() int64        { return fi.size }
+func (fi *fileInfo) ModTime() time.Time { return fi.modTime }
+func (fi *fileInfo) IsDir() bool        { return fi.dir }
+func (fi *fileInfo) Sys() interface{}   { return nil }
+
+func (fi *fileInfo) Mode() os.FileMode {
+	if fi.dir {
+		return os.ModeDir | 0755
+	}
+	return 0644
+}
+
+// ETag implements webdav.ETager.
+func (fi *fileInfo) ETag(ctx context.Context) (string, error) {
+	if fi.dir {
+		return "", webdav.ErrNotImplemented
+	}
+	return fi.etag, nil
+}
+
+// ContentType implements webdav.ContentTyper.
+func (fi *fileInfo) ContentType(ctx context.Context) (string, error) {
+	if fi.dir {
+		return "", webdav.ErrNotImplemented
+	}
+	return "text/markdown; charset=utf-8", nil
+}
@@ -0,0 +1,328 @@
+package dav
+
+import (
+	"context"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+	"golang.org/x/net/webdav"
+
+	"github.com/aprice/freenote/notes"
+	"github.com/aprice/freenote/page"
+	"github.com/aprice/freenote/store"
+)
+
+const noteExt = ".md"
+
+// fileSystem presents one user's notes as a webdav.FileSystem. It is created
+// per request, and caches the user's notes until something is changed.
+type fileSystem struct {
+	h     *Handler
+	ns    store.NoteStore
+	owner uuid.UUID
+	tree  *tree
+}
+
+// tree maps paths to folders and notes. Paths are slash-separated without
+// leading or trailing slashes; the root is "".
+type tree struct {
+	dirs  map[string]time.Time
+	files map[string]*notes.Note
+}
+
+// splitName splits a note path into its folder and title.
+func splitName(name string) (folder, title string) {
+	folder, base := path.Split(name)
+	return strings.TrimSuffix(folder, "/"), strings.TrimSuffix(base, noteExt)
+}
+
+func clean(name string) string {
+	return strings.Trim(path.Clean("/"+name), "/")
+}
+
+func parent(name string) string {
+	dir := path.Dir(name)
+	if dir == "." || dir == "/" {
+		return ""
+	}
+	return dir
+}
+
+func within(name, dir string) bool {
+	return name == dir || dir == "" || strings.HasPrefix(name, dir+"/")
+}
+
+func (fs *fileSystem) load() (*tree, error) {
+	if fs.tree != nil {
+		return fs.tree, nil
+	}
+	list, _, err := fs.ns.QueryNotes(store.NoteQuery{Owner: fs.owner, Page: page.All("created")})
+	if err != nil && err != store.ErrNotFound {
+		return nil, err
+	}
+	// Names are assigned oldest first, so existing files keep their names
+	// when a newer note has the same title.
+	sort.SliceStable(list, func(i, j int) bool {
+		if list[i].Created.Equal(list[j].Created) {
+			return list[i].ID.String() < list[j].ID.String()
+		}
+		return list[i].Created.Before(list[j].Created)
+	})
+	t := &tree{
+		dirs:  map[string]time.Time{"": {}},
+		files: make(map[string]*notes.Note, len(list)),
+	}
+	for i := range list {
+		note := &list[i]
+		folder := clean(note.Folder)
+		for dir := folder; ; dir = parent(dir) {
+			if note.Modified.After(t.dirs[dir]) {
+				t.dirs[dir] = note.Modified
+			} else if _, ok := t.dirs[dir]; !ok {
+				t.dirs[dir] = time.Time{}
+			}
+			if dir == "" {
+				break
+			}
+		}
+		base := notes.FileName(note.Title)
+		name := path.Join(folder, base+noteExt)
+		if _, ok := t.files[name]; ok {
+			name = path.Join(folder, base+" ("+note.ID.String()[:8]+")"+noteExt)
+		}
+		t.files[name] = note
+	}
+	fs.h.emptyDirs(fs.owner, func(dirs map[string]bool) {
+		for dir := range dirs {
+			for d := dir; d != ""; d = parent(d) {
+				if _, ok := t.dirs[d]; !ok {
+					t.dirs[d] = time.Time{}
+				}
+			}
+		}
+	})
+	fs.tree = t
+	return t, nil
+}
+
+func (fs *fileSystem) save(note *notes.Note) error {
+	fs.tree = nil
+	note.HTMLBody = ""
+	return fs.ns.SaveNote(note)
+}
+
+func (fs *fileSystem) delete(id uuid.UUID) error {
+	fs.tree = nil
+	return fs.ns.DeleteNote(id)
+}
+
+// Mkdir creates an empty folder, which exists only in memory until a note is
+// saved in it.
+func (fs *fileSystem) Mkdir(ctx context.Context, name string, perm os.FileMode) error {
+	name = clean(name)
+	t, err := fs.load()
+	if err != nil {
+		return err
+	}
+	if _, ok := t.dirs[name]; ok {
+		return os.ErrExist
+	}
+	if _, ok := t.files[name]; ok {
+		return os.ErrExist
+	}
+	if _, ok := t.dirs[parent(name)]; !ok {
+		return os.ErrNotExist
+	}
+	if notes.ValidateFolder(name) != nil {
+		return os.ErrPermission
+	}
+	fs.h.emptyDirs(fs.owner, func(dirs map[string]bool) {
+		dirs[name] = true
+	})
+	fs.tree = nil
+	return nil
+}
+
+// OpenFile opens a folder or note. Notes opened for writing are saved when
+// closed.
+func (fs *fileSystem) OpenFile(ctx context.Context, name string, flag int, perm os.FileMode) (webdav.File, error) {
+	name = clean(name)
+	t, err := fs.load()
+	if err != nil {
+		return nil, err
+	}
+	if modTime, ok := t.dirs[name]; ok {
+		if flag&(os.O_WRONLY|os.O_RDWR) != 0 {
+			return nil, os.ErrPermission
+		}
+		return &file{info: dirInfo(name, modTime), children: fs.children(t, name)}, nil
+	}
+	note, exists := t.files[name]
+	write := flag&(os.O_WRONLY|os.O_RDWR) != 0
+	if !exists {
+		if !write || flag&os.O_CREATE == 0 {
+			return nil, os.ErrNotExist
+		}
+		folder, title := splitName(name)
+		if !strings.HasSuffix(name, noteExt) || notes.ValidateFolder(folder) != nil {
+			return nil, os.ErrPermission
+		}
+		if _, ok := t.dirs[folder]; !ok {
+			return nil, os.ErrNotExist
+		}
+		note = &notes.Note{
+			ID:      uuid.NewV4(),
+			Owner:   fs.owner,
+			Folder:  folder,
+			Title:   title,
+			Created: time.Now(),
+		}
+	} else if write && flag&os.O_EXCL != 0 {
+		return nil, os.ErrExist
+	}
+	if !write {
+		content, err := note.MarshalMarkdown()
+		if err != nil {
+			return nil, err
+		}
+		return &file{info: noteInfo(name, note), content: strings.NewReader(string(content))}, nil
+	}
+	// Set the modification time now, and give the file's info the ETag the
+	// note will have once it's saved.
+	note.Modified = time.Now()
+	saved := *note
+	saved.Version++
+	f := &file{fs: fs, note: note, buf: new(strings.Builder)}
+	if flag&os.O_TRUNC == 0 && exists {
+		content, err := note.MarshalMarkdown()
+		if err != nil {
+			return nil, err
+		}
+		f.buf.Write(content)
+	}
+	f.info = noteInfo(name, &saved)
+	return f, nil
+}
+
+// children lists the immediate contents of a folder.
+func (fs *fileSystem) children(t *tree, dir string) []os.FileInfo {
+	var out []os.FileInfo
+	for d, modTime := range t.dirs {
+		if d != "" && parent(d) == dir {
+			out = append(out, dirInfo(d, modTime))
+		}
+	}
+	for name, note := range t.files {
+		if parent(name) == dir {
+			out = append(out, noteInfo(name, note))
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name() < out[j].Name() })
+	return out
+}
+
+// RemoveAll deletes a note, or a folder and every note in it.
+func (fs *fileSystem) RemoveAll(ctx context.Context, name string) error {
+	name = clean(name)
+	if name == "" {
+		return os.ErrPermission
+	}
+	t, err := fs.load()
+	if err != nil {
+		return err
+	}
+	if note, ok := t.files[name]; ok {
+		return fs.delete(note.ID)
+	}
+	if _, ok := t.dirs[name]; !ok {
+		return os.ErrNotExist
+	}
+	for fname, note := range t.files {
+		if within(fname, name) {
+			if err = fs.delete(note.ID); err != nil {
+				return err
+			}
+		}
+	}
+	fs.h.emptyDirs(fs.owner, func(dirs map[string]bool) {
+		for dir := range dirs {
+			if within(dir, name) {
+				delete(dirs, dir)
+			}
+		}
+	})
+	fs.tree = nil
+	return nil
+}
+
+// Rename renames or moves a note, changing its title and folder, or moves a
+// folder and every note in it.
+func (fs *fileSystem) Rename(ctx context.Context, oldName, newName string) error {
+	oldName, newName = clean(oldName), clean(newName)
+	if oldName == "" || newName == "" {
+		return os.ErrPermission
+	}
+	t, err := fs.load()
+	if err != nil {
+		return err
+	}
+	if _, ok := t.dirs[parent(newName)]; !ok {
+		return os.ErrNotExist
+	}
+	if note, ok := t.files[oldName]; ok {
+		folder, title := splitName(newName)
+		if !strings.HasSuffix(newName, noteExt) || notes.ValidateFolder(folder) != nil {
+			return os.ErrPermission
+		}
+		if path.Base(oldName) != path.Base(newName) {
+			note.Title = title
+		}
+		note.Folder = folder
+		note.Modified = time.Now()
+		return fs.save(note)
+	}
+	if _, ok := t.dirs[oldName]; !ok {
+		return os.ErrNotExist
+	}
+	if within(newName, oldName) || notes.ValidateFolder(newName) != nil {
+		return os.ErrPermission
+	}
+	for fname, note := range t.files {
+		if within(fname, oldName) {
+			note.Folder = newName + strings.TrimPrefix(clean(note.Folder), oldName)
+			if err = fs.save(note); err != nil {
+				return err
+			}
+		}
+	}
+	fs.h.emptyDirs(fs.owner, func(dirs map[string]bool) {
+		for dir := range dirs {
+			if within(dir, oldName) {
+				delete(dirs, dir)
+				dirs[newName+strings.TrimPrefix(dir, oldName)] = true
+			}
+		}
+	})
+	fs.tree = nil
+	return nil
+}
+
+// Stat returns information about a folder or note.
+func (fs *fileSystem) Stat(ctx context.Context, name string) (os.FileInfo, error) {
+	name = clean(name)
+	t, err := fs.load()
+	if err != nil {
+		return nil, err
+	}
+	if modTime, ok := t.dirs[name]; ok {
+		return dirInfo(name, modTime), nil
+	}
+	if note, ok := t.files[name]; ok {
+		return noteInfo(name, note), nil
+	}
+	return nil, os.ErrNotExist
+}
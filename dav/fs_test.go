@@ -0,0 +1,21 @@
+package dav
+
+import "testing"
+
+func TestPaths(t *testing.T) {
+	if actual := clean("/a/b/../c/"); actual != "a/c" {
+		t.Errorf("clean: got %q", actual)
+	}
+	if actual := parent("a/b/c.md"); actual != "a/b" {
+		t.Errorf("parent: got %q", actual)
+	}
+	if actual := parent("c.md"); actual != "" {
+		t.Errorf("parent of root file: got %q", actual)
+	}
+	if folder, title := splitName("a/b/Title.md"); folder != "a/b" || title != "Title" {
+		t.Errorf("splitName: got %q, %q", folder, title)
+	}
+	if !within("a/b/c.md", "a") || within("ab/c.md", "a") || !within("a", "a") {
+		t.Error("within: wrong result")
+	}
+}
@@ -0,0 +1,91 @@
+package importer
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/aprice/freenote/notes"
+)
+
+const enexTimeFormat = "20060102T150405Z"
+
+type enexNote struct {
+	Title   string   `xml:"title"`
+	Content string   `xml:"content"`
+	Created string   `xml:"created"`
+	Updated string   `xml:"updated"`
+	Tags    []string `xml:"tag"`
+}
+
+var (
+	enNoteOpen  = regexp.MustCompile(`(?s)^.*?<en-note[^>]*>`)
+	enNoteClose = regexp.MustCompile(`(?s)</en-note>\s*$`)
+	enTodoDone  = regexp.MustCompile(`<en-todo[^>]*checked="true"[^>]*/?>(</en-todo>)?`)
+	enTodo      = regexp.MustCompile(`<en-todo[^>]*/?>(</en-todo>)?`)
+	enMedia     = regexp.MustCompile(`(?s)<en-(media|crypt)[^>]*(/>|>.*?</en-(media|crypt)>)`)
+)
+
+// ReadENEX reads notes from an Evernote .enex export. Note bodies are returned
+// as HTML. ENEX files don't record the notebook, so notes have no Folder.
+func ReadENEX(r io.Reader) ([]Item, error) {
+	var items []Item
+	dec := xml.NewDecoder(r)
+	dec.Strict = false
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return items, err
+		}
+		start, ok := tok.(xml.StartElement)
+		if !ok || start.Name.Local != "note" {
+			continue
+		}
+		en := enexNote{}
+		if err = dec.DecodeElement(&en, &start); err != nil {
+			return items, err
+		}
+		items = append(items, enexItem(len(items), en))
+	}
+	return items, nil
+}
+
+func enexItem(idx int, en enexNote) Item {
+	item := Item{Source: fmt.Sprintf("note %d", idx+1)}
+	if title := strings.TrimSpace(en.Title); title != "" {
+		item.Source = title
+	}
+	note := notes.Note{
+		Title:    strings.TrimSpace(en.Title),
+		Tags:     en.Tags,
+		HTMLBody: enexContent(en.Content),
+	}
+	var err error
+	if en.Created != "" {
+		if note.Created, err = time.Parse(enexTimeFormat, en.Created); err != nil {
+			item.Err = err
+		}
+	}
+	if en.Updated != "" {
+		if note.Modified, err = time.Parse(enexTimeFormat, en.Updated); err != nil {
+			item.Err = err
+		}
+	}
+	item.Note = note
+	return item
+}
+
+// enexContent extracts the HTML body from ENML note content.
+func enexContent(enml string) string {
+	body := enNoteOpen.ReplaceAllString(enml, "")
+	body = enNoteClose.ReplaceAllString(body, "")
+	body = enTodoDone.ReplaceAllString(body, "[x] ")
+	body = enTodo.ReplaceAllString(body, "[ ] ")
+	body = enMedia.ReplaceAllString(body, "")
+	return strings.TrimSpace(body)
+}
@@ -0,0 +1,137 @@
+package importer
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+
+	"github.com/aprice/freenote/notes"
+)
+
+// Format identifies a supported import file format.
+type Format string
+
+const (
+	// FormatENEX is an Evernote notebook export.
+	FormatENEX Format = "enex"
+	// FormatSimplenote is a Simplenote JSON export.
+	FormatSimplenote Format = "simplenote"
+	// FormatMarkdown is a zip archive of markdown files with front matter.
+	FormatMarkdown Format = "markdown"
+)
+
+// ErrUnknownFormat indicates an import was requested in an unsupported format.
+var ErrUnknownFormat = errors.New("unknown import format")
+
+// Item is a single note read from an import source, or the error encountered
+// reading it. Notes with an HTMLBody and no Body must be converted to markdown
+// before saving.
+type Item struct {
+	Source string
+	Note   notes.Note
+	Err    error
+}
+
+// Result is the outcome of importing a single Item.
+type Result struct {
+	Source string    `json:"source" xml:"source,attr"`
+	ID     uuid.UUID `json:"id,omitempty" xml:"id,attr,omitempty"`
+	Title  string    `json:"title,omitempty" xml:"Title,omitempty"`
+	Error  string    `json:"error,omitempty" xml:"Error,omitempty"`
+}
+
+// Report summarizes the outcome of an import.
+type Report struct {
+	Imported int      `json:"imported"`
+	Failed   int      `json:"failed"`
+	Results  []Result `json:"results" xml:"Results>Result"`
+	XMLName  struct{} `json:"-" xml:"Import"`
+}
+
+// Add the outcome of importing an item to this Report.
+func (r *Report) Add(item Item, err error) {
+	res := Result{Source: item.Source, Title: item.Note.Title}
+	if err == nil {
+		err = item.Err
+	}
+	if err != nil {
+		res.Error = err.Error()
+		r.Failed++
+	} else {
+		res.ID = item.Note.ID
+		r.Imported++
+	}
+	r.Results = append(r.Results, res)
+}
+
+// ParseFormat returns the Format with the given name, or the Format implied by
+// the given content type if the name is empty.
+func ParseFormat(name, ctype string) (Format, error) {
+	switch Format(strings.ToLower(name)) {
+	case FormatENEX:
+		return FormatENEX, nil
+	case FormatSimplenote:
+		return FormatSimplenote, nil
+	case FormatMarkdown:
+		return FormatMarkdown, nil
+	case "":
+	default:
+		return "", ErrUnknownFormat
+	}
+	switch ctype {
+	case "application/enex+xml", "application/xml", "text/xml":
+		return FormatENEX, nil
+	case "application/json":
+		return FormatSimplenote, nil
+	case "application/zip", "application/x-zip-compressed":
+		return FormatMarkdown, nil
+	default:
+		return "", ErrUnknownFormat
+	}
+}
+
+// Read all the notes from the given import source. An error is returned only
+// if the source as a whole is unreadable; errors reading individual notes are
+// reported on each Item.
+func Read(format Format, r io.Reader) ([]Item, error) {
+	switch format {
+	case FormatENEX:
+		return ReadENEX(r)
+	case FormatSimplenote:
+		return ReadSimplenote(r)
+	case FormatMarkdown:
+		return ReadMarkdownZip(r)
+	default:
+		return nil, ErrUnknownFormat
+	}
+}
+
+// Prepare fills in the fields of an imported note that aren't set by the
+// source, so it's ready to be saved for the given owner.
+func Prepare(note *notes.Note, owner uuid.UUID, folder string) {
+	note.ID = uuid.NewV4()
+	note.Owner = owner
+	note.Version = 0
+	if note.Folder == "" {
+		note.Folder = folder
+	}
+	now := time.Now()
+	if note.Modified.IsZero() {
+		note.Modified = now
+	}
+	if note.Created.IsZero() {
+		note.Created = note.Modified
+	}
+}
+
+// titleFromBody guesses a note title from the first line of a markdown body.
+func titleFromBody(body string) string {
+	line := strings.TrimSpace(body)
+	if idx := strings.IndexByte(line, '\n'); idx >= 0 {
+		line = line[:idx]
+	}
+	return strings.TrimSpace(strings.TrimLeft(line, "#"))
+}
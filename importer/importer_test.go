@@ -0,0 +1,148 @@
+package importer
+
+import (
+	"archive/zip"
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testENEX = `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE en-export SYSTEM "http://xml.evernote.com/pub/evernote-export3.dtd">
+<en-export export-date="20170801T120000Z" application="Evernote" version="Evernote Mac 6.11">
+<note><title>Shopping</title><content><![CDATA[<?xml version="1.0" encoding="UTF-8" standalone="no"?>
+<!DOCTYPE en-note SYSTEM "http://xml.evernote.com/pub/enml2.dtd">
+<en-note><div><en-todo checked="true"/>Milk</div><div><en-todo/>Eggs</div><en-media hash="abc" type="image/png"/></en-note>]]></content>
+<created>20170730T205204Z</created><updated>20170731T101500Z</updated><tag>errands</tag><tag>home</tag></note>
+<note><title>Bad Date</title><content><![CDATA[<en-note>x</en-note>]]></content><created>yesterday</created></note>
+</en-export>`
+
+func TestReadENEX(t *testing.T) {
+	items, err := ReadENEX(strings.NewReader(testENEX))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 2 {
+		t.Fatalf("got %d items, expected 2", len(items))
+	}
+	n := items[0].Note
+	if items[0].Err != nil {
+		t.Errorf("unexpected error: %v", items[0].Err)
+	}
+	if n.Title != "Shopping" {
+		t.Errorf("Title=%q, expected %q", n.Title, "Shopping")
+	}
+	if expected := "<div>[x] Milk</div><div>[ ] Eggs</div>"; n.HTMLBody != expected {
+		t.Errorf("HTMLBody=%q, expected %q", n.HTMLBody, expected)
+	}
+	if expected := time.Date(2017, 7, 30, 20, 52, 4, 0, time.UTC); !n.Created.Equal(expected) {
+		t.Errorf("Created=%s, expected %s", n.Created, expected)
+	}
+	if len(n.Tags) != 2 || n.Tags[1] != "home" {
+		t.Errorf("Tags=%v, expected [errands home]", n.Tags)
+	}
+	if items[1].Err == nil {
+		t.Error("expected error for invalid created date")
+	}
+}
+
+const testSimplenote = `{
+	"activeNotes": [{
+		"id": "abc123",
+		"content": "# Groceries\r\n\r\n- milk\n- eggs",
+		"creationDate": "2017-04-16T14:52:09.409Z",
+		"lastModified": "2017-04-17T08:00:00.000Z",
+		"tags": ["errands"]
+	}],
+	"trashedNotes": [{"id": "def456", "content": "Old"}]
+}`
+
+func TestReadSimplenote(t *testing.T) {
+	items, err := ReadSimplenote(strings.NewReader(testSimplenote))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 1 {
+		t.Fatalf("got %d items, expected 1", len(items))
+	}
+	n := items[0].Note
+	if n.Title != "Groceries" {
+		t.Errorf("Title=%q, expected %q", n.Title, "Groceries")
+	}
+	if expected := "- milk\n- eggs"; n.Body != expected {
+		t.Errorf("Body=%q, expected %q", n.Body, expected)
+	}
+	if n.Modified.Day() != 17 || len(n.Tags) != 1 {
+		t.Errorf("metadata not preserved: %#v", n)
+	}
+}
+
+func TestReadMarkdownZip(t *testing.T) {
+	buf := new(bytes.Buffer)
+	zw := zip.NewWriter(buf)
+	files := []struct{ name, body string }{
+		{"work/plan.md", "# The Plan\n\nStep one."},
+		{"work/meta.md", "---\ntitle: Meta\nfolder: elsewhere\ntags: [a, b]\ncreated: 2017-01-02T03:04:05Z\n---\n\nBody"},
+		{"inbox.markdown", "no heading"},
+		{"image.png", "not a note"},
+		{"__MACOSX/work/._plan.md", "resource fork"},
+	}
+	for _, f := range files {
+		w, err := zw.Create(f.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(f.body))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	items, err := ReadMarkdownZip(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 3 {
+		t.Fatalf("got %d items, expected 3", len(items))
+	}
+	cases := []struct {
+		title, folder string
+	}{
+		{"The Plan", "work"},
+		{"Meta", "elsewhere"},
+		{"inbox", ""},
+	}
+	for i, tc := range cases {
+		if items[i].Err != nil {
+			t.Errorf("%s: unexpected error %v", items[i].Source, items[i].Err)
+		}
+		if items[i].Note.Title != tc.title || items[i].Note.Folder != tc.folder {
+			t.Errorf("%s: got title %q folder %q, expected %q %q", items[i].Source,
+				items[i].Note.Title, items[i].Note.Folder, tc.title, tc.folder)
+		}
+	}
+	if items[1].Note.Created.Year() != 2017 || len(items[1].Note.Tags) != 2 {
+		t.Errorf("front matter not applied: %#v", items[1].Note)
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	cases := []struct {
+		name, ctype string
+		format      Format
+		wantErr     bool
+	}{
+		{"ENEX", "", FormatENEX, false},
+		{"", "application/zip", FormatMarkdown, false},
+		{"", "application/json", FormatSimplenote, false},
+		{"", "text/plain", "", true},
+		{"onenote", "application/json", "", true},
+	}
+	for _, tc := range cases {
+		format, err := ParseFormat(tc.name, tc.ctype)
+		if format != tc.format || (err != nil) != tc.wantErr {
+			t.Errorf("ParseFormat(%q, %q)=%q, %v", tc.name, tc.ctype, format, err)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package importer
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"path"
+	"strings"
+
+	"github.com/aprice/freenote/notes"
+)
+
+var markdownExts = map[string]bool{
+	".md":       true,
+	".markdown": true,
+	".mdown":    true,
+	".txt":      true,
+}
+
+// ReadMarkdownZip reads notes from a zip archive of markdown files. Front
+// matter, if present, supplies note metadata; otherwise the folder is taken
+// from the file's directory in the archive, the title from the first heading
+// or file name, and the modified date from the archive entry.
+func ReadMarkdownZip(r io.Reader) ([]Item, error) {
+	raw, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	zr, err := zip.NewReader(bytes.NewReader(raw), int64(len(raw)))
+	if err != nil {
+		return nil, err
+	}
+	var items []Item
+	for _, f := range zr.File {
+		if f.FileInfo().IsDir() || !isMarkdownFile(f.Name) {
+			continue
+		}
+		items = append(items, markdownItem(f))
+	}
+	return items, nil
+}
+
+func isMarkdownFile(name string) bool {
+	for _, part := range strings.Split(name, "/") {
+		if strings.HasPrefix(part, ".") || part == "__MACOSX" {
+			return false
+		}
+	}
+	return markdownExts[strings.ToLower(path.Ext(name))]
+}
+
+func markdownItem(f *zip.File) Item {
+	item := Item{Source: f.Name}
+	rc, err := f.Open()
+	if err != nil {
+		item.Err = err
+		return item
+	}
+	defer rc.Close()
+	raw, err := ioutil.ReadAll(rc)
+	if err != nil {
+		item.Err = err
+		return item
+	}
+	note, err := notes.ParseMarkdown(raw)
+	if err != nil {
+		item.Err = err
+		return item
+	}
+	if note.Folder == "" {
+		if dir := path.Dir(f.Name); dir != "." {
+			note.Folder = dir
+		}
+	}
+	if note.Title == "" {
+		if strings.HasPrefix(note.Body, "#") {
+			note.Title = titleFromBody(note.Body)
+		} else {
+			base := path.Base(f.Name)
+			note.Title = strings.TrimSuffix(base, path.Ext(base))
+		}
+	}
+	if note.Modified.IsZero() {
+		note.Modified = f.Modified
+	}
+	item.Note = note
+	return item
+}
@@ -0,0 +1,68 @@
+package importer
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/aprice/freenote/notes"
+)
+
+type simplenoteExport struct {
+	ActiveNotes []simplenoteNote `json:"activeNotes"`
+}
+
+type simplenoteNote struct {
+	ID           string   `json:"id"`
+	Content      string   `json:"content"`
+	CreationDate string   `json:"creationDate"`
+	LastModified string   `json:"lastModified"`
+	Tags         []string `json:"tags"`
+}
+
+// ReadSimplenote reads notes from a Simplenote JSON export. Trashed notes are
+// not imported. Simplenote has no notebooks, so notes have no Folder.
+func ReadSimplenote(r io.Reader) ([]Item, error) {
+	export := simplenoteExport{}
+	if err := json.NewDecoder(r).Decode(&export); err != nil {
+		return nil, err
+	}
+	items := make([]Item, 0, len(export.ActiveNotes))
+	for i, sn := range export.ActiveNotes {
+		items = append(items, simplenoteItem(i, sn))
+	}
+	return items, nil
+}
+
+func simplenoteItem(idx int, sn simplenoteNote) Item {
+	item := Item{Source: sn.ID}
+	if item.Source == "" {
+		item.Source = fmt.Sprintf("note %d", idx+1)
+	}
+	// Simplenote uses the first line of the content as the title.
+	content := strings.TrimLeft(sn.Content, "\r\n")
+	title, body := content, ""
+	if idx := strings.IndexByte(content, '\n'); idx >= 0 {
+		title, body = content[:idx], strings.TrimLeft(content[idx+1:], "\r\n")
+	}
+	note := notes.Note{
+		Title: strings.TrimSpace(strings.TrimLeft(title, "#")),
+		Tags:  sn.Tags,
+		Body:  body,
+	}
+	var err error
+	if sn.CreationDate != "" {
+		if note.Created, err = time.Parse(time.RFC3339, sn.CreationDate); err != nil {
+			item.Err = err
+		}
+	}
+	if sn.LastModified != "" {
+		if note.Modified, err = time.Parse(time.RFC3339, sn.LastModified); err != nil {
+			item.Err = err
+		}
+	}
+	item.Note = note
+	return item
+}
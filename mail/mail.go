@@ -0,0 +1,68 @@
+// Package mail sends plain text email through the configured mail server.
+package mail
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+
+	"github.com/aprice/freenote/config"
+)
+
+// ErrNotConfigured indicates there's no mail server to send through.
+var ErrNotConfigured = errors.New("no mail server configured")
+
+// Sender sends email through a mail server. The server's Namespace is used as
+// the sender address, falling back to its User.
+type Sender struct {
+	Server config.ConnectionInfo
+	// SendMail sends a message; it's smtp.SendMail unless replaced, as in
+	// tests.
+	SendMail func(addr string, a smtp.Auth, from string, to []string, msg []byte) error
+}
+
+// NewSender creates a sender for the given mail server.
+func NewSender(server config.ConnectionInfo) *Sender {
+	return &Sender{Server: server, SendMail: smtp.SendMail}
+}
+
+// Configured reports whether there's a mail server to send through.
+func (s *Sender) Configured() bool {
+	return s.Server.Host != ""
+}
+
+// Send sends a plain text message to a single address.
+func (s *Sender) Send(to, subject, body string) error {
+	if !s.Configured() {
+		return ErrNotConfigured
+	}
+	from := s.Server.Namespace
+	if from == "" {
+		from = s.Server.User
+	}
+	var auth smtp.Auth
+	if s.Server.User != "" {
+		host, _, err := net.SplitHostPort(s.Server.Host)
+		if err != nil {
+			return err
+		}
+		auth = smtp.PlainAuth("", s.Server.User, s.Server.Password, host)
+	}
+	msg := new(bytes.Buffer)
+	fmt.Fprintf(msg, "From: %s\r\n", from)
+	fmt.Fprintf(msg, "To: %s\r\n", headerValue(to))
+	fmt.Fprintf(msg, "Subject: %s\r\n", headerValue(subject))
+	fmt.Fprintf(msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	msg.WriteString(strings.Replace(strings.Replace(body, "\r\n", "\n", -1), "\n", "\r\n", -1))
+	return s.SendMail(s.Server.Host, auth, from, []string{to}, msg.Bytes())
+}
+
+// headerValue keeps user-provided text from adding mail headers.
+func headerValue(s string) string {
+	return strings.NewReplacer("\r", " ", "\n", " ").Replace(s)
+}
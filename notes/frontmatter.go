@@ -0,0 +1,126 @@
+package notes
+
+import (
+	"bytes"
+	"strings"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+	yaml "gopkg.in/yaml.v2"
+)
+
+var frontMatterDelim = []byte("---")
+
+// FrontMatter is the YAML metadata block at the head of a markdown note file.
+type FrontMatter struct {
+	ID         string              `yaml:"id,omitempty"`
+	Title      string              `yaml:"title,omitempty"`
+	Folder     string              `yaml:"folder,omitempty"`
+	Tags       []string            `yaml:"tags,omitempty"`
+	Created    time.Time           `yaml:"created,omitempty"`
+	Modified   time.Time           `yaml:"modified,omitempty"`
+	Properties map[string]Property `yaml:"properties,omitempty"`
+}
+
+// SplitFrontMatter separates a markdown document into its front matter and
+// body. If the document has no front matter, front will be nil.
+func SplitFrontMatter(in []byte) (front, body []byte) {
+	if !bytes.HasPrefix(in, frontMatterDelim) {
+		return nil, in
+	}
+	rest := in[len(frontMatterDelim):]
+	if len(rest) > 0 && rest[0] == '\r' {
+		rest = rest[1:]
+	}
+	if len(rest) == 0 || rest[0] != '\n' {
+		return nil, in
+	}
+	rest = rest[1:]
+	for offset := 0; offset < len(rest); {
+		end := bytes.IndexByte(rest[offset:], '\n')
+		var line []byte
+		if end < 0 {
+			line = rest[offset:]
+			end = len(rest)
+		} else {
+			line = rest[offset : offset+end]
+			end = offset + end + 1
+		}
+		if bytes.Equal(bytes.TrimRight(line, "\r"), frontMatterDelim) {
+			return rest[:offset], bytes.TrimLeft(rest[end:], "\r\n")
+		}
+		offset = end
+	}
+	return nil, in
+}
+
+// ParseMarkdown reads a markdown document with optional front matter into a
+// Note. Only the fields present in the front matter are set.
+func ParseMarkdown(in []byte) (Note, error) {
+	front, body := SplitFrontMatter(in)
+	note := Note{Body: string(body)}
+	if front == nil {
+		return note, nil
+	}
+	fm := FrontMatter{}
+	if err := yaml.Unmarshal(front, &fm); err != nil {
+		return note, err
+	}
+	if fm.ID != "" {
+		id, err := uuid.FromString(fm.ID)
+		if err != nil {
+			return note, err
+		}
+		note.ID = id
+	}
+	note.Title = fm.Title
+	note.Folder = fm.Folder
+	note.Tags = fm.Tags
+	note.Created = fm.Created
+	note.Modified = fm.Modified
+	note.Properties = fm.Properties
+	return note, ValidateProperties(note.Properties)
+}
+
+// MarshalMarkdown renders the note as a markdown document with front matter.
+func (n Note) MarshalMarkdown() ([]byte, error) {
+	fm := FrontMatter{
+		Title:      n.Title,
+		Folder:     n.Folder,
+		Tags:       n.Tags,
+		Created:    n.Created,
+		Modified:   n.Modified,
+		Properties: n.Properties,
+	}
+	if n.ID != uuid.Nil {
+		fm.ID = n.ID.String()
+	}
+	front, err := yaml.Marshal(fm)
+	if err != nil {
+		return nil, err
+	}
+	buf := new(bytes.Buffer)
+	buf.Write(frontMatterDelim)
+	buf.WriteByte('\n')
+	buf.Write(front)
+	buf.Write(frontMatterDelim)
+	buf.WriteString("\n\n")
+	buf.WriteString(n.Body)
+	return buf.Bytes(), nil
+}
+
+// FileName returns a file name, without extension, for a note with the given
+// title. Path separators are replaced, and empty or hidden names are prefixed.
+func FileName(title string) string {
+	name := strings.Map(func(r rune) rune {
+		switch r {
+		case '/', '\\':
+			return '-'
+		}
+		return r
+	}, strings.TrimSpace(title))
+	if name == "" || strings.HasPrefix(name, ".") {
+		name = "Untitled" + name
+	}
+	return name
+}
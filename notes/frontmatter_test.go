@@ -0,0 +1,71 @@
+package notes
+
+import (
+	"testing"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+func TestSplitFrontMatter(t *testing.T) {
+	cases := []struct {
+		in, front, body string
+		hasFront        bool
+	}{
+		{"no front matter", "", "no front matter", false},
+		{"---\ntitle: x\n---\nbody", "title: x\n", "body", true},
+		{"---\r\ntitle: x\r\n---\r\n\r\nbody", "title: x\r\n", "body", true},
+		{"---\nunterminated", "", "---\nunterminated", false},
+		{"---\n---\n", "", "", true},
+		{"----\nrule", "", "----\nrule", false},
+	}
+	for _, tc := range cases {
+		front, body := SplitFrontMatter([]byte(tc.in))
+		if (front != nil) != tc.hasFront || string(front) != tc.front || string(body) != tc.body {
+			t.Errorf("SplitFrontMatter(%q)=%q, %q; expected %q, %q", tc.in, front, body, tc.front, tc.body)
+		}
+	}
+}
+
+func TestMarkdownRoundTrip(t *testing.T) {
+	note := Note{
+		ID:       uuid.NewV4(),
+		Title:    "Round Trip",
+		Folder:   "a/b",
+		Tags:     []string{"one", "two"},
+		Created:  time.Date(2017, 1, 2, 3, 4, 5, 0, time.UTC),
+		Modified: time.Date(2017, 6, 7, 8, 9, 10, 0, time.UTC),
+		Body:     "# Heading\n\n---\n\ntext",
+	}
+	raw, err := note.MarshalMarkdown()
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := ParseMarkdown(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.ID != note.ID || parsed.Title != note.Title || parsed.Folder != note.Folder ||
+		parsed.Body != note.Body || !parsed.Created.Equal(note.Created) ||
+		!parsed.Modified.Equal(note.Modified) || len(parsed.Tags) != 2 {
+		t.Errorf("round trip mismatch:\n\tgot %#v\n\texpected %#v", parsed, note)
+	}
+}
+
+func TestFileName(t *testing.T) {
+	cases := []struct {
+		title, expected string
+	}{
+		{"Shopping List", "Shopping List"},
+		{"  padded  ", "padded"},
+		{"either/or", "either-or"},
+		{`back\slash`, "back-slash"},
+		{"", "Untitled"},
+		{".hidden", "Untitled.hidden"},
+	}
+	for _, tc := range cases {
+		if actual := FileName(tc.title); actual != tc.expected {
+			t.Errorf("FileName(%q): got %q, expected %q", tc.title, actual, tc.expected)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package notes
+
+import "strings"
+
+// Conflict markers written by Merge around the two versions of a conflicting
+// change.
+const (
+	ConflictLocal  = "<<<<<<< local"
+	ConflictSep    = "======="
+	ConflictServer = ">>>>>>> server"
+)
+
+// Merge does a line-based three-way merge of a local and a server version of a
+// note body, both derived from base. Changes to different lines are combined;
+// where both versions changed the same lines differently, both are kept between
+// conflict markers, and clean is false.
+func Merge(base, local, server string) (merged string, clean bool) {
+	o, a, b := splitLines(base), splitLines(local), splitLines(server)
+	ma, mb := matchLines(o, a), matchLines(o, b)
+	var out []string
+	clean = true
+	i, ai, bi := 0, 0, 0
+	for {
+		// Lines unchanged in both versions.
+		k := 0
+		for i+k < len(o) && ma[i+k] == ai+k && mb[i+k] == bi+k {
+			k++
+		}
+		if k > 0 {
+			out = append(out, o[i:i+k]...)
+			i, ai, bi = i+k, ai+k, bi+k
+			continue
+		}
+		// A changed chunk runs to the next base line kept in both versions.
+		j, aj, bj := len(o), len(a), len(b)
+		for n := i; n < len(o); n++ {
+			if ma[n] >= 0 && mb[n] >= 0 {
+				j, aj, bj = n, ma[n], mb[n]
+				break
+			}
+		}
+		oc, ac, bc := o[i:j], a[ai:aj], b[bi:bj]
+		switch {
+		case equalLines(ac, oc):
+			out = append(out, bc...)
+		case equalLines(bc, oc), equalLines(ac, bc):
+			out = append(out, ac...)
+		default:
+			clean = false
+			out = append(out, ConflictLocal+"\n")
+			out = append(out, terminate(ac)...)
+			out = append(out, ConflictSep+"\n")
+			out = append(out, terminate(bc)...)
+			out = append(out, ConflictServer+"\n")
+		}
+		i, ai, bi = j, aj, bj
+		if i == len(o) && ai == len(a) && bi == len(b) {
+			break
+		}
+	}
+	return strings.Join(out, ""), clean
+}
+
+// splitLines splits text into lines, keeping their line endings.
+func splitLines(s string) []string {
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// matchLines returns, for each line of o, the index of the same line in a in
+// their longest common subsequence, or -1.
+func matchLines(o, a []string) []int {
+	// lcs[i][j] is the length of the LCS of o[i:] and a[j:].
+	lcs := make([][]int, len(o)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(a)+1)
+	}
+	for i := len(o) - 1; i >= 0; i-- {
+		for j := len(a) - 1; j >= 0; j-- {
+			if o[i] == a[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	match := make([]int, len(o))
+	i, j := 0, 0
+	for i < len(o) {
+		switch {
+		case j < len(a) && o[i] == a[j]:
+			match[i] = j
+			i++
+			j++
+		case j < len(a) && lcs[i][j+1] > lcs[i+1][j]:
+			j++
+		default:
+			match[i] = -1
+			i++
+		}
+	}
+	return match
+}
+
+func equalLines(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// terminate makes sure the last of a chunk of lines ends with a newline, so a
+// conflict marker can follow it.
+func terminate(lines []string) []string {
+	if n := len(lines); n > 0 && !strings.HasSuffix(lines[n-1], "\n") {
+		lines = append(lines[:n-1:n-1], lines[n-1]+"\n")
+	}
+	return lines
+}
@@ -0,0 +1,33 @@
+package notes
+
+import "testing"
+
+func TestMerge(t *testing.T) {
+	base := "one\ntwo\nthree\nfour\nfive\n"
+	cases := []struct {
+		name, local, server, merged string
+		clean                       bool
+	}{
+		{"unchanged", base, base, base, true},
+		{"local only", "one\n2\nthree\nfour\nfive\n", base, "one\n2\nthree\nfour\nfive\n", true},
+		{"server only", base, "one\ntwo\nthree\nfour\n", "one\ntwo\nthree\nfour\n", true},
+		{"separate lines", "zero\none\n2\nthree\nfour\nfive\n", "one\ntwo\nthree\n4\nfive\nsix\n",
+			"zero\none\n2\nthree\n4\nfive\nsix\n", true},
+		{"same change", "one\n2\nthree\nfour\nfive\n", "one\n2\nthree\nfour\nfive\n", "one\n2\nthree\nfour\nfive\n", true},
+		{"conflict", "one\nlocal\nthree\nfour\nfive", "one\nserver\nthree\nfour\n5\n",
+			"one\n<<<<<<< local\nlocal\n=======\nserver\n>>>>>>> server\nthree\nfour\n<<<<<<< local\nfive\n=======\n5\n>>>>>>> server\n", false},
+		{"delete and change", "one\nthree\nfour\nfive\n", "one\nTWO\nthree\nfour\nfive\n",
+			"one\n<<<<<<< local\n=======\nTWO\n>>>>>>> server\nthree\nfour\nfive\n", false},
+		{"empty base", "local\n", "server\n", "<<<<<<< local\nlocal\n=======\nserver\n>>>>>>> server\n", false},
+	}
+	for _, tc := range cases {
+		b := base
+		if tc.name == "empty base" {
+			b = ""
+		}
+		merged, clean := Merge(b, tc.local, tc.server)
+		if merged != tc.merged || clean != tc.clean {
+			t.Errorf("%s: merged %t:\n%s\nexpected %t:\n%s", tc.name, clean, merged, tc.clean, tc.merged)
+		}
+	}
+}
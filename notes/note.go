@@ -1,6 +1,9 @@
 package notes
 
 import (
+	"errors"
+	"strconv"
+	"strings"
 	"time"
 
 	uuid "github.com/satori/go.uuid"
@@ -15,6 +18,48 @@ type Note struct {
 	Created  time.Time `json:"created" xml:"Meta>Created"`
 	Modified time.Time `json:"modified" xml:"Meta>Modified" storm:"index"`
 	Tags     []string  `json:"tags" xml:"Meta>Tags>Tag,omitempty" storm:"index"`
-	Body     string    `json:"body"`
-	HTMLBody string    `json:"html" xml:"html"`
+	Pinned   bool      `json:"pinned,omitempty" xml:"Meta>Pinned,omitempty"`
+	Favorite bool      `json:"favorite,omitempty" xml:"Meta>Favorite,omitempty"`
+	// Position is the note's place in its folder's manual order, from 1.
+	// Notes that haven't been ordered are 0, and come first.
+	Position int `json:"position,omitempty" xml:"Meta>Position,omitempty"`
+	// Version counts the note's saves. It's set by the data store, so that it
+	// changes with every save, whatever the note's Modified time.
+	Version  int    `json:"version" xml:"Meta>Version"`
+	Body     string `json:"body"`
+	HTMLBody string `json:"html" xml:"html"`
+	// Properties are custom typed values, keyed by name.
+	Properties map[string]Property `json:"properties" xml:"-"`
+	// Reminders are stored with the note, and fired by the server.
+	Reminders []Reminder `json:"reminders" xml:"Meta>Reminders>Reminder,omitempty"`
+}
+
+// ETag returns an entity tag identifying this version of the note.
+func (n Note) ETag() string {
+	return `"` + n.ID.String() + "-" + strconv.Itoa(n.Version) + `"`
+}
+
+// ErrFolderUUID indicates a folder path whose root is a UUID, which would be
+// ambiguous with note IDs in routes.
+var ErrFolderUUID = errors.New("root folder cannot be UUID")
+
+// ErrFolderRelative indicates a folder path with a . or .. part, which would
+// point outside the folder in file systems notes are synced to.
+var ErrFolderRelative = errors.New("folder path cannot contain . or .. parts")
+
+// ValidateFolder checks that a folder path is allowed.
+func ValidateFolder(folder string) error {
+	if folder == "" {
+		return nil
+	}
+	parts := strings.Split(folder, "/")
+	if _, err := uuid.FromString(parts[0]); err == nil {
+		return ErrFolderUUID
+	}
+	for _, part := range parts {
+		if part == "." || part == ".." {
+			return ErrFolderRelative
+		}
+	}
+	return nil
 }
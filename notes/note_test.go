@@ -0,0 +1,20 @@
+package notes
+
+import "testing"
+
+func TestValidateFolder(t *testing.T) {
+	tests := map[string]error{
+		"":                                     nil,
+		"work/projects":                        nil,
+		"work/..hidden":                        nil,
+		"8c7e0a4c-3b40-4f4c-9bd5-1e7a49b0e0a1": ErrFolderUUID,
+		"../escape":                            ErrFolderRelative,
+		"work/../../escape":                    ErrFolderRelative,
+		"work/./projects":                      ErrFolderRelative,
+	}
+	for folder, expected := range tests {
+		if err := ValidateFolder(folder); err != expected {
+			t.Errorf("ValidateFolder(%q) returned %v, expected %v", folder, err, expected)
+		}
+	}
+}
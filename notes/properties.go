@@ -0,0 +1,247 @@
+package notes
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PropertyType is the type of a note property's value.
+type PropertyType string
+
+// Property types.
+const (
+	PropertyString PropertyType = "string"
+	PropertyNumber PropertyType = "number"
+	PropertyDate   PropertyType = "date"
+	PropertyBool   PropertyType = "bool"
+)
+
+// ErrPropertyName indicates a property name with characters other than
+// letters, digits, underscores, and hyphens.
+var ErrPropertyName = errors.New("property names may only contain letters, digits, _, and -")
+
+// PropertyNamePattern matches valid property names.
+var PropertyNamePattern = regexp.MustCompile(`^[\p{L}\p{N}_-]+$`)
+
+// Property is a typed custom value on a note. In JSON and front matter it's a
+// plain string, number, or boolean; strings that are dates, like 2006-01-02,
+// or RFC3339 timestamps, are dates.
+type Property struct {
+	Type PropertyType `bson:"type"`
+	// Value is a string, float64, time.Time, or bool, according to Type.
+	Value interface{} `bson:"value"`
+}
+
+// PropertyOf makes a property of a plain value.
+func PropertyOf(v interface{}) (Property, error) {
+	switch v := v.(type) {
+	case string:
+		if t, ok := parseDate(v); ok {
+			return Property{PropertyDate, t}, nil
+		}
+		return Property{PropertyString, v}, nil
+	case float64:
+		return Property{PropertyNumber, v}, nil
+	case int:
+		return Property{PropertyNumber, float64(v)}, nil
+	case int64:
+		return Property{PropertyNumber, float64(v)}, nil
+	case uint64:
+		return Property{PropertyNumber, float64(v)}, nil
+	case bool:
+		return Property{PropertyBool, v}, nil
+	case time.Time:
+		return Property{PropertyDate, v.UTC()}, nil
+	}
+	return Property{}, fmt.Errorf("unsupported property value %v", v)
+}
+
+// ParseProperty parses text as a property of the given type.
+func ParseProperty(typ PropertyType, s string) (Property, bool) {
+	switch typ {
+	case PropertyString:
+		return Property{typ, s}, true
+	case PropertyNumber:
+		if f, err := strconv.ParseFloat(s, 64); err == nil {
+			return Property{typ, f}, true
+		}
+	case PropertyDate:
+		if t, ok := parseDate(s); ok {
+			return Property{typ, t}, true
+		}
+	case PropertyBool:
+		if s == "true" || s == "false" {
+			return Property{typ, s == "true"}, true
+		}
+	}
+	return Property{}, false
+}
+
+func parseDate(s string) (time.Time, bool) {
+	if t, err := time.Parse(DueFormat, s); err == nil {
+		return t, true
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t.UTC(), true
+	}
+	return time.Time{}, false
+}
+
+// Plain returns the property's plain value: dates are formatted as strings.
+func (p Property) Plain() interface{} {
+	if t, ok := p.Value.(time.Time); ok {
+		if t.Equal(t.Truncate(24 * time.Hour)) {
+			return t.Format(DueFormat)
+		}
+		return t.Format(time.RFC3339)
+	}
+	return p.Value
+}
+
+// Compare compares two properties of the same type, returning -1, 0, or 1. ok
+// is false if their types differ.
+func (p Property) Compare(o Property) (c int, ok bool) {
+	if p.Type != o.Type {
+		return 0, false
+	}
+	switch a := p.Value.(type) {
+	case string:
+		return strings.Compare(a, o.Value.(string)), true
+	case float64:
+		b := o.Value.(float64)
+		if a < b {
+			return -1, true
+		} else if a > b {
+			return 1, true
+		}
+		return 0, true
+	case time.Time:
+		b := o.Value.(time.Time)
+		if a.Before(b) {
+			return -1, true
+		} else if a.After(b) {
+			return 1, true
+		}
+		return 0, true
+	case bool:
+		b := o.Value.(bool)
+		if a == b {
+			return 0, true
+		} else if b {
+			return -1, true
+		}
+		return 1, true
+	}
+	return 0, false
+}
+
+// MarshalJSON fulfills json.Marshaler.
+func (p Property) MarshalJSON() ([]byte, error) {
+	return json.Marshal(p.Plain())
+}
+
+// UnmarshalJSON fulfills json.Unmarshaler.
+func (p *Property) UnmarshalJSON(b []byte) error {
+	var v interface{}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	prop, err := PropertyOf(v)
+	if err != nil {
+		return err
+	}
+	*p = prop
+	return nil
+}
+
+// MarshalYAML fulfills yaml.Marshaler.
+func (p Property) MarshalYAML() (interface{}, error) {
+	return p.Plain(), nil
+}
+
+// UnmarshalYAML fulfills yaml.Unmarshaler.
+func (p *Property) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var v interface{}
+	if err := unmarshal(&v); err != nil {
+		return err
+	}
+	prop, err := PropertyOf(v)
+	if err != nil {
+		return err
+	}
+	*p = prop
+	return nil
+}
+
+// ValidateProperties checks that property names are allowed.
+func ValidateProperties(props map[string]Property) error {
+	for name := range props {
+		if !PropertyNamePattern.MatchString(name) {
+			return ErrPropertyName
+		}
+	}
+	return nil
+}
+
+// Property filter operators.
+const (
+	OpEqual        = "="
+	OpNotEqual     = "!="
+	OpLess         = "<"
+	OpLessEqual    = "<="
+	OpGreater      = ">"
+	OpGreaterEqual = ">="
+)
+
+// PropertyFilter matches notes by a property, such as priority >= 2.
+type PropertyFilter struct {
+	Name  string
+	Op    string
+	Value string
+}
+
+// Candidates returns the filter's value as a property of each type it can be
+// parsed as. A property only matches a value of its own type.
+func (f PropertyFilter) Candidates() []Property {
+	var props []Property
+	for _, typ := range []PropertyType{PropertyString, PropertyNumber, PropertyDate, PropertyBool} {
+		if prop, ok := ParseProperty(typ, f.Value); ok {
+			props = append(props, prop)
+		}
+	}
+	return props
+}
+
+// Matches reports whether a note's properties match the filter. Notes without
+// the property only match OpNotEqual.
+func (f PropertyFilter) Matches(props map[string]Property) bool {
+	prop, ok := props[f.Name]
+	if !ok {
+		return f.Op == OpNotEqual
+	}
+	want, ok := ParseProperty(prop.Type, f.Value)
+	if !ok {
+		return f.Op == OpNotEqual
+	}
+	c, _ := prop.Compare(want)
+	switch f.Op {
+	case OpEqual:
+		return c == 0
+	case OpNotEqual:
+		return c != 0
+	case OpLess:
+		return c < 0
+	case OpLessEqual:
+		return c <= 0
+	case OpGreater:
+		return c > 0
+	case OpGreaterEqual:
+		return c >= 0
+	}
+	return false
+}
@@ -0,0 +1,89 @@
+package notes
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPropertyJSON(t *testing.T) {
+	raw := `{"status":"open","priority":2,"due":"2026-11-01","sent":"2026-11-01T09:30:00Z","billable":true}`
+	props := map[string]Property{}
+	if err := json.Unmarshal([]byte(raw), &props); err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]Property{
+		"status":   {PropertyString, "open"},
+		"priority": {PropertyNumber, 2.0},
+		"due":      {PropertyDate, time.Date(2026, 11, 1, 0, 0, 0, 0, time.UTC)},
+		"sent":     {PropertyDate, time.Date(2026, 11, 1, 9, 30, 0, 0, time.UTC)},
+		"billable": {PropertyBool, true},
+	}
+	for name, e := range expected {
+		if c, ok := props[name].Compare(e); !ok || c != 0 {
+			t.Errorf("%s is %+v, expected %+v", name, props[name], e)
+		}
+	}
+	out, err := json.Marshal(props)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != `{"billable":true,"due":"2026-11-01","priority":2,"sent":"2026-11-01T09:30:00Z","status":"open"}` {
+		t.Errorf("Marshalled %s", out)
+	}
+	if err = json.Unmarshal([]byte(`{"bad":[1]}`), &props); err == nil {
+		t.Error("Unmarshalled an array property")
+	}
+}
+
+func TestPropertyFrontMatter(t *testing.T) {
+	note, err := ParseMarkdown([]byte("---\nproperties:\n  status: open\n  priority: 2\n  due: 2026-11-01\n---\nbody"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p := note.Properties["priority"]; p.Type != PropertyNumber || p.Value != 2.0 {
+		t.Errorf("priority is %+v", p)
+	}
+	if p := note.Properties["due"]; p.Type != PropertyDate {
+		t.Errorf("due is %+v", p)
+	}
+	raw, err := note.MarshalMarkdown()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(raw), "properties:\n  due: \"2026-11-01\"\n  priority: 2\n  status: open\n") {
+		t.Errorf("Marshalled %s", raw)
+	}
+	if _, err = ParseMarkdown([]byte("---\nproperties:\n  a.b: 1\n---\n")); err != ErrPropertyName {
+		t.Errorf("Parsing a bad property name returned %v", err)
+	}
+}
+
+func TestPropertyFilter(t *testing.T) {
+	props := map[string]Property{
+		"status":   {PropertyString, "open"},
+		"priority": {PropertyNumber, 2.0},
+		"due":      {PropertyDate, time.Date(2026, 11, 1, 0, 0, 0, 0, time.UTC)},
+	}
+	cases := []struct {
+		filter  PropertyFilter
+		matches bool
+	}{
+		{PropertyFilter{"status", OpEqual, "open"}, true},
+		{PropertyFilter{"status", OpNotEqual, "open"}, false},
+		{PropertyFilter{"priority", OpGreaterEqual, "2"}, true},
+		{PropertyFilter{"priority", OpGreater, "2"}, false},
+		{PropertyFilter{"priority", OpLess, "10"}, true},
+		{PropertyFilter{"priority", OpEqual, "high"}, false},
+		{PropertyFilter{"due", OpLess, "2026-12-01"}, true},
+		{PropertyFilter{"due", OpGreater, "2026-11-01T12:00:00Z"}, false},
+		{PropertyFilter{"missing", OpEqual, "x"}, false},
+		{PropertyFilter{"missing", OpNotEqual, "x"}, true},
+	}
+	for _, tc := range cases {
+		if matches := tc.filter.Matches(props); matches != tc.matches {
+			t.Errorf("%+v matched %t, expected %t", tc.filter, matches, tc.matches)
+		}
+	}
+}
@@ -0,0 +1,327 @@
+package notes
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// QueryField is the note field a search term matches.
+type QueryField string
+
+// Search query fields. FieldText matches notes whose title or body contains
+// the term.
+const (
+	FieldText     QueryField = ""
+	FieldTag      QueryField = "tag"
+	FieldFolder   QueryField = "folder"
+	FieldTitle    QueryField = "title"
+	FieldCreated  QueryField = "created"
+	FieldModified QueryField = "modified"
+)
+
+var queryFields = map[string]QueryField{
+	"tag":      FieldTag,
+	"folder":   FieldFolder,
+	"title":    FieldTitle,
+	"created":  FieldCreated,
+	"modified": FieldModified,
+}
+
+// SearchTerm is a single condition in a search query, such as tag:work.
+type SearchTerm struct {
+	Field QueryField
+	// Negate matches notes that don't meet the condition.
+	Negate bool
+	// Value is the text, tag, folder, or title to match. Text and titles match
+	// if they contain it, ignoring case; folders match themselves and their
+	// subfolders.
+	Value string
+	// From and Until are the range of dates matched by created and modified
+	// terms, from inclusive until exclusive. Either may be zero.
+	From  time.Time
+	Until time.Time
+}
+
+// Clause is a list of search terms, any of which must match.
+type Clause []SearchTerm
+
+// Query is a parsed search query. Every clause must match.
+type Query struct {
+	Clauses []Clause
+}
+
+// IsZero reports whether the query matches every note.
+func (q Query) IsZero() bool {
+	return len(q.Clauses) == 0
+}
+
+// QuerySyntaxError describes a problem parsing a search query, at a position
+// counted in characters from 1.
+type QuerySyntaxError struct {
+	Pos int
+	Msg string
+}
+
+func (e *QuerySyntaxError) Error() string {
+	return fmt.Sprintf("query syntax error at position %d: %s", e.Pos, e.Msg)
+}
+
+// relativeDate matches an age, such as 7d, in hours, days, or weeks.
+var relativeDate = regexp.MustCompile(`^(\d+)([hdw])$`)
+
+var relativeUnits = map[string]time.Duration{
+	"h": time.Hour,
+	"d": 24 * time.Hour,
+	"w": 7 * 24 * time.Hour,
+}
+
+// ParseQuery parses a search query. Terms are separated by spaces, and all of
+// them must match, unless joined by OR, in which case either must. A term is
+// text, a "quoted phrase", or a field and value, such as tag:work,
+// folder:projects/alpha, or title:"release notes". created and modified
+// compare dates, such as created:>2026-01-01, or ages relative to now, such as
+// modified:<7d, for less than seven days ago. A term starting with - matches
+// notes that don't meet it.
+func ParseQuery(s string, now time.Time) (Query, error) {
+	p := queryParser{src: []rune(s), now: now}
+	return p.parse()
+}
+
+type queryParser struct {
+	src []rune
+	pos int
+	now time.Time
+}
+
+func (p *queryParser) errorf(pos int, format string, args ...interface{}) error {
+	return &QuerySyntaxError{Pos: pos + 1, Msg: fmt.Sprintf(format, args...)}
+}
+
+func (p *queryParser) skipSpace() {
+	for p.pos < len(p.src) && unicode.IsSpace(p.src[p.pos]) {
+		p.pos++
+	}
+}
+
+func (p *queryParser) parse() (Query, error) {
+	var (
+		q      Query
+		or     bool
+		orPos  int
+		hasAny bool
+	)
+	for {
+		p.skipSpace()
+		if p.pos >= len(p.src) {
+			break
+		}
+		start := p.pos
+		if p.word() == "OR" {
+			if !hasAny || or {
+				return Query{}, p.errorf(start, "OR must be between two terms")
+			}
+			or, orPos = true, start
+			continue
+		}
+		p.pos = start
+		term, err := p.term()
+		if err != nil {
+			return Query{}, err
+		}
+		if or {
+			last := len(q.Clauses) - 1
+			q.Clauses[last] = append(q.Clauses[last], term)
+		} else {
+			q.Clauses = append(q.Clauses, Clause{term})
+		}
+		or, hasAny = false, true
+	}
+	if or {
+		return Query{}, p.errorf(orPos, "OR must be between two terms")
+	}
+	return q, nil
+}
+
+// word reads up to the next space.
+func (p *queryParser) word() string {
+	start := p.pos
+	for p.pos < len(p.src) && !unicode.IsSpace(p.src[p.pos]) {
+		p.pos++
+	}
+	return string(p.src[start:p.pos])
+}
+
+// quoted reads a quoted phrase, starting at the opening quote.
+func (p *queryParser) quoted() (string, error) {
+	start := p.pos
+	p.pos++
+	for p.pos < len(p.src) && p.src[p.pos] != '"' {
+		p.pos++
+	}
+	if p.pos >= len(p.src) {
+		return "", p.errorf(start, "unterminated quote")
+	}
+	p.pos++
+	return string(p.src[start+1 : p.pos-1]), nil
+}
+
+// value reads a term's value, which may be quoted.
+func (p *queryParser) value() (string, error) {
+	if p.pos < len(p.src) && p.src[p.pos] == '"' {
+		return p.quoted()
+	}
+	return p.word(), nil
+}
+
+func (p *queryParser) term() (SearchTerm, error) {
+	var term SearchTerm
+	if p.src[p.pos] == '-' {
+		term.Negate = true
+		p.pos++
+		if p.pos >= len(p.src) || unicode.IsSpace(p.src[p.pos]) {
+			return term, p.errorf(p.pos-1, "expected a term after -")
+		}
+	}
+	start := p.pos
+	if p.src[p.pos] != '"' {
+		for i := p.pos; i < len(p.src) && !unicode.IsSpace(p.src[i]); i++ {
+			if p.src[i] != ':' {
+				continue
+			}
+			if field, ok := queryFields[strings.ToLower(string(p.src[p.pos:i]))]; ok {
+				term.Field = field
+				p.pos = i + 1
+			}
+			break
+		}
+	}
+	valuePos := p.pos
+	value, err := p.value()
+	if err != nil {
+		return term, err
+	}
+	if value == "" {
+		if term.Field == FieldText {
+			return term, p.errorf(start, "empty phrase")
+		}
+		return term, p.errorf(valuePos, "expected a value for %s", term.Field)
+	}
+	switch term.Field {
+	case FieldCreated, FieldModified:
+		if term.From, term.Until, err = p.dateRange(value); err != nil {
+			return term, p.errorf(valuePos, "%s", err)
+		}
+	case FieldFolder:
+		term.Value = strings.Trim(value, "/")
+	default:
+		term.Value = value
+	}
+	return term, nil
+}
+
+// dateRange parses a date comparison, such as >2026-01-01 or <7d, into the
+// range of dates it matches. Dates without a time match the whole day; ages
+// compare with now, so <7d matches dates less than seven days ago.
+func (p *queryParser) dateRange(s string) (from, until time.Time, err error) {
+	op := OpEqual
+	for _, o := range []string{OpGreaterEqual, OpLessEqual, OpGreater, OpLess, OpEqual} {
+		if strings.HasPrefix(s, o) {
+			op, s = o, s[len(o):]
+			break
+		}
+	}
+	if m := relativeDate.FindStringSubmatch(s); m != nil {
+		n, err := strconv.Atoi(m[1])
+		if err != nil {
+			return from, until, fmt.Errorf("invalid age %q", s)
+		}
+		t := p.now.Add(-time.Duration(n) * relativeUnits[m[2]])
+		// An age comparison is the reverse of a date comparison.
+		switch op {
+		case OpLess, OpLessEqual, OpEqual:
+			return t, until, nil
+		default:
+			return from, t, nil
+		}
+	}
+	var start, end time.Time
+	if t, err := time.Parse(DueFormat, s); err == nil {
+		start, end = t, t.AddDate(0, 0, 1)
+	} else if t, err := time.Parse(time.RFC3339, s); err == nil {
+		start, end = t, t.Add(time.Nanosecond)
+	} else {
+		return from, until, fmt.Errorf("invalid date %q, expected 2006-01-02, an RFC3339 date, or an age such as 7d", s)
+	}
+	switch op {
+	case OpGreater:
+		return end, until, nil
+	case OpGreaterEqual:
+		return start, until, nil
+	case OpLess:
+		return from, start, nil
+	case OpLessEqual:
+		return from, end, nil
+	}
+	return start, end, nil
+}
+
+// Matches reports whether a note meets the term.
+func (t SearchTerm) Matches(note Note) bool {
+	return t.matches(note) != t.Negate
+}
+
+func (t SearchTerm) matches(note Note) bool {
+	switch t.Field {
+	case FieldText:
+		text := strings.ToLower(t.Value)
+		return strings.Contains(strings.ToLower(note.Title), text) || strings.Contains(strings.ToLower(note.Body), text)
+	case FieldTitle:
+		return strings.Contains(strings.ToLower(note.Title), strings.ToLower(t.Value))
+	case FieldTag:
+		for _, tag := range note.Tags {
+			if tag == t.Value {
+				return true
+			}
+		}
+		return false
+	case FieldFolder:
+		return InFolder(note.Folder, t.Value)
+	case FieldCreated:
+		return t.InRange(note.Created)
+	case FieldModified:
+		return t.InRange(note.Modified)
+	}
+	return false
+}
+
+// InRange reports whether a time is in the term's date range.
+func (t SearchTerm) InRange(v time.Time) bool {
+	return (t.From.IsZero() || !v.Before(t.From)) && (t.Until.IsZero() || v.Before(t.Until))
+}
+
+// InFolder reports whether a folder path is the given folder or one of its
+// subfolders.
+func InFolder(path, folder string) bool {
+	return path == folder || (folder != "" && strings.HasPrefix(path, folder+"/"))
+}
+
+// Matches reports whether a note matches the query.
+func (q Query) Matches(note Note) bool {
+	for _, clause := range q.Clauses {
+		matched := false
+		for _, term := range clause {
+			if term.Matches(note) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	return true
+}
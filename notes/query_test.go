@@ -0,0 +1,126 @@
+package notes
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseQuery(t *testing.T) {
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	day := func(d string) time.Time {
+		t, _ := time.Parse(DueFormat, d)
+		return t
+	}
+	q, err := ParseQuery(`milk tag:work OR tag:home -folder:/archive/ title:"release notes" created:>2026-01-01 modified:<7d "a b"`, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Clause{
+		{{Value: "milk"}},
+		{{Field: FieldTag, Value: "work"}, {Field: FieldTag, Value: "home"}},
+		{{Field: FieldFolder, Value: "archive", Negate: true}},
+		{{Field: FieldTitle, Value: "release notes"}},
+		{{Field: FieldCreated, From: day("2026-01-02")}},
+		{{Field: FieldModified, From: now.AddDate(0, 0, -7)}},
+		{{Value: "a b"}},
+	}
+	if len(q.Clauses) != len(expected) {
+		t.Fatalf("Got %d clauses, expected %d: %+v", len(q.Clauses), len(expected), q.Clauses)
+	}
+	for i, clause := range q.Clauses {
+		if len(clause) != len(expected[i]) {
+			t.Errorf("Clause %d is %+v, expected %+v", i, clause, expected[i])
+			continue
+		}
+		for j, term := range clause {
+			e := expected[i][j]
+			if term.Field != e.Field || term.Value != e.Value || term.Negate != e.Negate ||
+				!term.From.Equal(e.From) || !term.Until.Equal(e.Until) {
+				t.Errorf("Term %d.%d is %+v, expected %+v", i, j, term, e)
+			}
+		}
+	}
+
+	ranges := []struct {
+		value       string
+		from, until time.Time
+	}{
+		{"2026-01-01", day("2026-01-01"), day("2026-01-02")},
+		{">=2026-01-01", day("2026-01-01"), time.Time{}},
+		{"<2026-01-01", time.Time{}, day("2026-01-01")},
+		{"<=2026-01-01", time.Time{}, day("2026-01-02")},
+		{">2w", time.Time{}, now.AddDate(0, 0, -14)},
+		{"3h", now.Add(-3 * time.Hour), time.Time{}},
+	}
+	for _, r := range ranges {
+		q, err := ParseQuery("created:"+r.value, now)
+		if err != nil {
+			t.Errorf("%s: %s", r.value, err)
+			continue
+		}
+		if term := q.Clauses[0][0]; !term.From.Equal(r.from) || !term.Until.Equal(r.until) {
+			t.Errorf("%s is %s to %s, expected %s to %s", r.value, term.From, term.Until, r.from, r.until)
+		}
+	}
+
+	// Words with colons that aren't fields are text.
+	if q, err = ParseQuery("at 10:30", now); err != nil || q.Clauses[1][0].Value != "10:30" {
+		t.Errorf("Got %+v, %v", q.Clauses, err)
+	}
+
+	errors := map[string]int{
+		`title:"release notes`:   7,
+		`OR milk`:                1,
+		`milk OR`:                6,
+		`milk OR OR eggs`:        9,
+		`milk - eggs`:            6,
+		`tag: work`:              5,
+		`créé created:yesterday`: 14,
+		`""`:                     1,
+	}
+	for query, pos := range errors {
+		_, err := ParseQuery(query, now)
+		if se, ok := err.(*QuerySyntaxError); !ok || se.Pos != pos {
+			t.Errorf("%s: got %v, expected a syntax error at %d", query, err, pos)
+		}
+	}
+}
+
+func TestQueryMatches(t *testing.T) {
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	note := Note{
+		Title:    "Release Notes",
+		Body:     "Shipped the MILK feature",
+		Folder:   "projects/alpha",
+		Tags:     []string{"work"},
+		Created:  now.AddDate(0, -1, 0),
+		Modified: now.AddDate(0, 0, -1),
+	}
+	cases := map[string]bool{
+		"milk":                             true,
+		"milk eggs":                        false,
+		"milk OR eggs":                     true,
+		"-eggs":                            true,
+		`title:"release notes"`:            true,
+		"title:milk":                       false,
+		"tag:work":                         true,
+		"-tag:work OR tag:home":            false,
+		"folder:projects":                  true,
+		"folder:proj":                      false,
+		"folder:projects/alpha":            true,
+		"created:>2026-09-01":              true,
+		"created:2026-09-19":               true,
+		"created:<2026-09-19":              false,
+		"modified:<7d":                     true,
+		"modified:>7d":                     false,
+		"tag:home OR folder:projects milk": true,
+	}
+	for query, expected := range cases {
+		q, err := ParseQuery(query, now)
+		if err != nil {
+			t.Errorf("%s: %s", query, err)
+		} else if q.Matches(note) != expected {
+			t.Errorf("%s matched %t, expected %t", query, !expected, expected)
+		}
+	}
+}
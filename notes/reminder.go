@@ -0,0 +1,177 @@
+package notes
+
+import (
+	"errors"
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+// Recurrence is how often a reminder repeats.
+type Recurrence string
+
+// Reminder recurrences. RecurNone fires once.
+const (
+	RecurNone    Recurrence = ""
+	RecurDaily   Recurrence = "daily"
+	RecurWeekly  Recurrence = "weekly"
+	RecurMonthly Recurrence = "monthly"
+	RecurYearly  Recurrence = "yearly"
+)
+
+// ErrReminderTime indicates a reminder without a time.
+var ErrReminderTime = errors.New("reminder time required")
+
+// ErrRecurrence indicates an unknown reminder recurrence.
+var ErrRecurrence = errors.New("recurrence must be daily, weekly, monthly, or yearly")
+
+// ErrWebhook indicates a reminder webhook that isn't an absolute HTTP(S) URL.
+var ErrWebhook = errors.New("webhook must be an http or https URL")
+
+// ErrWebhookHost indicates a reminder webhook on a loopback, private, or
+// link-local address, which the server won't post to.
+var ErrWebhookHost = errors.New("webhook must be on a public host")
+
+// Reminder is a notification about a note at a set time, optionally
+// repeating.
+type Reminder struct {
+	ID uuid.UUID `json:"id" xml:"id,attr"`
+	// Time is when the reminder next fires.
+	Time       time.Time  `json:"time" xml:"time,attr"`
+	Recurrence Recurrence `json:"recurrence,omitempty" xml:"recurrence,attr,omitempty"`
+	Message    string     `json:"message"`
+	// Email sends the reminder to the owner's email address, and Webhook posts
+	// it to a URL.
+	Email   bool   `json:"email,omitempty" xml:"email,attr,omitempty"`
+	Webhook string `json:"webhook,omitempty" xml:"webhook,attr,omitempty"`
+	// Done is set once a reminder that doesn't repeat has fired.
+	Done bool `json:"done,omitempty" xml:"done,attr,omitempty"`
+}
+
+// Validate checks that a reminder can be scheduled.
+func (r Reminder) Validate() error {
+	if r.Time.IsZero() {
+		return ErrReminderTime
+	}
+	switch r.Recurrence {
+	case RecurNone, RecurDaily, RecurWeekly, RecurMonthly, RecurYearly:
+	default:
+		return ErrRecurrence
+	}
+	if r.Webhook != "" {
+		u, err := url.Parse(r.Webhook)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return ErrWebhook
+		}
+		host := strings.ToLower(strings.TrimSuffix(u.Hostname(), "."))
+		if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+			return ErrWebhookHost
+		}
+		// Host names are checked when the webhook is posted to, as what they
+		// resolve to can change.
+		if ip := net.ParseIP(host); ip != nil && !PublicIP(ip) {
+			return ErrWebhookHost
+		}
+	}
+	return nil
+}
+
+// reservedNets are non-public networks not covered by the net.IP methods.
+var reservedNets = []*net.IPNet{
+	parseCIDR("0.0.0.0/8"),
+	parseCIDR("100.64.0.0/10"),
+}
+
+func parseCIDR(s string) *net.IPNet {
+	_, n, err := net.ParseCIDR(s)
+	if err != nil {
+		panic(err)
+	}
+	return n
+}
+
+// PublicIP reports whether an IP address may be on the public internet, rather
+// than loopback, private, link-local, multicast, or otherwise reserved.
+// Reminder webhooks are only posted to public addresses.
+func PublicIP(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsMulticast() {
+		return false
+	}
+	for _, n := range reservedNets {
+		if n.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// Advance moves a fired reminder on to the first time it repeats after now,
+// skipping any repeats missed in the meantime, or marks it done if it doesn't
+// repeat.
+func (r *Reminder) Advance(now time.Time) {
+	if r.Recurrence == RecurNone {
+		r.Done = true
+		return
+	}
+	for !r.Time.After(now) {
+		switch r.Recurrence {
+		case RecurDaily:
+			r.Time = r.Time.AddDate(0, 0, 1)
+		case RecurWeekly:
+			r.Time = r.Time.AddDate(0, 0, 7)
+		case RecurMonthly:
+			r.Time = r.Time.AddDate(0, 1, 0)
+		case RecurYearly:
+			r.Time = r.Time.AddDate(1, 0, 0)
+		default:
+			r.Done = true
+			return
+		}
+	}
+}
+
+// Reminder returns the note's reminder with the given ID, or nil.
+func (n *Note) Reminder(id uuid.UUID) *Reminder {
+	for i := range n.Reminders {
+		if n.Reminders[i].ID == id {
+			return &n.Reminders[i]
+		}
+	}
+	return nil
+}
+
+// ReminderItem is a pending reminder along with the note it's on.
+type ReminderItem struct {
+	Reminder
+	Owner     uuid.UUID `json:"owner" xml:"owner,attr"`
+	Note      uuid.UUID `json:"note" xml:"note,attr"`
+	NoteTitle string    `json:"noteTitle"`
+}
+
+// PendingReminders returns the pending reminders on a list of notes due before
+// the given time, or all of them if it's zero, in the order they're due.
+func PendingReminders(list []Note, before time.Time) []ReminderItem {
+	items := make([]ReminderItem, 0)
+	for _, note := range list {
+		for _, r := range note.Reminders {
+			if r.Done || (!before.IsZero() && !r.Time.Before(before)) {
+				continue
+			}
+			items = append(items, ReminderItem{
+				Reminder:  r,
+				Owner:     note.Owner,
+				Note:      note.ID,
+				NoteTitle: note.Title,
+			})
+		}
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].Time.Before(items[j].Time)
+	})
+	return items
+}
@@ -0,0 +1,86 @@
+package notes
+
+import (
+	"testing"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+func TestReminderAdvance(t *testing.T) {
+	start := time.Date(2026, 1, 15, 9, 0, 0, 0, time.UTC)
+	now := time.Date(2026, 3, 15, 12, 0, 0, 0, time.UTC)
+	cases := []struct {
+		recurrence Recurrence
+		next       time.Time
+		done       bool
+	}{
+		{RecurNone, start, true},
+		{RecurDaily, time.Date(2026, 3, 16, 9, 0, 0, 0, time.UTC), false},
+		{RecurWeekly, time.Date(2026, 3, 19, 9, 0, 0, 0, time.UTC), false},
+		{RecurMonthly, time.Date(2026, 4, 15, 9, 0, 0, 0, time.UTC), false},
+		{RecurYearly, time.Date(2027, 1, 15, 9, 0, 0, 0, time.UTC), false},
+	}
+	for _, tc := range cases {
+		r := Reminder{Time: start, Recurrence: tc.recurrence}
+		r.Advance(now)
+		if !r.Time.Equal(tc.next) || r.Done != tc.done {
+			t.Errorf("%q: advanced to %s done %t, expected %s done %t", tc.recurrence, r.Time, r.Done, tc.next, tc.done)
+		}
+	}
+}
+
+func TestReminderValidate(t *testing.T) {
+	now := time.Now()
+	cases := []struct {
+		reminder Reminder
+		err      error
+	}{
+		{Reminder{Time: now, Recurrence: RecurWeekly, Webhook: "https://example.com/hook"}, nil},
+		{Reminder{}, ErrReminderTime},
+		{Reminder{Time: now, Recurrence: "hourly"}, ErrRecurrence},
+		{Reminder{Time: now, Webhook: "file:///etc/passwd"}, ErrWebhook},
+		{Reminder{Time: now, Webhook: "/hook"}, ErrWebhook},
+		{Reminder{Time: now, Webhook: "http://203.0.113.9:8080/hook"}, nil},
+		{Reminder{Time: now, Webhook: "http://localhost:8080/hook"}, ErrWebhookHost},
+		{Reminder{Time: now, Webhook: "http://127.0.0.1/hook"}, ErrWebhookHost},
+		{Reminder{Time: now, Webhook: "http://10.1.2.3/hook"}, ErrWebhookHost},
+		{Reminder{Time: now, Webhook: "http://169.254.169.254/latest/meta-data"}, ErrWebhookHost},
+		{Reminder{Time: now, Webhook: "http://[::1]/hook"}, ErrWebhookHost},
+		{Reminder{Time: now, Webhook: "http://[::ffff:192.168.0.1]/hook"}, ErrWebhookHost},
+		{Reminder{Time: now, Webhook: "http://0.0.0.0/hook"}, ErrWebhookHost},
+	}
+	for _, tc := range cases {
+		if err := tc.reminder.Validate(); err != tc.err {
+			t.Errorf("%+v: got %v, expected %v", tc.reminder, err, tc.err)
+		}
+	}
+}
+
+func TestPendingReminders(t *testing.T) {
+	now := time.Now()
+	list := []Note{
+		{ID: uuid.NewV4(), Title: "one", Reminders: []Reminder{
+			{Message: "later", Time: now.Add(2 * time.Hour)},
+			{Message: "done", Time: now.Add(-time.Hour), Done: true},
+		}},
+		{ID: uuid.NewV4(), Title: "two", Reminders: []Reminder{
+			{Message: "soon", Time: now.Add(time.Hour)},
+			{Message: "overdue", Time: now.Add(-time.Hour)},
+		}},
+	}
+	items := PendingReminders(list, time.Time{})
+	var messages []string
+	for _, item := range items {
+		messages = append(messages, item.Message)
+	}
+	if len(messages) != 3 || messages[0] != "overdue" || messages[1] != "soon" || messages[2] != "later" {
+		t.Errorf("Pending reminders are %q", messages)
+	}
+	if items[1].Note != list[1].ID || items[1].NoteTitle != "two" {
+		t.Errorf("Reminder item is %+v", items[1])
+	}
+	if items = PendingReminders(list, now); len(items) != 1 || items[0].Message != "overdue" {
+		t.Errorf("Reminders due now are %+v", items)
+	}
+}
@@ -0,0 +1,178 @@
+package notes
+
+import (
+	"html"
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// SnippetContext is how many characters of context a snippet has around the
+// matches in it, either side.
+const SnippetContext = 60
+
+// MaxSnippets is the most snippets taken from a note.
+const MaxSnippets = 3
+
+// Snippet is an excerpt of a note's body around text matched by a search.
+type Snippet struct {
+	Text string `json:"text"`
+	// Matches are where the matched text is in Text.
+	Matches []Match `json:"matches" xml:"Match"`
+	// HTML is Text, escaped, with the matched text in <mark> elements.
+	HTML string `json:"html"`
+}
+
+// Match is the position of matched text, in characters from 0, from Start
+// inclusive to End exclusive.
+type Match struct {
+	Start int `json:"start" xml:"start,attr"`
+	End   int `json:"end" xml:"end,attr"`
+}
+
+// TextTerms returns the text a query looks for in note titles and bodies; that
+// is, the values of its text terms that aren't negated.
+func (q Query) TextTerms() []string {
+	var terms []string
+	for _, clause := range q.Clauses {
+		for _, term := range clause {
+			if term.Field == FieldText && !term.Negate {
+				terms = append(terms, term.Value)
+			}
+		}
+	}
+	return terms
+}
+
+// Snippets returns up to MaxSnippets excerpts of a note's body around where it
+// contains the search terms, ignoring case. Runs of whitespace in the body are
+// collapsed to single spaces.
+func Snippets(body string, terms []string) []Snippet {
+	text := []rune(strings.Join(strings.Fields(body), " "))
+	matches := findMatches(text, terms)
+	var snippets []Snippet
+	for i := 0; i < len(matches) && len(snippets) < MaxSnippets; {
+		start := wordStart(text, matches[i].Start-SnippetContext, matches[i].Start)
+		end := wordEnd(text, matches[i].End+SnippetContext, matches[i].End)
+		// Take in every match that fits.
+		var in []Match
+		for ; i < len(matches) && matches[i].End <= end; i++ {
+			in = append(in, matches[i])
+		}
+		snippets = append(snippets, makeSnippet(text, start, end, in))
+	}
+	return snippets
+}
+
+// findMatches finds the terms in text, ignoring case, merging overlapping
+// matches.
+func findMatches(text []rune, terms []string) []Match {
+	lower := make([]rune, len(text))
+	for i, r := range text {
+		lower[i] = unicode.ToLower(r)
+	}
+	var matches []Match
+	for _, term := range terms {
+		t := []rune(term)
+		for i, r := range t {
+			t[i] = unicode.ToLower(r)
+		}
+		if len(t) == 0 {
+			continue
+		}
+		for i := 0; i+len(t) <= len(lower); i++ {
+			if string(lower[i:i+len(t)]) == string(t) {
+				matches = append(matches, Match{i, i + len(t)})
+			}
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		return matches[i].Start < matches[j].Start
+	})
+	var merged []Match
+	for _, m := range matches {
+		if n := len(merged); n > 0 && m.Start <= merged[n-1].End {
+			if m.End > merged[n-1].End {
+				merged[n-1].End = m.End
+			}
+			continue
+		}
+		merged = append(merged, m)
+	}
+	return merged
+}
+
+// wordStart moves a snippet start forward to the start of a word, unless it's
+// the start of the text, but not past limit.
+func wordStart(text []rune, i, limit int) int {
+	if i <= 0 {
+		return 0
+	}
+	for j := i; j < limit; j++ {
+		if text[j-1] == ' ' {
+			return j
+		}
+	}
+	return i
+}
+
+// wordEnd moves a snippet end back to the end of a word, unless it's the end
+// of the text, but not before limit.
+func wordEnd(text []rune, i, limit int) int {
+	if i >= len(text) {
+		return len(text)
+	}
+	for j := i; j > limit; j-- {
+		if text[j] == ' ' {
+			return j
+		}
+	}
+	return i
+}
+
+// makeSnippet makes a snippet of text, with an ellipsis where it's cut off.
+func makeSnippet(text []rune, start, end int, matches []Match) Snippet {
+	var (
+		s      Snippet
+		plain  strings.Builder
+		marked strings.Builder
+		offset = -start
+		pos    = start
+	)
+	if start > 0 {
+		plain.WriteString("…")
+		marked.WriteString("…")
+		offset++
+	}
+	for _, m := range matches {
+		plain.WriteString(string(text[pos:m.End]))
+		marked.WriteString(html.EscapeString(string(text[pos:m.Start])))
+		marked.WriteString("<mark>" + html.EscapeString(string(text[m.Start:m.End])) + "</mark>")
+		s.Matches = append(s.Matches, Match{m.Start + offset, m.End + offset})
+		pos = m.End
+	}
+	plain.WriteString(string(text[pos:end]))
+	marked.WriteString(html.EscapeString(string(text[pos:end])))
+	if end < len(text) {
+		plain.WriteString("…")
+		marked.WriteString("…")
+	}
+	s.Text, s.HTML = plain.String(), marked.String()
+	return s
+}
+
+// Score rates how relevant a note is to search terms, higher being more
+// relevant. Matches in the title count more than those in the body, and those
+// in longer bodies count less.
+func Score(note Note, terms []string) float64 {
+	title, body := strings.ToLower(note.Title), strings.ToLower(note.Body)
+	words := float64(len(strings.Fields(body)))
+	var score float64
+	for _, term := range terms {
+		t := strings.ToLower(term)
+		score += 3 * float64(strings.Count(title, t))
+		score += float64(strings.Count(body, t)) / (1 + math.Log1p(words/100))
+	}
+	return math.Round(score*1000) / 1000
+}
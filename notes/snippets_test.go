@@ -0,0 +1,47 @@
+package notes
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSnippets(t *testing.T) {
+	filler := strings.Repeat("lorem ipsum ", 20)
+	body := "Buy Milk &\n\teggs. " + filler + "Then the milkman. " + filler + "milk " + filler + "milk " + filler + "milk"
+	snippets := Snippets(body, []string{"milk", "EGGS"})
+	if len(snippets) != MaxSnippets {
+		t.Fatalf("Got %d snippets, expected %d: %+v", len(snippets), MaxSnippets, snippets)
+	}
+	first := snippets[0]
+	if !strings.HasPrefix(first.Text, "Buy Milk & eggs. lorem") || !strings.HasSuffix(first.Text, "…") {
+		t.Errorf("First snippet is %q", first.Text)
+	}
+	if !strings.HasPrefix(first.HTML, "Buy <mark>Milk</mark> &amp; <mark>eggs</mark>. lorem") {
+		t.Errorf("First snippet HTML is %q", first.HTML)
+	}
+	for _, s := range snippets {
+		text := []rune(s.Text)
+		for _, m := range s.Matches {
+			if match := strings.ToLower(string(text[m.Start:m.End])); match != "milk" && match != "eggs" {
+				t.Errorf("Match %+v in %q is %q", m, s.Text, match)
+			}
+		}
+	}
+	second := snippets[1]
+	if !strings.HasPrefix(second.Text, "…") || !strings.Contains(second.HTML, "the <mark>milk</mark>man") {
+		t.Errorf("Second snippet is %q", second.HTML)
+	}
+	if len(Snippets("nothing here", []string{"milk"})) != 0 {
+		t.Error("Got snippets without matches")
+	}
+}
+
+func TestScore(t *testing.T) {
+	terms := []string{"milk"}
+	inTitle := Score(Note{Title: "Milk", Body: "eggs"}, terms)
+	inBody := Score(Note{Title: "Groceries", Body: "milk"}, terms)
+	inLongBody := Score(Note{Title: "Groceries", Body: "milk " + strings.Repeat("word ", 500)}, terms)
+	if !(inTitle > inBody && inBody > inLongBody && inLongBody > 0) {
+		t.Errorf("Scores in title %f, body %f, long body %f", inTitle, inBody, inLongBody)
+	}
+}
@@ -0,0 +1,162 @@
+package notes
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+// Task is a GitHub-style task list item in a note body, such as "- [ ] milk".
+type Task struct {
+	// ID identifies the task within its note. It's derived from the task's
+	// text, so it stays the same when the task is checked or other lines
+	// change; tasks with the same text are numbered in order.
+	ID      string `json:"id"`
+	Text    string `json:"text"`
+	Checked bool   `json:"checked"`
+	// Line is the zero-based line number of the task in the body.
+	Line int `json:"line"`
+	// Due is the date from a @due(2006-01-02) annotation in the text, in the
+	// same format, or empty.
+	Due string `json:"due,omitempty"`
+	// Tags are the #tag annotations in the text.
+	Tags []string `json:"tags,omitempty"`
+}
+
+// DueFormat is the layout of task due dates.
+const DueFormat = "2006-01-02"
+
+// TaskItem is a task in a user's task index, along with the note it's in.
+type TaskItem struct {
+	// Key identifies the item in the index; it's the note ID and task ID.
+	Key       string `json:"-" xml:"-" storm:"id" bson:"_id"`
+	Task      `bson:",inline"`
+	Owner     uuid.UUID `json:"owner" storm:"index"`
+	Note      uuid.UUID `json:"note" storm:"index"`
+	NoteTitle string    `json:"noteTitle"`
+	Folder    string    `json:"path"`
+}
+
+// TaskItems returns the index items for the tasks in a note.
+func TaskItems(note Note) []TaskItem {
+	tasks := Tasks(note.Body)
+	items := make([]TaskItem, len(tasks))
+	for i, task := range tasks {
+		items[i] = TaskItem{
+			Key:       note.ID.String() + "/" + task.ID,
+			Task:      task,
+			Owner:     note.Owner,
+			Note:      note.ID,
+			NoteTitle: note.Title,
+			Folder:    note.Folder,
+		}
+	}
+	return items
+}
+
+// ErrTaskNotFound indicates a task ID that isn't in the note.
+var ErrTaskNotFound = errors.New("task not found")
+
+// taskPattern matches a task list item, optionally in a block quote. The
+// second group is the check mark.
+var taskPattern = regexp.MustCompile(`^((?:\s*>)*\s*(?:[-*+]|\d{1,9}[.)])\s+\[)([ xX])\]\s+(\S.*?)\s*$`)
+
+// dueAnnotation and tagAnnotation match the annotations in a task's text.
+var (
+	dueAnnotation = regexp.MustCompile(`(?:^|\s)@due\((\d{4}-\d{2}-\d{2})\)`)
+	tagAnnotation = regexp.MustCompile(`(?:^|\s)#([\p{L}\p{N}_/-]+)`)
+)
+
+// Tasks returns the task list items in a markdown body, in order. Items in
+// fenced code blocks are skipped.
+func Tasks(body string) []Task {
+	var tasks []Task
+	seen := make(map[string]int)
+	var (
+		fence   string
+		isFence bool
+	)
+	for i, line := range strings.Split(body, "\n") {
+		if fence, isFence = codeFence(line, fence); isFence || fence != "" {
+			continue
+		}
+		m := taskPattern.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		task := Task{Text: m[3], Checked: m[2] != " ", Line: i}
+		sum := sha1.Sum([]byte(task.Text))
+		task.ID = hex.EncodeToString(sum[:4])
+		if seen[task.ID]++; seen[task.ID] > 1 {
+			task.ID += "-" + strconv.Itoa(seen[task.ID])
+		}
+		task.Due, task.Tags = annotations(task.Text)
+		tasks = append(tasks, task)
+	}
+	return tasks
+}
+
+// ToggleTask checks or unchecks a task in a markdown body, returning the new
+// body and the task as it now is.
+func ToggleTask(body, id string) (string, Task, error) {
+	for _, task := range Tasks(body) {
+		if task.ID != id {
+			continue
+		}
+		lines := strings.Split(body, "\n")
+		loc := taskPattern.FindStringSubmatchIndex(lines[task.Line])
+		mark := "x"
+		if task.Checked {
+			mark = " "
+		}
+		lines[task.Line] = lines[task.Line][:loc[4]] + mark + lines[task.Line][loc[5]:]
+		task.Checked = !task.Checked
+		return strings.Join(lines, "\n"), task, nil
+	}
+	return body, Task{}, ErrTaskNotFound
+}
+
+// annotations returns the due date and tags annotated in a task's text. A
+// due annotation that isn't a valid date is ignored.
+func annotations(text string) (string, []string) {
+	var due string
+	if m := dueAnnotation.FindStringSubmatch(text); m != nil {
+		if _, err := time.Parse(DueFormat, m[1]); err == nil {
+			due = m[1]
+		}
+	}
+	var tags []string
+	for _, m := range tagAnnotation.FindAllStringSubmatch(text, -1) {
+		tags = append(tags, m[1])
+	}
+	return due, tags
+}
+
+// codeFence tracks fenced code blocks line by line. Given a line and the fence
+// of the block it's in, if any, it returns the fence of the block after it, and
+// whether the line opened or closed a block.
+func codeFence(line, fence string) (string, bool) {
+	trimmed := strings.TrimLeft(line, " ")
+	if len(line)-len(trimmed) > 3 {
+		return fence, false
+	}
+	if fence != "" {
+		if strings.HasPrefix(trimmed, fence) && strings.Trim(trimmed, fence[:1]+" \t\r") == "" {
+			return "", true
+		}
+		return fence, false
+	}
+	for _, c := range []string{"`", "~"} {
+		n := len(trimmed) - len(strings.TrimLeft(trimmed, c))
+		if n >= 3 {
+			return trimmed[:n], true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,63 @@
+package notes
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTasks(t *testing.T) {
+	body := "# List\n" +
+		"- [ ] milk\n" +
+		"* [x] eggs  \n" +
+		"  1. [X] nested\n" +
+		"> - [ ] quoted\n" +
+		"- [] not a task\n" +
+		"- [ ]\n" +
+		"```\n- [ ] code\n```\n" +
+		"+ [ ] milk\r\n"
+	expected := []Task{
+		{Text: "milk", Line: 1},
+		{Text: "eggs", Checked: true, Line: 2},
+		{Text: "nested", Checked: true, Line: 3},
+		{Text: "quoted", Line: 4},
+		{Text: "milk", Line: 10},
+	}
+	tasks := Tasks(body)
+	if len(tasks) != len(expected) {
+		t.Fatalf("Got %d tasks, expected %d: %+v", len(tasks), len(expected), tasks)
+	}
+	for i, task := range tasks {
+		e := expected[i]
+		if task.Text != e.Text || task.Checked != e.Checked || task.Line != e.Line {
+			t.Errorf("Task %d is %+v, expected %+v", i, task, e)
+		}
+	}
+	if tasks[0].ID == tasks[1].ID || tasks[4].ID != tasks[0].ID+"-2" {
+		t.Errorf("Task IDs not unique: %s, %s, %s", tasks[0].ID, tasks[1].ID, tasks[4].ID)
+	}
+
+	annotated := Tasks("- [ ] call #work/ops @due(2026-11-01) #urgent\n- [ ] pay @due(2026-02-30) issue#3")
+	if task := annotated[0]; task.Due != "2026-11-01" || strings.Join(task.Tags, ",") != "work/ops,urgent" {
+		t.Errorf("Annotated task is %+v", task)
+	}
+	if task := annotated[1]; task.Due != "" || len(task.Tags) != 0 {
+		t.Errorf("Task with bad annotations is %+v", task)
+	}
+
+	toggled, task, err := ToggleTask(body, tasks[4].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !task.Checked || task.ID != tasks[4].ID {
+		t.Errorf("Toggled task is %+v", task)
+	}
+	if expected := body[:len(body)-len("+ [ ] milk\r\n")] + "+ [x] milk\r\n"; toggled != expected {
+		t.Errorf("Toggled body is %q, expected %q", toggled, expected)
+	}
+	if again, _, _ := ToggleTask(toggled, tasks[4].ID); again != body {
+		t.Errorf("Toggling twice gave %q", again)
+	}
+	if _, _, err = ToggleTask(body, "nope"); err != ErrTaskNotFound {
+		t.Errorf("Toggling a missing task returned %v", err)
+	}
+}
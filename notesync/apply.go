@@ -0,0 +1,210 @@
+package notesync
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+
+	"github.com/aprice/freenote/notes"
+)
+
+// Remote is the server side of a sync, for a single user's notes.
+type Remote interface {
+	// List returns every note's metadata. Bodies may be omitted or truncated.
+	List() ([]notes.Note, error)
+	Get(id uuid.UUID) (notes.Note, error)
+	Create(note notes.Note) (notes.Note, error)
+	Update(note notes.Note) (notes.Note, error)
+	Delete(id uuid.UUID) error
+}
+
+// Apply carries out sync actions in the directory at root, updating the state
+// as each succeeds. A failed action is passed to report and skipped, so it
+// will be retried on the next sync; report is also called with a nil error for
+// each action that succeeds. The state is not saved.
+func Apply(root string, state *State, actions []Action, remote Remote, report func(Action, error)) {
+	s := syncer{root: root, state: state, remote: remote}
+	for _, a := range actions {
+		report(a, s.apply(a))
+	}
+}
+
+type syncer struct {
+	root   string
+	state  *State
+	remote Remote
+}
+
+func (s *syncer) apply(a Action) error {
+	switch a.Kind {
+	case KindDownload:
+		note, err := s.remote.Get(a.ID)
+		if err != nil {
+			return err
+		}
+		if err = s.write(a.Path, note); err != nil {
+			return err
+		}
+		if a.OldPath != "" && a.OldPath != a.Path {
+			return s.remove(a.OldPath)
+		}
+	case KindUpload:
+		note := *a.Remote
+		if a.OldPath != a.Path {
+			note.Folder, note.Title = folder(a.Path), title(a.Path, a.ID)
+		}
+		a.Local.merge(&note)
+		note.Modified = time.Now()
+		saved, err := s.remote.Update(note)
+		if err != nil {
+			return err
+		}
+		return s.write(a.Path, saved)
+	case KindCreate:
+		now := time.Now()
+		note := notes.Note{
+			Folder:   folder(a.Path),
+			Title:    stem(a.Path),
+			Created:  a.Local.Note.Created,
+			Modified: now,
+		}
+		if note.Created.IsZero() {
+			note.Created = now
+		}
+		a.Local.merge(&note)
+		saved, err := s.remote.Create(note)
+		if err != nil {
+			return err
+		}
+		delete(s.state.Notes, a.ID)
+		return s.write(a.Path, saved)
+	case KindDeleteLocal:
+		if err := s.remove(a.Path); err != nil {
+			return err
+		}
+		delete(s.state.Notes, a.ID)
+	case KindDeleteRemote:
+		if err := s.remote.Delete(a.ID); err != nil {
+			return err
+		}
+		delete(s.state.Notes, a.ID)
+	case KindConflict:
+		note, err := s.remote.Get(a.ID)
+		if err != nil {
+			return err
+		}
+		// The copy has no ID, so it's created as a new note on the next sync.
+		conflict := notes.Note{
+			Folder: folder(a.CopyPath),
+			Title:  stem(a.CopyPath),
+		}
+		a.Local.merge(&conflict)
+		content, err := conflict.MarshalMarkdown()
+		if err != nil {
+			return err
+		}
+		if err = s.writeFile(a.CopyPath, content, time.Now()); err != nil {
+			return err
+		}
+		if err = s.write(a.Path, note); err != nil {
+			return err
+		}
+		if a.OldPath != a.Path {
+			return s.remove(a.OldPath)
+		}
+	case KindTrack:
+		s.state.Notes[a.ID] = Entry{Path: a.Path, Modified: a.Remote.Modified, Hash: a.Local.Hash}
+	case KindForget:
+		delete(s.state.Notes, a.ID)
+	}
+	return nil
+}
+
+// errOutsideRoot indicates a path that would be outside the sync directory.
+var errOutsideRoot = errors.New("path is outside the sync directory")
+
+// local returns the local file path for a slash-separated path in the sync
+// directory, or errOutsideRoot if it's not in it.
+func (s *syncer) local(name string) (string, error) {
+	full := filepath.Join(s.root, filepath.FromSlash(name))
+	rel, err := filepath.Rel(s.root, full)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", errOutsideRoot
+	}
+	return full, nil
+}
+
+// merge sets a note's body, and its tags if the file has front matter. The
+// title and folder come from the file's path, so they're left alone.
+func (lf *LocalFile) merge(note *notes.Note) {
+	note.Body = lf.Note.Body
+	note.HTMLBody = ""
+	if lf.HasFrontMatter {
+		note.Tags = lf.Note.Tags
+		note.Properties = lf.Note.Properties
+		if note.Properties == nil {
+			// An empty map clears them on the server; none keeps them.
+			note.Properties = map[string]notes.Property{}
+		}
+	}
+}
+
+// title returns the note title for a file path, removing the ID suffix added
+// to distinguish notes with the same title.
+func title(name string, id uuid.UUID) string {
+	return strings.TrimSuffix(stem(name), " ("+id.String()[:8]+")")
+}
+
+// write saves a note to a local file and records it as synced.
+func (s *syncer) write(name string, note notes.Note) error {
+	content, err := note.MarshalMarkdown()
+	if err != nil {
+		return err
+	}
+	if err = s.writeFile(name, content, note.Modified); err != nil {
+		return err
+	}
+	s.state.Notes[note.ID] = Entry{Path: name, Modified: note.Modified, Hash: hash(content)}
+	return nil
+}
+
+func (s *syncer) writeFile(name string, content []byte, modified time.Time) error {
+	full, err := s.local(name)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(full), 0700); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(full, content, 0600); err != nil {
+		return err
+	}
+	if !modified.IsZero() {
+		return os.Chtimes(full, modified, modified)
+	}
+	return nil
+}
+
+// remove deletes a local file, and any directories left empty by doing so.
+func (s *syncer) remove(name string) error {
+	full, err := s.local(name)
+	if err != nil {
+		return err
+	}
+	if err = os.Remove(full); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for dir := path.Dir(name); dir != "." && dir != "/"; dir = path.Dir(dir) {
+		// Fails, and stops, at the first directory that isn't empty.
+		if os.Remove(filepath.Join(s.root, filepath.FromSlash(dir))) != nil {
+			break
+		}
+	}
+	return nil
+}
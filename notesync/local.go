@@ -0,0 +1,92 @@
+package notesync
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/aprice/freenote/notes"
+)
+
+const noteExt = ".md"
+
+// LocalFile is a markdown file in a synced directory.
+type LocalFile struct {
+	// Path is slash-separated and relative to the root of the synced directory.
+	Path    string
+	Content []byte
+	Hash    string
+	// Note is the parsed file. Its ID is set if the file has been synced
+	// before, and its other fields are only set if the file has front matter.
+	Note           notes.Note
+	HasFrontMatter bool
+}
+
+// ScanDir reads every markdown file in a synced directory. Hidden files and
+// directories, including the state file, are skipped.
+func ScanDir(root string) ([]LocalFile, error) {
+	var files []LocalFile
+	err := filepath.Walk(root, func(name string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if name != root && strings.HasPrefix(info.Name(), ".") {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info.IsDir() || !strings.EqualFold(filepath.Ext(name), noteExt) {
+			return nil
+		}
+		rel, err := filepath.Rel(root, name)
+		if err != nil {
+			return err
+		}
+		lf, err := ReadFile(root, filepath.ToSlash(rel))
+		if err != nil {
+			return err
+		}
+		files = append(files, lf)
+		return nil
+	})
+	return files, err
+}
+
+// ReadFile reads a markdown file in a synced directory, given its
+// slash-separated path relative to the root.
+func ReadFile(root, name string) (LocalFile, error) {
+	content, err := ioutil.ReadFile(filepath.Join(root, filepath.FromSlash(name)))
+	if err != nil {
+		return LocalFile{}, err
+	}
+	lf := LocalFile{
+		Path:    name,
+		Content: content,
+		Hash:    hash(content),
+	}
+	front, _ := notes.SplitFrontMatter(content)
+	lf.HasFrontMatter = front != nil
+	if lf.Note, err = notes.ParseMarkdown(content); err != nil {
+		return lf, fmt.Errorf("%s: %v", name, err)
+	}
+	return lf, nil
+}
+
+// folder returns the note folder for a file path.
+func folder(name string) string {
+	dir := path.Dir(name)
+	if dir == "." {
+		return ""
+	}
+	return dir
+}
+
+// stem returns the file name of a path, without the extension.
+func stem(name string) string {
+	base := path.Base(name)
+	return base[:len(base)-len(path.Ext(base))]
+}
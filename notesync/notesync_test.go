@@ -0,0 +1,316 @@
+package notesync
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+
+	"github.com/aprice/freenote/notes"
+	"github.com/aprice/freenote/store"
+)
+
+type fakeRemote map[uuid.UUID]notes.Note
+
+func (f fakeRemote) List() ([]notes.Note, error) {
+	var out []notes.Note
+	for _, n := range f {
+		n.Body = ""
+		out = append(out, n)
+	}
+	return out, nil
+}
+
+func (f fakeRemote) Get(id uuid.UUID) (notes.Note, error) {
+	n, ok := f[id]
+	if !ok {
+		return n, store.ErrNotFound
+	}
+	return n, nil
+}
+
+func (f fakeRemote) Create(n notes.Note) (notes.Note, error) {
+	n.ID = uuid.NewV4()
+	f[n.ID] = n
+	return n, nil
+}
+
+func (f fakeRemote) Update(n notes.Note) (notes.Note, error) {
+	if _, ok := f[n.ID]; !ok {
+		return n, store.ErrNotFound
+	}
+	f[n.ID] = n
+	return n, nil
+}
+
+func (f fakeRemote) Delete(id uuid.UUID) error {
+	delete(f, id)
+	return nil
+}
+
+func (f fakeRemote) byTitle(title string) (notes.Note, bool) {
+	for _, n := range f {
+		if n.Title == title {
+			return n, true
+		}
+	}
+	return notes.Note{}, false
+}
+
+func runSync(t *testing.T, root string, remote fakeRemote) []string {
+	state, err := LoadState(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	local, err := ScanDir(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	list, _ := remote.List()
+	actions := Plan(state, local, list, time.Date(2017, 6, 1, 0, 0, 0, 0, time.UTC))
+	var done []string
+	Apply(root, &state, actions, remote, func(a Action, err error) {
+		if err != nil {
+			t.Errorf("%s: %v", a, err)
+		}
+		done = append(done, a.String())
+	})
+	if err = state.Save(root); err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(done)
+	return done
+}
+
+func expectActions(t *testing.T, actual []string, expected ...string) {
+	t.Helper()
+	sort.Strings(expected)
+	if strings.Join(actual, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Actions:\n\t%s\nExpected:\n\t%s", strings.Join(actual, "\n\t"), strings.Join(expected, "\n\t"))
+	}
+}
+
+func readNote(t *testing.T, root, name string) notes.Note {
+	t.Helper()
+	b, err := ioutil.ReadFile(filepath.Join(root, filepath.FromSlash(name)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err := notes.ParseMarkdown(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func writeFile(t *testing.T, root, name, content string) {
+	t.Helper()
+	full := filepath.Join(root, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(full), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(full, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func exists(root, name string) bool {
+	_, err := os.Stat(filepath.Join(root, filepath.FromSlash(name)))
+	return err == nil
+}
+
+func TestSync(t *testing.T) {
+	root, err := ioutil.TempDir("", "notesync")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	modified := time.Now().Add(-time.Hour)
+	plan := notes.Note{ID: uuid.NewV4(), Folder: "work", Title: "Plan", Body: "plan", Created: modified, Modified: modified}
+	list := notes.Note{ID: uuid.NewV4(), Title: "List", Body: "list", Created: modified, Modified: modified}
+	remote := fakeRemote{plan.ID: plan, list.ID: list}
+	writeFile(t, root, "Ideas.md", "some ideas")
+
+	// Initial sync
+	expectActions(t, runSync(t, root, remote),
+		"download work/Plan.md", "download List.md", "create Ideas.md")
+	if n := readNote(t, root, "work/Plan.md"); n.ID != plan.ID || n.Body != "plan" {
+		t.Errorf("Downloaded note wrong: %+v", n)
+	}
+	ideas, ok := remote.byTitle("Ideas")
+	if !ok || ideas.Body != "some ideas" {
+		t.Fatalf("Created note wrong: %+v", ideas)
+	}
+	if n := readNote(t, root, "Ideas.md"); n.ID != ideas.ID {
+		t.Errorf("Created note's file has ID %s, expected %s", n.ID, ideas.ID)
+	}
+	expectActions(t, runSync(t, root, remote))
+
+	// Changes on each side, and a local move
+	list.Title, list.Body, list.Modified = "Shopping List", "milk", time.Now()
+	remote[list.ID] = list
+	content, _ := ioutil.ReadFile(filepath.Join(root, "Ideas.md"))
+	writeFile(t, root, "Ideas.md", strings.Replace(string(content), "some ideas", "more ideas", 1))
+	if err = os.Rename(filepath.Join(root, "work"), filepath.Join(root, "done")); err != nil {
+		t.Fatal(err)
+	}
+	expectActions(t, runSync(t, root, remote),
+		"download Shopping List.md (from List.md)", "upload Ideas.md", "upload done/Plan.md (from work/Plan.md)")
+	if exists(root, "List.md") || readNote(t, root, "Shopping List.md").Body != "milk" {
+		t.Error("Remote rename not applied")
+	}
+	if remote[ideas.ID].Body != "more ideas" {
+		t.Errorf("Local edit not uploaded: %q", remote[ideas.ID].Body)
+	}
+	if remote[plan.ID].Folder != "done" || remote[plan.ID].Title != "Plan" {
+		t.Errorf("Local move not uploaded: %+v", remote[plan.ID])
+	}
+	expectActions(t, runSync(t, root, remote))
+
+	// Conflict
+	plan = remote[plan.ID]
+	plan.Body, plan.Modified = "remote plan", time.Now().Add(time.Second)
+	remote[plan.ID] = plan
+	content, _ = ioutil.ReadFile(filepath.Join(root, "done/Plan.md"))
+	writeFile(t, root, "done/Plan.md", string(content)+" local")
+	expectActions(t, runSync(t, root, remote),
+		"conflict done/Plan.md (local copy saved as done/Plan (conflict 2017-06-01).md)")
+	if n := readNote(t, root, "done/Plan.md"); n.Body != "remote plan" {
+		t.Errorf("Conflict didn't keep remote version: %q", n.Body)
+	}
+	if n := readNote(t, root, "done/Plan (conflict 2017-06-01).md"); n.ID != uuid.Nil || n.Body != "plan local" {
+		t.Errorf("Conflict copy wrong: %+v", n)
+	}
+	expectActions(t, runSync(t, root, remote), "create done/Plan (conflict 2017-06-01).md")
+
+	// Deletions on each side
+	delete(remote, list.ID)
+	if err = os.Remove(filepath.Join(root, "Ideas.md")); err != nil {
+		t.Fatal(err)
+	}
+	expectActions(t, runSync(t, root, remote), "delete local Shopping List.md", "delete remote Ideas.md")
+	if exists(root, "Shopping List.md") {
+		t.Error("Remote deletion not applied")
+	}
+	if _, ok := remote[ideas.ID]; ok {
+		t.Error("Local deletion not applied")
+	}
+	expectActions(t, runSync(t, root, remote))
+}
+
+func TestPlanNames(t *testing.T) {
+	now := time.Now()
+	a := notes.Note{ID: uuid.NewV4(), Title: "Same", Created: now, Modified: now}
+	b := notes.Note{ID: uuid.NewV4(), Title: "Same", Created: now, Modified: now}
+	c := notes.Note{ID: uuid.NewV4(), Title: "either/or", Folder: "x/y", Created: now, Modified: now}
+	d := notes.Note{ID: uuid.NewV4(), Title: "Escape", Folder: "../../x/./", Created: now, Modified: now}
+	local := []LocalFile{{Path: "Same.md", Note: notes.Note{ID: a.ID, Modified: now}}}
+	actions := Plan(State{Notes: map[uuid.UUID]Entry{}}, local, []notes.Note{a, b, c, d}, now)
+	paths := make(map[uuid.UUID]string)
+	for _, act := range actions {
+		paths[act.ID] = act.Path
+	}
+	if paths[a.ID] != "Same.md" {
+		t.Errorf("Existing file should keep its name, got %q", paths[a.ID])
+	}
+	if expected := "Same (" + b.ID.String()[:8] + ").md"; paths[b.ID] != expected {
+		t.Errorf("Duplicate title got %q, expected %q", paths[b.ID], expected)
+	}
+	if paths[c.ID] != "x/y/either-or.md" {
+		t.Errorf("Got %q for note in folder", paths[c.ID])
+	}
+	if paths[d.ID] != "x/Escape.md" {
+		t.Errorf("Got %q for note in relative folder", paths[d.ID])
+	}
+}
+
+func TestOutsideRoot(t *testing.T) {
+	root, err := ioutil.TempDir("", "notesync")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	s := &syncer{root: filepath.Join(root, "sync")}
+	for _, name := range []string{"../escape.md", "a/../../escape.md", ".."} {
+		if err = s.writeFile(name, []byte("escaped"), time.Time{}); err != errOutsideRoot {
+			t.Errorf("writeFile(%q) returned %v", name, err)
+		}
+		if err = s.remove(name); err != errOutsideRoot {
+			t.Errorf("remove(%q) returned %v", name, err)
+		}
+	}
+	if exists(root, "escape.md") {
+		t.Error("File written outside the sync directory")
+	}
+}
+
+func TestPush(t *testing.T) {
+	root, err := ioutil.TempDir("", "notesync")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	remote := fakeRemote{}
+	state := State{Notes: make(map[uuid.UUID]Entry)}
+	push := func(name string, uploaded bool) notes.Note {
+		t.Helper()
+		note, ok, err := Push(root, &state, name, remote)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok != uploaded {
+			t.Errorf("Push %s uploaded %t, expected %t", name, ok, uploaded)
+		}
+		return note
+	}
+
+	writeFile(t, root, "work/Todo.md", "first")
+	created := push("work/Todo.md", true)
+	if created.Folder != "work" || created.Title != "Todo" || remote[created.ID].Body != "first" {
+		t.Errorf("Created note wrong: %+v", created)
+	}
+	push("work/Todo.md", false)
+	writeFile(t, root, "work/Todo.md", "second")
+	if n := push("work/Todo.md", true); n.ID != created.ID || remote[created.ID].Body != "second" {
+		t.Errorf("Updated note wrong: %+v", n)
+	}
+	if err = state.Save(root); err != nil {
+		t.Fatal(err)
+	}
+	// Sync matches the file without front matter by its path.
+	expectActions(t, runSync(t, root, remote))
+
+	// A file with front matter is matched by its ID, wherever it is.
+	note := remote[created.ID]
+	note.Body = "third"
+	content, _ := note.MarshalMarkdown()
+	if err = os.Remove(filepath.Join(root, "work/Todo.md")); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, root, "Todo.md", string(content))
+	if n := push("Todo.md", true); n.ID != created.ID || n.Folder != "" || n.Body != "third" {
+		t.Errorf("Moved note wrong: %+v", n)
+	}
+
+	note = remote[created.ID]
+	note.Modified = time.Now().Add(time.Minute)
+	remote[note.ID] = note
+	writeFile(t, root, "Todo.md", strings.Replace(readFileString(t, root, "Todo.md"), "third", "fourth", 1))
+	if _, _, err = Push(root, &state, "Todo.md", remote); err != ErrRemoteChanged {
+		t.Errorf("Push over a remote change returned %v", err)
+	}
+}
+
+func readFileString(t *testing.T, root, name string) string {
+	t.Helper()
+	b, err := ioutil.ReadFile(filepath.Join(root, filepath.FromSlash(name)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
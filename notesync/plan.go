@@ -0,0 +1,236 @@
+package notesync
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+
+	"github.com/aprice/freenote/notes"
+)
+
+// Kind is a type of sync action.
+type Kind string
+
+const (
+	// KindDownload writes a note from the server to a local file, moving the
+	// file if the note was renamed or moved.
+	KindDownload Kind = "download"
+	// KindUpload updates a note on the server from a local file, renaming or
+	// moving it if the file was.
+	KindUpload Kind = "upload"
+	// KindCreate creates a new note on the server from a local file.
+	KindCreate Kind = "create"
+	// KindDeleteLocal deletes the local file of a note deleted on the server.
+	KindDeleteLocal Kind = "delete local"
+	// KindDeleteRemote deletes a note on the server whose local file was deleted.
+	KindDeleteRemote Kind = "delete remote"
+	// KindConflict downloads a note changed on both sides, saving the local
+	// version as a conflict copy, which is created as a new note on the next
+	// sync.
+	KindConflict Kind = "conflict"
+	// KindTrack records a local file that already matches the server.
+	KindTrack Kind = "track"
+	// KindForget drops a note deleted on both sides from the state.
+	KindForget Kind = "forget"
+)
+
+// Action is a single step in syncing a directory.
+type Action struct {
+	Kind Kind
+	// ID is the note's ID, or Nil for a new note.
+	ID uuid.UUID
+	// Path is the local file the action reads or writes.
+	Path string
+	// OldPath is the note's previous local path, if it's being renamed or moved.
+	OldPath string
+	// CopyPath is where the local version is saved in a conflict.
+	CopyPath string
+	Local    *LocalFile
+	Remote   *notes.Note
+}
+
+func (a Action) String() string {
+	s := string(a.Kind) + " " + a.Path
+	if a.OldPath != "" && a.OldPath != a.Path {
+		s += " (from " + a.OldPath + ")"
+	}
+	if a.CopyPath != "" {
+		s += " (local copy saved as " + a.CopyPath + ")"
+	}
+	return s
+}
+
+// Plan works out the actions needed to sync a directory, given the state at
+// the last sync, the local files, and the notes on the server. The notes only
+// need metadata; bodies are ignored.
+func Plan(state State, local []LocalFile, remote []notes.Note, now time.Time) []Action {
+	p := &planner{taken: make(map[string]bool), now: now}
+	remoteByID := make(map[uuid.UUID]*notes.Note, len(remote))
+	for i := range remote {
+		remoteByID[remote[i].ID] = &remote[i]
+	}
+
+	// Local files are matched to notes by the ID in their front matter, or
+	// failing that by their last-synced path, as files uploaded by Push have
+	// no front matter. If a file was copied, the copy at the last-synced path
+	// keeps the note, and the others become new notes.
+	localByID := make(map[uuid.UUID]*LocalFile, len(local))
+	var added []*LocalFile
+	for i := range local {
+		lf := &local[i]
+		id := lf.Note.ID
+		if id == uuid.Nil {
+			id = state.byPath(lf.Path)
+		}
+		if id == uuid.Nil {
+			added = append(added, lf)
+			continue
+		}
+		_, inState := state.Notes[id]
+		if !inState && remoteByID[id] == nil {
+			added = append(added, lf)
+		} else if prev, ok := localByID[id]; !ok {
+			localByID[id] = lf
+		} else if state.Notes[id].Path == lf.Path {
+			localByID[id] = lf
+			added = append(added, prev)
+		} else {
+			added = append(added, lf)
+		}
+	}
+
+	ids := make(map[uuid.UUID]bool)
+	for id := range state.Notes {
+		ids[id] = true
+	}
+	for id := range localByID {
+		ids[id] = true
+	}
+	for id := range remoteByID {
+		ids[id] = true
+	}
+	sorted := make([]uuid.UUID, 0, len(ids))
+	for id := range ids {
+		sorted = append(sorted, id)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].String() < sorted[j].String() })
+
+	for _, id := range sorted {
+		entry, inState := state.Notes[id]
+		lf, rn := localByID[id], remoteByID[id]
+		if !inState {
+			switch {
+			case lf != nil && rn != nil && sameTime(lf.Note.Modified, rn.Modified):
+				p.keep(Action{Kind: KindTrack, ID: id, Path: lf.Path, Local: lf, Remote: rn})
+			case lf != nil && rn != nil:
+				p.later(Action{Kind: KindConflict, ID: id, OldPath: lf.Path, Local: lf, Remote: rn})
+			case rn != nil:
+				p.later(Action{Kind: KindDownload, ID: id, Remote: rn})
+			}
+			continue
+		}
+		localChanged := lf == nil || lf.Hash != entry.Hash || lf.Path != entry.Path
+		remoteChanged := rn == nil || !sameTime(rn.Modified, entry.Modified)
+		switch {
+		case !localChanged && !remoteChanged:
+			p.taken[lf.Path] = true
+		case !remoteChanged && lf == nil:
+			p.actions = append(p.actions, Action{Kind: KindDeleteRemote, ID: id, Path: entry.Path, Remote: rn})
+		case !remoteChanged:
+			p.keep(Action{Kind: KindUpload, ID: id, Path: lf.Path, OldPath: entry.Path, Local: lf, Remote: rn})
+		case !localChanged && rn == nil:
+			p.actions = append(p.actions, Action{Kind: KindDeleteLocal, ID: id, Path: lf.Path})
+		case !localChanged:
+			p.later(Action{Kind: KindDownload, ID: id, OldPath: lf.Path, Remote: rn})
+		case lf == nil && rn == nil:
+			p.actions = append(p.actions, Action{Kind: KindForget, ID: id, Path: entry.Path})
+		case lf == nil:
+			// Deleted locally but changed on the server: restore it.
+			p.later(Action{Kind: KindDownload, ID: id, Remote: rn})
+		case rn == nil:
+			// Deleted on the server but changed locally: recreate it.
+			p.keep(Action{Kind: KindCreate, ID: id, Path: lf.Path, Local: lf})
+		default:
+			p.later(Action{Kind: KindConflict, ID: id, OldPath: lf.Path, Local: lf, Remote: rn})
+		}
+	}
+	for _, lf := range added {
+		p.keep(Action{Kind: KindCreate, Path: lf.Path, Local: lf})
+	}
+
+	// Notes being written locally get paths once every file staying where it
+	// is has been accounted for.
+	for _, a := range p.pending {
+		a.Path = p.notePath(a.Remote, a.OldPath)
+		if a.Kind == KindConflict {
+			a.CopyPath = p.copyPath(a.Local.Path)
+		}
+		p.actions = append(p.actions, a)
+	}
+	return p.actions
+}
+
+type planner struct {
+	actions []Action
+	pending []Action
+	taken   map[string]bool
+	now     time.Time
+}
+
+// keep adds an action which leaves the local file where it is.
+func (p *planner) keep(a Action) {
+	p.taken[a.Path] = true
+	p.actions = append(p.actions, a)
+}
+
+// later adds an action which needs a local path for a note.
+func (p *planner) later(a Action) {
+	p.pending = append(p.pending, a)
+}
+
+// notePath picks a local path for a note, keeping its current path if it
+// still fits the note's title and folder.
+func (p *planner) notePath(note *notes.Note, current string) string {
+	dir := cleanFolder(note.Folder)
+	base := notes.FileName(note.Title)
+	unique := base + " (" + note.ID.String()[:8] + ")"
+	if current != "" && !p.taken[current] && folder(current) == dir {
+		if s := stem(current); s == base || s == unique {
+			p.taken[current] = true
+			return current
+		}
+	}
+	name := path.Join(dir, base+noteExt)
+	if p.taken[name] {
+		name = path.Join(dir, unique+noteExt)
+	}
+	p.taken[name] = true
+	return name
+}
+
+// cleanFolder makes a note folder safe to use as a local path, dropping empty,
+// . and .. parts, so notes are never written outside the sync directory.
+func cleanFolder(folder string) string {
+	var parts []string
+	for _, part := range strings.Split(folder, "/") {
+		if part != "" && part != "." && part != ".." {
+			parts = append(parts, part)
+		}
+	}
+	return strings.Join(parts, "/")
+}
+
+// copyPath picks a path for the conflict copy of a local file.
+func (p *planner) copyPath(name string) string {
+	base := path.Join(folder(name), stem(name)+" (conflict "+p.now.Format("2006-01-02")+")")
+	copyName := base + noteExt
+	for i := 2; p.taken[copyName]; i++ {
+		copyName = fmt.Sprintf("%s %d%s", base, i, noteExt)
+	}
+	p.taken[copyName] = true
+	return copyName
+}
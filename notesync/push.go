@@ -0,0 +1,71 @@
+package notesync
+
+import (
+	"errors"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+
+	"github.com/aprice/freenote/notes"
+)
+
+// ErrRemoteChanged is returned by Push when the note has changed on the server
+// since the file was last synced, so uploading it would lose those changes.
+var ErrRemoteChanged = errors.New("note changed on the server since it was last synced")
+
+// Push uploads a single local file, given its slash-separated path relative to
+// the root, and records it in the state as synced. The file is matched to a
+// note like in Plan, and a new note is created if there is none. Unlike Apply,
+// the file is never rewritten, so it can be used while the file is being
+// edited. Push reports whether anything was uploaded; a file unchanged since
+// it was last synced is skipped.
+func Push(root string, state *State, name string, remote Remote) (notes.Note, bool, error) {
+	lf, err := ReadFile(root, name)
+	if err != nil {
+		return notes.Note{}, false, err
+	}
+	id, base := lf.Note.ID, lf.Note.Modified
+	if id == uuid.Nil {
+		id = state.byPath(name)
+	}
+	if entry, ok := state.Notes[id]; ok {
+		if entry.Path == name && entry.Hash == lf.Hash {
+			return notes.Note{}, false, nil
+		}
+		base = entry.Modified
+	}
+
+	var saved notes.Note
+	if id == uuid.Nil {
+		now := time.Now()
+		note := notes.Note{
+			Folder:   folder(name),
+			Title:    stem(name),
+			Created:  lf.Note.Created,
+			Modified: now,
+		}
+		if note.Created.IsZero() {
+			note.Created = now
+		}
+		lf.merge(&note)
+		if saved, err = remote.Create(note); err != nil {
+			return notes.Note{}, false, err
+		}
+	} else {
+		note, err := remote.Get(id)
+		if err != nil {
+			return notes.Note{}, false, err
+		}
+		if !base.IsZero() && !sameTime(base, note.Modified) {
+			return note, false, ErrRemoteChanged
+		}
+		note.Folder, note.Title = folder(name), title(name, id)
+		lf.merge(&note)
+		note.Modified = time.Now()
+		if saved, err = remote.Update(note); err != nil {
+			return notes.Note{}, false, err
+		}
+	}
+	state.Notes[saved.ID] = Entry{Path: name, Modified: saved.Modified, Hash: lf.Hash}
+	return saved, true, nil
+}
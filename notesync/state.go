@@ -0,0 +1,89 @@
+// Package notesync keeps a local directory tree of markdown files in two-way
+// sync with a user's notes. Folders are directories, and each note is a
+// Title.md file with front matter identifying it.
+package notesync
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+// StateFile is the name of the file in the root of a synced directory that
+// records the last-synced version of each note.
+const StateFile = ".freenote-sync.json"
+
+// Entry is the last-synced version of a note.
+type Entry struct {
+	// Path is the slash-separated path of the note's file, relative to the
+	// root of the synced directory.
+	Path string `json:"path"`
+	// Modified is the note's modification time on the server.
+	Modified time.Time `json:"modified"`
+	// Hash identifies the content of the local file.
+	Hash string `json:"hash"`
+}
+
+// State is the last-synced version of every note in a synced directory.
+type State struct {
+	Notes map[uuid.UUID]Entry `json:"notes"`
+}
+
+// LoadState reads the state file in a synced directory. A directory which
+// hasn't been synced yet has an empty state.
+func LoadState(root string) (State, error) {
+	state := State{Notes: make(map[uuid.UUID]Entry)}
+	b, err := ioutil.ReadFile(filepath.Join(root, StateFile))
+	if os.IsNotExist(err) {
+		return state, nil
+	} else if err != nil {
+		return state, err
+	}
+	if err = json.Unmarshal(b, &state); err != nil {
+		return state, err
+	}
+	if state.Notes == nil {
+		state.Notes = make(map[uuid.UUID]Entry)
+	}
+	return state, nil
+}
+
+// Save writes the state file to a synced directory.
+func (s State) Save(root string) error {
+	b, err := json.MarshalIndent(s, "", "\t")
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(root, StateFile+".tmp")
+	if err = ioutil.WriteFile(tmp, b, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(root, StateFile))
+}
+
+// byPath returns the ID of the note last synced to a path, or uuid.Nil.
+func (s State) byPath(name string) uuid.UUID {
+	for id, entry := range s.Notes {
+		if entry.Path == name {
+			return id
+		}
+	}
+	return uuid.Nil
+}
+
+func hash(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// sameTime compares modification times to the millisecond, as some stores
+// don't keep more precision than that.
+func sameTime(a, b time.Time) bool {
+	return a.Truncate(time.Millisecond).Equal(b.Truncate(time.Millisecond))
+}
@@ -0,0 +1,249 @@
+// Package oidc implements the OpenID Connect authorization code flow, with
+// PKCE, for logging in through an external identity provider.
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrProvider indicates the identity provider returned an error or an invalid
+// response.
+var ErrProvider = errors.New("identity provider error")
+
+// Default scopes requested if none are configured.
+var defaultScopes = []string{"openid", "profile", "email"}
+
+// Keys are refetched at most this often when a token uses an unknown key.
+const keyRefreshInterval = time.Minute
+
+const discoveryPath = "/.well-known/openid-configuration"
+
+// Config identifies an identity provider and this client's registration with it.
+type Config struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	Scopes       []string
+}
+
+// Provider is an OpenID Connect identity provider. Provider metadata and keys
+// are fetched on first use and cached. It is safe for concurrent use.
+type Provider struct {
+	conf   Config
+	client *http.Client
+
+	mu          sync.Mutex
+	meta        *metadata
+	keys        map[string]*rsa.PublicKey
+	keysFetched time.Time
+}
+
+type metadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// NewProvider creates a Provider with the given configuration. If client is
+// nil, http.DefaultClient is used. No requests are made until the Provider is
+// used.
+func NewProvider(conf Config, client *http.Client) *Provider {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	if len(conf.Scopes) == 0 {
+		conf.Scopes = defaultScopes
+	}
+	conf.Issuer = strings.TrimSuffix(conf.Issuer, "/")
+	return &Provider{conf: conf, client: client}
+}
+
+// AuthURL returns the provider URL to send the user to for login. The state
+// and nonce should be random values from RandomToken, and challenge should be
+// from Challenge.
+func (p *Provider) AuthURL(ctx context.Context, redirectURI, state, nonce, challenge string) (string, error) {
+	meta, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+	q := url.Values{}
+	q.Set("response_type", "code")
+	q.Set("client_id", p.conf.ClientID)
+	q.Set("redirect_uri", redirectURI)
+	q.Set("scope", strings.Join(p.conf.Scopes, " "))
+	q.Set("state", state)
+	q.Set("nonce", nonce)
+	q.Set("code_challenge", challenge)
+	q.Set("code_challenge_method", "S256")
+	sep := "?"
+	if strings.Contains(meta.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return meta.AuthorizationEndpoint + sep + q.Encode(), nil
+}
+
+// Exchange redeems an authorization code for tokens, returning the raw ID
+// token. The ID token must be checked with Verify before use.
+func (p *Provider) Exchange(ctx context.Context, code, verifier, redirectURI string) (string, error) {
+	meta, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", redirectURI)
+	form.Set("code_verifier", verifier)
+	form.Set("client_id", p.conf.ClientID)
+	req, err := http.NewRequest(http.MethodPost, meta.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.conf.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.conf.ClientID), url.QueryEscape(p.conf.ClientSecret))
+	}
+	var tokens struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	res, err := p.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	err = json.NewDecoder(res.Body).Decode(&tokens)
+	if res.StatusCode != http.StatusOK || tokens.Error != "" {
+		return "", fmt.Errorf("%v: token request failed with %d %s %s", ErrProvider, res.StatusCode, tokens.Error, tokens.ErrorDescription)
+	} else if err != nil {
+		return "", err
+	}
+	if tokens.IDToken == "" {
+		return "", fmt.Errorf("%v: no ID token returned", ErrProvider)
+	}
+	return tokens.IDToken, nil
+}
+
+// discover fetches and caches the provider's metadata.
+func (p *Provider) discover(ctx context.Context) (*metadata, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.meta != nil {
+		return p.meta, nil
+	}
+	meta := new(metadata)
+	if err := p.getJSON(ctx, p.conf.Issuer+discoveryPath, meta); err != nil {
+		return nil, err
+	}
+	if strings.TrimSuffix(meta.Issuer, "/") != p.conf.Issuer {
+		return nil, fmt.Errorf("%v: issuer %q does not match configured issuer %q", ErrProvider, meta.Issuer, p.conf.Issuer)
+	}
+	if meta.AuthorizationEndpoint == "" || meta.TokenEndpoint == "" || meta.JWKSURI == "" {
+		return nil, fmt.Errorf("%v: incomplete provider metadata", ErrProvider)
+	}
+	p.meta = meta
+	return meta, nil
+}
+
+// key returns the provider's signing key with the given ID, refreshing the
+// cached key set if the key is unknown, e.g. after the provider rotates keys.
+func (p *Provider) key(ctx context.Context, kid string) (*rsa.PublicKey, error) {
+	meta, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if key, ok := p.keys[kid]; ok {
+		return key, nil
+	}
+	if time.Since(p.keysFetched) < keyRefreshInterval {
+		return nil, ErrUnknownKey
+	}
+	var jwks struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Use string `json:"use"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	if err = p.getJSON(ctx, meta.JWKSURI, &jwks); err != nil {
+		return nil, err
+	}
+	p.keysFetched = time.Now()
+	p.keys = make(map[string]*rsa.PublicKey, len(jwks.Keys))
+	for _, k := range jwks.Keys {
+		if k.Kty != "RSA" || (k.Use != "" && k.Use != "sig") {
+			continue
+		}
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			continue
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil || len(e) > 4 {
+			continue
+		}
+		p.keys[k.Kid] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+	if key, ok := p.keys[kid]; ok {
+		return key, nil
+	}
+	return nil, ErrUnknownKey
+}
+
+func (p *Provider) getJSON(ctx context.Context, uri string, out interface{}) error {
+	req, err := http.NewRequest(http.MethodGet, uri, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	res, err := p.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(res.Body)
+		return fmt.Errorf("%v: GET %s returned %d %s", ErrProvider, uri, res.StatusCode, body)
+	}
+	return json.NewDecoder(res.Body).Decode(out)
+}
+
+// RandomToken returns a random URL-safe string, for use as a state, nonce, or
+// PKCE code verifier.
+func RandomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// Challenge returns the PKCE S256 code challenge for a code verifier.
+func Challenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
@@ -0,0 +1,121 @@
+package oidc_test
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aprice/freenote/oidc"
+	"github.com/aprice/freenote/oidc/oidctest"
+)
+
+const testRedirect = "http://localhost/callback"
+
+func TestLoginFlow(t *testing.T) {
+	mock := oidctest.NewProvider("freenote", "secret")
+	defer mock.Close()
+	mock.SetClaims(map[string]interface{}{"sub": "alice", "groups": []string{"staff"}})
+	p := oidc.NewProvider(mock.Config(), nil)
+	ctx := context.Background()
+
+	verifier, _ := oidc.RandomToken()
+	authURL, err := p.AuthURL(ctx, testRedirect, "state", "nonce", oidc.Challenge(verifier))
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	res, err := client.Get(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	loc, err := url.Parse(res.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loc.Query().Get("state") != "state" {
+		t.Errorf("state not returned, got %q", loc.Query().Get("state"))
+	}
+	code := loc.Query().Get("code")
+
+	if _, err = p.Exchange(ctx, code, "wrong-verifier", testRedirect); err == nil {
+		t.Fatal("exchange succeeded with wrong PKCE verifier")
+	}
+	// Codes are single-use, so get another
+	res, _ = client.Get(authURL)
+	res.Body.Close()
+	loc, _ = url.Parse(res.Header.Get("Location"))
+	raw, err := p.Exchange(ctx, loc.Query().Get("code"), verifier, testRedirect)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := p.Verify(ctx, raw, "nonce", time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.Subject() != "alice" {
+		t.Errorf("expected subject alice, got %q", claims.Subject())
+	}
+	if groups := claims.Strings("groups"); len(groups) != 1 || groups[0] != "staff" {
+		t.Errorf("expected groups [staff], got %v", groups)
+	}
+	if _, err = p.Verify(ctx, raw, "other-nonce", time.Now()); err != oidc.ErrInvalidToken {
+		t.Errorf("expected nonce mismatch to fail, got %v", err)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	mock := oidctest.NewProvider("freenote", "secret")
+	defer mock.Close()
+	p := oidc.NewProvider(mock.Config(), nil)
+	ctx := context.Background()
+	now := time.Now()
+	base := func() map[string]interface{} {
+		return map[string]interface{}{
+			"iss":   mock.URL,
+			"sub":   "alice",
+			"aud":   "freenote",
+			"iat":   now.Unix(),
+			"exp":   now.Add(time.Hour).Unix(),
+			"nonce": "n",
+		}
+	}
+	if _, err := p.Verify(ctx, mock.Sign(base()), "n", now); err != nil {
+		t.Fatalf("valid token rejected: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		modify func(map[string]interface{})
+	}{
+		{"expired", func(c map[string]interface{}) { c["exp"] = now.Add(-time.Hour).Unix() }},
+		{"future", func(c map[string]interface{}) { c["iat"] = now.Add(time.Hour).Unix() }},
+		{"issuer", func(c map[string]interface{}) { c["iss"] = "https://evil.example.com" }},
+		{"audience", func(c map[string]interface{}) { c["aud"] = "other" }},
+		{"azp", func(c map[string]interface{}) { c["aud"] = []string{"freenote", "other"}; c["azp"] = "other" }},
+		{"subject", func(c map[string]interface{}) { delete(c, "sub") }},
+	}
+	for _, tt := range tests {
+		claims := base()
+		tt.modify(claims)
+		if _, err := p.Verify(ctx, mock.Sign(claims), "n", now); err == nil {
+			t.Errorf("%s: invalid token accepted", tt.name)
+		}
+	}
+
+	parts := strings.Split(mock.Sign(base()), ".")
+	forged := mock.Sign(map[string]interface{}{"sub": "mallory"})
+	tampered := parts[0] + "." + strings.Split(forged, ".")[1] + "." + parts[2]
+	if _, err := p.Verify(ctx, tampered, "n", now); err == nil {
+		t.Error("tampered token accepted")
+	}
+	unsigned := "eyJhbGciOiJub25lIn0." + parts[1] + "."
+	if _, err := p.Verify(ctx, unsigned, "n", now); err == nil {
+		t.Error("unsigned token accepted")
+	}
+}
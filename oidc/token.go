@@ -0,0 +1,152 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+// ErrInvalidToken indicates a malformed ID token, or one that failed
+// validation.
+var ErrInvalidToken = errors.New("invalid ID token")
+
+// ErrUnknownKey indicates an ID token was signed with a key the provider does
+// not publish.
+var ErrUnknownKey = errors.New("ID token signed with unknown key")
+
+// Allowed clock difference between this server and the provider.
+const clockSkew = time.Minute
+
+// Claims holds the claims from a verified ID token.
+type Claims map[string]interface{}
+
+// String returns the named claim if it is a string, or "" otherwise.
+func (c Claims) String(name string) string {
+	s, _ := c[name].(string)
+	return s
+}
+
+// Strings returns the named claim as a list of strings. A single string claim
+// is returned as a list of one.
+func (c Claims) Strings(name string) []string {
+	switch v := c[name].(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		out := make([]string, 0, len(v))
+		for _, s := range v {
+			if s, ok := s.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	default:
+		return nil
+	}
+}
+
+// Bool returns the named claim if it is a boolean, or the string "true", or
+// false otherwise.
+func (c Claims) Bool(name string) bool {
+	switch v := c[name].(type) {
+	case bool:
+		return v
+	case string:
+		return v == "true"
+	}
+	return false
+}
+
+// Subject returns the subject identifier, which is unique per issuer.
+func (c Claims) Subject() string {
+	return c.String("sub")
+}
+
+// Issuer returns the issuer identifier.
+func (c Claims) Issuer() string {
+	return c.String("iss")
+}
+
+func (c Claims) time(name string) (time.Time, bool) {
+	f, ok := c[name].(float64)
+	if !ok {
+		return time.Time{}, false
+	}
+	return time.Unix(int64(f), 0), true
+}
+
+// Verify checks an ID token's signature against the provider's published
+// keys, and validates its issuer, audience, expiry, and nonce. It returns the
+// token's claims if valid.
+func (p *Provider) Verify(ctx context.Context, rawIDToken, nonce string, now time.Time) (Claims, error) {
+	parts := strings.Split(rawIDToken, ".")
+	if len(parts) != 3 {
+		return nil, ErrInvalidToken
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, ErrInvalidToken
+	}
+	// Only RS256 is supported; it is required of all providers.
+	if header.Alg != "RS256" {
+		return nil, ErrInvalidToken
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	key, err := p.key(ctx, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err = rsa.VerifyPKCS1v15(key, crypto.SHA256, sum[:], sig); err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	claims := Claims{}
+	if err = decodeSegment(parts[1], &claims); err != nil {
+		return nil, ErrInvalidToken
+	}
+	if strings.TrimSuffix(claims.Issuer(), "/") != p.conf.Issuer || claims.Subject() == "" {
+		return nil, ErrInvalidToken
+	}
+	aud := claims.Strings("aud")
+	found := false
+	for _, a := range aud {
+		found = found || a == p.conf.ClientID
+	}
+	if !found {
+		return nil, ErrInvalidToken
+	}
+	if azp := claims.String("azp"); len(aud) > 1 && azp != p.conf.ClientID {
+		return nil, ErrInvalidToken
+	}
+	if exp, ok := claims.time("exp"); !ok || now.After(exp.Add(clockSkew)) {
+		return nil, ErrInvalidToken
+	}
+	if iat, ok := claims.time("iat"); ok && iat.After(now.Add(clockSkew)) {
+		return nil, ErrInvalidToken
+	}
+	if claims.String("nonce") != nonce {
+		return nil, ErrInvalidToken
+	}
+	return claims, nil
+}
+
+func decodeSegment(seg string, out interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, out)
+}
@@ -2,6 +2,7 @@ package page
 
 import (
 	"fmt"
+	"math"
 	"net/url"
 	"strconv"
 	"strings"
@@ -17,6 +18,14 @@ type Page struct {
 	SortBy         string `json:"-"`
 }
 
+// MaxLength is the page length used to request every record.
+const MaxLength = math.MaxInt32
+
+// All returns a Page covering every record, sorted by the given field.
+func All(sortBy string) Page {
+	return Page{Length: MaxLength, SortBy: sortBy}
+}
+
 // QueryString returns the query string to retrieve this Page.
 func (p Page) QueryString() string {
 	var direction string
@@ -0,0 +1,88 @@
+package reminders
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/aprice/freenote/notes"
+)
+
+// ContentTypeICS is the media type of iCalendar feeds.
+const ContentTypeICS = "text/calendar; charset=utf-8"
+
+const icsTimeFormat = "20060102T150405Z"
+
+var rrules = map[notes.Recurrence]string{
+	notes.RecurDaily:   "FREQ=DAILY",
+	notes.RecurWeekly:  "FREQ=WEEKLY",
+	notes.RecurMonthly: "FREQ=MONTHLY",
+	notes.RecurYearly:  "FREQ=YEARLY",
+}
+
+// WriteICS writes reminders as an iCalendar (RFC 5545) feed, with an event and
+// alarm for each. Repeating reminders become repeating events. ownerURI is the
+// URI of the user or group that owns the reminders' notes.
+func WriteICS(w io.Writer, items []notes.ReminderItem, ownerURI string) error {
+	bw := bufio.NewWriter(w)
+	line := func(name, value string) {
+		writeFolded(bw, name+":"+value)
+	}
+	stamp := time.Now().UTC().Format(icsTimeFormat)
+	line("BEGIN", "VCALENDAR")
+	line("VERSION", "2.0")
+	line("PRODID", "-//Freenote//Reminders//EN")
+	line("X-WR-CALNAME", "Freenote reminders")
+	for _, item := range items {
+		summary := item.Message
+		if summary == "" {
+			summary = item.NoteTitle
+		}
+		line("BEGIN", "VEVENT")
+		line("UID", item.ID.String()+"@freenote")
+		line("DTSTAMP", stamp)
+		line("DTSTART", item.Time.UTC().Format(icsTimeFormat))
+		if rule, ok := rrules[item.Recurrence]; ok {
+			line("RRULE", rule)
+		}
+		line("SUMMARY", icsText(summary))
+		line("DESCRIPTION", icsText(item.NoteTitle))
+		line("URL", NoteURL(ownerURI, item))
+		line("BEGIN", "VALARM")
+		line("ACTION", "DISPLAY")
+		line("DESCRIPTION", icsText(summary))
+		line("TRIGGER", "PT0S")
+		line("END", "VALARM")
+		line("END", "VEVENT")
+	}
+	line("END", "VCALENDAR")
+	return bw.Flush()
+}
+
+var icsEscaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`, "\r", `\n`)
+
+// icsText escapes a TEXT property value.
+func icsText(s string) string {
+	return icsEscaper.Replace(s)
+}
+
+// writeFolded writes a content line, folded so no line is longer than 75
+// octets, without splitting UTF-8 sequences.
+func writeFolded(w *bufio.Writer, s string) {
+	limit := 75
+	for len(s) > limit {
+		n := limit
+		for n > 0 && !utf8.RuneStart(s[n]) {
+			n--
+		}
+		w.WriteString(s[:n])
+		w.WriteString("\r\n ")
+		s = s[n:]
+		// Continuation lines start with a space, which counts.
+		limit = 74
+	}
+	w.WriteString(s)
+	w.WriteString("\r\n")
+}
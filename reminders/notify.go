@@ -0,0 +1,122 @@
+package reminders
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/aprice/freenote/notes"
+	"github.com/aprice/freenote/users"
+)
+
+// Event is the payload posted to a reminder's webhook.
+type Event struct {
+	notes.ReminderItem
+	// URL is the note's URL in the REST API.
+	URL string `json:"url"`
+}
+
+// NoteURL returns the REST API URL of the note a reminder is on. ownerURI is
+// the URI of the user or group that owns the note, from rest.UserURI or
+// rest.GroupURI.
+func NoteURL(ownerURI string, item notes.ReminderItem) string {
+	return fmt.Sprintf("%s/notes/%s", ownerURI, item.Note)
+}
+
+// deliver sends a reminder by each means it asks for, with the URL of its note.
+// Email is skipped if the owner has no verified address or no mail server is
+// configured. It only fails if
+// nothing was sent, so that a reminder which reached its owner one way isn't
+// sent again that way when it's retried.
+func (s *Scheduler) deliver(item notes.ReminderItem, owner users.User, url string) error {
+	var (
+		sent bool
+		errs []string
+	)
+	if item.Email {
+		if !owner.EmailVerified || !s.mail.Configured() {
+			log.Printf("Not emailing reminder %s on note %s: no mail server or verified address", item.ID, item.Note)
+		} else if err := s.email(item, owner, url); err != nil {
+			errs = append(errs, "email: "+err.Error())
+		} else {
+			sent = true
+		}
+	}
+	if item.Webhook != "" {
+		if err := s.post(item, url); err != nil {
+			errs = append(errs, "webhook: "+err.Error())
+		} else {
+			sent = true
+		}
+	}
+	if len(errs) == 0 {
+		return nil
+	} else if sent {
+		log.Printf("Reminder %s on note %s only partly delivered: %s", item.ID, item.Note, strings.Join(errs, "; "))
+		return nil
+	}
+	return errors.New(strings.Join(errs, "; "))
+}
+
+// email sends a reminder to its owner through the configured mail server.
+func (s *Scheduler) email(item notes.ReminderItem, owner users.User, url string) error {
+	subject := "Reminder: " + item.NoteTitle
+	body := ""
+	if item.Message != "" {
+		subject = "Reminder: " + item.Message
+		body = item.Message + "\n\n"
+	}
+	body += item.NoteTitle + "\n" + url + "\n"
+	return s.mail.Send(owner.Email, subject, body)
+}
+
+// post sends a reminder to its webhook as a JSON Event.
+func (s *Scheduler) post(item notes.ReminderItem, url string) error {
+	body, err := json.Marshal(Event{item, url})
+	if err != nil {
+		return err
+	}
+	res, err := s.client.Post(item.Webhook, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("webhook responded %s", res.Status)
+	}
+	return nil
+}
+
+// errWebhookAddress indicates a webhook whose host resolved to an address that
+// isn't public.
+var errWebhookAddress = errors.New("webhook address is not public")
+
+// webhookClient returns an HTTP client for posting to webhooks, which only
+// connects to public addresses, whatever a webhook's host name resolves to.
+// Webhooks are never posted through a proxy, so the address can be checked.
+func webhookClient() *http.Client {
+	dialer := &net.Dialer{
+		Timeout: 10 * time.Second,
+		Control: func(network, address string, c syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !notes.PublicIP(ip) {
+				return errWebhookAddress
+			}
+			return nil
+		},
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &http.Client{Timeout: 10 * time.Second, Transport: transport}
+}
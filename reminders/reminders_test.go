@@ -0,0 +1,190 @@
+package reminders
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+
+	"github.com/aprice/freenote/config"
+	"github.com/aprice/freenote/notes"
+	"github.com/aprice/freenote/store"
+	"github.com/aprice/freenote/users"
+)
+
+func TestFire(t *testing.T) {
+	dir, err := ioutil.TempDir("", "reminders")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	conf := config.Config{
+		BaseURI:    "https://notes.example.com",
+		BoltDB:     filepath.Join(dir, "test.db"),
+		MailServer: config.ConnectionInfo{Host: "mail.example.com:25", Namespace: "freenote@example.com"},
+	}
+
+	var events []Event
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var ev Event
+		json.NewDecoder(r.Body).Decode(&ev)
+		events = append(events, ev)
+		if ev.Message == "flaky" || ev.Message == "half" {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer hook.Close()
+
+	now := time.Now().Truncate(time.Second)
+	user := users.New("alice")
+	user.Email, user.EmailVerified = "alice@example.com", true
+	note := notes.Note{ID: uuid.NewV4(), Owner: user.ID, Title: "Plans", Reminders: []notes.Reminder{
+		{ID: uuid.NewV4(), Time: now.Add(-time.Minute), Message: "once", Email: true, Webhook: hook.URL},
+		{ID: uuid.NewV4(), Time: now.Add(-25 * time.Hour), Recurrence: notes.RecurDaily, Message: "daily", Webhook: hook.URL},
+		{ID: uuid.NewV4(), Time: now.Add(-time.Minute), Message: "flaky", Webhook: hook.URL},
+		{ID: uuid.NewV4(), Time: now.Add(time.Hour), Message: "later", Webhook: hook.URL},
+		// Emailed, but its webhook fails.
+		{ID: uuid.NewV4(), Time: now.Add(-time.Minute), Message: "half", Email: true, Webhook: hook.URL},
+	}}
+	group := users.NewGroup("team", user.ID)
+	groupNote := notes.Note{ID: uuid.NewV4(), Owner: group.ID, Title: "Roadmap", Reminders: []notes.Reminder{
+		{ID: uuid.NewV4(), Time: now.Add(-time.Minute), Message: "team", Webhook: hook.URL},
+	}}
+	db, err := store.NewSession(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = db.UserStore().SaveUser(&user); err != nil {
+		t.Fatal(err)
+	}
+	if err = db.NoteStore().SaveNote(&note); err != nil {
+		t.Fatal(err)
+	}
+	if err = db.GroupStore().SaveGroup(&group); err != nil {
+		t.Fatal(err)
+	}
+	if err = db.NoteStore().SaveNote(&groupNote); err != nil {
+		t.Fatal(err)
+	}
+	db.(io.Closer).Close()
+
+	var mail []string
+	s := NewScheduler(conf)
+	// The test webhook is on loopback, which the scheduler's own client won't
+	// post to.
+	s.client = hook.Client()
+	s.mail.SendMail = func(addr string, a smtp.Auth, from string, to []string, msg []byte) error {
+		mail = append(mail, addr+" "+from+" "+strings.Join(to, ",")+"\n"+string(msg))
+		return nil
+	}
+	if err = s.fire(now); err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 5 {
+		t.Fatalf("Webhook got %d events, expected 5: %+v", len(events), events)
+	}
+	for _, ev := range events {
+		url := "https://notes.example.com/users/" + user.ID.String() + "/notes/" + note.ID.String()
+		if ev.Message == "team" {
+			url = "https://notes.example.com/groups/" + group.ID.String() + "/notes/" + groupNote.ID.String()
+		}
+		if ev.URL != url || ev.NoteTitle == "" {
+			t.Errorf("Event is %+v", ev)
+		}
+	}
+	if len(mail) != 2 || !strings.HasPrefix(mail[0], "mail.example.com:25 freenote@example.com alice@example.com\n") ||
+		!strings.Contains(mail[0], "Subject: Reminder: once\r\n") {
+		t.Errorf("Sent mail %q", mail)
+	}
+
+	db, _ = store.NewSession(conf)
+	saved, err := db.NoteStore().NoteByID(note.ID)
+	db.(io.Closer).Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := saved.Reminders
+	if !r[0].Done {
+		t.Errorf("One-off reminder not done: %+v", r[0])
+	}
+	if r[1].Done || !r[1].Time.Equal(note.Reminders[1].Time.AddDate(0, 0, 2)) {
+		t.Errorf("Daily reminder not advanced: %+v", r[1])
+	}
+	if r[2].Done || r[3].Done {
+		t.Errorf("Failed or later reminders changed: %+v, %+v", r[2], r[3])
+	}
+	if !r[4].Done {
+		t.Errorf("Partly delivered reminder not done: %+v", r[4])
+	}
+
+	// Fired reminders don't fire again; the failed one is retried.
+	events, mail = nil, nil
+	if err = s.fire(now); err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 || events[0].Message != "flaky" || len(mail) != 0 {
+		t.Errorf("Second run sent %+v and %d emails", events, len(mail))
+	}
+}
+
+func TestWebhookAddress(t *testing.T) {
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("Webhook on loopback was posted to")
+	}))
+	defer hook.Close()
+	s := NewScheduler(config.Config{})
+	// A host name that resolves to loopback is refused when dialed.
+	url := strings.Replace(hook.URL, "127.0.0.1", "localhost", 1)
+	if err := s.post(notes.ReminderItem{Reminder: notes.Reminder{Webhook: url}}, "https://notes.example.com"); !errors.Is(err, errWebhookAddress) {
+		t.Errorf("Post to %s returned %v", url, err)
+	}
+}
+
+func TestWriteICS(t *testing.T) {
+	item := notes.ReminderItem{
+		Reminder: notes.Reminder{
+			ID:         uuid.NewV4(),
+			Time:       time.Date(2026, 11, 1, 9, 30, 0, 0, time.FixedZone("EST", -5*3600)),
+			Recurrence: notes.RecurWeekly,
+			Message:    "Call Bob; bring notes, " + strings.Repeat("ü", 40),
+		},
+		Note:      uuid.NewV4(),
+		NoteTitle: "Plans",
+	}
+	buf := new(bytes.Buffer)
+	if err := WriteICS(buf, []notes.ReminderItem{item}, "https://notes.example.com/users/"+item.Owner.String()); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, expected := range []string{
+		"BEGIN:VCALENDAR\r\n",
+		"UID:" + item.ID.String() + "@freenote\r\n",
+		"DTSTART:20261101T143000Z\r\n",
+		"RRULE:FREQ=WEEKLY\r\n",
+		`SUMMARY:Call Bob\; bring notes\, ü`,
+		"\r\nEND:VCALENDAR\r\n",
+	} {
+		if !strings.Contains(out, expected) {
+			t.Errorf("Feed doesn't contain %q:\n%s", expected, out)
+		}
+	}
+	for _, line := range strings.Split(out, "\r\n") {
+		if len(line) > 75 {
+			t.Errorf("Line too long: %q", line)
+		}
+	}
+	if unfolded := strings.Replace(out, "\r\n ", "", -1); !strings.Contains(unfolded, "bring notes\\, "+strings.Repeat("ü", 40)+"\r\n") {
+		t.Errorf("Folded summary doesn't unfold:\n%s", out)
+	}
+}
@@ -0,0 +1,168 @@
+// Package reminders fires note reminders by email and webhook, and publishes
+// them as an iCalendar feed.
+package reminders
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+
+	"github.com/aprice/freenote/config"
+	"github.com/aprice/freenote/mail"
+	"github.com/aprice/freenote/notes"
+	"github.com/aprice/freenote/page"
+	"github.com/aprice/freenote/rest"
+	"github.com/aprice/freenote/store"
+	"github.com/aprice/freenote/users"
+)
+
+// DefaultInterval is how often the scheduler checks for due reminders.
+const DefaultInterval = time.Minute
+
+// GiveUpAfter is how long the scheduler keeps retrying a reminder that fails to
+// deliver before it moves on.
+const GiveUpAfter = 24 * time.Hour
+
+// Scheduler fires reminders when they're due. Reminders are kept with their
+// notes in the backing store, so reminders that came due while the server was
+// down fire when it starts.
+type Scheduler struct {
+	conf config.Config
+	// Interval is how often to check for due reminders.
+	Interval time.Duration
+
+	client *http.Client
+	mail   *mail.Sender
+	stop   chan struct{}
+	done   chan struct{}
+}
+
+// NewScheduler creates a scheduler for reminders in the configured store.
+func NewScheduler(conf config.Config) *Scheduler {
+	return &Scheduler{
+		conf:     conf,
+		Interval: DefaultInterval,
+		client:   webhookClient(),
+		mail:     mail.NewSender(conf.MailServer),
+	}
+}
+
+// Start checking for due reminders, starting now.
+func (s *Scheduler) Start() {
+	s.stop = make(chan struct{})
+	s.done = make(chan struct{})
+	go func() {
+		defer close(s.done)
+		ticker := time.NewTicker(s.Interval)
+		defer ticker.Stop()
+		for {
+			if err := s.fire(time.Now()); err != nil {
+				log.Println("failed to fire reminders: ", err)
+			}
+			select {
+			case <-s.stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Stop checking for reminders, waiting for any being delivered.
+func (s *Scheduler) Stop() {
+	close(s.stop)
+	<-s.done
+}
+
+// fire delivers the reminders due at now, then advances them. The store isn't
+// held while reminders are delivered.
+func (s *Scheduler) fire(now time.Time) error {
+	var (
+		due    []notes.ReminderItem
+		owners = make(map[uuid.UUID]users.User)
+		uris   = make(map[uuid.UUID]string)
+	)
+	err := s.withSession(func(db store.Session) error {
+		list, _, err := db.NoteStore().QueryNotes(store.NoteQuery{
+			ReminderBefore: now,
+			Page:           page.All("modified"),
+		})
+		if err != nil {
+			return err
+		}
+		due = notes.PendingReminders(list, now)
+		for _, item := range due {
+			if _, ok := uris[item.Owner]; ok {
+				continue
+			}
+			owner, err := db.UserStore().UserByID(item.Owner)
+			if err == store.ErrNotFound {
+				// Group-owned notes have the group as their owner.
+				uris[item.Owner] = rest.GroupURI(s.conf.BaseURI, item.Owner)
+				continue
+			} else if err != nil {
+				return err
+			}
+			owners[item.Owner] = owner
+			uris[item.Owner] = rest.UserURI(s.conf.BaseURI, item.Owner)
+		}
+		return nil
+	})
+	if err == store.ErrNotFound || len(due) == 0 {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	var fired []notes.ReminderItem
+	for _, item := range due {
+		if err = s.deliver(item, owners[item.Owner], NoteURL(uris[item.Owner], item)); err == nil {
+			fired = append(fired, item)
+		} else if now.Sub(item.Time) > GiveUpAfter {
+			log.Printf("Giving up on reminder %s on note %s: %s", item.ID, item.Note, err)
+			fired = append(fired, item)
+		} else {
+			log.Printf("Failed to deliver reminder %s on note %s, will retry: %s", item.ID, item.Note, err)
+		}
+	}
+	if len(fired) == 0 {
+		return nil
+	}
+
+	return s.withSession(func(db store.Session) error {
+		ns := db.NoteStore()
+		for _, item := range fired {
+			// Reload the note in case it changed during delivery, and leave
+			// reminders that were rescheduled in the meantime alone.
+			note, err := ns.NoteByID(item.Note)
+			if err == store.ErrNotFound {
+				continue
+			} else if err != nil {
+				return err
+			}
+			r := note.Reminder(item.ID)
+			if r == nil || r.Done || !r.Time.Equal(item.Time) {
+				continue
+			}
+			r.Advance(now)
+			if err = ns.SaveNote(&note); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *Scheduler) withSession(f func(store.Session) error) error {
+	db, err := store.NewSession(s.conf)
+	if err != nil {
+		return err
+	}
+	if closer, ok := db.(io.Closer); ok {
+		defer closer.Close()
+	}
+	return f(db)
+}
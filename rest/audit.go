@@ -0,0 +1,22 @@
+package rest
+
+import (
+	"github.com/aprice/freenote/audit"
+	"github.com/aprice/freenote/page"
+)
+
+// DecoratedAuditEntries represents a page of audit log entries with hypermedia
+// links for the collection.
+type DecoratedAuditEntries struct {
+	Links   Links         `json:"_links" xml:"Links>Link"`
+	Entries []audit.Entry `json:"entries" xml:"Page>Entry"`
+	XMLName struct{}      `json:"-" xml:"Audit"`
+}
+
+// DecorateAuditEntries decorates a page of audit log entries with hypermedia
+// links for the collection. The audit log is read-only.
+func DecorateAuditEntries(values []audit.Entry, base string, page page.Page) DecoratedAuditEntries {
+	links := Links{}
+	links.CollectionCR(base, page, false)
+	return DecoratedAuditEntries{Entries: values, Links: links}
+}
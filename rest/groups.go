@@ -0,0 +1,57 @@
+package rest
+
+import (
+	"fmt"
+
+	uuid "github.com/satori/go.uuid"
+
+	"github.com/aprice/freenote/page"
+	"github.com/aprice/freenote/users"
+)
+
+// GroupURI returns the URI of the group with the given ID.
+func GroupURI(baseURI string, id uuid.UUID) string {
+	return fmt.Sprintf("%s/groups/%s", baseURI, id)
+}
+
+// DecoratedGroup represents a group with hypermedia links.
+type DecoratedGroup struct {
+	Links Links `json:"_links" xml:"Links>Link"`
+	users.Group
+	XMLName struct{} `json:"-" xml:"Group"`
+}
+
+// DecorateGroup decorates a Group with hypermedia links, including a notes link
+// to the notes it owns.
+func DecorateGroup(group users.Group, canWrite bool, baseURI string) DecoratedGroup {
+	links := Links{}
+	uri := GroupURI(baseURI, group.ID)
+	links.RecordRUD(uri, canWrite)
+	links.Add(Link{
+		Rel:    "notes",
+		Method: "GET",
+		Href:   uri + "/notes",
+	})
+	return DecoratedGroup{Group: group, Links: links}
+}
+
+// DecoratedGroups represents a collection of groups with hypermedia links for
+// the collection and groups.
+type DecoratedGroups struct {
+	Links   Links            `json:"_links" xml:"Links>Link"`
+	Groups  []DecoratedGroup `json:"groups" xml:"Page>Group"`
+	XMLName struct{}         `json:"-" xml:"Groups"`
+}
+
+// DecorateGroups decorates a collection of Groups with hypermedia links for the
+// collection and groups. The groups only get read links; whether a user may
+// change a group is on the group itself.
+func DecorateGroups(values []users.Group, page page.Page, canCreate bool, baseURI string) DecoratedGroups {
+	decorated := make([]DecoratedGroup, len(values))
+	for i := range values {
+		decorated[i] = DecorateGroup(values[i], false, baseURI)
+	}
+	links := Links{}
+	links.CollectionCR(fmt.Sprintf("%s/groups", baseURI), page, canCreate)
+	return DecoratedGroups{Groups: decorated, Links: links}
+}
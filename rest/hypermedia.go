@@ -126,7 +126,7 @@ func (l Links) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
 
 // AppendQueryString adds a field to a query string.
 func AppendQueryString(base, query string) string {
-	if strings.Contains("?", base) {
+	if strings.Contains(base, "?") {
 		return base + "&" + query
 	}
 	return base + "?" + query
@@ -6,23 +6,27 @@ import (
 
 	"github.com/aprice/freenote/notes"
 	"github.com/aprice/freenote/page"
-	"github.com/aprice/freenote/users"
 )
 
-// DecoratedNote represents a Note with hypermedia links.
+// DecoratedNote represents a Note with hypermedia links. Notes listed as search
+// results also have snippets of their bodies around the text the search
+// matched, and a relevance score.
 type DecoratedNote struct {
 	Links Links `json:"_links" xml:"Links>Link"`
 	notes.Note
-	XMLName struct{} `json:"-" xml:"Note"`
+	Snippets []notes.Snippet `json:"snippets,omitempty" xml:"Snippets>Snippet,omitempty"`
+	Score    float64         `json:"score,omitempty" xml:"score,attr,omitempty"`
+	XMLName  struct{}        `json:"-" xml:"Note"`
 }
 
-// DecorateNote decorates a Note with hypermedia links.
-func DecorateNote(note notes.Note, canWrite bool, baseURI string) DecoratedNote {
+// DecorateNote decorates a Note with hypermedia links. ownerURI is the URI of
+// the user or group that owns the note, from UserURI or GroupURI.
+func DecorateNote(note notes.Note, canWrite bool, ownerURI string) DecoratedNote {
 	links := Links{}
-	links.RecordRUD(fmt.Sprintf("%s/users/%s/notes/%s", baseURI, note.Owner, note.ID), canWrite)
+	links.RecordRUD(fmt.Sprintf("%s/notes/%s", ownerURI, note.ID), canWrite)
 	links.Add(Link{
 		Rel:  "author",
-		Href: fmt.Sprintf("%s/users/%s", baseURI, note.Owner),
+		Href: ownerURI,
 	})
 	return DecoratedNote{Note: note, Links: links}
 }
@@ -36,23 +40,38 @@ type DecoratedNotes struct {
 }
 
 // DecorateNotes decorates a collection of Notes with hypermedia links for the
-// collection and notes.
-func DecorateNotes(owner users.User, values []notes.Note, folder string, page page.Page, canWrite bool, baseURI string) DecoratedNotes {
+// collection and notes. The filter query string, including any folder, is
+// kept on the page links. If
+// the notes are the results of a search for text terms, each gets snippets and
+// a score. ownerURI is the URI of the user or group that owns the notes.
+func DecorateNotes(values []notes.Note, filter string, terms []string, page page.Page, canWrite bool, ownerURI string) DecoratedNotes {
 	links := Links{}
-	decorated := make([]DecoratedNote, len(values))
-	var base string
-	if folder == "" {
-		base = fmt.Sprintf("%s/users/%s/notes", baseURI, owner.ID)
-	} else {
-		base = fmt.Sprintf("%s/users/%s/notes/%s", baseURI, owner.ID, folder)
+	base := fmt.Sprintf("%s/notes", ownerURI)
+	if filter != "" {
+		base += "?" + filter
 	}
+	links.CollectionCR(base, page, canWrite)
+	return DecoratedNotes{Notes: decorateNoteList(values, terms, canWrite, ownerURI), Links: links}
+}
+
+// decorateNoteList decorates each note in a collection, truncating their bodies
+// to the first line, after taking snippets of them around any search terms.
+func decorateNoteList(values []notes.Note, terms []string, canWrite bool, ownerURI string) []DecoratedNote {
+	decorated := make([]DecoratedNote, len(values))
 	for i := range values {
+		var (
+			snippets []notes.Snippet
+			score    float64
+		)
+		if len(terms) > 0 {
+			snippets, score = notes.Snippets(values[i].Body, terms), notes.Score(values[i], terms)
+		}
 		idx := strings.Index(values[i].Body, "\n")
 		if idx > 0 {
 			values[i].Body = values[i].Body[:idx]
 		}
-		decorated[i] = DecorateNote(values[i], canWrite, baseURI)
+		decorated[i] = DecorateNote(values[i], canWrite, ownerURI)
+		decorated[i].Snippets, decorated[i].Score = snippets, score
 	}
-	links.CollectionCR(base, page, canWrite)
-	return DecoratedNotes{Notes: decorated, Links: links}
+	return decorated
 }
@@ -0,0 +1,60 @@
+package rest
+
+import (
+	"fmt"
+
+	"github.com/aprice/freenote/notes"
+	"github.com/aprice/freenote/page"
+)
+
+// DecoratedReminder represents a pending reminder with hypermedia links to the
+// note it's on.
+type DecoratedReminder struct {
+	Links Links `json:"_links" xml:"Links>Link"`
+	notes.ReminderItem
+	XMLName struct{} `json:"-" xml:"Reminder"`
+}
+
+// DecorateReminder decorates a pending reminder with hypermedia links to the
+// note it's on. ownerURI is the URI of the user or group that owns the note,
+// from UserURI or GroupURI.
+func DecorateReminder(item notes.ReminderItem, ownerURI string) DecoratedReminder {
+	links := Links{}
+	links.Add(Link{
+		Rel:    "note",
+		Href:   fmt.Sprintf("%s/notes/%s", ownerURI, item.Note),
+		Method: "GET",
+	})
+	return DecoratedReminder{ReminderItem: item, Links: links}
+}
+
+// DecoratedReminders represents a page of pending reminders with hypermedia
+// links for the collection and reminders.
+type DecoratedReminders struct {
+	Links     Links               `json:"_links" xml:"Links>Link"`
+	Reminders []DecoratedReminder `json:"reminders" xml:"Page>Reminder"`
+	XMLName   struct{}            `json:"-" xml:"Reminders"`
+}
+
+// DecorateReminders decorates a page of pending reminders with hypermedia links
+// for the collection, its iCalendar feed, and the reminders. The filter query
+// string is kept on the page links. ownerURI is the URI of the user or group
+// that owns the reminders' notes.
+func DecorateReminders(values []notes.ReminderItem, filter string, page page.Page, ownerURI string) DecoratedReminders {
+	links := Links{}
+	decorated := make([]DecoratedReminder, len(values))
+	for i := range values {
+		decorated[i] = DecorateReminder(values[i], ownerURI)
+	}
+	base := ownerURI + "/reminders"
+	links.Add(Link{
+		Rel:    "calendar",
+		Href:   base + ".ics",
+		Method: "GET",
+	})
+	if filter != "" {
+		base += "?" + filter
+	}
+	links.CollectionCR(base, page, false)
+	return DecoratedReminders{Reminders: decorated, Links: links}
+}
@@ -0,0 +1,86 @@
+package rest
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+
+	"github.com/aprice/freenote/notes"
+	"github.com/aprice/freenote/page"
+	"github.com/aprice/freenote/users"
+)
+
+// DecoratedSearch represents a saved search with hypermedia links, and the
+// number of notes it currently matches.
+type DecoratedSearch struct {
+	Links   Links     `json:"_links" xml:"Links>Link"`
+	ID      uuid.UUID `json:"id" xml:"id,attr"`
+	Name    string    `json:"name"`
+	Query   string    `json:"query"`
+	Created time.Time `json:"created"`
+	Count   int       `json:"count" xml:"count,attr"`
+	XMLName struct{}  `json:"-" xml:"Search"`
+}
+
+// DecorateSearch decorates a user's saved search with hypermedia links,
+// including a notes link to run it.
+func DecorateSearch(user users.User, search users.Search, count int, baseURI string) DecoratedSearch {
+	links := Links{}
+	uri := fmt.Sprintf("%s/users/%s/searches/%s", baseURI, user.ID, search.ID)
+	links.RecordRUD(uri, true)
+	links.Add(Link{
+		Rel:    "notes",
+		Method: "GET",
+		Href:   uri + "/notes",
+	})
+	return DecoratedSearch{
+		Links:   links,
+		ID:      search.ID,
+		Name:    search.Name,
+		Query:   search.Query,
+		Created: search.Created,
+		Count:   count,
+	}
+}
+
+// DecoratedSearches represents a user's saved searches with hypermedia links
+// for the collection and searches.
+type DecoratedSearches struct {
+	Links    Links             `json:"_links" xml:"Links>Link"`
+	Searches []DecoratedSearch `json:"searches" xml:"Search"`
+	XMLName  struct{}          `json:"-" xml:"Searches"`
+}
+
+// DecorateSearches decorates all of a user's saved searches with hypermedia
+// links, in order by name. counts holds the number of notes each matches.
+func DecorateSearches(user users.User, counts map[uuid.UUID]int, baseURI string) DecoratedSearches {
+	base := fmt.Sprintf("%s/users/%s/searches", baseURI, user.ID)
+	links := Links{}
+	links.Canonical(base)
+	links.Create(base)
+	decorated := make([]DecoratedSearch, 0, len(user.Searches))
+	for _, search := range user.Searches {
+		decorated = append(decorated, DecorateSearch(user, *search, counts[search.ID], baseURI))
+	}
+	sort.Slice(decorated, func(i, j int) bool {
+		return decorated[i].Name < decorated[j].Name
+	})
+	return DecoratedSearches{Links: links, Searches: decorated}
+}
+
+// DecorateSearchNotes decorates a page of the notes matching a saved search,
+// with page links for the search's notes and a link to the search. Any text
+// terms are used for snippets, as with DecorateNotes.
+func DecorateSearchNotes(user users.User, search users.Search, values []notes.Note, terms []string, page page.Page, canWrite bool, baseURI string) DecoratedNotes {
+	uri := fmt.Sprintf("%s/users/%s/searches/%s", baseURI, user.ID, search.ID)
+	links := Links{}
+	links.CollectionCR(uri+"/notes", page, false)
+	links.Add(Link{
+		Rel:    "search",
+		Method: "GET",
+		Href:   uri,
+	})
+	return DecoratedNotes{Notes: decorateNoteList(values, terms, canWrite, UserURI(baseURI, user.ID)), Links: links}
+}
@@ -0,0 +1,83 @@
+package rest
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+
+	"github.com/aprice/freenote/users"
+)
+
+// DecoratedSession represents a user session with hypermedia links. Session
+// keys are never included.
+type DecoratedSession struct {
+	Links     Links     `json:"_links" xml:"Links>Link"`
+	ID        uuid.UUID `json:"id" xml:"id,attr"`
+	Created   time.Time `json:"created"`
+	LastUsed  time.Time `json:"lastUsed"`
+	Expires   time.Time `json:"expires"`
+	UserAgent string    `json:"userAgent"`
+	IP        string    `json:"ip"`
+	Label     string    `json:"label,omitempty" xml:",omitempty"`
+	Current   bool      `json:"current" xml:"current,attr"`
+	XMLName   struct{}  `json:"-" xml:"Session"`
+}
+
+// DecorateSession decorates a user's session with hypermedia links.
+func DecorateSession(user users.User, sess users.Session, current bool, baseURI string) DecoratedSession {
+	links := Links{}
+	uri := fmt.Sprintf("%s/users/%s/sessions/%s", baseURI, user.ID, sess.ID)
+	links.Canonical(uri)
+	links.Save(uri)
+	links.Delete(uri)
+	return DecoratedSession{
+		Links:     links,
+		ID:        sess.ID,
+		Created:   sess.Created,
+		LastUsed:  sess.LastUsed,
+		Expires:   sess.Expires,
+		UserAgent: sess.UserAgent,
+		IP:        sess.IP,
+		Label:     sess.Label,
+		Current:   current,
+	}
+}
+
+// DecoratedSessions represents a user's sessions with hypermedia links for the
+// collection and sessions.
+type DecoratedSessions struct {
+	Links    Links              `json:"_links" xml:"Links>Link"`
+	Sessions []DecoratedSession `json:"sessions" xml:"Session"`
+	XMLName  struct{}           `json:"-" xml:"Sessions"`
+}
+
+// DecorateSessions decorates all of a user's sessions with hypermedia links,
+// most recently used first. The session with the ID current is flagged as the
+// session making the request.
+func DecorateSessions(user users.User, current uuid.UUID, baseURI string) DecoratedSessions {
+	base := fmt.Sprintf("%s/users/%s/sessions", baseURI, user.ID)
+	links := Links{}
+	links.Canonical(base)
+	links.Add(Link{
+		Rel:    "revokeall",
+		Href:   base,
+		Method: "DELETE",
+	})
+	if current != uuid.Nil {
+		links.Add(Link{
+			Rel:    "revokeothers",
+			Href:   AppendQueryString(base, "others=true"),
+			Method: "DELETE",
+		})
+	}
+	decorated := make([]DecoratedSession, 0, len(user.Sessions))
+	for _, sess := range user.Sessions {
+		decorated = append(decorated, DecorateSession(user, *sess, sess.ID == current, baseURI))
+	}
+	sort.Slice(decorated, func(i, j int) bool {
+		return decorated[i].LastUsed.After(decorated[j].LastUsed)
+	})
+	return DecoratedSessions{Links: links, Sessions: decorated}
+}
@@ -0,0 +1,28 @@
+package rest
+
+import (
+	"fmt"
+	"net/url"
+
+	"github.com/aprice/freenote/suggest"
+)
+
+// DecoratedSuggestions represents notes suggested for a typed title, with
+// hypermedia links for the collection.
+type DecoratedSuggestions struct {
+	Links       Links                `json:"_links" xml:"Links>Link"`
+	Suggestions []suggest.Suggestion `json:"suggestions" xml:"Suggestion"`
+	XMLName     struct{}             `json:"-" xml:"Suggestions"`
+}
+
+// DecorateSuggestions decorates notes suggested for a typed title with
+// hypermedia links. ownerURI is the URI of the user or group that owns the
+// notes.
+func DecorateSuggestions(prefix string, values []suggest.Suggestion, ownerURI string) DecoratedSuggestions {
+	links := Links{}
+	links.Canonical(fmt.Sprintf("%s/notes/suggest?prefix=%s", ownerURI, url.QueryEscape(prefix)))
+	if values == nil {
+		values = make([]suggest.Suggestion, 0)
+	}
+	return DecoratedSuggestions{Links: links, Suggestions: values}
+}
@@ -0,0 +1,59 @@
+package rest
+
+import (
+	"fmt"
+
+	"github.com/aprice/freenote/notes"
+	"github.com/aprice/freenote/page"
+)
+
+// DecoratedTask represents an indexed task with hypermedia links to the note
+// it's in.
+type DecoratedTask struct {
+	Links Links `json:"_links" xml:"Links>Link"`
+	notes.TaskItem
+	XMLName struct{} `json:"-" xml:"Task"`
+}
+
+// DecorateTask decorates an indexed task with hypermedia links to the note it's
+// in, and to toggle it.
+func DecorateTask(task notes.TaskItem, canWrite bool, baseURI string) DecoratedTask {
+	links := Links{}
+	noteURI := fmt.Sprintf("%s/users/%s/notes/%s", baseURI, task.Owner, task.Note)
+	links.Add(Link{
+		Rel:    "note",
+		Href:   noteURI,
+		Method: "GET",
+	})
+	if canWrite {
+		links.Add(Link{
+			Rel:    "toggle",
+			Href:   fmt.Sprintf("%s/tasks/%s/toggle", noteURI, task.ID),
+			Method: "POST",
+		})
+	}
+	return DecoratedTask{TaskItem: task, Links: links}
+}
+
+// DecoratedTasks represents a page of indexed tasks with hypermedia links for
+// the collection and tasks.
+type DecoratedTasks struct {
+	Links   Links           `json:"_links" xml:"Links>Link"`
+	Tasks   []DecoratedTask `json:"tasks" xml:"Page>Task"`
+	XMLName struct{}        `json:"-" xml:"Tasks"`
+}
+
+// DecorateTasks decorates a page of indexed tasks with hypermedia links for the
+// collection and tasks. The filter query string is kept on the page links.
+func DecorateTasks(values []notes.TaskItem, base, filter string, page page.Page, canWrite bool, baseURI string) DecoratedTasks {
+	links := Links{}
+	decorated := make([]DecoratedTask, len(values))
+	for i := range values {
+		decorated[i] = DecorateTask(values[i], canWrite, baseURI)
+	}
+	if filter != "" {
+		base += "?" + filter
+	}
+	links.CollectionCR(base, page, false)
+	return DecoratedTasks{Tasks: decorated, Links: links}
+}
@@ -0,0 +1,65 @@
+package rest
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+
+	"github.com/aprice/freenote/users"
+)
+
+// DecoratedToken represents a personal API token with hypermedia links. The
+// secret is only included when the token is created.
+type DecoratedToken struct {
+	Links    Links     `json:"_links" xml:"Links>Link"`
+	ID       uuid.UUID `json:"id" xml:"id,attr"`
+	Name     string    `json:"name"`
+	Created  time.Time `json:"created"`
+	LastUsed time.Time `json:"lastUsed"`
+	Token    string    `json:"token,omitempty" xml:",omitempty"`
+	XMLName  struct{}  `json:"-" xml:"Token"`
+}
+
+// DecorateToken decorates a user's API token with hypermedia links.
+func DecorateToken(user users.User, tok users.Token, baseURI string) DecoratedToken {
+	links := Links{}
+	uri := fmt.Sprintf("%s/users/%s/tokens/%s", baseURI, user.ID, tok.ID)
+	links.Canonical(uri)
+	links.Delete(uri)
+	return DecoratedToken{
+		Links:    links,
+		ID:       tok.ID,
+		Name:     tok.Name,
+		Created:  tok.Created,
+		LastUsed: tok.LastUsed,
+	}
+}
+
+// DecoratedTokens represents a user's API tokens with hypermedia links for the
+// collection and tokens.
+type DecoratedTokens struct {
+	Links   Links            `json:"_links" xml:"Links>Link"`
+	Tokens  []DecoratedToken `json:"tokens" xml:"Token"`
+	XMLName struct{}         `json:"-" xml:"Tokens"`
+}
+
+// DecorateTokens decorates all of a user's API tokens with hypermedia links,
+// newest first.
+func DecorateTokens(user users.User, canCreate bool, baseURI string) DecoratedTokens {
+	base := fmt.Sprintf("%s/users/%s/tokens", baseURI, user.ID)
+	links := Links{}
+	links.Canonical(base)
+	if canCreate {
+		links.Create(base)
+	}
+	decorated := make([]DecoratedToken, 0, len(user.Tokens))
+	for _, tok := range user.Tokens {
+		decorated = append(decorated, DecorateToken(user, *tok, baseURI))
+	}
+	sort.Slice(decorated, func(i, j int) bool {
+		return decorated[i].Created.After(decorated[j].Created)
+	})
+	return DecoratedTokens{Links: links, Tokens: decorated}
+}
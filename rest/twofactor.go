@@ -0,0 +1,115 @@
+package rest
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/aprice/freenote/users"
+)
+
+// TwoFactorStatus represents the state of a user's two-factor authentication
+// with hypermedia links. Secrets are never included.
+type TwoFactorStatus struct {
+	Links         Links    `json:"_links" xml:"Links>Link"`
+	Enabled       bool     `json:"enabled" xml:"enabled,attr"`
+	Pending       bool     `json:"pending" xml:"pending,attr"`
+	RecoveryCodes int      `json:"recoveryCodes" xml:"recoveryCodes,attr"`
+	XMLName       struct{} `json:"-" xml:"TwoFactor"`
+}
+
+// DecorateTwoFactor decorates a user's two-factor status with hypermedia links.
+func DecorateTwoFactor(user users.User, baseURI string) TwoFactorStatus {
+	uri := fmt.Sprintf("%s/users/%s/twofactor", baseURI, user.ID)
+	links := Links{}
+	links.Canonical(uri)
+	status := TwoFactorStatus{Links: links}
+	if tf := user.TwoFactor; tf != nil {
+		status.Enabled = tf.Enabled
+		status.Pending = !tf.Enabled
+		status.RecoveryCodes = len(tf.RecoveryCodes)
+	}
+	if status.Enabled {
+		links.Delete(uri)
+		links.Add(Link{
+			Rel:    "recoverycodes",
+			Href:   uri + "/recoverycodes",
+			Method: "POST",
+		})
+		return status
+	}
+	if status.Pending {
+		links.Add(Link{
+			Rel:    "confirm",
+			Href:   uri,
+			Method: "PUT",
+		})
+	}
+	links.Add(Link{
+		Rel:    "enrol",
+		Href:   uri,
+		Method: "POST",
+	})
+	return status
+}
+
+// TwoFactorEnrolment is the response to starting two-factor enrolment. The
+// URI is an otpauth URI suitable for display as a QR code.
+type TwoFactorEnrolment struct {
+	Links   Links    `json:"_links" xml:"Links>Link"`
+	Secret  string   `json:"secret"`
+	URI     string   `json:"uri"`
+	XMLName struct{} `json:"-" xml:"TwoFactorEnrolment"`
+}
+
+// DecorateTwoFactorEnrolment decorates a new two-factor secret with hypermedia
+// links.
+func DecorateTwoFactorEnrolment(user users.User, secret, uri, baseURI string) TwoFactorEnrolment {
+	links := Links{}
+	links.Add(Link{
+		Rel:    "confirm",
+		Href:   fmt.Sprintf("%s/users/%s/twofactor", baseURI, user.ID),
+		Method: "PUT",
+	})
+	return TwoFactorEnrolment{Links: links, Secret: secret, URI: uri}
+}
+
+// RecoveryCodes is a set of newly generated two-factor recovery codes. They are
+// only available when generated.
+type RecoveryCodes struct {
+	Links   Links    `json:"_links" xml:"Links>Link"`
+	Codes   []string `json:"recoveryCodes" xml:"Code"`
+	XMLName struct{} `json:"-" xml:"RecoveryCodes"`
+}
+
+// DecorateRecoveryCodes decorates a new set of recovery codes with hypermedia
+// links.
+func DecorateRecoveryCodes(user users.User, codes []string, baseURI string) RecoveryCodes {
+	links := Links{}
+	links.Add(Link{
+		Rel:    "twofactor",
+		Href:   fmt.Sprintf("%s/users/%s/twofactor", baseURI, user.ID),
+		Method: "GET",
+	})
+	return RecoveryCodes{Links: links, Codes: codes}
+}
+
+// TwoFactorChallenge is issued when a user logs in with a valid password but
+// must also supply a two-factor code.
+type TwoFactorChallenge struct {
+	Links     Links     `json:"_links" xml:"Links>Link"`
+	Challenge string    `json:"challenge"`
+	Expires   time.Time `json:"expires"`
+	XMLName   struct{}  `json:"-" xml:"TwoFactorChallenge"`
+}
+
+// DecorateTwoFactorChallenge decorates a two-factor login challenge with
+// hypermedia links.
+func DecorateTwoFactorChallenge(challenge string, expires time.Time, baseURI string) TwoFactorChallenge {
+	links := Links{}
+	links.Add(Link{
+		Rel:    "answer",
+		Href:   baseURI + "/session",
+		Method: "POST",
+	})
+	return TwoFactorChallenge{Links: links, Challenge: challenge, Expires: expires}
+}
@@ -3,10 +3,17 @@ package rest
 import (
 	"fmt"
 
+	uuid "github.com/satori/go.uuid"
+
 	"github.com/aprice/freenote/page"
 	"github.com/aprice/freenote/users"
 )
 
+// UserURI returns the URI of the user with the given ID.
+func UserURI(baseURI string, id uuid.UUID) string {
+	return fmt.Sprintf("%s/users/%s", baseURI, id)
+}
+
 // DecoratedUser represents a user with hypermedia links.
 type DecoratedUser struct {
 	Links Links `json:"_links" xml:"Links>Link"`
@@ -37,8 +44,22 @@ func DecorateUser(user users.User, canReadNotes, canWrite bool, baseURI string)
 			Href:   fmt.Sprintf("%s/users/%s/notes", baseURI, user.ID),
 		})
 	}
+	if canWrite {
+		links.Add(Link{
+			Rel:    "verifyemail",
+			Method: "POST",
+			Href:   fmt.Sprintf("%s/users/%s/email", baseURI, user.ID),
+		})
+	} else {
+		user.Email = ""
+		user.EmailVerified = false
+	}
+	user.EmailVerification = nil
 	user.Password = nil
 	user.Sessions = nil
+	user.TwoFactor = nil
+	user.Tokens = nil
+	user.Searches = nil
 	return DecoratedUser{User: user, Links: links}
 }
 
@@ -56,6 +77,12 @@ func DecorateUsers(values []users.User, page page.Page, canWrite bool, baseURI s
 	for i := range values {
 		values[i].Password = nil
 		values[i].Sessions = nil
+		values[i].TwoFactor = nil
+		values[i].Tokens = nil
+		values[i].Searches = nil
+		values[i].Email = ""
+		values[i].EmailVerified = false
+		values[i].EmailVerification = nil
 	}
 	links := Links{}
 	links.CollectionCR(fmt.Sprintf("%s/users", baseURI), page, canWrite)
@@ -0,0 +1,124 @@
+package server
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/aprice/freenote/audit"
+	"github.com/aprice/freenote/rest"
+	"github.com/aprice/freenote/stats"
+	"github.com/aprice/freenote/store"
+	"github.com/aprice/freenote/users"
+)
+
+var errInvalidAccessLevel = errors.New("invalid access level")
+var errChangeOwnAccess = errors.New("can't change own access level or account status")
+
+// validateAccessChange checks that actor may set subject's access level to the
+// given level. Admins can't change their own access, to avoid lockouts, and
+// nobody can grant recovery access.
+func validateAccessChange(actor, subject users.User, level users.AccessLevel) error {
+	if level == subject.Access {
+		return nil
+	}
+	if level < users.LevelGuest || level > users.LevelAdmin {
+		return errInvalidAccessLevel
+	}
+	if actor.ID == subject.ID {
+		return errChangeOwnAccess
+	}
+	return nil
+}
+
+func auditAccessChange(db store.Session, r *http.Request, actor, subject users.User, level users.AccessLevel) {
+	entry := audit.NewEntry(audit.ActionAccessChange, audit.OutcomeSuccess)
+	entry.Target = subject.ID
+	entry.Detail = subject.Access.String() + " -> " + level.String()
+	recordAudit(db, r, actor, entry)
+}
+
+// users/{id}/access
+func (rh *requestHandler) doAccess(w http.ResponseWriter, r *http.Request) {
+	defer stats.Measure("req", "access", r.Method)()
+	switch r.Method {
+	case http.MethodOptions:
+		rh.preflight(w, r, nil, http.MethodPut)
+		return
+	case http.MethodPut:
+		if rh.user.Access < users.LevelAdmin {
+			statusResponse(w, http.StatusForbidden)
+			return
+		}
+		var err error
+		ar := struct{ Access string }{}
+		if r.Header.Get("Content-Type") == "text/plain" {
+			var body []byte
+			body, err = ioutil.ReadAll(r.Body)
+			if handleError(w, err) {
+				return
+			}
+			ar.Access = string(body)
+		} else if err = parseRequest(r, &ar); badRequest(w, err) {
+			return
+		}
+		level := users.ParseAccessLevel(strings.ToLower(strings.TrimSpace(ar.Access)))
+		if level == users.LevelAnon {
+			badRequest(w, errInvalidAccessLevel)
+			return
+		}
+		if err = validateAccessChange(rh.user, rh.owner, level); badRequest(w, err) {
+			return
+		}
+		if level != rh.owner.Access {
+			auditAccessChange(rh.db, r, rh.user, rh.owner, level)
+			rh.owner.Access = level
+			if err = rh.db.UserStore().SaveUser(&rh.owner); handleError(w, err) {
+				return
+			}
+		}
+		sendResponse(w, r, rest.DecorateUser(rh.owner, true, true, rh.baseURI), http.StatusOK)
+	default:
+		w.Header().Add("Allow", http.MethodPut)
+		statusResponse(w, http.StatusMethodNotAllowed)
+	}
+}
+
+// users/{id}/disabled
+func (rh *requestHandler) doDisabled(w http.ResponseWriter, r *http.Request) {
+	defer stats.Measure("req", "disabled", r.Method)()
+	switch r.Method {
+	case http.MethodOptions:
+		rh.preflight(w, r, nil, http.MethodPut, http.MethodDelete)
+		return
+	case http.MethodPut, http.MethodDelete:
+		if rh.user.Access < users.LevelAdmin {
+			statusResponse(w, http.StatusForbidden)
+			return
+		}
+		if rh.owner.ID == rh.user.ID {
+			badRequest(w, errChangeOwnAccess)
+			return
+		}
+		disable := r.Method == http.MethodPut
+		if disable != rh.owner.Disabled {
+			rh.owner.Disabled = disable
+			action := audit.ActionUserEnable
+			if disable {
+				action = audit.ActionUserDisable
+				rh.owner.RevokeSessions()
+			}
+			if err := rh.db.UserStore().SaveUser(&rh.owner); handleError(w, err) {
+				return
+			}
+			entry := audit.NewEntry(action, audit.OutcomeSuccess)
+			entry.Target = rh.owner.ID
+			recordAudit(rh.db, r, rh.user, entry)
+		}
+		sendResponse(w, r, rest.DecorateUser(rh.owner, true, true, rh.baseURI), http.StatusOK)
+	default:
+		w.Header().Add("Allow", "PUT, DELETE")
+		statusResponse(w, http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,115 @@
+package server
+
+import (
+	"log"
+	"net"
+	"net/http"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+
+	"github.com/aprice/freenote/audit"
+	"github.com/aprice/freenote/ids"
+	"github.com/aprice/freenote/page"
+	"github.com/aprice/freenote/rest"
+	"github.com/aprice/freenote/stats"
+	"github.com/aprice/freenote/store"
+	"github.com/aprice/freenote/users"
+)
+
+// recordAudit appends an entry to the audit log for the given request, acted
+// by the given user. Failure to record the entry is logged but otherwise
+// ignored, so as not to interfere with the request.
+func recordAudit(db store.Session, r *http.Request, actor users.User, entry audit.Entry) {
+	entry.Actor = actor.ID
+	if entry.ActorName == "" {
+		entry.ActorName = actor.Username
+	}
+	entry.SourceIP = sourceIP(r)
+	if err := db.AuditStore().AddEntry(&entry); err != nil {
+		log.Printf("failed to record audit entry %s %s: %v", entry.Action, entry.Outcome, err)
+	}
+}
+
+func sourceIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func parseAuditQuery(r *http.Request) (store.AuditQuery, error) {
+	var err error
+	pageReq := page.Page{
+		Length:         50,
+		SortBy:         "time",
+		SortDescending: true,
+	}
+	pageReq.FromQueryString(r.URL, []string{"time"})
+	query := store.AuditQuery{
+		Page:    pageReq,
+		Action:  audit.Action(r.URL.Query().Get("action")),
+		Outcome: audit.Outcome(r.URL.Query().Get("outcome")),
+	}
+	if raw := r.URL.Query().Get("actor"); raw != "" {
+		if query.Actor, err = ids.ParseID(raw); err != nil {
+			return query, err
+		}
+	}
+	if raw := r.URL.Query().Get("target"); raw != "" {
+		if query.Target, err = ids.ParseID(raw); err != nil {
+			return query, err
+		}
+	}
+	if raw := r.URL.Query().Get("since"); raw != "" {
+		if query.Since, err = time.Parse(time.RFC3339, raw); err != nil {
+			return query, err
+		}
+	}
+	if raw := r.URL.Query().Get("until"); raw != "" {
+		if query.Until, err = time.Parse(time.RFC3339, raw); err != nil {
+			return query, err
+		}
+	}
+	return query, nil
+}
+
+// audit
+func (rh *requestHandler) doAudit(w http.ResponseWriter, r *http.Request) {
+	defer stats.Measure("req", "audit", r.Method)()
+	rh.queryAudit(w, r, uuid.Nil, rh.baseURI+"/audit")
+}
+
+// users/{id}/audit
+func (rh *requestHandler) doUserAudit(w http.ResponseWriter, r *http.Request) {
+	defer stats.Measure("req", "useraudit", r.Method)()
+	if !authorizeUser(rh.user, rh.owner) {
+		statusResponse(w, http.StatusForbidden)
+		return
+	}
+	rh.queryAudit(w, r, rh.owner.ID, rh.baseURI+"/users/"+rh.owner.ID.String()+"/audit")
+}
+
+func (rh *requestHandler) queryAudit(w http.ResponseWriter, r *http.Request, userID uuid.UUID, base string) {
+	switch r.Method {
+	case http.MethodOptions:
+		rh.preflight(w, r, nil, http.MethodGet)
+		return
+	case http.MethodGet:
+		query, err := parseAuditQuery(r)
+		if badRequest(w, err) {
+			return
+		}
+		query.User = userID
+		list, total, err := rh.db.AuditStore().QueryEntries(query)
+		if handleError(w, err) {
+			return
+		}
+		query.Page.HasMore = total > (query.Page.Start + query.Page.Length)
+		sendResponse(w, r, rest.DecorateAuditEntries(list, base, query.Page), http.StatusOK)
+	default:
+		w.Header().Add("Allow", http.MethodGet)
+		statusResponse(w, http.StatusMethodNotAllowed)
+	}
+}
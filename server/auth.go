@@ -3,6 +3,7 @@ package server
 import (
 	"encoding/base64"
 	"errors"
+	"log"
 	"net/http"
 	"regexp"
 	"strings"
@@ -10,6 +11,7 @@ import (
 
 	uuid "github.com/satori/go.uuid"
 
+	"github.com/aprice/freenote/audit"
 	"github.com/aprice/freenote/ids"
 	"github.com/aprice/freenote/notes"
 	"github.com/aprice/freenote/store"
@@ -20,15 +22,25 @@ var errNoAuth = errors.New("no authentication provided")
 var errAuthFailed = errors.New("authentication failed")
 var errAuthCookieInvalid = errors.New("auth cookie invalid")
 var errUnauthorized = errors.New("unauthorized request")
+var errTokenRequired = errors.New("API token required for two-factor accounts")
+var errChallengeInvalid = errors.New("two-factor challenge invalid")
+var errUsernameTaken = errors.New("username already in use")
+
+// API tokens are distinguished from passwords by a prefix.
+const apiTokenPrefix = "fnt_"
 
 const failedAuthDelay = 100 * time.Millisecond
 
 // Supported authentication: HTTP Basic, HTTP Bearer, Cookie
-func authenticate(w http.ResponseWriter, r *http.Request, us store.UserStore) (users.User, error) {
+func authenticate(w http.ResponseWriter, r *http.Request, db store.Session) (users.User, error) {
+	us := db.UserStore()
 	if uname, pass, ok := r.BasicAuth(); ok {
 		uname = strings.ToLower(uname)
 		if uname == users.RecoveryAdminName {
 			user, err := users.AuthenticateAdmin(pass)
+			entry := audit.NewEntry(audit.ActionRecoveryLogin, audit.OutcomeOf(err))
+			entry.ActorName = uname
+			recordAudit(db, r, user, entry)
 			if err != nil {
 				return users.User{}, err
 			}
@@ -36,17 +48,36 @@ func authenticate(w http.ResponseWriter, r *http.Request, us store.UserStore) (u
 		}
 		user, err := us.UserByName(uname)
 		if err != nil {
+			auditFailedLogin(db, r, users.User{Username: uname}, "unknown user")
 			return users.User{}, err
 		}
 		// TODO: Throttle login attempts by user
 		// TODO: Throttle login attempts by source IP
-		ok, err = user.Password.Verify(pass)
+		if tokID, secret, isToken := parseAPIToken(pass); isToken {
+			tok := user.Token(tokID)
+			ok = tok != nil && tok.Verify(secret)
+			if ok && tok.Touch() {
+				if err = us.SaveUser(&user); err != nil {
+					log.Println("failed to save token use: ", err)
+				}
+			}
+			err = nil
+		} else if user.TwoFactorEnabled() {
+			auditFailedLogin(db, r, user, errTokenRequired.Error())
+			return users.User{}, errTokenRequired
+		} else if ok, err = user.Password.Verify(pass); ok && err == nil && !user.Disabled {
+			upgradePassword(us, &user, pass)
+		}
 		if err != nil {
-			// Log failed login attempts
+			auditFailedLogin(db, r, user, err.Error())
 			time.Sleep(failedAuthDelay)
 			return users.User{}, err
 		} else if !ok {
+			auditFailedLogin(db, r, user, "incorrect password")
 			return users.User{}, errAuthFailed
+		} else if user.Disabled {
+			auditFailedLogin(db, r, user, users.ErrAccountDisabled.Error())
+			return users.User{}, users.ErrAccountDisabled
 		} else {
 			return user, nil
 		}
@@ -64,6 +95,15 @@ func authenticate(w http.ResponseWriter, r *http.Request, us store.UserStore) (u
 			deleteSessionCookie(w)
 			return users.User{}, errAuthCookieInvalid
 		}
+		if user.Disabled {
+			deleteSessionCookie(w)
+			return users.User{}, users.ErrAccountDisabled
+		}
+		if current := user.Session(sess.ID); current != nil && current.Touch(r.UserAgent(), sourceIP(r)) {
+			if err = us.SaveUser(&user); err != nil {
+				log.Println("failed to save session use: ", err)
+			}
+		}
 		refreshSessionCookie(w, r)
 		return user, nil
 	}
@@ -71,6 +111,57 @@ func authenticate(w http.ResponseWriter, r *http.Request, us store.UserStore) (u
 	return users.User{}, errNoAuth
 }
 
+// upgradePassword rehashes and saves a user's just-verified password if its
+// hash is out of date. Failure is logged but doesn't prevent login.
+func upgradePassword(us store.UserStore, user *users.User, password string) {
+	changed, err := user.UpgradePassword(password)
+	if err == nil && changed {
+		err = us.SaveUser(user)
+	}
+	if err != nil {
+		log.Println("failed to upgrade password hash: ", err)
+	}
+}
+
+// auditFailedLogin records a failed login attempt by the given user. Successful
+// HTTP Basic logins aren't recorded, as they happen on every API request.
+func auditFailedLogin(db store.Session, r *http.Request, user users.User, detail string) {
+	entry := audit.NewEntry(audit.ActionLogin, audit.OutcomeFailure)
+	entry.Target = user.ID
+	entry.Detail = detail
+	recordAudit(db, r, user, entry)
+}
+
+// provisionUser creates a user on first login through an external
+// authentication source, named by via. They get an unknown random password, so
+// they can only log in through that source until they set one.
+func provisionUser(db store.Session, r *http.Request, username, displayName, via string) (users.User, error) {
+	if err := users.ValidateUsername(username); err != nil {
+		return users.User{}, err
+	}
+	if _, err := db.UserStore().UserByName(username); err == nil {
+		return users.User{}, errUsernameTaken
+	}
+	user := users.New(username)
+	user.DisplayName = displayName
+	var err error
+	if _, user.Password, err = users.RandomPassword(32); err != nil {
+		return users.User{}, err
+	}
+	if err = db.UserStore().SaveUser(&user); err != nil {
+		return users.User{}, err
+	}
+	entry := audit.NewEntry(audit.ActionUserCreate, audit.OutcomeSuccess)
+	entry.Target = user.ID
+	entry.Detail = via
+	recordAudit(db, r, user, entry)
+	wn := notes.WelcomeNote(user.ID)
+	if err = db.NoteStore().SaveNote(&wn); err != nil {
+		log.Println("saving welcome note failed: ", err)
+	}
+	return user, nil
+}
+
 // TODO: Do this without matching a regexp on every request
 var userOwnedPat = regexp.MustCompile(`/users/([^/]+).*`)
 
@@ -96,6 +187,11 @@ func authorize(path string, user users.User) bool {
 		return false
 	} else if path == "/users/" || path == "/users" {
 		return user.Access >= users.LevelAdmin
+	} else if strings.HasPrefix(path, "/audit") {
+		return user.Access >= users.LevelAdmin
+	} else if strings.HasPrefix(path, "/groups") {
+		// Membership is checked once the group is loaded.
+		return user.Access >= users.LevelUser
 	}
 	return true
 }
@@ -104,13 +200,37 @@ func authorizeUser(actor, subject users.User) bool {
 	return actor.ID == subject.ID || actor.Access >= users.LevelAdmin
 }
 
-func authorizeNote(actor users.User, note notes.Note) bool {
-	// TODO: Sharing
+// authorizeGroup reports whether the actor may see a group and read its notes.
+func authorizeGroup(actor users.User, group users.Group) bool {
+	return group.Role(actor.ID).CanRead() || actor.Access >= users.LevelAdmin
+}
+
+// authorizeGroupWrite reports whether the actor may write a group's notes.
+func authorizeGroupWrite(actor users.User, group users.Group) bool {
+	return group.Role(actor.ID).CanWrite()
+}
+
+// authorizeGroupManage reports whether the actor may change or delete a group
+// and its members.
+func authorizeGroupManage(actor users.User, group users.Group) bool {
+	return group.Role(actor.ID).CanManage() || actor.Access >= users.LevelAdmin
+}
+
+// authorizeNote reports whether the actor may read a note. group is the group
+// that owns the note, or nil for a user's note.
+func authorizeNote(actor users.User, note notes.Note, group *users.Group) bool {
+	if group != nil {
+		return note.Owner == group.ID && authorizeGroup(actor, *group)
+	}
 	return actor.ID == note.Owner || actor.Access >= users.LevelAdmin
 }
 
-func authorizeNoteWrite(actor users.User, note notes.Note) bool {
-	// TODO: Sharing
+// authorizeNoteWrite reports whether the actor may change a note. group is the
+// group that owns the note, or nil for a user's note.
+func authorizeNoteWrite(actor users.User, note notes.Note, group *users.Group) bool {
+	if group != nil {
+		return note.Owner == group.ID && authorizeGroupWrite(actor, *group)
+	}
 	return actor.ID == note.Owner
 }
 
@@ -120,33 +240,55 @@ func parseSessionCookie(r *http.Request) (users.Session, error) {
 	if err != nil {
 		return sess, err
 	}
-	b, err := base64.RawURLEncoding.DecodeString(c.Value)
-	if err != nil {
-		err = errAuthCookieInvalid
-		return sess, err
+	var ok bool
+	sess.UserID, sess.ID, sess.Secret, ok = decodeCredential(c.Value)
+	if !ok {
+		return users.Session{}, errAuthCookieInvalid
 	}
-	sess.UserID, err = uuid.FromBytes(b[:16])
-	if err != nil {
-		err = errAuthCookieInvalid
-		return users.Session{}, err
+	return sess, nil
+}
+
+// encodeCredential packs an ID and secret into a single opaque string, as used
+// for session cookies, API tokens, and two-factor challenges.
+func encodeCredential(id1, id2 uuid.UUID, secret string) string {
+	b := make([]byte, 32+len(secret))
+	copy(b, id1.Bytes())
+	copy(b[16:], id2.Bytes())
+	copy(b[32:], []byte(secret))
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// decodeCredential unpacks a string created by encodeCredential.
+func decodeCredential(in string) (id1, id2 uuid.UUID, secret string, ok bool) {
+	b, err := base64.RawURLEncoding.DecodeString(in)
+	if err != nil || len(b) < 32 {
+		return uuid.Nil, uuid.Nil, "", false
 	}
-	sess.ID, err = uuid.FromBytes(b[16:32])
-	if err != nil {
-		err = errAuthCookieInvalid
-		return users.Session{}, err
+	if id1, err = uuid.FromBytes(b[:16]); err != nil {
+		return uuid.Nil, uuid.Nil, "", false
 	}
-	sess.Secret = string(b[32:])
-	return sess, nil
+	if id2, err = uuid.FromBytes(b[16:32]); err != nil {
+		return uuid.Nil, uuid.Nil, "", false
+	}
+	return id1, id2, string(b[32:]), true
+}
+
+func encodeAPIToken(userID, tokenID uuid.UUID, secret string) string {
+	return apiTokenPrefix + encodeCredential(userID, tokenID, secret)
+}
+
+func parseAPIToken(in string) (uuid.UUID, string, bool) {
+	if !strings.HasPrefix(in, apiTokenPrefix) {
+		return uuid.Nil, "", false
+	}
+	_, tokID, secret, ok := decodeCredential(strings.TrimPrefix(in, apiTokenPrefix))
+	return tokID, secret, ok
 }
 
 func writeSessionCookie(w http.ResponseWriter, sess users.Session) {
-	b := make([]byte, 32+len(sess.Secret))
-	copy(b, sess.UserID.Bytes())
-	copy(b[16:], sess.ID.Bytes())
-	copy(b[32:], []byte(sess.Secret))
 	c := &http.Cookie{
 		Name:   "auth",
-		Value:  base64.RawURLEncoding.EncodeToString(b),
+		Value:  encodeCredential(sess.UserID, sess.ID, sess.Secret),
 		MaxAge: 60 * 60 * 24 * 90,
 		Path:   "/",
 	}
@@ -0,0 +1,42 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/aprice/freenote/stats"
+	"github.com/aprice/freenote/users"
+)
+
+// doDAV serves a user's notes over WebDAV at /dav/{username}/. Like the REST
+// API, admins can read other users' notes but only the owner can change them.
+func (rh *requestHandler) doDAV(w http.ResponseWriter, r *http.Request) {
+	defer stats.Measure("req", "dav", r.Method)()
+	if rh.user.Access == users.LevelAnon {
+		w.Header().Set("WWW-Authenticate", `Basic realm="Freenote"`)
+		statusResponse(w, http.StatusUnauthorized)
+		return
+	}
+	username := strings.ToLower(rh.popSegment())
+	if username == "" {
+		statusResponse(w, http.StatusNotFound)
+		return
+	}
+	owner, err := rh.db.UserStore().UserByName(username)
+	if handleError(w, err) {
+		return
+	}
+	if !authorizeUser(rh.user, owner) {
+		statusResponse(w, http.StatusForbidden)
+		return
+	}
+	switch r.Method {
+	case http.MethodOptions, http.MethodGet, http.MethodHead, "PROPFIND":
+	default:
+		if rh.user.ID != owner.ID {
+			statusResponse(w, http.StatusForbidden)
+			return
+		}
+	}
+	rh.dav.Serve(w, r, rh.db.NoteStore(), owner.ID, "/dav/"+username)
+}
@@ -0,0 +1,89 @@
+package server
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/aprice/freenote/audit"
+	"github.com/aprice/freenote/mail"
+	"github.com/aprice/freenote/rest"
+	"github.com/aprice/freenote/stats"
+	"github.com/aprice/freenote/users"
+)
+
+var errEmailVerificationNone = errors.New("no email address to verify")
+var errEmailCodeInvalid = errors.New("invalid or expired email verification code")
+
+// sendEmailVerification sends a user the code to verify their email address.
+// Failures are logged, as the user can ask for the code to be sent again.
+func (rh *requestHandler) sendEmailVerification(user users.User, code string) {
+	body := "Enter this code to verify your email address for Freenote:\n\n" + code +
+		"\n\nIt expires in 24 hours. If you didn't ask for this, you can ignore it.\n"
+	if err := rh.mail.Send(user.Email, "Verify your email address", body); err != nil {
+		log.Printf("Failed to send email verification to user %s: %s", user.ID, err)
+	}
+}
+
+// users/{id}/email
+func (rh *requestHandler) doEmail(w http.ResponseWriter, r *http.Request) {
+	if rh.popSegment() != "" {
+		statusResponse(w, http.StatusNotFound)
+		return
+	}
+	defer stats.Measure("req", "email", r.Method)()
+	switch r.Method {
+	case http.MethodOptions:
+		rh.preflight(w, r, nil, http.MethodPost)
+	case http.MethodPost:
+		if rh.user.ID != rh.owner.ID {
+			statusResponse(w, http.StatusForbidden)
+			return
+		}
+		if rh.owner.Email == "" || rh.owner.EmailVerified {
+			http.Error(w, "Conflict: "+errEmailVerificationNone.Error(), http.StatusConflict)
+			return
+		}
+		var payload struct{ Code string }
+		if err := parseRequest(r, &payload); badRequest(w, err) {
+			return
+		}
+		now := time.Now()
+		if payload.Code == "" {
+			// Send a new code.
+			if !rh.mail.Configured() {
+				http.Error(w, "Conflict: "+mail.ErrNotConfigured.Error(), http.StatusConflict)
+				return
+			}
+			code, err := rh.owner.NewEmailVerification(now)
+			if handleError(w, err) {
+				return
+			}
+			if err = rh.db.UserStore().SaveUser(&rh.owner); handleError(w, err) {
+				return
+			}
+			rh.sendEmailVerification(rh.owner, code)
+			statusResponse(w, http.StatusAccepted)
+			return
+		}
+		verified := rh.owner.VerifyEmail(payload.Code, now)
+		if err := rh.db.UserStore().SaveUser(&rh.owner); handleError(w, err) {
+			return
+		}
+		entry := audit.NewEntry(audit.ActionEmailVerify, audit.OutcomeSuccess)
+		entry.Target = rh.owner.ID
+		entry.Detail = rh.owner.Email
+		if !verified {
+			entry.Outcome = audit.OutcomeFailure
+			recordAudit(rh.db, r, rh.user, entry)
+			badRequest(w, errEmailCodeInvalid)
+			return
+		}
+		recordAudit(rh.db, r, rh.user, entry)
+		sendResponse(w, r, rest.DecorateUser(rh.owner, true, true, rh.baseURI), http.StatusOK)
+	default:
+		w.Header().Add("Allow", http.MethodPost)
+		statusResponse(w, http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,274 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/aprice/freenote/audit"
+	"github.com/aprice/freenote/ids"
+	"github.com/aprice/freenote/page"
+	"github.com/aprice/freenote/rest"
+	"github.com/aprice/freenote/stats"
+	"github.com/aprice/freenote/store"
+	"github.com/aprice/freenote/users"
+)
+
+// groupPayload is the body of a request to create or change a group.
+type groupPayload struct {
+	Name    string
+	Members []users.Member
+}
+
+// groups/?.*
+func (rh *requestHandler) doGroups(w http.ResponseWriter, r *http.Request) {
+	if len(rh.path) > 1 {
+		rh.doGroup(w, r)
+		return
+	}
+	defer stats.Measure("req", "groups", r.Method)()
+	switch r.Method {
+	case http.MethodOptions:
+		rh.preflight(w, r, nil, http.MethodGet, http.MethodPost)
+		return
+	case http.MethodGet:
+		pageReq := page.Page{
+			Length: 10,
+			SortBy: "name",
+		}
+		pageReq.FromQueryString(r.URL, []string{"name"})
+		var (
+			list  []users.Group
+			total int
+			err   error
+		)
+		if rh.user.Access >= users.LevelAdmin {
+			list, total, err = rh.db.GroupStore().Groups(pageReq)
+		} else {
+			list, total, err = rh.memberGroups(pageReq)
+		}
+		if handleError(w, err) {
+			return
+		}
+		pageReq.HasMore = total > (pageReq.Start + pageReq.Length)
+		sendResponse(w, r, rest.DecorateGroups(list, pageReq, rh.user.Access >= users.LevelAdmin, rh.baseURI), http.StatusOK)
+	case http.MethodPost:
+		if rh.user.Access < users.LevelAdmin {
+			statusResponse(w, http.StatusForbidden)
+			return
+		}
+		var payload groupPayload
+		if err := parseRequest(r, &payload); badRequest(w, err) {
+			return
+		}
+		group := users.NewGroup(payload.Name, rh.user.ID)
+		if payload.Members != nil {
+			group.Members = payload.Members
+		}
+		if err := rh.validateGroup(group); badRequest(w, err) {
+			return
+		}
+		if err := rh.db.GroupStore().SaveGroup(&group); handleError(w, err) {
+			return
+		}
+		entry := audit.NewEntry(audit.ActionGroupCreate, audit.OutcomeSuccess)
+		entry.Target = group.ID
+		entry.Detail = group.Name
+		recordAudit(rh.db, r, rh.user, entry)
+		w.Header().Add("Location", rest.GroupURI(rh.baseURI, group.ID))
+		sendResponse(w, r, rest.DecorateGroup(group, true, rh.baseURI), http.StatusCreated)
+	default:
+		w.Header().Add("Allow", "GET, POST")
+		statusResponse(w, http.StatusMethodNotAllowed)
+	}
+}
+
+// memberGroups returns a page of the groups the user is a member of, and how
+// many there are in all.
+func (rh *requestHandler) memberGroups(pageReq page.Page) ([]users.Group, int, error) {
+	list, err := rh.db.GroupStore().GroupsByMember(rh.user.ID)
+	if err != nil {
+		return nil, -1, err
+	}
+	total := len(list)
+	if pageReq.SortDescending {
+		for i, j := 0, len(list)-1; i < j; i, j = i+1, j-1 {
+			list[i], list[j] = list[j], list[i]
+		}
+	}
+	start, end := pageReq.Start, pageReq.Start+pageReq.Length
+	if start > total {
+		start = total
+	}
+	if end > total || end < start {
+		end = total
+	}
+	return list[start:end], total, nil
+}
+
+// validateGroup checks a group's name and members, and that its members are
+// all users.
+func (rh *requestHandler) validateGroup(group users.Group) error {
+	if err := group.Validate(); err != nil {
+		return err
+	}
+	for _, m := range group.Members {
+		if _, err := rh.db.UserStore().UserByID(m.User); err == store.ErrNotFound {
+			return fmt.Errorf("no user with ID %s", m.User)
+		} else if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// groups/{id}/?.*
+func (rh *requestHandler) doGroup(w http.ResponseWriter, r *http.Request) {
+	groupID, err := ids.ParseID(rh.popSegment())
+	if badRequest(w, err) {
+		return
+	}
+	group, err := rh.db.GroupStore().GroupByID(groupID)
+	if err == store.ErrNotFound && rh.user.Access < users.LevelAdmin {
+		// Don't tell non-members which groups exist.
+		statusResponse(w, http.StatusForbidden)
+		return
+	} else if handleError(w, err) {
+		return
+	}
+	if !authorizeGroup(rh.user, group) {
+		statusResponse(w, http.StatusForbidden)
+		return
+	}
+	rh.group = &group
+	if next := rh.popSegment(); next == "notes" {
+		rh.doNotes(w, r)
+		return
+	} else if next == "members" {
+		rh.doMember(w, r)
+		return
+	} else if next == "reminders" || next == "reminders.ics" {
+		rh.doReminders(w, r, next == "reminders.ics")
+		return
+	} else if next != "" {
+		statusResponse(w, http.StatusNotFound)
+		return
+	}
+	defer stats.Measure("req", "group", r.Method)()
+	switch r.Method {
+	case http.MethodOptions:
+		rh.preflight(w, r, nil, http.MethodGet, http.MethodPut, http.MethodDelete)
+		return
+	case http.MethodGet:
+		sendResponse(w, r, rest.DecorateGroup(group, authorizeGroupManage(rh.user, group), rh.baseURI), http.StatusOK)
+	case http.MethodPut:
+		if !authorizeGroupManage(rh.user, group) {
+			statusResponse(w, http.StatusForbidden)
+			return
+		}
+		var payload groupPayload
+		if err = parseRequest(r, &payload); badRequest(w, err) {
+			return
+		}
+		group.Name = payload.Name
+		if payload.Members != nil {
+			group.Members = payload.Members
+		}
+		if err = rh.validateGroup(group); badRequest(w, err) {
+			return
+		}
+		rh.saveGroup(w, r, group)
+	case http.MethodDelete:
+		if !authorizeGroupManage(rh.user, group) {
+			statusResponse(w, http.StatusForbidden)
+			return
+		}
+		list, _, err := rh.db.NoteStore().QueryNotes(store.NoteQuery{Owner: group.ID, Page: page.All("modified")})
+		if err != nil && err != store.ErrNotFound {
+			handleError(w, err)
+			return
+		}
+		for _, note := range list {
+			if err = rh.db.NoteStore().DeleteNote(note.ID); handleError(w, err) {
+				return
+			}
+		}
+		if err = rh.db.GroupStore().DeleteGroup(group.ID); handleError(w, err) {
+			return
+		}
+		entry := audit.NewEntry(audit.ActionGroupDelete, audit.OutcomeSuccess)
+		entry.Target = group.ID
+		entry.Detail = group.Name
+		recordAudit(rh.db, r, rh.user, entry)
+		statusResponse(w, http.StatusNoContent)
+	default:
+		w.Header().Add("Allow", "GET, PUT, DELETE")
+		statusResponse(w, http.StatusMethodNotAllowed)
+	}
+}
+
+// saveGroup saves a changed group and responds with it.
+func (rh *requestHandler) saveGroup(w http.ResponseWriter, r *http.Request, group users.Group) {
+	if err := rh.db.GroupStore().SaveGroup(&group); handleError(w, err) {
+		return
+	}
+	entry := audit.NewEntry(audit.ActionGroupUpdate, audit.OutcomeSuccess)
+	entry.Target = group.ID
+	entry.Detail = group.Name
+	recordAudit(rh.db, r, rh.user, entry)
+	sendResponse(w, r, rest.DecorateGroup(group, authorizeGroupManage(rh.user, group), rh.baseURI), http.StatusOK)
+}
+
+// groups/{id}/members/(id|username)
+func (rh *requestHandler) doMember(w http.ResponseWriter, r *http.Request) {
+	idOrName := rh.popSegment()
+	if idOrName == "" || rh.popSegment() != "" {
+		statusResponse(w, http.StatusNotFound)
+		return
+	}
+	var member users.User
+	if id, err := ids.ParseID(idOrName); err == nil {
+		member, err = rh.db.UserStore().UserByID(id)
+		if handleError(w, err) {
+			return
+		}
+	} else if member, err = rh.db.UserStore().UserByName(idOrName); handleError(w, err) {
+		return
+	}
+	group := *rh.group
+	defer stats.Measure("req", "member", r.Method)()
+	switch r.Method {
+	case http.MethodOptions:
+		rh.preflight(w, r, nil, http.MethodPut, http.MethodDelete)
+		return
+	case http.MethodPut:
+		if !authorizeGroupManage(rh.user, group) {
+			statusResponse(w, http.StatusForbidden)
+			return
+		}
+		var payload struct{ Role users.Role }
+		if err := parseRequest(r, &payload); badRequest(w, err) {
+			return
+		}
+		if err := group.SetMember(member.ID, payload.Role); badRequest(w, err) {
+			return
+		}
+		rh.saveGroup(w, r, group)
+	case http.MethodDelete:
+		// Members may leave a group themselves.
+		if member.ID != rh.user.ID && !authorizeGroupManage(rh.user, group) {
+			statusResponse(w, http.StatusForbidden)
+			return
+		}
+		removed, err := group.RemoveMember(member.ID)
+		if badRequest(w, err) {
+			return
+		} else if !removed {
+			statusResponse(w, http.StatusNotFound)
+			return
+		}
+		rh.saveGroup(w, r, group)
+	default:
+		w.Header().Add("Allow", "PUT, DELETE")
+		statusResponse(w, http.StatusMethodNotAllowed)
+	}
+}
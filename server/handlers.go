@@ -1,16 +1,18 @@
 package server
 
 import (
-	"errors"
 	"fmt"
 	"io/ioutil"
 	"log"
 	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
 	"time"
 
 	uuid "github.com/satori/go.uuid"
 
+	"github.com/aprice/freenote/audit"
 	"github.com/aprice/freenote/ids"
 	"github.com/aprice/freenote/notes"
 	"github.com/aprice/freenote/page"
@@ -22,6 +24,13 @@ import (
 
 // session
 func (rh *requestHandler) doSession(w http.ResponseWriter, r *http.Request) {
+	if next := rh.popSegment(); next == "oidc" {
+		rh.doOIDC(w, r)
+		return
+	} else if next != "" {
+		statusResponse(w, http.StatusNotFound)
+		return
+	}
 	defer stats.Measure("req", "session", r.Method)()
 	var err error
 	switch r.Method {
@@ -37,30 +46,65 @@ func (rh *requestHandler) doSession(w http.ResponseWriter, r *http.Request) {
 		return
 	case http.MethodPost:
 		var user users.User
-		if username := strings.ToLower(r.FormValue("username")); username != "" {
+		if challenge := r.FormValue("challenge"); challenge != "" {
+			user, err = rh.answerTwoFactorChallenge(r, challenge, r.FormValue("code"))
+			if handleError(w, err) {
+				return
+			}
+		} else if username := strings.ToLower(r.FormValue("username")); username != "" {
 			user, err = rh.db.UserStore().UserByName(username)
+			if err != nil {
+				auditFailedLogin(rh.db, r, users.User{Username: username}, "unknown user")
+			}
 			if handleError(w, err) {
 				return
 			}
 			var ok bool
 			if ok, err = user.Password.Verify(r.FormValue("password")); !ok || err != nil {
+				auditFailedLogin(rh.db, r, user, "incorrect password")
 				http.Error(w, "Authentication Failed", http.StatusUnauthorized)
 				return
 			}
+			if user.Disabled {
+				auditFailedLogin(rh.db, r, user, users.ErrAccountDisabled.Error())
+				handleError(w, users.ErrAccountDisabled)
+				return
+			}
+			upgradePassword(rh.db.UserStore(), &user, r.FormValue("password"))
+			if user.TwoFactorEnabled() {
+				code := r.FormValue("code")
+				if code == "" {
+					rh.issueTwoFactorChallenge(w, r, user)
+					return
+				}
+				now := time.Now()
+				if !user.LoginTwoFactor(code, now) {
+					if err = rh.db.UserStore().SaveUser(&user); handleError(w, err) {
+						return
+					}
+					auditFailedLogin(rh.db, r, user, twoFactorFailure(user, now))
+					time.Sleep(failedAuthDelay)
+					http.Error(w, "Authentication Failed", http.StatusUnauthorized)
+					return
+				}
+			}
 		} else {
-			user, err = authenticate(w, r, rh.db.UserStore())
+			user, err = authenticate(w, r, rh.db)
 			if handleError(w, err) {
 				return
 			}
 		}
 		user.CleanSessions()
-		sess, err := user.NewSession()
+		sess, err := user.NewSession(r.UserAgent(), sourceIP(r))
 		if handleError(w, err) {
 			return
 		}
 		if err = rh.db.UserStore().SaveUser(&user); handleError(w, err) {
 			return
 		}
+		entry := audit.NewEntry(audit.ActionLogin, audit.OutcomeSuccess)
+		entry.Target = user.ID
+		recordAudit(rh.db, r, user, entry)
 		writeSessionCookie(w, sess)
 		sendResponse(w, r, rest.DecorateUser(user, true, true, rh.baseURI), http.StatusOK)
 	case http.MethodDelete:
@@ -79,7 +123,7 @@ func (rh *requestHandler) doSession(w http.ResponseWriter, r *http.Request) {
 			}
 			payload.SessionID = sess.ID
 			payload.UserID = sess.UserID
-		} else if err := parseRequest(r, payload); badRequest(w, err) {
+		} else if err := parseRequest(r, &payload); badRequest(w, err) {
 			return
 		}
 		if payload.UserID != rh.user.ID {
@@ -88,19 +132,14 @@ func (rh *requestHandler) doSession(w http.ResponseWriter, r *http.Request) {
 		}
 		deleteSessionCookie(w)
 		rh.user.CleanSessions()
-		idx := -1
-		for i, v := range rh.user.Sessions {
-			if v.ID == payload.SessionID {
-				idx = i
-				break
-			}
-		}
-		if idx >= 0 {
-			rh.user.Sessions = append(rh.user.Sessions[:idx], rh.user.Sessions[idx:]...)
+		if rh.user.RemoveSession(payload.SessionID) {
 			if err := rh.db.UserStore().SaveUser(&rh.user); handleError(w, err) {
 				return
 			}
 		}
+		entry := audit.NewEntry(audit.ActionLogout, audit.OutcomeSuccess)
+		entry.Target = rh.user.ID
+		recordAudit(rh.db, r, rh.user, entry)
 	default:
 		w.Header().Add("Allow", "GET, POST, DELETE")
 		statusResponse(w, http.StatusMethodNotAllowed)
@@ -143,6 +182,7 @@ func (rh *requestHandler) doUsers(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 		newUser.ID = uuid.NewV4()
+		newUser.Sessions, newUser.TwoFactor, newUser.Tokens, newUser.Searches = nil, nil, nil, nil
 		var pw string
 		pw, newUser.Password, err = users.RandomPassword(12)
 		if handleError(w, err) {
@@ -153,13 +193,16 @@ func (rh *requestHandler) doUsers(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 		if _, err = rh.db.UserStore().UserByName(newUser.Username); err == nil {
-			badRequest(w, errors.New("username already in use"))
+			badRequest(w, errUsernameTaken)
 			return
 		}
 		if err = rh.db.UserStore().SaveUser(&newUser); handleError(w, err) {
 			log.Println("error saving user: ", err)
 			return
 		}
+		entry := audit.NewEntry(audit.ActionUserCreate, audit.OutcomeSuccess)
+		entry.Target = newUser.ID
+		recordAudit(rh.db, r, rh.user, entry)
 		wn := notes.WelcomeNote(newUser.ID)
 		err = rh.db.NoteStore().SaveNote(&wn)
 		if err != nil {
@@ -202,9 +245,48 @@ func (rh *requestHandler) doUser(w http.ResponseWriter, r *http.Request) {
 	if nextHandler == "password" {
 		rh.doPassword(w, r)
 		return
+	} else if nextHandler == "email" {
+		rh.doEmail(w, r)
+		return
 	} else if nextHandler == "notes" {
 		rh.doNotes(w, r)
 		return
+	} else if nextHandler == "import" {
+		rh.doImport(w, r)
+		return
+	} else if nextHandler == "tasks" {
+		rh.doTasks(w, r)
+		return
+	} else if nextHandler == "favorites" {
+		rh.doFavorites(w, r)
+		return
+	} else if nextHandler == "searches" {
+		rh.doSearches(w, r)
+		return
+	} else if nextHandler == "reorder" {
+		rh.doReorder(w, r)
+		return
+	} else if nextHandler == "reminders" || nextHandler == "reminders.ics" {
+		rh.doReminders(w, r, nextHandler == "reminders.ics")
+		return
+	} else if nextHandler == "audit" {
+		rh.doUserAudit(w, r)
+		return
+	} else if nextHandler == "sessions" {
+		rh.doSessions(w, r)
+		return
+	} else if nextHandler == "access" {
+		rh.doAccess(w, r)
+		return
+	} else if nextHandler == "disabled" {
+		rh.doDisabled(w, r)
+		return
+	} else if nextHandler == "twofactor" {
+		rh.doTwoFactor(w, r)
+		return
+	} else if nextHandler == "tokens" {
+		rh.doTokens(w, r)
+		return
 	} else if len(nextHandler) > 1 {
 		statusResponse(w, http.StatusNotFound)
 		return
@@ -238,9 +320,42 @@ func (rh *requestHandler) doUser(w http.ResponseWriter, r *http.Request) {
 		// Password change is via a different route
 		updateUser.Password = owner.Password
 		updateUser.Sessions = owner.Sessions
+		updateUser.TwoFactor = owner.TwoFactor
+		updateUser.Tokens = owner.Tokens
+		// Saved searches are via a different route
+		updateUser.Searches = owner.Searches
+		// Account status is via a different route, access only changed by admins
+		updateUser.Disabled = owner.Disabled
+		// Email verification is via a different route, and other users never
+		// see the email address, so can't keep it
+		email := updateUser.Email
+		updateUser.Email = owner.Email
+		updateUser.EmailVerified = owner.EmailVerified
+		updateUser.EmailVerification = owner.EmailVerification
+		var emailCode string
+		if rh.user.ID == owner.ID {
+			if emailCode, err = updateUser.SetEmail(email, time.Now()); badRequest(w, err) {
+				return
+			}
+		}
+		if rh.user.Access < users.LevelAdmin {
+			updateUser.Access = owner.Access
+			updateUser.ExternalID = owner.ExternalID
+		} else if err = validateAccessChange(rh.user, owner, updateUser.Access); badRequest(w, err) {
+			return
+		}
 		if err = rh.db.UserStore().SaveUser(updateUser); handleError(w, err) {
 			return
 		}
+		if emailCode != "" && rh.mail.Configured() {
+			rh.sendEmailVerification(*updateUser, emailCode)
+		}
+		entry := audit.NewEntry(audit.ActionUserUpdate, audit.OutcomeSuccess)
+		entry.Target = updateUser.ID
+		recordAudit(rh.db, r, rh.user, entry)
+		if updateUser.Access != owner.Access {
+			auditAccessChange(rh.db, r, rh.user, owner, updateUser.Access)
+		}
 		w.Header().Add("Location", fmt.Sprintf("%s/users/%s", rh.baseURI, updateUser.ID))
 		sendResponse(w, r, rest.DecorateUser(*updateUser, true, true, rh.baseURI), http.StatusOK)
 		return
@@ -276,13 +391,18 @@ func (rh *requestHandler) doPassword(w http.ResponseWriter, r *http.Request) {
 		} else if err = parseRequest(r, &pwr); badRequest(w, err) {
 			return
 		}
-		if err = users.ValidatePassword(pwr.Password); badRequest(w, err) {
+		entry := audit.NewEntry(audit.ActionPasswordChange, audit.OutcomeFailure)
+		entry.Target = rh.owner.ID
+		if err = users.ValidatePassword(pwr.Password); err != nil {
+			entry.Detail = err.Error()
+			recordAudit(rh.db, r, rh.user, entry)
+			badRequest(w, err)
 			return
 		}
 		if rh.owner.Password, err = users.NewPassword(pwr.Password); handleError(w, err) {
 			return
 		}
-		sess, err := rh.owner.NewSession()
+		sess, err := rh.owner.NewSession(r.UserAgent(), sourceIP(r))
 		if handleError(w, err) {
 			return
 		}
@@ -290,6 +410,8 @@ func (rh *requestHandler) doPassword(w http.ResponseWriter, r *http.Request) {
 		if err = rh.db.UserStore().SaveUser(&rh.owner); handleError(w, err) {
 			return
 		}
+		entry.Outcome = audit.OutcomeSuccess
+		recordAudit(rh.db, r, rh.user, entry)
 		w.WriteHeader(http.StatusOK)
 	default:
 		w.Header().Add("Allow", http.MethodPut)
@@ -297,13 +419,44 @@ func (rh *requestHandler) doPassword(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// ownerID returns the ID of the group whose notes are being handled, if any,
+// or else the user's.
+func (rh *requestHandler) ownerID() uuid.UUID {
+	if rh.group != nil {
+		return rh.group.ID
+	}
+	return rh.owner.ID
+}
+
+// ownerURI returns the URI of the group or user whose notes are being handled.
+func (rh *requestHandler) ownerURI() string {
+	if rh.group != nil {
+		return rest.GroupURI(rh.baseURI, rh.group.ID)
+	}
+	return rest.UserURI(rh.baseURI, rh.owner.ID)
+}
+
+// authorizeNotes reports whether the user may read the notes being handled, or
+// with write, create and change them.
+func (rh *requestHandler) authorizeNotes(write bool) bool {
+	if rh.group == nil {
+		return authorizeUser(rh.user, rh.owner)
+	} else if write {
+		return authorizeGroupWrite(rh.user, *rh.group)
+	}
+	return authorizeGroup(rh.user, *rh.group)
+}
+
 // users/{id}/notes/?.*
+// groups/{id}/notes/?.*
 func (rh *requestHandler) doNotes(w http.ResponseWriter, r *http.Request) {
-	if len(rh.path) > 1 {
+	if strings.Trim(rh.path, "/") == "suggest" {
+		rh.doSuggest(w, r)
+		return
+	} else if len(rh.path) > 1 {
 		rh.doNote(w, r)
 		return
 	}
-	var err error
 	folderPath := r.URL.Query().Get("folder")
 	defer stats.Measure("req", "notes", r.Method)()
 	switch r.Method {
@@ -311,92 +464,154 @@ func (rh *requestHandler) doNotes(w http.ResponseWriter, r *http.Request) {
 		rh.preflight(w, r, nil, http.MethodGet, http.MethodPost)
 		return
 	case http.MethodGet:
-		if !authorizeUser(rh.user, rh.owner) {
+		if !rh.authorizeNotes(false) {
 			statusResponse(w, http.StatusForbidden)
 			return
 		}
 		//TODO: Option to list folders instead of notes
-		//TODO: Option to filter by tag
-		//TODO: Full text search
-		var (
-			list  []notes.Note
-			total int
-		)
-		pageReq := page.Page{
-			Length:         10,
-			SortBy:         "modified",
-			SortDescending: true,
-		}
-		pageReq.FromQueryString(r.URL, []string{"modified", "title", "created"})
-		modifiedSince := time.Time{}
-		if msRaw := r.URL.Query().Get("modifiedSince"); msRaw != "" {
-			modifiedSince, err = time.Parse(time.RFC3339, msRaw)
-			if badRequest(w, err) {
-				return
-			}
-		}
-
-		q := store.NoteQuery{
-			Owner:         rh.owner.ID,
-			Page:          pageReq,
-			Folder:        folderPath,
-			ModifiedSince: modifiedSince,
-		}
-		list, total, err = rh.db.NoteStore().QueryNotes(q)
-		if handleError(w, err) {
+		q, filter, err := parseNoteQuery(r.URL)
+		if badRequest(w, err) {
 			return
 		}
-		pageReq.HasMore = total > (pageReq.Start + pageReq.Length)
-		sendResponse(w, r, rest.DecorateNotes(rh.owner, list, folderPath, pageReq, authorizeUser(rh.user, rh.owner), rh.baseURI), http.StatusOK)
+		rh.sendNotes(w, r, q, filter)
 	case http.MethodPost:
+		if !rh.authorizeNotes(true) {
+			statusResponse(w, http.StatusForbidden)
+			return
+		}
 		note := new(notes.Note)
 		var err error
 		if err = parseRequest(r, note); badRequest(w, err) {
 			return
 		}
 		note.ID = uuid.NewV4()
-		note.Owner = rh.owner.ID
+		note.Owner = rh.ownerID()
+		note.Version = 0
 		if folderPath != "" {
 			note.Folder = folderPath
 		}
-		if note.Folder != "" {
-			parts := strings.Split(note.Folder, "/")
-			if _, err = uuid.FromString(parts[0]); err == nil {
-				http.Error(w, "Bad Request: root folder cannot be UUID", http.StatusBadRequest)
-				return
-			}
+		if err = notes.ValidateFolder(note.Folder); badRequest(w, err) {
+			return
+		}
+		if err = rh.prepareReminders(note, nil); badRequest(w, err) {
+			return
+		}
+		if ok, err := rh.remindersAllowed(*note); handleError(w, err) {
+			return
+		} else if !ok {
+			badRequest(w, errTooManyReminders)
+			return
+		}
+		if err = prepareProperties(note, nil); badRequest(w, err) {
+			return
 		}
 		ensureMarkdownBody(note, rh.sanitizer)
 		if err = rh.db.NoteStore().SaveNote(note); handleError(w, err) {
 			return
 		}
 		ensureHTMLBody(note, rh.sanitizer)
-		w.Header().Add("Location", fmt.Sprintf("%s/users/%s/notes/%s", rh.baseURI, rh.owner.ID, note.ID))
-		sendResponse(w, r, rest.DecorateNote(*note, true, rh.baseURI), http.StatusCreated)
+		w.Header().Add("Location", fmt.Sprintf("%s/notes/%s", rh.ownerURI(), note.ID))
+		sendResponse(w, r, rest.DecorateNote(*note, true, rh.ownerURI()), http.StatusCreated)
 	default:
 		w.Header().Add("Allow", "GET, POST")
 		statusResponse(w, http.StatusMethodNotAllowed)
 	}
 }
 
+// parseNoteQuery reads a notes collection query from a request URL, returning
+// it along with the filter query string to keep on page links.
+func parseNoteQuery(u *url.URL) (store.NoteQuery, string, error) {
+	var err error
+	query := u.Query()
+	pageReq := page.Page{
+		Length:         10,
+		SortBy:         "modified",
+		SortDescending: true,
+	}
+	pageReq.FromQueryString(u, []string{"modified", "title", "created", "position"})
+	if sort := query.Get("sort"); strings.HasPrefix(sort, store.PropertySortPrefix) &&
+		notes.PropertyNamePattern.MatchString(strings.TrimPrefix(sort, store.PropertySortPrefix)) {
+		pageReq.SortBy = sort
+	}
+	q := store.NoteQuery{
+		Page:   pageReq,
+		Folder: query.Get("folder"),
+		Tag:    query.Get("tag"),
+	}
+	if q.Search, err = notes.ParseQuery(query.Get("q"), time.Now()); err != nil {
+		return q, "", err
+	}
+	if msRaw := query.Get("modifiedSince"); msRaw != "" {
+		if q.ModifiedSince, err = time.Parse(time.RFC3339, msRaw); err != nil {
+			return q, "", err
+		}
+	}
+	if raw := query.Get("pinned"); raw != "" {
+		if q.Pinned, err = strconv.ParseBool(raw); err != nil {
+			return q, "", err
+		}
+	}
+	if raw := query.Get("favorite"); raw != "" {
+		if q.Favorite, err = strconv.ParseBool(raw); err != nil {
+			return q, "", err
+		}
+	}
+	var props []string
+	if q.Properties, props, err = parsePropertyFilters(u.RawQuery); err != nil {
+		return q, "", err
+	}
+	filter := url.Values{}
+	for _, k := range []string{"folder", "tag", "q", "modifiedSince", "pinned", "favorite"} {
+		if v := query.Get(k); v != "" {
+			filter.Set(k, v)
+		}
+	}
+	if enc := filter.Encode(); enc != "" {
+		props = append([]string{enc}, props...)
+	}
+	return q, strings.Join(props, "&"), nil
+}
+
+// sendNotes responds with a page of the owner's notes matching a query.
+func (rh *requestHandler) sendNotes(w http.ResponseWriter, r *http.Request, q store.NoteQuery, filter string) {
+	q.Owner = rh.ownerID()
+	list, total, err := rh.db.NoteStore().QueryNotes(q)
+	if handleError(w, err) {
+		return
+	}
+	q.Page.HasMore = total > (q.Page.Start + q.Page.Length)
+	sendResponse(w, r, rest.DecorateNotes(list, filter, q.Search.TextTerms(), q.Page, rh.authorizeNotes(true), rh.ownerURI()), http.StatusOK)
+}
+
 // users/{id}/notes/{id}
+// groups/{id}/notes/{id}
 func (rh *requestHandler) doNote(w http.ResponseWriter, r *http.Request) {
 	var (
-		noteID uuid.UUID
-		err    error
-		note   notes.Note
+		noteID  uuid.UUID
+		err     error
+		note    notes.Note
+		created bool
 	)
 	if noteID, err = ids.ParseID(rh.popSegment()); badRequest(w, err) {
 		return
 	}
-	if note, err = rh.db.NoteStore().NoteByID(noteID); handleError(w, err) {
+	if note, err = rh.db.NoteStore().NoteByID(noteID); err == store.ErrNotFound && r.Method == http.MethodPut {
+		// PUT to an unused ID creates the note, so restored notes keep their IDs.
+		note, created = notes.Note{ID: noteID, Owner: rh.ownerID()}, true
+	} else if handleError(w, err) {
 		return
 	}
-	if note.Owner != rh.owner.ID {
+	if note.Owner != rh.ownerID() {
 		http.NotFound(w, r)
 		return
 	}
-	// If there were anything chained after this, we'd add note to the context.
+	if next := rh.popSegment(); next == "tasks" {
+		rh.doTask(w, r, note)
+		return
+	} else if next != "" {
+		statusResponse(w, http.StatusNotFound)
+		return
+	}
 	defer stats.Measure("req", "note", r.Method)()
 	switch r.Method {
 	case http.MethodOptions:
@@ -404,21 +619,26 @@ func (rh *requestHandler) doNote(w http.ResponseWriter, r *http.Request) {
 		return
 	case http.MethodGet:
 		//TODO: Sharing
-		if !authorizeNote(rh.user, note) {
+		if !authorizeNote(rh.user, note, rh.group) {
 			statusResponse(w, http.StatusForbidden)
 			return
 		}
 		ensureHTMLBody(&note, rh.sanitizer)
 		//TODO: text/markdown, text/plain Accept support & front matter addition
-		sendResponse(w, r, rest.DecorateNote(note, authorizeNoteWrite(rh.user, note), rh.baseURI), http.StatusOK)
+		w.Header().Set("ETag", note.ETag())
+		sendResponse(w, r, rest.DecorateNote(note, authorizeNoteWrite(rh.user, note, rh.group), rh.ownerURI()), http.StatusOK)
 	case http.MethodPut:
-		//TODO: Conflict checking (etag, modified, etc)
 		//TODO: Sharing
 		//TODO: text/markdown, text/plain, text/html Content-Type support & front matter parsing
-		if !authorizeUser(rh.user, rh.owner) {
+		if !rh.authorizeNotes(true) {
 			statusResponse(w, http.StatusForbidden)
 			return
 		}
+		if !ifMatch(r, note, !created) {
+			statusResponse(w, http.StatusPreconditionFailed)
+			return
+		}
+		existing := note
 		note := new(notes.Note)
 		var err error
 		if err = parseRequest(r, note); badRequest(w, err) {
@@ -429,18 +649,53 @@ func (rh *requestHandler) doNote(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, "Bad Request: cant't change ID", http.StatusBadRequest)
 			return
 		}
+		note.Owner = rh.ownerID()
+		// The version is the server's, whatever the client sent.
+		note.Version = existing.Version
+		if err = notes.ValidateFolder(note.Folder); badRequest(w, err) {
+			return
+		}
+		if err = rh.prepareReminders(note, existing.Reminders); badRequest(w, err) {
+			return
+		}
+		if ok, err := rh.remindersAllowed(*note); handleError(w, err) {
+			return
+		} else if !ok {
+			badRequest(w, errTooManyReminders)
+			return
+		}
+		if err = prepareProperties(note, existing.Properties); badRequest(w, err) {
+			return
+		}
 		ensureMarkdownBody(note, rh.sanitizer)
-		if err = rh.db.NoteStore().SaveNote(note); handleError(w, err) {
+		// Saving an existing note fails if it's been saved since it was read
+		// above, so concurrent PUTs with the same ETag can't both succeed.
+		if created {
+			err = rh.db.NoteStore().SaveNote(note)
+		} else {
+			err = rh.db.NoteStore().UpdateNote(note)
+		}
+		if handleError(w, err) {
 			return
 		}
 		ensureHTMLBody(note, rh.sanitizer)
-		sendResponse(w, r, rest.DecorateNote(*note, authorizeNoteWrite(rh.user, *note), rh.baseURI), http.StatusOK)
+		w.Header().Set("ETag", note.ETag())
+		status := http.StatusOK
+		if created {
+			w.Header().Add("Location", fmt.Sprintf("%s/notes/%s", rh.ownerURI(), note.ID))
+			status = http.StatusCreated
+		}
+		sendResponse(w, r, rest.DecorateNote(*note, authorizeNoteWrite(rh.user, *note, rh.group), rh.ownerURI()), status)
 		return
 	case http.MethodDelete:
-		if !authorizeNote(rh.user, note) {
+		if !rh.authorizeNotes(true) {
 			statusResponse(w, http.StatusForbidden)
 			return
 		}
+		if !ifMatch(r, note, true) {
+			statusResponse(w, http.StatusPreconditionFailed)
+			return
+		}
 		if err := rh.db.NoteStore().DeleteNote(noteID); handleError(w, err) {
 			return
 		}
@@ -450,3 +705,22 @@ func (rh *requestHandler) doNote(w http.ResponseWriter, r *http.Request) {
 		statusResponse(w, http.StatusMethodNotAllowed)
 	}
 }
+
+// ifMatch checks a request's If-Match header, if any, against the current
+// version of a note, which may not exist yet.
+func ifMatch(r *http.Request, note notes.Note, exists bool) bool {
+	im := r.Header.Get("If-Match")
+	if im == "" {
+		return true
+	}
+	if !exists {
+		return false
+	}
+	etag := note.ETag()
+	for _, candidate := range strings.Split(im, ",") {
+		if candidate = strings.TrimSpace(candidate); candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
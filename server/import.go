@@ -0,0 +1,61 @@
+package server
+
+import (
+	"mime"
+	"net/http"
+
+	"github.com/aprice/freenote/importer"
+	"github.com/aprice/freenote/notes"
+	"github.com/aprice/freenote/stats"
+)
+
+// Largest import file accepted, in bytes.
+const maxImportSize = 64 << 20
+
+// users/{id}/import
+func (rh *requestHandler) doImport(w http.ResponseWriter, r *http.Request) {
+	defer stats.Measure("req", "import", r.Method)()
+	switch r.Method {
+	case http.MethodOptions:
+		rh.preflight(w, r, nil, http.MethodPost)
+		return
+	case http.MethodPost:
+		if !authorizeUser(rh.user, rh.owner) {
+			statusResponse(w, http.StatusForbidden)
+			return
+		}
+		ctype, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		format, err := importer.ParseFormat(r.URL.Query().Get("format"), ctype)
+		if badRequest(w, err) {
+			return
+		}
+		folder := r.URL.Query().Get("folder")
+		if badRequest(w, notes.ValidateFolder(folder)) {
+			return
+		}
+		items, err := importer.Read(format, http.MaxBytesReader(w, r.Body, maxImportSize))
+		if badRequest(w, err) {
+			return
+		}
+		report := importer.Report{Results: make([]importer.Result, 0, len(items))}
+		ns := rh.db.NoteStore()
+		for _, item := range items {
+			err = nil
+			if item.Err == nil {
+				importer.Prepare(&item.Note, rh.owner.ID, folder)
+				err = notes.ValidateFolder(item.Note.Folder)
+			}
+			if item.Err == nil && err == nil {
+				ensureMarkdownBody(&item.Note, rh.sanitizer)
+				// Never keep imported HTML, it's rendered from markdown on read.
+				item.Note.HTMLBody = ""
+				err = ns.SaveNote(&item.Note)
+			}
+			report.Add(item, err)
+		}
+		sendResponse(w, r, report, http.StatusOK)
+	default:
+		w.Header().Add("Allow", http.MethodPost)
+		statusResponse(w, http.StatusMethodNotAllowed)
+	}
+}
@@ -1,6 +1,9 @@
 package server
 
 import (
+	"fmt"
+	"io"
+	"regexp"
 	"strings"
 
 	"github.com/lunny/html2md"
@@ -49,15 +52,82 @@ func init() {
 	})
 }
 
+// newSanitizer returns the policy for sanitizing rendered note bodies, which
+// allows the checkboxes rendered for task list items.
+func newSanitizer() *bluemonday.Policy {
+	p := bluemonday.UGCPolicy()
+	p.AllowAttrs("type").Matching(regexp.MustCompile(`^checkbox$`)).OnElements("input")
+	p.AllowAttrs("checked", "disabled", "data-task").OnElements("input")
+	return p
+}
+
+// checkboxPattern matches the checkboxes rendered for task list items.
+var checkboxPattern = regexp.MustCompile(`<input[^>]*type="checkbox"[^>]*>`)
+
 func ensureMarkdownBody(note *notes.Note, p *bluemonday.Policy) {
 	if note.Body == "" && note.HTMLBody != "" {
-		note.Body = html2md.Convert(note.HTMLBody)
+		// Turn task checkboxes back into markers, which html2md would drop.
+		html := checkboxPattern.ReplaceAllStringFunc(note.HTMLBody, func(tag string) string {
+			if strings.Contains(tag, " checked") {
+				return "[x]"
+			}
+			return "[ ]"
+		})
+		note.Body = html2md.Convert(html)
 	}
 }
 
 func ensureHTMLBody(note *notes.Note, p *bluemonday.Policy) {
 	if note.HTMLBody == "" && note.Body != "" {
-		raw := blackfriday.Run([]byte(note.Body), blackfriday.WithRenderer(bfRender), blackfriday.WithExtensions(bfExt))
+		r := &taskRenderer{Renderer: bfRender, tasks: notes.Tasks(note.Body)}
+		raw := blackfriday.Run([]byte(note.Body), blackfriday.WithRenderer(r), blackfriday.WithExtensions(bfExt))
 		note.HTMLBody = string(p.SanitizeBytes(raw))
 	}
 }
+
+// taskRenderer renders GitHub-style task list items as checkboxes, labelled
+// with the IDs of the note's tasks in order.
+type taskRenderer struct {
+	blackfriday.Renderer
+	tasks []notes.Task
+	next  int
+	lost  bool
+}
+
+// RenderNode replaces the marker at the start of a list item with a checkbox.
+func (r *taskRenderer) RenderNode(w io.Writer, node *blackfriday.Node, entering bool) blackfriday.WalkStatus {
+	if !entering || !isTaskItem(node) {
+		return r.Renderer.RenderNode(w, node, entering)
+	}
+	checked := node.Literal[1] != ' '
+	io.WriteString(w, `<input type="checkbox" disabled="disabled"`)
+	if checked {
+		io.WriteString(w, ` checked="checked"`)
+	}
+	// If the items rendered get out of step with the tasks found in the body,
+	// stop labelling them rather than risk toggling the wrong one.
+	if r.next >= len(r.tasks) || r.tasks[r.next].Checked != checked {
+		r.lost = true
+	}
+	if !r.lost {
+		fmt.Fprintf(w, ` data-task="%s"`, r.tasks[r.next].ID)
+	}
+	r.next++
+	io.WriteString(w, ` />`)
+	node.Literal = node.Literal[3:]
+	return r.Renderer.RenderNode(w, node, entering)
+}
+
+// isTaskItem reports whether a node is the text at the start of a list item
+// beginning with a task marker.
+func isTaskItem(node *blackfriday.Node) bool {
+	para := node.Parent
+	if node.Type != blackfriday.Text || node.Prev != nil || para == nil ||
+		para.Type != blackfriday.Paragraph || para.Prev != nil ||
+		para.Parent == nil || para.Parent.Type != blackfriday.Item {
+		return false
+	}
+	lit := node.Literal
+	return len(lit) >= 4 && lit[0] == '[' && lit[2] == ']' && lit[3] == ' ' &&
+		(lit[1] == ' ' || lit[1] == 'x' || lit[1] == 'X')
+}
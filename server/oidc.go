@@ -0,0 +1,313 @@
+package server
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aprice/freenote/audit"
+	"github.com/aprice/freenote/oidc"
+	"github.com/aprice/freenote/stats"
+	"github.com/aprice/freenote/store"
+	"github.com/aprice/freenote/users"
+)
+
+var errOIDCState = errors.New("login state missing or invalid")
+var errOIDCNoGroup = errors.New("not a member of any allowed group")
+var errOIDCLinked = errors.New("user already linked to another identity")
+
+// oidcCookie holds login state between redirecting to the identity provider
+// and the callback.
+const oidcCookie = "oidc"
+
+const oidcLoginLifetime = 10 * time.Minute
+
+type oidcLogin struct {
+	State    string
+	Nonce    string
+	Verifier string
+	Return   string
+}
+
+// session/oidc/?.*
+func (rh *requestHandler) doOIDC(w http.ResponseWriter, r *http.Request) {
+	if rh.oidc == nil {
+		statusResponse(w, http.StatusNotFound)
+		return
+	}
+	next := rh.popSegment()
+	if next != "" && next != "callback" {
+		statusResponse(w, http.StatusNotFound)
+		return
+	}
+	defer stats.Measure("req", "oidc", r.Method)()
+	switch r.Method {
+	case http.MethodOptions:
+		rh.preflight(w, r, nil, http.MethodGet)
+		return
+	case http.MethodGet:
+		if next == "callback" {
+			rh.oidcCallback(w, r)
+		} else {
+			rh.oidcRedirect(w, r)
+		}
+	default:
+		w.Header().Add("Allow", http.MethodGet)
+		statusResponse(w, http.StatusMethodNotAllowed)
+	}
+}
+
+func (rh *requestHandler) oidcRedirectURI() string {
+	return rh.baseURI + "/session/oidc/callback"
+}
+
+// oidcRedirect starts a login, sending the user to the identity provider.
+func (rh *requestHandler) oidcRedirect(w http.ResponseWriter, r *http.Request) {
+	var (
+		login oidcLogin
+		err   error
+	)
+	for _, v := range []*string{&login.State, &login.Nonce, &login.Verifier} {
+		if *v, err = oidc.RandomToken(); handleError(w, err) {
+			return
+		}
+	}
+	// Only allow local paths, to avoid an open redirect
+	if ret := r.URL.Query().Get("return"); strings.HasPrefix(ret, "/") && !strings.HasPrefix(ret, "//") {
+		login.Return = ret
+	}
+	authURL, err := rh.oidc.AuthURL(r.Context(), rh.oidcRedirectURI(), login.State, login.Nonce, oidc.Challenge(login.Verifier))
+	if err != nil {
+		log.Println("OIDC discovery failed: ", err)
+		statusResponse(w, http.StatusBadGateway)
+		return
+	}
+	b, err := json.Marshal(login)
+	if handleError(w, err) {
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcCookie,
+		Value:    base64.RawURLEncoding.EncodeToString(b),
+		Path:     "/session/oidc",
+		MaxAge:   int(oidcLoginLifetime / time.Second),
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(rh.baseURI, "https"),
+	})
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// oidcCallback completes a login when the identity provider redirects back.
+func (rh *requestHandler) oidcCallback(w http.ResponseWriter, r *http.Request) {
+	login, err := readOIDCLogin(r)
+	http.SetCookie(w, &http.Cookie{
+		Name:    oidcCookie,
+		Value:   "",
+		Path:    "/session/oidc",
+		Expires: time.Now(),
+		MaxAge:  -1,
+	})
+	q := r.URL.Query()
+	if err == nil && subtle.ConstantTimeCompare([]byte(q.Get("state")), []byte(login.State)) != 1 {
+		err = errOIDCState
+	}
+	if badRequest(w, err) {
+		return
+	}
+	if e := q.Get("error"); e != "" {
+		auditFailedLogin(rh.db, r, users.User{}, "identity provider: "+e)
+		http.Error(w, "Authentication Failed: "+e, http.StatusUnauthorized)
+		return
+	}
+	raw, err := rh.oidc.Exchange(r.Context(), q.Get("code"), login.Verifier, rh.oidcRedirectURI())
+	if err != nil {
+		log.Println("OIDC code exchange failed: ", err)
+		auditFailedLogin(rh.db, r, users.User{}, err.Error())
+		http.Error(w, "Authentication Failed", http.StatusUnauthorized)
+		return
+	}
+	claims, err := rh.oidc.Verify(r.Context(), raw, login.Nonce, time.Now())
+	if err != nil {
+		log.Println("OIDC token verification failed: ", err)
+		auditFailedLogin(rh.db, r, users.User{}, err.Error())
+		http.Error(w, "Authentication Failed", http.StatusUnauthorized)
+		return
+	}
+	user, err := rh.oidcUser(r, claims)
+	if err == store.ErrNotFound {
+		auditFailedLogin(rh.db, r, users.User{Username: claims.Subject()}, "no user for external identity")
+		http.Error(w, "Authentication Failed", http.StatusUnauthorized)
+		return
+	} else if err == errOIDCNoGroup || err == errOIDCLinked || err == errUsernameTaken || err == users.ErrAccountDisabled {
+		auditFailedLogin(rh.db, r, user, err.Error())
+		http.Error(w, "Forbidden: "+err.Error(), http.StatusForbidden)
+		return
+	} else if badRequest(w, err) {
+		return
+	}
+	user.CleanSessions()
+	sess, err := user.NewSession(r.UserAgent(), sourceIP(r))
+	if handleError(w, err) {
+		return
+	}
+	if err = rh.db.UserStore().SaveUser(&user); handleError(w, err) {
+		return
+	}
+	entry := audit.NewEntry(audit.ActionLogin, audit.OutcomeSuccess)
+	entry.Target = user.ID
+	entry.Detail = "oidc"
+	recordAudit(rh.db, r, user, entry)
+	writeSessionCookie(w, sess)
+	ret := login.Return
+	if ret == "" {
+		ret = "/"
+	}
+	http.Redirect(w, r, rh.baseURI+ret, http.StatusFound)
+}
+
+func readOIDCLogin(r *http.Request) (oidcLogin, error) {
+	var login oidcLogin
+	c, err := r.Cookie(oidcCookie)
+	if err != nil {
+		return login, errOIDCState
+	}
+	b, err := base64.RawURLEncoding.DecodeString(c.Value)
+	if err != nil {
+		return login, errOIDCState
+	}
+	if err = json.Unmarshal(b, &login); err != nil || login.State == "" {
+		return login, errOIDCState
+	}
+	return login, nil
+}
+
+// oidcUser finds or provisions the user for an external identity, and applies
+// any group access mapping. The user is not saved.
+func (rh *requestHandler) oidcUser(r *http.Request, claims oidc.Claims) (users.User, error) {
+	conf := rh.conf.OIDC
+	us := rh.db.UserStore()
+	level, err := oidcAccess(conf.GroupAccess, claims.Strings(conf.GroupsClaim))
+	if err != nil {
+		return users.User{Username: claims.Subject()}, err
+	}
+	externalID := claims.Issuer() + "#" + claims.Subject()
+	user, err := us.UserByExternalID(externalID)
+	if err == store.ErrNotFound {
+		if conf.LinkByUsername {
+			user, err = oidcLinkUser(us, claims, conf.UsernameClaim)
+			if err == nil && user.ExternalID != "" {
+				return user, errOIDCLinked
+			}
+		}
+		if err == store.ErrNotFound && conf.Provision {
+			username := oidcUsername(claims, conf.UsernameClaim)
+			if user, err = provisionUser(rh.db, r, username, claims.String("name"), "oidc"); err != nil {
+				return users.User{}, err
+			}
+			user.Email = oidcVerifiedEmail(claims)
+			user.EmailVerified = user.Email != ""
+		}
+	}
+	if err != nil {
+		return users.User{}, err
+	}
+	if user.Disabled {
+		return user, users.ErrAccountDisabled
+	}
+	user.ExternalID = externalID
+	if level != users.LevelAnon && level != user.Access && user.Access != users.LevelRecovery {
+		auditAccessChange(rh.db, r, user, user, level)
+		user.Access = level
+	}
+	return user, nil
+}
+
+// oidcLinkUser finds the local user to link an external identity to, by the
+// full value of the configured claim. If that's an email address, it's only
+// matched against users' email addresses, and only if the provider has
+// verified it and exactly one local user has verified it too, as users set
+// their own addresses; usernames never match just the local part of an
+// address.
+func oidcLinkUser(us store.UserStore, claims oidc.Claims, claim string) (users.User, error) {
+	value := claims.String(oidcUsernameClaim(claim))
+	if value == "" {
+		return users.User{}, store.ErrNotFound
+	}
+	if strings.Contains(value, "@") {
+		email := oidcVerifiedEmail(claims)
+		if email == "" || email != value {
+			return users.User{}, store.ErrNotFound
+		}
+		return oidcUserByEmail(us, email)
+	}
+	return us.UserByName(strings.ToLower(value))
+}
+
+// oidcUserByEmail finds the one user who has verified an email address.
+func oidcUserByEmail(us store.UserStore, email string) (users.User, error) {
+	list, err := us.UsersByEmail(email)
+	if err != nil {
+		return users.User{}, err
+	}
+	var found []users.User
+	for _, user := range list {
+		if user.EmailVerified {
+			found = append(found, user)
+		}
+	}
+	if len(found) != 1 {
+		return users.User{}, store.ErrNotFound
+	}
+	return found[0], nil
+}
+
+// oidcVerifiedEmail returns the email claim if the provider has verified it,
+// or "" otherwise.
+func oidcVerifiedEmail(claims oidc.Claims) string {
+	if !claims.Bool("email_verified") {
+		return ""
+	}
+	return claims.String("email")
+}
+
+// oidcUsername derives a username for a new user from the configured claim,
+// using the local part of email addresses.
+func oidcUsername(claims oidc.Claims, claim string) string {
+	name := strings.ToLower(claims.String(oidcUsernameClaim(claim)))
+	if at := strings.Index(name, "@"); at >= 0 {
+		name = name[:at]
+	}
+	return name
+}
+
+// oidcUsernameClaim returns the configured username claim, or the default.
+func oidcUsernameClaim(claim string) string {
+	if claim == "" {
+		return "preferred_username"
+	}
+	return claim
+}
+
+// oidcAccess returns the highest access level mapped from any of the given
+// groups. It returns LevelAnon if no groups are mapped, and errOIDCNoGroup if
+// groups are mapped but the user is in none of them.
+func oidcAccess(mapping map[string]string, groups []string) (users.AccessLevel, error) {
+	if len(mapping) == 0 {
+		return users.LevelAnon, nil
+	}
+	level := users.LevelAnon
+	for _, g := range groups {
+		if l := users.ParseAccessLevel(mapping[g]); l > level && l <= users.LevelAdmin {
+			level = l
+		}
+	}
+	if level == users.LevelAnon {
+		return level, errOIDCNoGroup
+	}
+	return level, nil
+}
@@ -0,0 +1,133 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+
+	uuid "github.com/satori/go.uuid"
+
+	"github.com/aprice/freenote/notes"
+	"github.com/aprice/freenote/page"
+	"github.com/aprice/freenote/stats"
+	"github.com/aprice/freenote/store"
+)
+
+var errNotInFolder = errors.New("note not in folder")
+
+// users/{id}/favorites
+func (rh *requestHandler) doFavorites(w http.ResponseWriter, r *http.Request) {
+	if rh.popSegment() != "" {
+		statusResponse(w, http.StatusNotFound)
+		return
+	}
+	defer stats.Measure("req", "favorites", r.Method)()
+	switch r.Method {
+	case http.MethodOptions:
+		rh.preflight(w, r, nil, http.MethodGet)
+	case http.MethodGet:
+		if !authorizeUser(rh.user, rh.owner) {
+			statusResponse(w, http.StatusForbidden)
+			return
+		}
+		q, filter, err := parseNoteQuery(r.URL)
+		if badRequest(w, err) {
+			return
+		}
+		if !q.Favorite {
+			q.Favorite = true
+			filter = strings.TrimPrefix(filter+"&favorite=true", "&")
+		}
+		rh.sendNotes(w, r, q, filter)
+	default:
+		w.Header().Add("Allow", http.MethodGet)
+		statusResponse(w, http.StatusMethodNotAllowed)
+	}
+}
+
+// users/{id}/reorder
+func (rh *requestHandler) doReorder(w http.ResponseWriter, r *http.Request) {
+	if rh.popSegment() != "" {
+		statusResponse(w, http.StatusNotFound)
+		return
+	}
+	defer stats.Measure("req", "reorder", r.Method)()
+	switch r.Method {
+	case http.MethodOptions:
+		rh.preflight(w, r, nil, http.MethodPost)
+	case http.MethodPost:
+		if !authorizeUser(rh.user, rh.owner) {
+			statusResponse(w, http.StatusForbidden)
+			return
+		}
+		req := struct {
+			Folder string      `json:"folder"`
+			Notes  []uuid.UUID `json:"notes"`
+		}{}
+		if err := parseRequest(r, &req); badRequest(w, err) {
+			return
+		}
+		ns := rh.db.NoteStore()
+		list, _, err := ns.QueryNotes(store.NoteQuery{
+			Owner:  rh.owner.ID,
+			Folder: req.Folder,
+			Page:   page.All("position"),
+		})
+		if err == store.ErrNotFound {
+			err = nil
+		}
+		if handleError(w, err) {
+			return
+		}
+		ordered, err := reorder(list, req.Folder, req.Notes)
+		if badRequest(w, err) {
+			return
+		}
+		for i := range ordered {
+			if ordered[i].Position == i+1 {
+				continue
+			}
+			ordered[i].Position = i + 1
+			if err = ns.SaveNote(&ordered[i]); handleError(w, err) {
+				return
+			}
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.Header().Add("Allow", http.MethodPost)
+		statusResponse(w, http.StatusMethodNotAllowed)
+	}
+}
+
+// reorder returns the notes in a folder in a new manual order: the given IDs
+// first, then the rest in their current order.
+func reorder(list []notes.Note, folder string, order []uuid.UUID) ([]notes.Note, error) {
+	byID := make(map[uuid.UUID]notes.Note)
+	var rest []notes.Note
+	for _, note := range list {
+		// An empty folder query matches every folder, not just the root.
+		if note.Folder == folder {
+			byID[note.ID] = note
+			rest = append(rest, note)
+		}
+	}
+	ordered := make([]notes.Note, 0, len(rest))
+	for _, id := range order {
+		note, ok := byID[id]
+		if !ok {
+			return nil, errNotInFolder
+		}
+		delete(byID, id)
+		ordered = append(ordered, note)
+	}
+	sort.SliceStable(rest, func(i, j int) bool {
+		return rest[i].Position < rest[j].Position
+	})
+	for _, note := range rest {
+		if _, ok := byID[note.ID]; ok {
+			ordered = append(ordered, note)
+		}
+	}
+	return ordered, nil
+}
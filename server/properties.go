@@ -0,0 +1,50 @@
+package server
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/aprice/freenote/notes"
+)
+
+// propertyFilterPattern matches a property filter query parameter, such as
+// prop.priority>=2, once unescaped.
+var propertyFilterPattern = regexp.MustCompile(`^prop\.([\p{L}\p{N}_-]+)(!=|<=|>=|=|<|>)(.*)$`)
+
+// parsePropertyFilters reads property filters from a raw query string. The
+// operator is part of the parameter, so they can't be read from parsed query
+// values. It also returns the filters re-encoded, to keep on page links.
+func parsePropertyFilters(rawQuery string) ([]notes.PropertyFilter, []string, error) {
+	var (
+		filters []notes.PropertyFilter
+		encoded []string
+	)
+	for _, raw := range strings.Split(rawQuery, "&") {
+		if !strings.HasPrefix(raw, "prop.") {
+			continue
+		}
+		param, err := url.QueryUnescape(raw)
+		if err != nil {
+			return nil, nil, err
+		}
+		m := propertyFilterPattern.FindStringSubmatch(param)
+		if m == nil {
+			return nil, nil, notes.ErrPropertyName
+		}
+		filters = append(filters, notes.PropertyFilter{Name: m[1], Op: m[2], Value: m[3]})
+		encoded = append(encoded, "prop."+url.QueryEscape(m[1])+m[2]+url.QueryEscape(m[3]))
+	}
+	return filters, encoded, nil
+}
+
+// prepareProperties validates the properties of a note being saved. A note
+// saved without any properties keeps its existing properties, so clients that
+// don't know about properties don't remove them.
+func prepareProperties(note *notes.Note, existing map[string]notes.Property) error {
+	if note.Properties == nil {
+		note.Properties = existing
+		return nil
+	}
+	return notes.ValidateProperties(note.Properties)
+}
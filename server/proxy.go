@@ -0,0 +1,134 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/aprice/freenote/config"
+	"github.com/aprice/freenote/store"
+	"github.com/aprice/freenote/users"
+)
+
+// trustedProxies is a set of networks whose forwarding headers are trusted.
+type trustedProxies []*net.IPNet
+
+// parseTrustedProxies parses a list of IP addresses and CIDR ranges.
+func parseTrustedProxies(in []string) (trustedProxies, error) {
+	out := make(trustedProxies, 0, len(in))
+	for _, s := range in {
+		s = strings.TrimSpace(s)
+		if !strings.Contains(s, "/") {
+			ip := net.ParseIP(s)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid trusted proxy address %q", s)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			out = append(out, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy range %q: %v", s, err)
+		}
+		out = append(out, ipNet)
+	}
+	return out, nil
+}
+
+// trusts returns true if the request came directly from a trusted proxy.
+func (tp trustedProxies) trusts(r *http.Request) bool {
+	return tp.contains(net.ParseIP(sourceIP(r)))
+}
+
+func (tp trustedProxies) contains(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	for _, n := range tp {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// forwardedFor returns the client address of a request from a trusted proxy:
+// the rightmost X-Forwarded-For hop that isn't a trusted proxy itself, as hops
+// to the left of it could have been sent by the client. If every hop is a
+// trusted proxy, or the next one isn't a valid address, it's the last trusted
+// hop. It returns "" if the request isn't from a trusted proxy or its last hop
+// isn't valid.
+func (tp trustedProxies) forwardedFor(r *http.Request) string {
+	if !tp.trusts(r) {
+		return ""
+	}
+	var hops []string
+	for _, h := range r.Header["X-Forwarded-For"] {
+		hops = append(hops, strings.Split(h, ",")...)
+	}
+	client := ""
+	for i := len(hops) - 1; i >= 0; i-- {
+		ip := net.ParseIP(strings.TrimSpace(hops[i]))
+		if ip == nil {
+			break
+		}
+		client = ip.String()
+		if !tp.contains(ip) {
+			break
+		}
+	}
+	return client
+}
+
+// forwardedProto returns the X-Forwarded-Proto of a request from a trusted
+// proxy, or "" if the header is absent or untrusted.
+func forwardedProto(r *http.Request, trusted bool) string {
+	if !trusted {
+		return ""
+	}
+	switch p := strings.ToLower(r.Header.Get("X-Forwarded-Proto")); p {
+	case "http", "https":
+		return p
+	default:
+		return ""
+	}
+}
+
+// authenticateProxy authenticates the user named by a trusted authenticating
+// proxy, provisioning them if allowed. It returns errNoAuth if the proxy didn't
+// name a user.
+func authenticateProxy(r *http.Request, db store.Session, conf config.ProxyAuthConfig) (users.User, error) {
+	username := strings.ToLower(strings.TrimSpace(r.Header.Get(conf.Header)))
+	if username == "" {
+		return users.User{}, errNoAuth
+	}
+	if username == users.RecoveryAdminName {
+		auditFailedLogin(db, r, users.User{Username: username}, "proxy login as recovery admin")
+		return users.User{}, errAuthFailed
+	}
+	user, err := db.UserStore().UserByName(username)
+	if err == store.ErrNotFound && conf.Provision {
+		name := ""
+		if conf.NameHeader != "" {
+			name = strings.TrimSpace(r.Header.Get(conf.NameHeader))
+		}
+		user, err = provisionUser(db, r, username, name, "proxy")
+	}
+	if err != nil {
+		auditFailedLogin(db, r, users.User{Username: username}, "proxy: "+err.Error())
+		if err == store.ErrNotFound || err == errUsernameTaken || users.ValidateUsername(username) != nil {
+			err = errAuthFailed
+		}
+		return users.User{}, err
+	}
+	if user.Disabled {
+		auditFailedLogin(db, r, user, users.ErrAccountDisabled.Error())
+		return users.User{}, users.ErrAccountDisabled
+	}
+	return user, nil
+}
@@ -0,0 +1,85 @@
+package server
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTrustedProxies(t *testing.T) {
+	tp, err := parseTrustedProxies([]string{"10.0.0.0/8", "192.0.2.7", "::1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testCases := []struct {
+		remoteAddr string
+		trusted    bool
+	}{
+		{"10.1.2.3:4567", true},
+		{"11.0.0.1:4567", false},
+		{"192.0.2.7:80", true},
+		{"192.0.2.8:80", false},
+		{"[::1]:80", true},
+		{"[::2]:80", false},
+		{"garbage", false},
+	}
+	for _, test := range testCases {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = test.remoteAddr
+		if actual := tp.trusts(r); actual != test.trusted {
+			t.Errorf("trusts(%q)=%v, expected %v", test.remoteAddr, actual, test.trusted)
+		}
+	}
+	if _, err = parseTrustedProxies([]string{"10.0.0.0/33"}); err == nil {
+		t.Error("invalid CIDR accepted")
+	}
+	if _, err = parseTrustedProxies([]string{"proxy.local"}); err == nil {
+		t.Error("hostname accepted")
+	}
+}
+
+func TestForwardedFor(t *testing.T) {
+	tp, err := parseTrustedProxies([]string{"10.0.0.0/8"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testCases := []struct {
+		remoteAddr string
+		headers    []string
+		expected   string
+	}{
+		{"10.0.0.1:80", []string{"203.0.113.9"}, "203.0.113.9"},
+		// The client can prepend hops; only those added by trusted proxies count.
+		{"10.0.0.1:80", []string{"198.51.100.1, 203.0.113.9, 10.0.0.2"}, "203.0.113.9"},
+		{"10.0.0.1:80", []string{"198.51.100.1", "203.0.113.9, 10.0.0.2"}, "203.0.113.9"},
+		{"10.0.0.1:80", []string{"10.0.0.3, 10.0.0.2"}, "10.0.0.3"},
+		{"10.0.0.1:80", []string{"garbage, 10.0.0.2"}, "10.0.0.2"},
+		{"10.0.0.1:80", []string{"garbage"}, ""},
+		{"10.0.0.1:80", nil, ""},
+		{"203.0.113.9:80", []string{"198.51.100.1"}, ""},
+	}
+	for _, test := range testCases {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = test.remoteAddr
+		for _, h := range test.headers {
+			r.Header.Add("X-Forwarded-For", h)
+		}
+		if actual := tp.forwardedFor(r); actual != test.expected {
+			t.Errorf("forwardedFor(%q, %q)=%q, expected %q", test.remoteAddr, test.headers, actual, test.expected)
+		}
+	}
+}
+
+func TestForwardedProto(t *testing.T) {
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("X-Forwarded-Proto", "HTTPS")
+	if p := forwardedProto(r, false); p != "" {
+		t.Errorf("untrusted X-Forwarded-Proto honored: %q", p)
+	}
+	if p := forwardedProto(r, true); p != "https" {
+		t.Errorf("trusted X-Forwarded-Proto=%q, expected https", p)
+	}
+	r.Header.Set("X-Forwarded-Proto", "javascript")
+	if p := forwardedProto(r, true); p != "" {
+		t.Errorf("invalid X-Forwarded-Proto honored: %q", p)
+	}
+}
@@ -0,0 +1,150 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+
+	"github.com/aprice/freenote/notes"
+	"github.com/aprice/freenote/page"
+	"github.com/aprice/freenote/reminders"
+	"github.com/aprice/freenote/rest"
+	"github.com/aprice/freenote/stats"
+	"github.com/aprice/freenote/store"
+)
+
+// users/{id}/reminders, users/{id}/reminders.ics
+// groups/{id}/reminders, groups/{id}/reminders.ics
+func (rh *requestHandler) doReminders(w http.ResponseWriter, r *http.Request, ics bool) {
+	if rh.popSegment() != "" {
+		statusResponse(w, http.StatusNotFound)
+		return
+	}
+	defer stats.Measure("req", "reminders", r.Method)()
+	switch r.Method {
+	case http.MethodOptions:
+		rh.preflight(w, r, nil, http.MethodGet)
+	case http.MethodGet:
+		if !rh.authorizeNotes(false) {
+			statusResponse(w, http.StatusForbidden)
+			return
+		}
+		var (
+			before time.Time
+			err    error
+		)
+		if raw := r.URL.Query().Get("before"); raw != "" {
+			if before, err = time.Parse(time.RFC3339, raw); badRequest(w, err) {
+				return
+			}
+		}
+		list, _, err := rh.db.NoteStore().QueryNotes(store.NoteQuery{
+			Owner:          rh.ownerID(),
+			Reminders:      true,
+			ReminderBefore: before,
+			Page:           page.All("modified"),
+		})
+		if err == store.ErrNotFound {
+			err = nil
+		}
+		if handleError(w, err) {
+			return
+		}
+		items := notes.PendingReminders(list, before)
+		if ics {
+			w.Header().Set("Content-Type", reminders.ContentTypeICS)
+			w.WriteHeader(http.StatusOK)
+			reminders.WriteICS(w, items, rh.ownerURI())
+			return
+		}
+		pageReq := page.Page{Length: 50}
+		pageReq.FromQueryString(r.URL, []string{"time"})
+		if pageReq.SortDescending {
+			for i, j := 0, len(items)-1; i < j; i, j = i+1, j-1 {
+				items[i], items[j] = items[j], items[i]
+			}
+		}
+		pageReq.HasMore = len(items) > pageReq.Start+pageReq.Length
+		if pageReq.Start > len(items) {
+			pageReq.Start = len(items)
+		}
+		if end := pageReq.Start + pageReq.Length; end < len(items) {
+			items = items[:end]
+		}
+		items = items[pageReq.Start:]
+		filter := url.Values{}
+		if raw := r.URL.Query().Get("before"); raw != "" {
+			filter.Set("before", raw)
+		}
+		sendResponse(w, r, rest.DecorateReminders(items, filter.Encode(), pageReq, rh.ownerURI()), http.StatusOK)
+	default:
+		w.Header().Add("Allow", http.MethodGet)
+		statusResponse(w, http.StatusMethodNotAllowed)
+	}
+}
+
+// maxNoteReminders is the most reminders a note may have, and maxReminders the
+// most pending reminders a user or group may have across their notes.
+const (
+	maxNoteReminders = 20
+	maxReminders     = 200
+)
+
+var errTooManyNoteReminders = fmt.Errorf("a note can have at most %d reminders", maxNoteReminders)
+var errTooManyReminders = fmt.Errorf("at most %d reminders can be pending across all notes", maxReminders)
+
+// errGroupReminderEmail indicates an emailed reminder on a group-owned note,
+// which has no owner to email.
+var errGroupReminderEmail = errors.New("reminders on group notes can't be emailed")
+
+// prepareReminders validates the reminders on a note being saved, and assigns
+// IDs to new ones. A note saved without any reminders list keeps its existing
+// reminders, so clients that don't know about reminders don't remove them.
+func (rh *requestHandler) prepareReminders(note *notes.Note, existing []notes.Reminder) error {
+	if note.Reminders == nil {
+		note.Reminders = existing
+		return nil
+	}
+	if len(note.Reminders) > maxNoteReminders {
+		return errTooManyNoteReminders
+	}
+	for i := range note.Reminders {
+		if err := note.Reminders[i].Validate(); err != nil {
+			return err
+		}
+		if note.Reminders[i].Email && rh.group != nil {
+			return errGroupReminderEmail
+		}
+		if note.Reminders[i].ID == uuid.Nil {
+			note.Reminders[i].ID = uuid.NewV4()
+		}
+	}
+	return nil
+}
+
+// remindersAllowed reports whether the owner's pending reminders, with those
+// on a note being saved in place of what it had before, are within the limit.
+func (rh *requestHandler) remindersAllowed(note notes.Note) (bool, error) {
+	pending := len(notes.PendingReminders([]notes.Note{note}, time.Time{}))
+	if pending == 0 {
+		return true, nil
+	}
+	list, _, err := rh.db.NoteStore().QueryNotes(store.NoteQuery{
+		Owner:     note.Owner,
+		Reminders: true,
+		Page:      page.All("modified"),
+	})
+	if err != nil && err != store.ErrNotFound {
+		return false, err
+	}
+	for _, other := range list {
+		if other.ID != note.ID {
+			pending += len(notes.PendingReminders([]notes.Note{other}, time.Time{}))
+		}
+	}
+	return pending <= maxReminders, nil
+}
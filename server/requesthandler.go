@@ -12,7 +12,11 @@ import (
 
 	"github.com/aprice/freenote"
 	"github.com/aprice/freenote/config"
+	"github.com/aprice/freenote/dav"
+	"github.com/aprice/freenote/mail"
+	"github.com/aprice/freenote/oidc"
 	"github.com/aprice/freenote/store"
+	"github.com/aprice/freenote/suggest"
 	"github.com/aprice/freenote/users"
 )
 
@@ -24,9 +28,18 @@ type requestHandler struct {
 	db        store.Session
 	user      users.User
 	owner     users.User
+	oidc      *oidc.Provider
+	dav       *dav.Handler
+	titles    *suggest.Index
+	mail      *mail.Sender
+	// group is the group whose notes are being handled, if any; otherwise
+	// they're owner's.
+	group *users.Group
+	// proxied is true if the request came from a trusted proxy.
+	proxied bool
 }
 
-func newRequestHandler(r *http.Request, conf config.Config, sanitizer *bluemonday.Policy) (*requestHandler, error) {
+func newRequestHandler(r *http.Request, conf config.Config, sanitizer *bluemonday.Policy, proxied bool) (*requestHandler, error) {
 	db, err := store.NewSession(conf)
 	if err != nil {
 		return nil, err
@@ -38,7 +51,7 @@ func newRequestHandler(r *http.Request, conf config.Config, sanitizer *bluemonda
 	} else {
 		u := strings.TrimPrefix(conf.BaseURI, "http")
 		u = strings.TrimPrefix(u, "s")
-		if p := r.Header.Get("X-Forwarded-Proto"); p != "" {
+		if p := forwardedProto(r, proxied); p != "" {
 			baseURI = p + u
 		} else if r.TLS != nil {
 			baseURI = "https" + u
@@ -52,6 +65,7 @@ func newRequestHandler(r *http.Request, conf config.Config, sanitizer *bluemonda
 		baseURI:   baseURI,
 		path:      r.URL.Path,
 		db:        db,
+		proxied:   proxied,
 	}
 	return rh, nil
 }
@@ -68,7 +82,14 @@ func (rh *requestHandler) handle(w http.ResponseWriter, r *http.Request) {
 		w.Header().Add("X-Freenote-Version", freenote.Version+"-"+freenote.Build)
 	}
 	var err error
-	rh.user, err = authenticate(w, r, rh.db.UserStore())
+	if rh.proxied && rh.conf.ProxyAuth.Header != "" {
+		rh.user, err = authenticateProxy(r, rh.db, rh.conf.ProxyAuth)
+	} else {
+		err = errNoAuth
+	}
+	if err == errNoAuth {
+		rh.user, err = authenticate(w, r, rh.db)
+	}
 	switch err {
 	case errNoAuth, nil:
 	case errAuthCookieInvalid:
@@ -97,6 +118,12 @@ func (rh *requestHandler) handle(w http.ResponseWriter, r *http.Request) {
 		rh.doUsers(w, r)
 	case "session":
 		rh.doSession(w, r)
+	case "audit":
+		rh.doAudit(w, r)
+	case "dav":
+		rh.doDAV(w, r)
+	case "groups":
+		rh.doGroups(w, r)
 	}
 }
 
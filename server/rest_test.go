@@ -2,11 +2,14 @@ package server
 
 import (
 	"bytes"
+	"crypto/sha512"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"net/smtp"
+	"net/url"
 	"os"
 	"regexp"
 	"strings"
@@ -16,10 +19,16 @@ import (
 	"io/ioutil"
 
 	"github.com/aprice/freenote/config"
+	"github.com/aprice/freenote/mail"
 	"github.com/aprice/freenote/notes"
+	"github.com/aprice/freenote/oidc/oidctest"
+	"github.com/aprice/freenote/page"
+	"github.com/aprice/freenote/rest"
 	"github.com/aprice/freenote/store"
 	"github.com/aprice/freenote/users"
+	"github.com/asdine/storm"
 	uuid "github.com/satori/go.uuid"
+	"golang.org/x/crypto/pbkdf2"
 )
 
 const testBoltDB = "test.db"
@@ -239,6 +248,288 @@ func TestCRUDNote(t *testing.T) {
 	}
 }
 
+// TestImport imports a Simplenote export and checks the notes were created.
+func TestImport(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	userID, s, err := setupTest()
+	defer cleanupTest()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	export := `{"activeNotes": [
+		{"id": "a", "content": "First\nbody", "lastModified": "2017-04-17T08:00:00Z", "tags": ["x"]},
+		{"id": "b", "content": "Second", "creationDate": "not a date"}
+	]}`
+	req := httptest.NewRequest("POST", fmt.Sprintf("/users/%s/import?folder=imported", userID),
+		strings.NewReader(export))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(testUsername, testPassword)
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Server responded %d: %s", w.Code, truncate(w.Body.String(), 50))
+	}
+	report := struct {
+		Imported int
+		Failed   int
+		Results  []struct {
+			ID    uuid.UUID
+			Error string
+		}
+	}{}
+	if err = json.NewDecoder(w.Body).Decode(&report); err != nil {
+		t.Fatal(err)
+	}
+	if report.Imported != 1 || report.Failed != 1 || len(report.Results) != 2 {
+		t.Fatalf("unexpected import report: %+v", report)
+	}
+
+	req = httptest.NewRequest("GET", fmt.Sprintf("/users/%s/notes/%s", userID, report.Results[0].ID), nil)
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(testUsername, testPassword)
+	w = httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Server responded %d: %s", w.Code, truncate(w.Body.String(), 50))
+	}
+	note := notes.Note{}
+	if err = json.NewDecoder(w.Body).Decode(&note); err != nil {
+		t.Fatal(err)
+	}
+	if note.Title != "First" || note.Folder != "imported" || note.Modified.Year() != 2017 {
+		t.Errorf("imported note does not match export: %+v", note)
+	}
+}
+
+// TestAudit checks that logins are recorded in the audit log, and that the log
+// is visible to the user but the full log is restricted to admins.
+func TestAudit(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	userID, s, err := setupTest()
+	defer cleanupTest()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, pw := range []string{"wrong", testPassword} {
+		req := httptest.NewRequest("POST", "/session",
+			strings.NewReader(fmt.Sprintf("username=%s&password=%s", testUsername, pw)))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set("Accept", "application/json")
+		s.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	req := httptest.NewRequest("GET", fmt.Sprintf("/users/%s/audit?action=login", userID), nil)
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(testUsername, testPassword)
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Server responded %d: %s", w.Code, truncate(w.Body.String(), 50))
+	}
+	payload := struct {
+		Entries []struct {
+			Actor   uuid.UUID
+			Action  string
+			Outcome string
+		}
+	}{}
+	if err = json.NewDecoder(w.Body).Decode(&payload); err != nil {
+		t.Fatal(err)
+	}
+	if len(payload.Entries) != 2 {
+		t.Fatalf("Returned entries not length 2, actually %d", len(payload.Entries))
+	}
+	// Newest first
+	if payload.Entries[0].Outcome != "success" || payload.Entries[1].Outcome != "failure" {
+		t.Errorf("unexpected audit entries: %+v", payload.Entries)
+	}
+	if payload.Entries[0].Actor != userID {
+		t.Errorf("audit actor %s, expected %s", payload.Entries[0].Actor, userID)
+	}
+
+	req = httptest.NewRequest("GET", "/audit", nil)
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(testUsername, testPassword)
+	w = httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("Server responded %d to non-admin audit request", w.Code)
+	}
+}
+
+// TestUserAdmin checks that users can't escalate their own access, and that
+// admins can change access and disable accounts.
+func TestUserAdmin(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	userID, s, err := setupTest()
+	defer cleanupTest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	const adminName, adminPassword = "admin", "correcthorse"
+	if _, err = createUser(adminName, adminPassword, users.LevelAdmin); err != nil {
+		t.Fatal(err)
+	}
+	call := func(method, url, body, username, password string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, url, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Accept", "application/json")
+		req.SetBasicAuth(username, password)
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, req)
+		return w
+	}
+	userURL := fmt.Sprintf("/users/%s", userID)
+
+	// Self-promotion via PUT is ignored
+	body := fmt.Sprintf(`{"id": %q, "username": %q, "access": %d}`, userID, testUsername, users.LevelAdmin)
+	if w := call("PUT", userURL, body, testUsername, testPassword); w.Code != http.StatusOK {
+		t.Fatalf("Server responded %d: %s", w.Code, truncate(w.Body.String(), 50))
+	}
+	if w := call("GET", "/users", "", testUsername, testPassword); w.Code != http.StatusForbidden {
+		t.Errorf("Server responded %d to user list after self-promotion", w.Code)
+	}
+	// Dedicated endpoint is admin-only
+	if w := call("PUT", userURL+"/access", `{"access": "admin"}`, testUsername, testPassword); w.Code != http.StatusForbidden {
+		t.Errorf("Server responded %d to non-admin access change", w.Code)
+	}
+	if w := call("PUT", userURL+"/access", `{"access": "recovery"}`, adminName, adminPassword); w.Code != http.StatusBadRequest {
+		t.Errorf("Server responded %d to recovery access grant", w.Code)
+	}
+	if w := call("PUT", userURL+"/access", `{"access": "guest"}`, adminName, adminPassword); w.Code != http.StatusOK {
+		t.Fatalf("Server responded %d: %s", w.Code, truncate(w.Body.String(), 50))
+	}
+	user := users.User{}
+	if err = json.NewDecoder(call("GET", userURL, "", testUsername, testPassword).Body).Decode(&user); err != nil {
+		t.Fatal(err)
+	}
+	if user.Access != users.LevelGuest {
+		t.Errorf("Access is %s after change, expected guest", user.Access)
+	}
+
+	// Disabled users can't authenticate until re-enabled
+	if w := call("PUT", userURL+"/disabled", "", adminName, adminPassword); w.Code != http.StatusOK {
+		t.Fatalf("Server responded %d: %s", w.Code, truncate(w.Body.String(), 50))
+	}
+	if w := call("GET", userURL, "", testUsername, testPassword); w.Code != http.StatusForbidden {
+		t.Errorf("Server responded %d to disabled user", w.Code)
+	}
+	if w := call("DELETE", userURL+"/disabled", "", adminName, adminPassword); w.Code != http.StatusOK {
+		t.Fatalf("Server responded %d: %s", w.Code, truncate(w.Body.String(), 50))
+	}
+	if w := call("GET", userURL, "", testUsername, testPassword); w.Code != http.StatusOK {
+		t.Errorf("Server responded %d to re-enabled user", w.Code)
+	}
+}
+
+// TestSessions lists sessions and revokes all but the current one.
+func TestSessions(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	userID, s, err := setupTest()
+	defer cleanupTest()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	agents := []string{"first-agent", "second-agent"}
+	var cookies []string
+	for _, agent := range agents {
+		req := httptest.NewRequest("POST", "/session",
+			strings.NewReader(fmt.Sprintf("username=%s&password=%s", testUsername, testPassword)))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set("Accept", "application/json")
+		req.Header.Set("User-Agent", agent)
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Server responded %d: %s", w.Code, truncate(w.Body.String(), 50))
+		}
+		cookies = append(cookies, w.Header().Get("Set-Cookie"))
+	}
+	call := func(method, url string, client int) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, url, nil)
+		req.Header.Set("Cookie", cookies[client])
+		req.Header.Set("Accept", "application/json")
+		req.Header.Set("User-Agent", agents[client])
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, req)
+		return w
+	}
+	sessionsURL := fmt.Sprintf("/users/%s/sessions", userID)
+
+	w := call("GET", sessionsURL, 0)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Server responded %d: %s", w.Code, truncate(w.Body.String(), 50))
+	}
+	payload := struct {
+		Sessions []struct {
+			ID        uuid.UUID
+			UserAgent string
+			Label     string
+			Current   bool
+		}
+	}{}
+	if err = json.NewDecoder(w.Body).Decode(&payload); err != nil {
+		t.Fatal(err)
+	}
+	if len(payload.Sessions) != 2 {
+		t.Fatalf("Returned sessions not length 2, actually %d", len(payload.Sessions))
+	}
+	var currentID uuid.UUID
+	for _, sess := range payload.Sessions {
+		if sess.Current != (sess.UserAgent == "first-agent") {
+			t.Errorf("session %+v has wrong current flag", sess)
+		}
+		if sess.Current {
+			currentID = sess.ID
+		}
+	}
+
+	label := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("PUT", fmt.Sprintf("%s/%s", sessionsURL, currentID), strings.NewReader(body))
+		req.Header.Set("Cookie", cookies[0])
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Accept", "application/json")
+		req.Header.Set("User-Agent", agents[0])
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, req)
+		return w
+	}
+	if w = label(`{"label": " work laptop "}`); w.Code != http.StatusOK {
+		t.Fatalf("Server responded %d: %s", w.Code, truncate(w.Body.String(), 50))
+	}
+	if w = label(fmt.Sprintf(`{"label": %q}`, strings.Repeat("x", users.MaxSessionLabelLength+1))); w.Code != http.StatusBadRequest {
+		t.Errorf("Server responded %d to overlong label", w.Code)
+	}
+	w = call("GET", fmt.Sprintf("%s/%s", sessionsURL, currentID), 0)
+	sess := struct{ Label string }{}
+	json.Unmarshal(w.Body.Bytes(), &sess)
+	if sess.Label != "work laptop" {
+		t.Errorf("Session label is %q", sess.Label)
+	}
+
+	if w = call("DELETE", sessionsURL+"?others=true", 0); w.Code != http.StatusNoContent {
+		t.Fatalf("Server responded %d: %s", w.Code, truncate(w.Body.String(), 50))
+	}
+	if w = call("GET", "/session", 1); w.Code != http.StatusUnauthorized {
+		t.Errorf("Server responded %d to revoked session", w.Code)
+	}
+	if w = call("GET", "/session", 0); w.Code != http.StatusOK {
+		t.Errorf("Server responded %d to current session", w.Code)
+	}
+}
+
 // TODO: Figure out why IDs aren't consistent
 var normalizeSpaces = regexp.MustCompile(`(?ms)\s+`)
 var normalizeIDs = regexp.MustCompile(`(?i)\s+id="[^"]*"\s*`)
@@ -252,20 +543,1616 @@ func normalizeHTML(in string) string {
 	return in
 }
 
-func setupTest() (userID uuid.UUID, server *Server, err error) {
-	userID, err = createTestUser()
+func TestTwoFactor(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	userID, s, err := setupTest()
+	defer cleanupTest()
 	if err != nil {
-		return
+		t.Fatal(err)
+	}
+	call := func(method, url, body string, auth func(*http.Request)) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, url, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Accept", "application/json")
+		if auth != nil {
+			auth(req)
+		}
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, req)
+		return w
+	}
+	basic := func(password string) func(*http.Request) {
+		return func(req *http.Request) { req.SetBasicAuth(testUsername, password) }
+	}
+	login := func(form string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/session", strings.NewReader(form))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set("Accept", "application/json")
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, req)
+		return w
+	}
+	tfURL := fmt.Sprintf("/users/%s/twofactor", userID)
+
+	w := call("POST", tfURL, "", basic(testPassword))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Server responded %d: %s", w.Code, truncate(w.Body.String(), 50))
+	}
+	enrolment := struct{ Secret, URI string }{}
+	if err = json.NewDecoder(w.Body).Decode(&enrolment); err != nil {
+		t.Fatal(err)
+	}
+	code, err := users.TOTPCode(enrolment.Secret, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	w = call("PUT", tfURL, fmt.Sprintf(`{"code": %q}`, code), basic(testPassword))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Server responded %d: %s", w.Code, truncate(w.Body.String(), 50))
+	}
+	recovery := struct{ RecoveryCodes []string }{}
+	if err = json.NewDecoder(w.Body).Decode(&recovery); err != nil {
+		t.Fatal(err)
+	}
+	if len(recovery.RecoveryCodes) == 0 {
+		t.Fatal("No recovery codes returned")
+	}
+
+	// Passwords no longer work for Basic auth
+	if w = call("GET", tfURL, "", basic(testPassword)); w.Code != http.StatusUnauthorized {
+		t.Fatalf("Expected 401 for password Basic auth, got %d", w.Code)
+	}
+
+	// Two-step login
+	w = login(fmt.Sprintf("username=%s&password=%s", testUsername, testPassword))
+	if w.Code != http.StatusUnauthorized || w.Header().Get("X-Freenote-Two-Factor") != "required" {
+		t.Fatalf("Expected two-factor challenge, got %d: %s", w.Code, truncate(w.Body.String(), 50))
+	}
+	challenge := struct{ Challenge string }{}
+	if err = json.NewDecoder(w.Body).Decode(&challenge); err != nil {
+		t.Fatal(err)
+	}
+	if w = login("challenge=" + challenge.Challenge + "&code=wrong"); w.Code != http.StatusUnauthorized {
+		t.Fatalf("Expected 401 for wrong code, got %d", w.Code)
+	}
+	w = login("challenge=" + challenge.Challenge + "&code=" + recovery.RecoveryCodes[0])
+	if w.Code != http.StatusOK {
+		t.Fatalf("Server responded %d: %s", w.Code, truncate(w.Body.String(), 50))
+	}
+	cookie := w.Header().Get("Set-Cookie")
+	withCookie := func(req *http.Request) { req.Header.Set("Cookie", cookie) }
+
+	// API tokens work in place of passwords
+	w = call("POST", fmt.Sprintf("/users/%s/tokens", userID), `{"name": "test"}`, withCookie)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Server responded %d: %s", w.Code, truncate(w.Body.String(), 50))
+	}
+	tok := struct {
+		ID    uuid.UUID
+		Token string
+	}{}
+	if err = json.NewDecoder(w.Body).Decode(&tok); err != nil {
+		t.Fatal(err)
+	}
+	if w = call("GET", tfURL, "", basic(tok.Token)); w.Code != http.StatusOK {
+		t.Fatalf("Token auth responded %d: %s", w.Code, truncate(w.Body.String(), 50))
+	}
+	w = call("DELETE", fmt.Sprintf("/users/%s/tokens/%s", userID, tok.ID), "", withCookie)
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("Server responded %d: %s", w.Code, truncate(w.Body.String(), 50))
+	}
+	if w = call("GET", tfURL, "", basic(tok.Token)); w.Code == http.StatusOK {
+		t.Fatal("Revoked token still accepted")
+	}
+
+	// Wrong codes lock out two-factor logins, whether supplied with the
+	// password or to a new challenge
+	password := fmt.Sprintf("username=%s&password=%s", testUsername, testPassword)
+	for i := 0; i < 4; i++ {
+		if w = login(password + "&code=000000"); w.Code != http.StatusUnauthorized {
+			t.Fatalf("Expected 401 for wrong code, got %d", w.Code)
+		}
+	}
+	w = login(password)
+	if err = json.NewDecoder(w.Body).Decode(&challenge); err != nil {
+		t.Fatal(err)
+	}
+	login("challenge=" + challenge.Challenge + "&code=wrong")
+	if w = login(password + "&code=" + recovery.RecoveryCodes[2]); w.Code != http.StatusUnauthorized {
+		t.Fatalf("Expected 401 while locked out, got %d", w.Code)
+	}
+
+	// Disabling requires a code
+	if w = call("DELETE", tfURL, "", withCookie); w.Code != http.StatusBadRequest {
+		t.Fatalf("Expected 400 disabling without code, got %d", w.Code)
+	}
+	w = call("DELETE", tfURL, fmt.Sprintf(`{"code": %q}`, recovery.RecoveryCodes[1]), withCookie)
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("Server responded %d: %s", w.Code, truncate(w.Body.String(), 50))
+	}
+	if w = call("GET", tfURL, "", basic(testPassword)); w.Code != http.StatusOK {
+		t.Fatalf("Password auth after disabling responded %d", w.Code)
 	}
-	server, err = New(testConfig)
-	return
 }
 
-func cleanupTest() {
-	os.Remove(testBoltDB)
+func TestOIDCLogin(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	_, _, err := setupTest()
+	defer cleanupTest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	mock := oidctest.NewProvider("freenote", "secret")
+	defer mock.Close()
+	conf := testConfig
+	conf.BaseURI = "http://freenote.example.com"
+	conf.OIDC = config.OIDCConfig{
+		Issuer:       mock.URL,
+		ClientID:     mock.ClientID,
+		ClientSecret: mock.ClientSecret,
+		Provision:    true,
+		GroupsClaim:  "groups",
+		GroupAccess:  map[string]string{"staff": "user", "it": "admin"},
+	}
+	s, err := New(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	noRedirect := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	// login runs the whole flow, returning the callback response.
+	login := func(claims map[string]interface{}, tamperState bool) *httptest.ResponseRecorder {
+		mock.SetClaims(claims)
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, httptest.NewRequest("GET", "/session/oidc?return=/notes", nil))
+		if w.Code != http.StatusFound {
+			t.Fatalf("Login responded %d: %s", w.Code, truncate(w.Body.String(), 50))
+		}
+		loginCookie := w.Header().Get("Set-Cookie")
+		res, err := noRedirect.Get(w.Header().Get("Location"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		callback, err := url.Parse(res.Header.Get("Location"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tamperState {
+			q := callback.Query()
+			q.Set("state", "forged")
+			callback.RawQuery = q.Encode()
+		}
+		req := httptest.NewRequest("GET", callback.RequestURI(), nil)
+		req.Header.Set("Cookie", loginCookie)
+		w = httptest.NewRecorder()
+		s.ServeHTTP(w, req)
+		return w
+	}
+
+	claims := map[string]interface{}{
+		"sub":                "oidc-1",
+		"preferred_username": "Carol@example.com",
+		"name":               "Carol",
+		"groups":             []string{"staff", "it"},
+	}
+	if w := login(claims, true); w.Code != http.StatusBadRequest {
+		t.Fatalf("Expected 400 for forged state, got %d", w.Code)
+	}
+	w := login(claims, false)
+	if w.Code != http.StatusFound {
+		t.Fatalf("Callback responded %d: %s", w.Code, truncate(w.Body.String(), 50))
+	}
+	if loc := w.Header().Get("Location"); loc != conf.BaseURI+"/notes" {
+		t.Errorf("Expected redirect to /notes, got %s", loc)
+	}
+	req := httptest.NewRequest("GET", "/session", nil)
+	for _, c := range w.Result().Cookies() {
+		if c.Name == "auth" {
+			req.AddCookie(c)
+		}
+	}
+	req.Header.Set("Accept", "application/json")
+	w = httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Session responded %d: %s", w.Code, truncate(w.Body.String(), 50))
+	}
+	user := users.User{}
+	if err = json.NewDecoder(w.Body).Decode(&user); err != nil {
+		t.Fatal(err)
+	}
+	if user.Username != "carol" || user.DisplayName != "Carol" || user.Access != users.LevelAdmin {
+		t.Errorf("Provisioned user wrong: %+v", user)
+	}
+
+	// Access follows groups on each login, for the same linked user
+	claims["groups"] = []string{"staff"}
+	claims["preferred_username"] = "renamed"
+	if w = login(claims, false); w.Code != http.StatusFound {
+		t.Fatalf("Callback responded %d: %s", w.Code, truncate(w.Body.String(), 50))
+	}
+	db, err := store.NewSession(testConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user, err = db.UserStore().UserByName("carol")
+	if closer, ok := db.(io.Closer); ok {
+		closer.Close()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Access != users.LevelUser {
+		t.Errorf("Expected access user after group change, got %s", user.Access)
+	}
+
+	claims["groups"] = []string{"contractors"}
+	if w = login(claims, false); w.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 outside allowed groups, got %d", w.Code)
+	}
+	// Existing local users aren't linked by default
+	if w = login(map[string]interface{}{"sub": "oidc-2", "preferred_username": testUsername, "groups": []string{"staff"}}, false); w.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 for username collision, got %d", w.Code)
+	}
+
+	// Linking matches whole usernames, or email addresses verified by the
+	// provider and by exactly one local user, never the local part of an
+	// address.
+	conf.OIDC.LinkByUsername, conf.OIDC.Provision = true, false
+	if s, err = New(conf); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = createUser("mallory", "password", users.LevelUser); err != nil {
+		t.Fatal(err)
+	}
+	setEmail := func(username string, verified bool) {
+		db, err := store.NewSession(testConfig)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.(io.Closer).Close()
+		user, err := db.UserStore().UserByName(username)
+		if err == nil {
+			user.Email, user.EmailVerified = testUsername+"@example.com", verified
+			err = db.UserStore().SaveUser(&user)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, c := range []struct {
+		email         string
+		verified      bool
+		localVerified bool
+		duplicate     bool
+		status        int
+	}{
+		{testUsername + "@evil.example", true, true, false, http.StatusUnauthorized},
+		{testUsername + "@example.com", false, true, false, http.StatusUnauthorized},
+		{testUsername + "@example.com", true, false, false, http.StatusUnauthorized},
+		{testUsername + "@example.com", true, true, true, http.StatusUnauthorized},
+		{testUsername + "@example.com", true, true, false, http.StatusFound},
+	} {
+		setEmail(testUsername, c.localVerified)
+		setEmail("mallory", c.duplicate)
+		claims := map[string]interface{}{
+			"sub":                "oidc-3",
+			"preferred_username": c.email,
+			"email":              c.email,
+			"email_verified":     c.verified,
+			"groups":             []string{"staff"},
+		}
+		if w = login(claims, false); w.Code != c.status {
+			t.Errorf("Expected %d linking %s (verified %v, locally %v, also mallory's %v), got %d",
+				c.status, c.email, c.verified, c.localVerified, c.duplicate, w.Code)
+		}
+	}
 }
 
-func createTestUser() (uuid.UUID, error) {
+func TestProxyAuth(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	_, _, err := setupTest()
+	defer cleanupTest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf := testConfig
+	// httptest requests come from 192.0.2.1
+	conf.TrustedProxies = []string{"192.0.2.0/24"}
+	conf.ProxyAuth = config.ProxyAuthConfig{
+		Header:     "Remote-User",
+		NameHeader: "Remote-Name",
+	}
+	s, err := New(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	call := func(username, remoteAddr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/session", nil)
+		req.Header.Set("Accept", "application/json")
+		req.Header.Set("Remote-User", username)
+		req.Header.Set("Remote-Name", "Dave")
+		req.Header.Set("X-Forwarded-For", "198.51.100.1, 203.0.113.9")
+		if remoteAddr != "" {
+			req.RemoteAddr = remoteAddr
+		}
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := call(testUsername, ""); w.Code != http.StatusOK {
+		t.Fatalf("Server responded %d: %s", w.Code, truncate(w.Body.String(), 50))
+	}
+	if w := call(testUsername, "203.0.113.9:1234"); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 from untrusted address, got %d", w.Code)
+	}
+	if w := call("dave", ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 for unknown user without provisioning, got %d", w.Code)
+	}
+
+	conf.ProxyAuth.Provision = true
+	if s, err = New(conf); err != nil {
+		t.Fatal(err)
+	}
+	w := call("Dave", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Server responded %d: %s", w.Code, truncate(w.Body.String(), 50))
+	}
+	user := users.User{}
+	if err = json.NewDecoder(w.Body).Decode(&user); err != nil {
+		t.Fatal(err)
+	}
+	if user.Username != "dave" || user.DisplayName != "Dave" || user.Access != users.LevelUser {
+		t.Errorf("Provisioned user wrong: %+v", user)
+	}
+
+	// The audit log records the client the proxy forwarded for.
+	db, err := store.NewSession(testConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, _, err := db.AuditStore().QueryEntries(store.AuditQuery{Target: user.ID, Page: page.All("time")})
+	db.(io.Closer).Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) == 0 || entries[0].SourceIP != "203.0.113.9" {
+		t.Errorf("Provisioning audit entries are %+v", entries)
+	}
+}
+
+func TestPasswordUpgrade(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	_, s, err := setupTest()
+	defer cleanupTest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := store.NewSession(testConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Store a version 1 (PBKDF2) hash, as created by older releases
+	user, err := db.UserStore().UserByName(testUsername)
+	if err != nil {
+		t.Fatal(err)
+	}
+	salt := []byte("NaClNaClNaClNaCl")
+	user.Password = &users.Password{
+		Version: 1,
+		Salt:    salt,
+		Hash:    pbkdf2.Key([]byte(testPassword), salt, 5000, 32, sha512.New),
+	}
+	err = db.UserStore().SaveUser(&user)
+	if closer, ok := db.(io.Closer); ok {
+		closer.Close()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest("GET", "/session", nil)
+	req.SetBasicAuth(testUsername, testPassword)
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Server responded %d: %s", w.Code, truncate(w.Body.String(), 50))
+	}
+	if db, err = store.NewSession(testConfig); err != nil {
+		t.Fatal(err)
+	}
+	user, err = db.UserStore().UserByName(testUsername)
+	if closer, ok := db.(io.Closer); ok {
+		closer.Close()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Password.Version != 2 || user.Password.NeedsUpdate() {
+		t.Errorf("Password not upgraded on login: version %d", user.Password.Version)
+	}
+	if ok, err := user.Password.Verify(testPassword); !ok || err != nil {
+		t.Errorf("Upgraded password not accepted: %v", err)
+	}
+}
+
+func TestNoteFilters(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	userID, s, err := setupTest()
+	defer cleanupTest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, body := range []string{
+		`{"title": "Groceries", "body": "milk, eggs", "tags": ["home"], "path": "home/kitchen", "created": "2026-01-15T10:00:00Z"}`,
+		`{"title": "Standup", "body": "Discuss the MILK budget", "tags": ["work"], "created": "2025-12-01T10:00:00Z"}`,
+		`{"title": "Milkshake recipes", "body": "blend", "tags": ["home", "food"], "path": "home/kitchen", "created": "2026-03-01T10:00:00Z"}`,
+	} {
+		if w := testCall(s, "POST", fmt.Sprintf("/users/%s/notes", userID), body); w.Code != http.StatusCreated {
+			t.Fatalf("Server responded %d: %s", w.Code, truncate(w.Body.String(), 50))
+		}
+	}
+	titles := func(query string) string {
+		w := testCall(s, "GET", fmt.Sprintf("/users/%s/notes?sort=title&order=asc&%s", userID, query), "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("Server responded %d: %s", w.Code, truncate(w.Body.String(), 50))
+		}
+		payload := struct {
+			Notes []notes.Note
+		}{}
+		if err := json.NewDecoder(w.Body).Decode(&payload); err != nil {
+			t.Fatal(err)
+		}
+		var out []string
+		for _, n := range payload.Notes {
+			out = append(out, n.Title)
+		}
+		return strings.Join(out, ", ")
+	}
+	if actual := titles("tag=home"); actual != "Groceries, Milkshake recipes" {
+		t.Errorf("tag=home returned %s", actual)
+	}
+	if actual := titles("q=milk"); actual != "Groceries, Milkshake recipes, Standup" {
+		t.Errorf("q=milk returned %s", actual)
+	}
+	if actual := titles("q=milk&tag=work"); actual != "Standup" {
+		t.Errorf("q=milk&tag=work returned %s", actual)
+	}
+	if actual := titles("q=nothing"); actual != "" {
+		t.Errorf("q=nothing returned %s", actual)
+	}
+	for query, expected := range map[string]string{
+		"milk -tag:food":              "Groceries, Standup",
+		"tag:work OR tag:food":        "Milkshake recipes, Standup",
+		`title:"milkshake rec" blend`: "Milkshake recipes",
+		"created:>2026-01-01 milk":    "Groceries, Milkshake recipes",
+		"created:2025-12-01":          "Standup",
+	} {
+		if actual := titles("q=" + url.QueryEscape(query)); actual != expected {
+			t.Errorf("q=%s returned %s, expected %s", query, actual, expected)
+		}
+	}
+	w := testCall(s, "GET", fmt.Sprintf("/users/%s/notes?q=%s", userID, url.QueryEscape(`milk title:"oops`)), "")
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "position 12") {
+		t.Errorf("Bad query responded %d: %s", w.Code, w.Body.String())
+	}
+	w = testCall(s, "GET", fmt.Sprintf("/users/%s/notes?q=milk&length=1", userID), "")
+	payload := rest.DecoratedNotes{}
+	if err := json.NewDecoder(w.Body).Decode(&payload); err != nil {
+		t.Fatal(err)
+	}
+	if next := payload.Links["next"].Href; !strings.Contains(next, "?q=milk&start=1&") {
+		t.Errorf("Next link %q lost the filter", next)
+	}
+	w = testCall(s, "GET", fmt.Sprintf("/users/%s/notes?folder=home/kitchen&length=1", userID), "")
+	payload = rest.DecoratedNotes{}
+	if err := json.NewDecoder(w.Body).Decode(&payload); err != nil {
+		t.Fatal(err)
+	}
+	next := payload.Links["next"].Href
+	if !strings.Contains(next, "/notes?folder=home%2Fkitchen&start=1&") {
+		t.Fatalf("Next link %q lost the folder", next)
+	}
+	w = testCall(s, "GET", next[strings.Index(next, "/users/"):], "")
+	payload = rest.DecoratedNotes{}
+	json.NewDecoder(w.Body).Decode(&payload)
+	if w.Code != http.StatusOK || len(payload.Notes) != 1 || payload.Notes[0].Folder != "home/kitchen" {
+		t.Errorf("Next folder page responded %d: %s", w.Code, truncate(w.Body.String(), 50))
+	}
+
+	// Search results have snippets and scores; other listings don't.
+	w = testCall(s, "GET", fmt.Sprintf("/users/%s/notes?q=milk+-tag:home", userID), "")
+	payload = rest.DecoratedNotes{}
+	json.NewDecoder(w.Body).Decode(&payload)
+	if len(payload.Notes) != 1 || len(payload.Notes[0].Snippets) != 1 || payload.Notes[0].Score <= 0 {
+		t.Fatalf("Search results are %+v", payload.Notes)
+	}
+	if html := payload.Notes[0].Snippets[0].HTML; html != "Discuss the <mark>MILK</mark> budget" {
+		t.Errorf("Snippet is %q", html)
+	}
+	w = testCall(s, "GET", fmt.Sprintf("/users/%s/notes?tag=work", userID), "")
+	if strings.Contains(w.Body.String(), "snippets") || strings.Contains(w.Body.String(), "score") {
+		t.Errorf("Listing has search results: %s", w.Body.String())
+	}
+}
+
+// TestPutCreate checks that PUT to an unused note ID creates the note with it.
+func TestPutCreate(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	otherID, err := createUser("other", testPassword, users.LevelUser)
+	if err != nil {
+		cleanupTest()
+		t.Fatal(err)
+	}
+	userID, s, err := setupTest()
+	defer cleanupTest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	call := func(method, url, username string, note notes.Note) (*httptest.ResponseRecorder, notes.Note) {
+		b, err := json.Marshal(note)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req := httptest.NewRequest(method, url, bytes.NewReader(b))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Accept", "application/json")
+		req.SetBasicAuth(username, testPassword)
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, req)
+		saved := notes.Note{}
+		json.Unmarshal(w.Body.Bytes(), &saved)
+		return w, saved
+	}
+
+	created := time.Date(2017, 4, 17, 8, 0, 0, 0, time.UTC)
+	note := notes.Note{
+		ID:       uuid.NewV4(),
+		Owner:    otherID,
+		Title:    "Restored",
+		Body:     "From a backup",
+		Folder:   "old",
+		Tags:     []string{"x"},
+		Created:  created,
+		Modified: created,
+	}
+	w, saved := call("PUT", fmt.Sprintf("/users/%s/notes/%s", userID, note.ID), testUsername, note)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Server responded %d: %s", w.Code, truncate(w.Body.String(), 50))
+	}
+	if !strings.HasSuffix(w.Header().Get("Location"), note.ID.String()) {
+		t.Errorf("Location %q is not the note", w.Header().Get("Location"))
+	}
+	if saved.ID != note.ID || saved.Owner != userID || !saved.Created.Equal(created) || saved.Folder != "old" {
+		t.Errorf("Saved note %+v does not match", saved)
+	}
+	if w, _ = call("PUT", fmt.Sprintf("/users/%s/notes/%s", userID, note.ID), testUsername, note); w.Code != http.StatusOK {
+		t.Errorf("Replacing responded %d: %s", w.Code, truncate(w.Body.String(), 50))
+	}
+
+	// Another user's note ID can't be taken.
+	w, theirs := call("POST", fmt.Sprintf("/users/%s/notes", otherID), "other", notes.Note{Title: "Theirs"})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Server responded %d: %s", w.Code, truncate(w.Body.String(), 50))
+	}
+	note.ID = theirs.ID
+	if w, _ = call("PUT", fmt.Sprintf("/users/%s/notes/%s", userID, note.ID), testUsername, note); w.Code != http.StatusNotFound {
+		t.Errorf("Taking another user's ID responded %d", w.Code)
+	}
+}
+
+// TestIfMatch checks that note updates and deletes honor If-Match.
+func TestIfMatch(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	userID, s, err := setupTest()
+	defer cleanupTest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	call := func(method, url, etag, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, url, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Accept", "application/json")
+		if etag != "" {
+			req.Header.Set("If-Match", etag)
+		}
+		req.SetBasicAuth(testUsername, testPassword)
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, req)
+		return w
+	}
+	w := call("POST", fmt.Sprintf("/users/%s/notes", userID), "", `{"title": "Versioned", "body": "one"}`)
+	note := notes.Note{}
+	if err = json.NewDecoder(w.Body).Decode(&note); err != nil {
+		t.Fatal(err)
+	}
+	url := fmt.Sprintf("/users/%s/notes/%s", userID, note.ID)
+	w = call("GET", url, "", "")
+	etag := w.Header().Get("ETag")
+	if etag != note.ETag() {
+		t.Fatalf("GET returned ETag %q, expected %q", etag, note.ETag())
+	}
+
+	// The ETag changes with every save, even when the client sends the same
+	// modification time, or a version of its own.
+	note.Body, note.Version = "two", 100
+	b, _ := json.Marshal(note)
+	if w = call("PUT", url, etag, string(b)); w.Code != http.StatusOK {
+		t.Fatalf("PUT with current ETag responded %d: %s", w.Code, truncate(w.Body.String(), 50))
+	}
+	if err = json.NewDecoder(w.Body).Decode(&note); err != nil {
+		t.Fatal(err)
+	}
+	if w.Header().Get("ETag") != note.ETag() || note.ETag() == etag || note.Version != 2 {
+		t.Errorf("PUT returned ETag %q, version %d", w.Header().Get("ETag"), note.Version)
+	}
+	stale := etag
+	etag = note.ETag()
+	if w = call("POST", fmt.Sprintf("/users/%s/reorder", userID), "", fmt.Sprintf(`{"notes": [%q]}`, note.ID)); w.Code != http.StatusNoContent {
+		t.Fatalf("Reorder responded %d", w.Code)
+	}
+	if w = call("GET", url, "", ""); w.Header().Get("ETag") == etag {
+		t.Error("ETag unchanged by reorder")
+	}
+	note.Body = "three"
+	b, _ = json.Marshal(note)
+	if w = call("PUT", url, etag, string(b)); w.Code != http.StatusPreconditionFailed {
+		t.Errorf("PUT with stale ETag responded %d", w.Code)
+	}
+	if w = call("PUT", url, stale, string(b)); w.Code != http.StatusPreconditionFailed {
+		t.Errorf("PUT with first ETag responded %d", w.Code)
+	}
+
+	// Only one of several concurrent PUTs with the same ETag succeeds.
+	current := call("GET", url, "", "").Header().Get("ETag")
+	codes := make(chan int, 5)
+	for i := 0; i < cap(codes); i++ {
+		go func() { codes <- call("PUT", url, current, string(b)).Code }()
+	}
+	saved := 0
+	for i := 0; i < cap(codes); i++ {
+		switch code := <-codes; code {
+		case http.StatusOK:
+			saved++
+		case http.StatusPreconditionFailed:
+		default:
+			t.Errorf("Concurrent PUT responded %d", code)
+		}
+	}
+	if saved != 1 {
+		t.Errorf("%d concurrent PUTs with the same ETag succeeded", saved)
+	}
+	// The store refuses to update a note saved since it was read.
+	db, err := store.NewSession(testConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	read, err := db.NoteStore().NoteByID(note.ID)
+	if err == nil {
+		first := read
+		err = db.NoteStore().UpdateNote(&first)
+	}
+	if err == nil {
+		err = db.NoteStore().UpdateNote(&read)
+	}
+	db.(io.Closer).Close()
+	if err != store.ErrConflict {
+		t.Errorf("Updating a stale note returned %v", err)
+	}
+	if w = call("DELETE", url, etag, ""); w.Code != http.StatusPreconditionFailed {
+		t.Errorf("DELETE with stale ETag responded %d", w.Code)
+	}
+	if w = call("DELETE", url, "*", ""); w.Code != http.StatusNoContent {
+		t.Errorf("DELETE with * responded %d", w.Code)
+	}
+	if w = call("PUT", url, "*", string(b)); w.Code != http.StatusPreconditionFailed {
+		t.Errorf("PUT with * to a deleted note responded %d", w.Code)
+	}
+}
+
+// TestTaskToggle checks task list rendering and toggling.
+func TestTaskToggle(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	userID, s, err := setupTest()
+	defer cleanupTest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	call := func(method, url, body string) (*httptest.ResponseRecorder, notes.Note) {
+		w := testCall(s, method, url, body)
+		note := notes.Note{}
+		json.Unmarshal(w.Body.Bytes(), &note)
+		return w, note
+	}
+	w, note := call("POST", fmt.Sprintf("/users/%s/notes", userID),
+		`{"title": "Shopping", "body": "- [ ] milk\n- [x] eggs\n- bread"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Server responded %d: %s", w.Code, truncate(w.Body.String(), 50))
+	}
+	tasks := notes.Tasks(note.Body)
+	for _, expected := range []string{
+		fmt.Sprintf(`<li><input type="checkbox" disabled="disabled" data-task="%s"/> milk</li>`, tasks[0].ID),
+		fmt.Sprintf(`<li><input type="checkbox" disabled="disabled" checked="checked" data-task="%s"/> eggs</li>`, tasks[1].ID),
+		`<li>bread</li>`,
+	} {
+		if !strings.Contains(note.HTMLBody, expected) {
+			t.Errorf("HTML %q does not contain %q", note.HTMLBody, expected)
+		}
+	}
+
+	url := fmt.Sprintf("/users/%s/notes/%s/tasks/%s/toggle", userID, note.ID, tasks[0].ID)
+	w, note = call("POST", url, "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Toggle responded %d: %s", w.Code, truncate(w.Body.String(), 50))
+	}
+	if note.Body != "- [x] milk\n- [x] eggs\n- bread" || !strings.Contains(note.HTMLBody, `checked="checked" data-task="`+tasks[0].ID) {
+		t.Errorf("Toggled note is %q: %q", note.Body, note.HTMLBody)
+	}
+	if w, _ = call("POST", fmt.Sprintf("/users/%s/notes/%s/tasks/nope/toggle", userID, note.ID), ""); w.Code != http.StatusNotFound {
+		t.Errorf("Toggling a missing task responded %d", w.Code)
+	}
+	if w, _ = call("GET", url, ""); w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET toggle responded %d", w.Code)
+	}
+}
+
+func TestTaskIndex(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	userID, s, err := setupTest()
+	defer cleanupTest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []uuid.UUID
+	for _, body := range []string{
+		`{"title": "Shopping", "body": "- [ ] milk #errand @due(2026-11-01)\n- [x] eggs #errand"}`,
+		`{"title": "Work", "path": "work", "body": "- [ ] report @due(2026-10-20)\n- [ ] email #errand"}`,
+	} {
+		w := testCall(s, "POST", fmt.Sprintf("/users/%s/notes", userID), body)
+		if w.Code != http.StatusCreated {
+			t.Fatalf("Server responded %d: %s", w.Code, truncate(w.Body.String(), 50))
+		}
+		note := notes.Note{}
+		json.Unmarshal(w.Body.Bytes(), &note)
+		ids = append(ids, note.ID)
+	}
+	query := func(filter string, expected ...string) rest.DecoratedTasks {
+		w := testCall(s, "GET", fmt.Sprintf("/users/%s/tasks?%s", userID, filter), "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: server responded %d: %s", filter, w.Code, truncate(w.Body.String(), 50))
+		}
+		result := rest.DecoratedTasks{}
+		json.Unmarshal(w.Body.Bytes(), &result)
+		var texts []string
+		for _, task := range result.Tasks {
+			texts = append(texts, task.Text)
+		}
+		if strings.Join(texts, ",") != strings.Join(expected, ",") {
+			t.Errorf("%s: got tasks %q, expected %q", filter, texts, expected)
+		}
+		return result
+	}
+	all := query("sort=text", "eggs #errand", "email #errand", "milk #errand @due(2026-11-01)", "report @due(2026-10-20)")
+	query("state=open&dueBefore=2026-11-02", "report @due(2026-10-20)", "milk #errand @due(2026-11-01)")
+	query("state=done", "eggs #errand")
+	query("tag=errand&folder=work", "email #errand")
+	task := all.Tasks[0]
+	if task.Due != "" || task.Tags[0] != "errand" || task.Note != ids[0] || task.NoteTitle != "Shopping" {
+		t.Errorf("Task is %+v", task.TaskItem)
+	}
+	if link := task.Links["note"].Href; !strings.HasSuffix(link, fmt.Sprintf("/users/%s/notes/%s", userID, ids[0])) {
+		t.Errorf("Note link is %q", link)
+	}
+	// Test requests have no host, so links are relative to a bare scheme.
+	if w := testCall(s, "POST", strings.TrimPrefix(task.Links["toggle"].Href, "http"), ""); w.Code != http.StatusOK {
+		t.Errorf("Toggle responded %d", w.Code)
+	}
+	query("state=done")
+	if w := testCall(s, "DELETE", fmt.Sprintf("/users/%s/notes/%s", userID, ids[1]), ""); w.Code != http.StatusNoContent {
+		t.Errorf("Delete responded %d", w.Code)
+	}
+	query("", "eggs #errand", "milk #errand @due(2026-11-01)")
+	if w := testCall(s, "GET", fmt.Sprintf("/users/%s/tasks?state=maybe", userID), ""); w.Code != http.StatusBadRequest {
+		t.Errorf("Bad state responded %d", w.Code)
+	}
+}
+
+// TestTaskIndexBackfill checks that notes saved before the task index existed
+// have their tasks indexed when tasks are first listed.
+func TestTaskIndexBackfill(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	userID, s, err := setupTest()
+	defer cleanupTest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Save straight to the database, as the store would index the tasks.
+	db, err := storm.Open(testBoltDB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	note := notes.Note{ID: uuid.NewV4(), Owner: userID, Title: "Old", Body: "- [ ] migrate"}
+	err = db.From("notes").Save(&note)
+	db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w := testCall(s, "POST", fmt.Sprintf("/users/%s/notes", userID), `{"title": "New", "body": "- [ ] write"}`); w.Code != http.StatusCreated {
+		t.Fatalf("Server responded %d", w.Code)
+	}
+	for i := 0; i < 2; i++ {
+		w := testCall(s, "GET", fmt.Sprintf("/users/%s/tasks?sort=text", userID), "")
+		result := struct{ Tasks []notes.TaskItem }{}
+		json.Unmarshal(w.Body.Bytes(), &result)
+		if len(result.Tasks) != 2 || result.Tasks[0].Text != "migrate" || result.Tasks[1].Text != "write" {
+			t.Errorf("Tasks listed: %+v", result.Tasks)
+		}
+	}
+}
+
+func TestReminders(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	userID, s, err := setupTest()
+	defer cleanupTest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := testCall(s, "POST", fmt.Sprintf("/users/%s/notes", userID), `{"title": "Plans", "body": "stuff", "reminders": [
+		{"time": "2026-11-02T09:00:00Z", "message": "second", "recurrence": "weekly"},
+		{"time": "2026-11-01T09:00:00Z", "message": "first", "webhook": "https://example.com/hook"}]}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Server responded %d: %s", w.Code, truncate(w.Body.String(), 50))
+	}
+	note := notes.Note{}
+	json.Unmarshal(w.Body.Bytes(), &note)
+	if len(note.Reminders) != 2 || note.Reminders[0].ID == uuid.Nil {
+		t.Fatalf("Saved reminders are %+v", note.Reminders)
+	}
+
+	// Clients that don't send reminders don't remove them.
+	w = testCall(s, "PUT", fmt.Sprintf("/users/%s/notes/%s", userID, note.ID),
+		fmt.Sprintf(`{"id": "%s", "title": "Plans", "body": "more stuff"}`, note.ID))
+	if w.Code != http.StatusOK {
+		t.Fatalf("PUT responded %d: %s", w.Code, truncate(w.Body.String(), 50))
+	}
+	w = testCall(s, "GET", fmt.Sprintf("/users/%s/reminders?before=2026-11-02T00:00:00Z", userID), "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET reminders responded %d: %s", w.Code, truncate(w.Body.String(), 50))
+	}
+	list := rest.DecoratedReminders{}
+	json.Unmarshal(w.Body.Bytes(), &list)
+	if len(list.Reminders) != 1 || list.Reminders[0].Message != "first" || list.Reminders[0].Note != note.ID {
+		t.Errorf("Reminders due before are %+v", list.Reminders)
+	} else if link := list.Reminders[0].Links["note"].Href; !strings.HasSuffix(link, "/notes/"+note.ID.String()) {
+		t.Errorf("Note link is %q", link)
+	}
+	w = testCall(s, "GET", fmt.Sprintf("/users/%s/reminders?length=1", userID), "")
+	json.Unmarshal(w.Body.Bytes(), &list)
+	if len(list.Reminders) != 1 || list.Reminders[0].Message != "first" || list.Links["next"].Href == "" {
+		t.Errorf("First page of reminders is %+v, links %v", list.Reminders, list.Links)
+	}
+
+	w = testCall(s, "GET", fmt.Sprintf("/users/%s/reminders.ics", userID), "")
+	if w.Code != http.StatusOK || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/calendar") {
+		t.Fatalf("GET feed responded %d %s", w.Code, w.Header().Get("Content-Type"))
+	}
+	if feed := w.Body.String(); strings.Count(feed, "BEGIN:VEVENT") != 2 || !strings.Contains(feed, "SUMMARY:second\r\n") {
+		t.Errorf("Feed is %q", feed)
+	}
+
+	w = testCall(s, "POST", fmt.Sprintf("/users/%s/notes", userID), `{"title": "Bad", "reminders": [{"time": "2026-11-01T09:00:00Z", "recurrence": "hourly"}]}`)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Bad recurrence responded %d", w.Code)
+	}
+
+	// Reminders are limited per note, and across the user's notes.
+	reminders := func(n int) string {
+		list := make([]string, n)
+		for i := range list {
+			list[i] = `{"time": "2030-11-01T09:00:00Z"}`
+		}
+		return `{"title": "Many", "reminders": [` + strings.Join(list, ",") + `]}`
+	}
+	if w = testCall(s, "POST", fmt.Sprintf("/users/%s/notes", userID), reminders(maxNoteReminders+1)); w.Code != http.StatusBadRequest {
+		t.Errorf("Too many reminders on a note responded %d", w.Code)
+	}
+	for pending := 2; pending+maxNoteReminders <= maxReminders; pending += maxNoteReminders {
+		if w = testCall(s, "POST", fmt.Sprintf("/users/%s/notes", userID), reminders(maxNoteReminders)); w.Code != http.StatusCreated {
+			t.Fatalf("Reminders within limit responded %d", w.Code)
+		}
+	}
+	if w = testCall(s, "POST", fmt.Sprintf("/users/%s/notes", userID), reminders(maxNoteReminders)); w.Code != http.StatusBadRequest {
+		t.Errorf("Too many reminders for the user responded %d", w.Code)
+	}
+}
+
+func TestPinnedAndOrder(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	userID, s, err := setupTest()
+	defer cleanupTest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := make(map[string]uuid.UUID)
+	for _, body := range []string{
+		`{"title": "A", "path": "f"}`,
+		`{"title": "B", "path": "f", "pinned": true}`,
+		`{"title": "C", "path": "f", "favorite": true}`,
+		`{"title": "D", "path": "g"}`,
+	} {
+		w := testCall(s, "POST", fmt.Sprintf("/users/%s/notes", userID), body)
+		if w.Code != http.StatusCreated {
+			t.Fatalf("Server responded %d: %s", w.Code, truncate(w.Body.String(), 50))
+		}
+		note := notes.Note{}
+		json.Unmarshal(w.Body.Bytes(), &note)
+		ids[note.Title] = note.ID
+	}
+	list := func(route string, expected ...string) {
+		w := testCall(s, "GET", fmt.Sprintf("/users/%s/%s", userID, route), "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: server responded %d: %s", route, w.Code, truncate(w.Body.String(), 50))
+		}
+		payload := rest.DecoratedNotes{}
+		json.Unmarshal(w.Body.Bytes(), &payload)
+		var titles []string
+		for _, note := range payload.Notes {
+			titles = append(titles, note.Title)
+		}
+		if strings.Join(titles, ",") != strings.Join(expected, ",") {
+			t.Errorf("%s: got %q, expected %q", route, titles, expected)
+		}
+	}
+	list("notes?sort=title&order=asc", "B", "A", "C", "D", "Welcome to Freenote")
+	list("notes?sort=title&order=desc", "B", "Welcome to Freenote", "D", "C", "A")
+	list("notes?sort=title&order=asc&start=1&length=2", "A", "C")
+	list("notes?pinned=true&sort=title", "B")
+	list("favorites?sort=title", "C")
+
+	order := fmt.Sprintf(`{"folder": "f", "notes": ["%s", "%s"]}`, ids["C"], ids["A"])
+	if w := testCall(s, "POST", fmt.Sprintf("/users/%s/reorder", userID), order); w.Code != http.StatusNoContent {
+		t.Fatalf("Reorder responded %d: %s", w.Code, truncate(w.Body.String(), 50))
+	}
+	list("notes?folder=f&sort=position&order=asc", "B", "C", "A")
+	order = fmt.Sprintf(`{"folder": "f", "notes": ["%s"]}`, ids["D"])
+	if w := testCall(s, "POST", fmt.Sprintf("/users/%s/reorder", userID), order); w.Code != http.StatusBadRequest {
+		t.Errorf("Reordering a note from another folder responded %d", w.Code)
+	}
+}
+
+func TestProperties(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	userID, s, err := setupTest()
+	defer cleanupTest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []uuid.UUID
+	for _, body := range []string{
+		`{"title": "A", "properties": {"status": "open", "priority": 3, "due": "2026-11-01"}}`,
+		`{"title": "B", "properties": {"status": "open", "priority": 1}}`,
+		`{"title": "C", "properties": {"status": "closed", "priority": 2}}`,
+	} {
+		w := testCall(s, "POST", fmt.Sprintf("/users/%s/notes", userID), body)
+		if w.Code != http.StatusCreated {
+			t.Fatalf("Server responded %d: %s", w.Code, truncate(w.Body.String(), 50))
+		}
+		note := notes.Note{}
+		json.Unmarshal(w.Body.Bytes(), &note)
+		ids = append(ids, note.ID)
+	}
+	list := func(query string, expected ...string) rest.DecoratedNotes {
+		w := testCall(s, "GET", fmt.Sprintf("/users/%s/notes?%s", userID, query), "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: server responded %d: %s", query, w.Code, truncate(w.Body.String(), 50))
+		}
+		payload := rest.DecoratedNotes{}
+		json.Unmarshal(w.Body.Bytes(), &payload)
+		var titles []string
+		for _, note := range payload.Notes {
+			titles = append(titles, note.Title)
+		}
+		if strings.Join(titles, ",") != strings.Join(expected, ",") {
+			t.Errorf("%s: got %q, expected %q", query, titles, expected)
+		}
+		return payload
+	}
+	list("prop.status=open&prop.priority>=2", "A")
+	list("prop.priority%3C3&sort=title&order=asc", "B", "C")
+	list("prop.status!=open&sort=title&order=asc", "C", "Welcome to Freenote")
+	list("prop.due<2026-12-01", "A")
+	page := list("prop.status=open&sort=prop.priority&order=asc&length=1", "B")
+	if next := page.Links["next"].Href; !strings.Contains(next, "?prop.status=open&start=1&") || !strings.Contains(next, "sort=prop.priority") {
+		t.Errorf("Next link is %q", next)
+	}
+	list("sort=prop.priority&order=desc", "A", "C", "B", "Welcome to Freenote")
+
+	// Saving without properties keeps them; an empty map clears them.
+	w := testCall(s, "PUT", fmt.Sprintf("/users/%s/notes/%s", userID, ids[0]), fmt.Sprintf(`{"id": "%s", "title": "A"}`, ids[0]))
+	if w.Code != http.StatusOK {
+		t.Fatalf("PUT responded %d: %s", w.Code, truncate(w.Body.String(), 50))
+	}
+	list("prop.status=open&sort=title&order=asc", "A", "B")
+	testCall(s, "PUT", fmt.Sprintf("/users/%s/notes/%s", userID, ids[0]), fmt.Sprintf(`{"id": "%s", "title": "A", "properties": {}}`, ids[0]))
+	list("prop.status=open", "B")
+
+	if w = testCall(s, "POST", fmt.Sprintf("/users/%s/notes", userID), `{"title": "D", "properties": {"a.b": 1}}`); w.Code != http.StatusBadRequest {
+		t.Errorf("Bad property name responded %d", w.Code)
+	}
+	if w = testCall(s, "GET", fmt.Sprintf("/users/%s/notes?prop.a.b=1", userID), ""); w.Code != http.StatusBadRequest {
+		t.Errorf("Bad property filter responded %d", w.Code)
+	}
+}
+
+func TestSearches(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	userID, s, err := setupTest()
+	defer cleanupTest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, body := range []string{
+		`{"title": "A", "tags": ["work"], "properties": {"priority": 1}}`,
+		`{"title": "B", "tags": ["work"], "properties": {"priority": 3}}`,
+		`{"title": "C", "tags": ["home"], "properties": {"priority": 2}}`,
+	} {
+		if w := testCall(s, "POST", fmt.Sprintf("/users/%s/notes", userID), body); w.Code != http.StatusCreated {
+			t.Fatalf("Server responded %d: %s", w.Code, truncate(w.Body.String(), 50))
+		}
+	}
+	base := fmt.Sprintf("/users/%s/searches", userID)
+	w := testCall(s, "POST", base, `{"name": "Work", "query": "?tag=work&sort=prop.priority&order=desc&start=5"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Server responded %d: %s", w.Code, truncate(w.Body.String(), 50))
+	}
+	search := rest.DecoratedSearch{}
+	json.Unmarshal(w.Body.Bytes(), &search)
+	if search.Count != 2 || search.Query != "tag=work&sort=prop.priority&order=desc" {
+		t.Errorf("Got count %d, query %q", search.Count, search.Query)
+	}
+	if w = testCall(s, "POST", base, `{"name": "work", "query": "tag=home"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("Duplicate name responded %d", w.Code)
+	}
+	if w = testCall(s, "POST", base, `{"name": "Bad", "query": "modifiedSince=yesterday"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("Bad query responded %d", w.Code)
+	}
+
+	list := func(query string, expected ...string) rest.DecoratedNotes {
+		w := testCall(s, "GET", fmt.Sprintf("%s/%s/notes?%s", base, search.ID, query), "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: server responded %d: %s", query, w.Code, truncate(w.Body.String(), 50))
+		}
+		payload := rest.DecoratedNotes{}
+		json.Unmarshal(w.Body.Bytes(), &payload)
+		var titles []string
+		for _, note := range payload.Notes {
+			titles = append(titles, note.Title)
+		}
+		if strings.Join(titles, ",") != strings.Join(expected, ",") {
+			t.Errorf("%s: got %q, expected %q", query, titles, expected)
+		}
+		return payload
+	}
+	page := list("", "B", "A")
+	if _, ok := page.Links["search"]; !ok {
+		t.Error("No search link")
+	}
+	page = list("length=1", "B")
+	if next := page.Links["next"].Href; !strings.Contains(next, fmt.Sprintf("/searches/%s/notes?start=1&length=1&sort=prop.priority", search.ID)) {
+		t.Errorf("Next link is %q", next)
+	}
+	list("sort=title&order=asc", "A", "B")
+
+	// Counts are live.
+	testCall(s, "POST", fmt.Sprintf("/users/%s/notes", userID), `{"title": "D", "tags": ["work"]}`)
+	w = testCall(s, "PUT", fmt.Sprintf("%s/%s", base, search.ID), `{"name": "Work stuff", "query": "tag=work"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("PUT responded %d: %s", w.Code, truncate(w.Body.String(), 50))
+	}
+	json.Unmarshal(w.Body.Bytes(), &search)
+	if search.Count != 3 || search.Name != "Work stuff" {
+		t.Errorf("Got %q with count %d", search.Name, search.Count)
+	}
+	w = testCall(s, "GET", base, "")
+	searches := rest.DecoratedSearches{}
+	json.Unmarshal(w.Body.Bytes(), &searches)
+	if len(searches.Searches) != 1 || searches.Searches[0].Count != 3 {
+		t.Errorf("Got searches %+v", searches.Searches)
+	}
+
+	// Saving the user keeps saved searches.
+	w = testCall(s, "GET", fmt.Sprintf("/users/%s", userID), "")
+	testCall(s, "PUT", fmt.Sprintf("/users/%s", userID), w.Body.String())
+	if w = testCall(s, "GET", fmt.Sprintf("%s/%s", base, search.ID), ""); w.Code != http.StatusOK {
+		t.Errorf("Search lost on user save, responded %d", w.Code)
+	}
+
+	if w = testCall(s, "DELETE", fmt.Sprintf("%s/%s", base, search.ID), ""); w.Code != http.StatusNoContent {
+		t.Errorf("DELETE responded %d", w.Code)
+	}
+	if w = testCall(s, "GET", fmt.Sprintf("%s/%s/notes", base, search.ID), ""); w.Code != http.StatusNotFound {
+		t.Errorf("Deleted search responded %d", w.Code)
+	}
+}
+
+// TestEmailVerification checks that email addresses are validated, and only
+// verified by the code sent to them.
+func TestEmailVerification(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	userID, s, err := setupTest()
+	defer cleanupTest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sent []string
+	s.mail = mail.NewSender(config.ConnectionInfo{Host: "mail.example.com:25", Namespace: "freenote@example.com"})
+	s.mail.SendMail = func(addr string, a smtp.Auth, from string, to []string, msg []byte) error {
+		sent = append(sent, strings.Join(to, ",")+"\n"+string(msg))
+		return nil
+	}
+	userURL := fmt.Sprintf("/users/%s", userID)
+	user := func() users.User {
+		t.Helper()
+		var u users.User
+		json.Unmarshal(testCall(s, "GET", userURL, "").Body.Bytes(), &u)
+		return u
+	}
+	put := func(email string) int {
+		u := user()
+		u.Email = email
+		b, _ := json.Marshal(u)
+		return testCall(s, "PUT", userURL, string(b)).Code
+	}
+	for _, email := range []string{"Eve <eve@example.com>", "eve", "eve@example.com\r\nBcc: x@example.com"} {
+		if code := put(email); code != http.StatusBadRequest {
+			t.Errorf("PUT with email %q responded %d", email, code)
+		}
+	}
+	if code := put("test@example.com"); code != http.StatusOK {
+		t.Fatalf("PUT responded %d", code)
+	}
+	if u := user(); u.Email != "test@example.com" || u.EmailVerified || len(sent) != 1 {
+		t.Fatalf("User %q verified %t after %d emails", u.Email, u.EmailVerified, len(sent))
+	}
+	code := regexp.MustCompile(`(?m)^([A-Za-z0-9+/]{16})\r$`).FindStringSubmatch(sent[0])
+	if !strings.HasPrefix(sent[0], "test@example.com\n") || code == nil {
+		t.Fatalf("Sent %q", sent[0])
+	}
+
+	// Setting verified directly is ignored.
+	u := user()
+	u.EmailVerified = true
+	b, _ := json.Marshal(u)
+	testCall(s, "PUT", userURL, string(b))
+	if user().EmailVerified {
+		t.Error("User set their email verified")
+	}
+	if w := testCall(s, "POST", userURL+"/email", `{"code": "wrong"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("Wrong code responded %d", w.Code)
+	}
+	if w := testCall(s, "POST", userURL+"/email", fmt.Sprintf(`{"code": %q}`, code[1])); w.Code != http.StatusOK {
+		t.Errorf("Code responded %d: %s", w.Code, truncate(w.Body.String(), 50))
+	}
+	if !user().EmailVerified {
+		t.Error("Email not verified")
+	}
+
+	// Changing the address needs it verified again.
+	if code := put("other@example.com"); code != http.StatusOK || user().EmailVerified || len(sent) != 2 {
+		t.Errorf("Changed address responded %d, sent %d emails", code, len(sent))
+	}
+	if w := testCall(s, "POST", userURL+"/email", "{}"); w.Code != http.StatusAccepted || len(sent) != 3 {
+		t.Errorf("Resend responded %d, sent %d emails", w.Code, len(sent))
+	}
+}
+
+func TestSuggest(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	userID, s, err := setupTest()
+	defer cleanupTest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	suggest := func(query string) string {
+		w := testCall(s, "GET", fmt.Sprintf("/users/%s/notes/suggest?%s", userID, query), "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("Server responded %d: %s", w.Code, truncate(w.Body.String(), 50))
+		}
+		payload := struct {
+			Suggestions []map[string]interface{}
+		}{}
+		json.Unmarshal(w.Body.Bytes(), &payload)
+		var titles []string
+		for _, s := range payload.Suggestions {
+			if len(s) != 3 || s["id"] == nil || s["path"] == nil {
+				t.Errorf("Suggestion is %v", s)
+			}
+			titles = append(titles, s["title"].(string))
+		}
+		return strings.Join(titles, ", ")
+	}
+	// Load the index before the notes exist, so they have to be added.
+	suggest("prefix=x")
+	ids := make(map[string]uuid.UUID)
+	now := time.Now().UTC()
+	for _, n := range []struct {
+		title string
+		age   int
+	}{
+		{"Release notes", 100},
+		{"Project release plan", 1},
+		{"Relay setup", 3},
+	} {
+		body := fmt.Sprintf(`{"title": %q, "path": "work", "modified": %q}`, n.title, now.AddDate(0, 0, -n.age).Format(time.RFC3339))
+		w := testCall(s, "POST", fmt.Sprintf("/users/%s/notes", userID), body)
+		if w.Code != http.StatusCreated {
+			t.Fatalf("Server responded %d: %s", w.Code, truncate(w.Body.String(), 50))
+		}
+		note := notes.Note{}
+		json.Unmarshal(w.Body.Bytes(), &note)
+		ids[n.title] = note.ID
+	}
+	if actual := suggest("prefix=rel"); actual != "Relay setup, Release notes, Project release plan" {
+		t.Errorf("rel suggested %s", actual)
+	}
+	if actual := suggest("prefix=RELE&limit=1"); actual != "Release notes" {
+		t.Errorf("RELE suggested %s", actual)
+	}
+	testCall(s, "DELETE", fmt.Sprintf("/users/%s/notes/%s", userID, ids["Relay setup"]), "")
+	testCall(s, "PUT", fmt.Sprintf("/users/%s/notes/%s", userID, ids["Release notes"]),
+		fmt.Sprintf(`{"id": %q, "title": "Old notes"}`, ids["Release notes"]))
+	if actual := suggest("prefix=rel"); actual != "Project release plan" {
+		t.Errorf("rel suggested %s after changes", actual)
+	}
+	if w := testCall(s, "GET", fmt.Sprintf("/users/%s/notes/suggest?limit=many", userID), ""); w.Code != http.StatusBadRequest {
+		t.Errorf("Bad limit responded %d", w.Code)
+	}
+}
+
+func TestGroups(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	ownerID, s, err := setupTest()
+	defer cleanupTest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = createUser("admin", testPassword, users.LevelAdmin); err != nil {
+		t.Fatal(err)
+	}
+	editorID, err := createUser("eddie", testPassword, users.LevelUser)
+	if err != nil {
+		t.Fatal(err)
+	}
+	viewerID, err := createUser("vera", testPassword, users.LevelUser)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = createUser("otto", testPassword, users.LevelUser); err != nil {
+		t.Fatal(err)
+	}
+	call := func(method, url, body, username string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, url, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Accept", "application/json")
+		if username != "" {
+			req.SetBasicAuth(username, testPassword)
+		}
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, req)
+		return w
+	}
+	type groupList struct {
+		Groups []users.Group
+	}
+
+	body := fmt.Sprintf(`{"name": "Team", "members": [{"user": %q, "role": "owner"}, {"user": %q, "role": "editor"}, {"user": %q, "role": "viewer"}]}`,
+		ownerID, editorID, viewerID)
+	if w := call("POST", "/groups", body, testUsername); w.Code != http.StatusForbidden {
+		t.Errorf("Non-admin group creation responded %d", w.Code)
+	}
+	if w := call("POST", "/groups", `{"name": "Team", "members": [{"user": "`+ownerID.String()+`", "role": "boss"}]}`, "admin"); w.Code != http.StatusBadRequest {
+		t.Errorf("Invalid role responded %d", w.Code)
+	}
+	w := call("POST", "/groups", body, "admin")
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Server responded %d: %s", w.Code, truncate(w.Body.String(), 50))
+	}
+	group := users.Group{}
+	json.Unmarshal(w.Body.Bytes(), &group)
+	if group.Name != "Team" || len(group.Members) != 3 || group.Role(viewerID) != users.RoleViewer {
+		t.Errorf("Created group %+v", group)
+	}
+	groupURL := "/groups/" + group.ID.String()
+
+	if w = call("GET", "/groups", "", ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("Anonymous group list responded %d", w.Code)
+	}
+	for username, count := range map[string]int{"vera": 1, "otto": 0, "admin": 1} {
+		w = call("GET", "/groups", "", username)
+		list := groupList{}
+		json.Unmarshal(w.Body.Bytes(), &list)
+		if w.Code != http.StatusOK || len(list.Groups) != count {
+			t.Errorf("%s listed %d groups, status %d", username, len(list.Groups), w.Code)
+		}
+	}
+	if w = call("GET", groupURL, "", "otto"); w.Code != http.StatusForbidden {
+		t.Errorf("Non-member group fetch responded %d", w.Code)
+	}
+
+	// Editors write the group's notes, which aren't theirs.
+	w = call("POST", groupURL+"/notes", `{"title": "Shared plan"}`, "eddie")
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Server responded %d: %s", w.Code, truncate(w.Body.String(), 50))
+	}
+	note := notes.Note{}
+	json.Unmarshal(w.Body.Bytes(), &note)
+	noteURL := groupURL + "/notes/" + note.ID.String()
+	if note.Owner != group.ID || w.Header().Get("Location") != "http"+noteURL {
+		t.Errorf("Group note owned by %s at %s", note.Owner, w.Header().Get("Location"))
+	}
+	if w = call("GET", fmt.Sprintf("/users/%s/notes/%s", editorID, note.ID), "", "eddie"); w.Code != http.StatusNotFound {
+		t.Errorf("Group note under editor responded %d", w.Code)
+	}
+	w = call("PUT", noteURL, fmt.Sprintf(`{"id": %q, "title": "Shared plan", "body": "Step one"}`, note.ID), "eddie")
+	if w.Code != http.StatusOK {
+		t.Errorf("Editor note update responded %d", w.Code)
+	}
+
+	// Viewers only read them.
+	w = call("GET", noteURL, "", "vera")
+	payload := struct {
+		Links map[string]interface{} `json:"_links"`
+		notes.Note
+	}{}
+	json.Unmarshal(w.Body.Bytes(), &payload)
+	if w.Code != http.StatusOK || payload.Body != "Step one" {
+		t.Errorf("Viewer note fetch responded %d: %s", w.Code, truncate(w.Body.String(), 50))
+	} else if _, ok := payload.Links["save"]; ok {
+		t.Error("Viewer offered a save link")
+	}
+	if w = call("GET", groupURL+"/notes?q=step", "", "vera"); !strings.Contains(w.Body.String(), "Shared plan") {
+		t.Errorf("Viewer note search responded %d: %s", w.Code, truncate(w.Body.String(), 50))
+	}
+	if w = call("PUT", noteURL, fmt.Sprintf(`{"id": %q, "title": "Mine"}`, note.ID), "vera"); w.Code != http.StatusForbidden {
+		t.Errorf("Viewer note update responded %d", w.Code)
+	}
+	reminder := `{"title": "Meeting", "reminders": [{"time": "2026-11-01T09:00:00Z", "email": true}]}`
+	if w = call("POST", groupURL+"/notes", reminder, "eddie"); w.Code != http.StatusBadRequest {
+		t.Errorf("Emailed reminder on group note responded %d", w.Code)
+	}
+	reminder = `{"title": "Meeting", "reminders": [{"time": "2026-11-01T09:00:00Z", "webhook": "https://example.com/hook"}]}`
+	if w = call("POST", groupURL+"/notes", reminder, "eddie"); w.Code != http.StatusCreated {
+		t.Fatalf("Webhook reminder on group note responded %d: %s", w.Code, truncate(w.Body.String(), 50))
+	}
+	meeting := notes.Note{}
+	json.NewDecoder(w.Body).Decode(&meeting)
+	meetingURL := "http" + groupURL + "/notes/" + meeting.ID.String()
+	w = call("GET", groupURL+"/reminders", "", "vera")
+	list := rest.DecoratedReminders{}
+	json.NewDecoder(w.Body).Decode(&list)
+	if w.Code != http.StatusOK || len(list.Reminders) != 1 || list.Reminders[0].Links["note"].Href != meetingURL {
+		t.Errorf("Group reminders responded %d: %+v", w.Code, list.Reminders)
+	}
+	w = call("GET", groupURL+"/reminders.ics", "", "vera")
+	if ics := strings.Replace(w.Body.String(), "\r\n ", "", -1); w.Code != http.StatusOK || !strings.Contains(ics, "URL:"+meetingURL+"\r\n") {
+		t.Errorf("Group reminders feed responded %d: %s", w.Code, ics)
+	}
+	if w = call("GET", groupURL+"/reminders", "", "otto"); w.Code != http.StatusForbidden {
+		t.Errorf("Non-member reminders responded %d", w.Code)
+	}
+	if w = call("POST", groupURL+"/notes", `{"title": "Mine"}`, "vera"); w.Code != http.StatusForbidden {
+		t.Errorf("Viewer note creation responded %d", w.Code)
+	}
+	if w = call("DELETE", noteURL, "", "vera"); w.Code != http.StatusForbidden {
+		t.Errorf("Viewer note deletion responded %d", w.Code)
+	}
+	if w = call("GET", groupURL+"/notes", "", "otto"); w.Code != http.StatusForbidden {
+		t.Errorf("Non-member note list responded %d", w.Code)
+	}
+
+	// Group owners manage members; members may leave.
+	if w = call("PUT", groupURL+"/members/otto", `{"role": "viewer"}`, "eddie"); w.Code != http.StatusForbidden {
+		t.Errorf("Editor member change responded %d", w.Code)
+	}
+	if w = call("PUT", groupURL+"/members/otto", `{"role": "viewer"}`, testUsername); w.Code != http.StatusOK {
+		t.Errorf("Owner member change responded %d", w.Code)
+	}
+	if w = call("GET", noteURL, "", "otto"); w.Code != http.StatusOK {
+		t.Errorf("New member note fetch responded %d", w.Code)
+	}
+	if w = call("DELETE", groupURL+"/members/"+testUsername, "", testUsername); w.Code != http.StatusBadRequest {
+		t.Errorf("Last owner leaving responded %d", w.Code)
+	}
+	if w = call("DELETE", groupURL+"/members/otto", "", "otto"); w.Code != http.StatusOK {
+		t.Errorf("Member leaving responded %d", w.Code)
+	}
+	if w = call("GET", noteURL, "", "otto"); w.Code != http.StatusForbidden {
+		t.Errorf("Former member note fetch responded %d", w.Code)
+	}
+	if w = call("PUT", groupURL, `{"name": "Renamed"}`, testUsername); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "Renamed") {
+		t.Errorf("Owner rename responded %d: %s", w.Code, truncate(w.Body.String(), 50))
+	}
+
+	// Deleting the group deletes its notes.
+	if w = call("DELETE", groupURL, "", "admin"); w.Code != http.StatusNoContent {
+		t.Fatalf("Group deletion responded %d", w.Code)
+	}
+	if w = call("GET", groupURL, "", "admin"); w.Code != http.StatusNotFound {
+		t.Errorf("Deleted group fetch responded %d", w.Code)
+	}
+	db, err := store.NewSession(testConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.(io.Closer).Close()
+	if _, err = db.NoteStore().NoteByID(note.ID); err != store.ErrNotFound {
+		t.Errorf("Deleted group's note fetch returned %v", err)
+	}
+}
+
+func TestDAV(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	_, s, err := setupTest()
+	defer cleanupTest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	call := func(method, url, body string, headers map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, url, strings.NewReader(body))
+		req.SetBasicAuth(testUsername, testPassword)
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, req)
+		return w
+	}
+
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest("PROPFIND", "/dav/test/", nil))
+	if w.Code != http.StatusUnauthorized || w.Header().Get("WWW-Authenticate") == "" {
+		t.Errorf("Expected 401 with challenge for anonymous request, got %d", w.Code)
+	}
+
+	if w = call("MKCOL", "/dav/test/work", "", nil); w.Code != http.StatusCreated {
+		t.Fatalf("MKCOL responded %d: %s", w.Code, truncate(w.Body.String(), 50))
+	}
+	w = call("PUT", "/dav/test/work/Plan.md", "---\ntags: [plans]\n---\n\nHello, world", nil)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("PUT responded %d: %s", w.Code, truncate(w.Body.String(), 50))
+	}
+	etag := w.Header().Get("ETag")
+
+	w = call("GET", "/dav/test/work/Plan.md", "", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET responded %d: %s", w.Code, truncate(w.Body.String(), 50))
+	}
+	note, err := notes.ParseMarkdown(w.Body.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if note.Title != "Plan" || note.Folder != "work" || note.Body != "Hello, world" || len(note.Tags) != 1 {
+		t.Errorf("Note wrong: %+v", note)
+	}
+	if w.Header().Get("ETag") != etag {
+		t.Errorf("Expected ETag %s, got %s", etag, w.Header().Get("ETag"))
+	}
+
+	w = call("PROPFIND", "/dav/test/work/", "", map[string]string{"Depth": "1"})
+	if w.Code != http.StatusMultiStatus || !strings.Contains(w.Body.String(), "/dav/test/work/Plan.md") {
+		t.Errorf("PROPFIND responded %d: %s", w.Code, truncate(w.Body.String(), 200))
+	}
+
+	w = call("PUT", "/dav/test/work/Plan.md", "Changed", map[string]string{"If-Match": `"stale"`})
+	if w.Code != http.StatusPreconditionFailed {
+		t.Errorf("Expected 412 for stale If-Match, got %d", w.Code)
+	}
+
+	w = call("MOVE", "/dav/test/work/Plan.md", "", map[string]string{"Destination": "http://example.com/dav/test/Done.md"})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("MOVE responded %d: %s", w.Code, truncate(w.Body.String(), 50))
+	}
+	if w = call("GET", "/dav/test/work/Plan.md", "", nil); w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for moved note, got %d", w.Code)
+	}
+	w = call("GET", "/dav/test/Done.md", "", nil)
+	if note, err = notes.ParseMarkdown(w.Body.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != http.StatusOK || note.Title != "Done" || note.Folder != "" {
+		t.Errorf("Moved note wrong (%d): %+v", w.Code, note)
+	}
+
+	lockBody := `<?xml version="1.0" encoding="utf-8"?>
+<D:lockinfo xmlns:D="DAV:"><D:lockscope><D:exclusive/></D:lockscope><D:locktype><D:write/></D:locktype></D:lockinfo>`
+	w = call("LOCK", "/dav/test/Done.md", lockBody, map[string]string{"Timeout": "Second-60"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("LOCK responded %d: %s", w.Code, truncate(w.Body.String(), 50))
+	}
+	token := w.Header().Get("Lock-Token")
+	if w = call("DELETE", "/dav/test/Done.md", "", nil); w.Code != http.StatusLocked {
+		t.Errorf("Expected 423 deleting locked note, got %d", w.Code)
+	}
+	if w = call("UNLOCK", "/dav/test/Done.md", "", map[string]string{"Lock-Token": token}); w.Code != http.StatusNoContent {
+		t.Errorf("UNLOCK responded %d", w.Code)
+	}
+
+	if w = call("DELETE", "/dav/test/Done.md", "", nil); w.Code != http.StatusNoContent {
+		t.Errorf("DELETE responded %d: %s", w.Code, truncate(w.Body.String(), 50))
+	}
+	if w = call("GET", "/dav/test/Done.md", "", nil); w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for deleted note, got %d", w.Code)
+	}
+}
+
+func setupTest() (userID uuid.UUID, server *Server, err error) {
+	userID, err = createTestUser()
+	if err != nil {
+		return
+	}
+	server, err = New(testConfig)
+	return
+}
+
+// testCall sends a JSON request to the server as the test user.
+func testCall(s *Server, method, url, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, url, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(testUsername, testPassword)
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+	return w
+}
+
+func cleanupTest() {
+	os.Remove(testBoltDB)
+}
+
+func createTestUser() (uuid.UUID, error) {
+	return createUser(testUsername, testPassword, users.LevelUser)
+}
+
+func createUser(username, password string, access users.AccessLevel) (uuid.UUID, error) {
 	db, err := store.NewSession(testConfig)
 	if err != nil {
 		return uuid.Nil, err
@@ -273,8 +2160,9 @@ func createTestUser() (uuid.UUID, error) {
 	if closer, ok := db.(io.Closer); ok {
 		defer closer.Close()
 	}
-	testUser := users.New(testUsername)
-	testUser.Password, err = users.NewPassword(testPassword)
+	testUser := users.New(username)
+	testUser.Access = access
+	testUser.Password, err = users.NewPassword(password)
 	if err != nil {
 		return uuid.Nil, err
 	}
@@ -0,0 +1,223 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	uuid "github.com/satori/go.uuid"
+
+	"github.com/aprice/freenote/ids"
+	"github.com/aprice/freenote/page"
+	"github.com/aprice/freenote/rest"
+	"github.com/aprice/freenote/stats"
+	"github.com/aprice/freenote/store"
+	"github.com/aprice/freenote/users"
+)
+
+// searchPayload is the body of a request to save a search.
+type searchPayload struct {
+	Name  string
+	Query string
+}
+
+// users/{id}/searches/?.*
+func (rh *requestHandler) doSearches(w http.ResponseWriter, r *http.Request) {
+	if len(rh.path) > 1 {
+		rh.doSearch(w, r)
+		return
+	}
+	defer stats.Measure("req", "searches", r.Method)()
+	if !authorizeUser(rh.user, rh.owner) {
+		statusResponse(w, http.StatusForbidden)
+		return
+	}
+	switch r.Method {
+	case http.MethodOptions:
+		rh.preflight(w, r, nil, http.MethodGet, http.MethodPost)
+		return
+	case http.MethodGet:
+		counts := make(map[uuid.UUID]int, len(rh.owner.Searches))
+		for _, search := range rh.owner.Searches {
+			count, err := rh.countSearch(*search)
+			if handleError(w, err) {
+				return
+			}
+			counts[search.ID] = count
+		}
+		sendResponse(w, r, rest.DecorateSearches(rh.owner, counts, rh.baseURI), http.StatusOK)
+	case http.MethodPost:
+		var payload searchPayload
+		if err := parseRequest(r, &payload); badRequest(w, err) {
+			return
+		}
+		query, err := cleanSearchQuery(payload.Query)
+		if badRequest(w, err) {
+			return
+		}
+		search, err := rh.owner.NewSearch(payload.Name, query)
+		if badRequest(w, err) {
+			return
+		}
+		if err = rh.db.UserStore().SaveUser(&rh.owner); handleError(w, err) {
+			return
+		}
+		count, err := rh.countSearch(search)
+		if handleError(w, err) {
+			return
+		}
+		w.Header().Add("Location", fmt.Sprintf("%s/users/%s/searches/%s", rh.baseURI, rh.owner.ID, search.ID))
+		sendResponse(w, r, rest.DecorateSearch(rh.owner, search, count, rh.baseURI), http.StatusCreated)
+	default:
+		w.Header().Add("Allow", "GET, POST")
+		statusResponse(w, http.StatusMethodNotAllowed)
+	}
+}
+
+// users/{id}/searches/{id}/?.*
+func (rh *requestHandler) doSearch(w http.ResponseWriter, r *http.Request) {
+	searchID, err := ids.ParseID(rh.popSegment())
+	if badRequest(w, err) {
+		return
+	}
+	if !authorizeUser(rh.user, rh.owner) {
+		statusResponse(w, http.StatusForbidden)
+		return
+	}
+	search := rh.owner.Search(searchID)
+	if search == nil {
+		statusResponse(w, http.StatusNotFound)
+		return
+	}
+	if next := rh.popSegment(); next == "notes" {
+		rh.doSearchNotes(w, r, *search)
+		return
+	} else if next != "" {
+		statusResponse(w, http.StatusNotFound)
+		return
+	}
+	defer stats.Measure("req", "search", r.Method)()
+	switch r.Method {
+	case http.MethodOptions:
+		rh.preflight(w, r, nil, http.MethodGet, http.MethodPut, http.MethodDelete)
+		return
+	case http.MethodGet:
+		count, err := rh.countSearch(*search)
+		if handleError(w, err) {
+			return
+		}
+		sendResponse(w, r, rest.DecorateSearch(rh.owner, *search, count, rh.baseURI), http.StatusOK)
+	case http.MethodPut:
+		var payload searchPayload
+		if err = parseRequest(r, &payload); badRequest(w, err) {
+			return
+		}
+		query, err := cleanSearchQuery(payload.Query)
+		if badRequest(w, err) {
+			return
+		}
+		if search, err = rh.owner.UpdateSearch(searchID, payload.Name, query); badRequest(w, err) {
+			return
+		}
+		if err = rh.db.UserStore().SaveUser(&rh.owner); handleError(w, err) {
+			return
+		}
+		count, err := rh.countSearch(*search)
+		if handleError(w, err) {
+			return
+		}
+		sendResponse(w, r, rest.DecorateSearch(rh.owner, *search, count, rh.baseURI), http.StatusOK)
+	case http.MethodDelete:
+		rh.owner.RemoveSearch(searchID)
+		if err = rh.db.UserStore().SaveUser(&rh.owner); handleError(w, err) {
+			return
+		}
+		statusResponse(w, http.StatusNoContent)
+	default:
+		w.Header().Add("Allow", "GET, PUT, DELETE")
+		statusResponse(w, http.StatusMethodNotAllowed)
+	}
+}
+
+// users/{id}/searches/{id}/notes
+func (rh *requestHandler) doSearchNotes(w http.ResponseWriter, r *http.Request, search users.Search) {
+	defer stats.Measure("req", "searchnotes", r.Method)()
+	switch r.Method {
+	case http.MethodOptions:
+		rh.preflight(w, r, nil, http.MethodGet)
+	case http.MethodGet:
+		q, err := searchQuery(search, r.URL.Query())
+		if badRequest(w, err) {
+			return
+		}
+		q.Owner = rh.owner.ID
+		list, total, err := rh.db.NoteStore().QueryNotes(q)
+		if handleError(w, err) {
+			return
+		}
+		q.Page.HasMore = total > (q.Page.Start + q.Page.Length)
+		sendResponse(w, r, rest.DecorateSearchNotes(rh.owner, search, list, q.Search.TextTerms(), q.Page, true, rh.baseURI), http.StatusOK)
+	default:
+		w.Header().Add("Allow", http.MethodGet)
+		statusResponse(w, http.StatusMethodNotAllowed)
+	}
+}
+
+// searchPageParams are the parameters of a request to run a saved search that
+// take precedence over the search's own.
+var searchPageParams = []string{"start", "length", "sort", "order"}
+
+// searchQuery builds the note query for a saved search, with paging and
+// sorting parameters from the request taking precedence.
+func searchQuery(search users.Search, params url.Values) (store.NoteQuery, error) {
+	override := url.Values{}
+	for _, k := range searchPageParams {
+		if v := params.Get(k); v != "" {
+			override.Set(k, v)
+		}
+	}
+	raw := search.Query
+	if enc := override.Encode(); enc != "" {
+		// Query values are read first come, first served.
+		raw = strings.TrimSuffix(enc+"&"+raw, "&")
+	}
+	q, _, err := parseNoteQuery(&url.URL{RawQuery: raw})
+	return q, err
+}
+
+// countSearch returns the number of the owner's notes a saved search matches.
+func (rh *requestHandler) countSearch(search users.Search) (int, error) {
+	q, err := searchQuery(search, nil)
+	if err != nil {
+		return 0, err
+	}
+	q.Owner = rh.owner.ID
+	// Only the total is needed, so don't sort by a property in memory.
+	q.Page = page.Page{Length: 1, SortBy: "modified"}
+	_, total, err := rh.db.NoteStore().QueryNotes(q)
+	if err == store.ErrNotFound {
+		return 0, nil
+	}
+	return total, err
+}
+
+// cleanSearchQuery checks that a search query string is a valid notes
+// collection query, and drops any leading ? and paging parameters.
+func cleanSearchQuery(raw string) (string, error) {
+	raw = strings.TrimPrefix(strings.TrimSpace(raw), "?")
+	if _, err := url.ParseQuery(raw); err != nil {
+		return "", err
+	}
+	if _, _, err := parseNoteQuery(&url.URL{RawQuery: raw}); err != nil {
+		return "", err
+	}
+	var kept []string
+	for _, param := range strings.Split(raw, "&") {
+		if param == "" || strings.HasPrefix(param, "start=") || strings.HasPrefix(param, "length=") {
+			continue
+		}
+		kept = append(kept, param)
+	}
+	return strings.Join(kept, "&"), nil
+}
@@ -5,6 +5,7 @@ import (
 	"crypto/tls"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"regexp"
 	"strings"
@@ -15,7 +16,11 @@ import (
 	"golang.org/x/crypto/acme/autocert"
 
 	"github.com/aprice/freenote/config"
+	"github.com/aprice/freenote/dav"
+	"github.com/aprice/freenote/mail"
+	"github.com/aprice/freenote/oidc"
 	"github.com/aprice/freenote/store"
+	"github.com/aprice/freenote/suggest"
 	"github.com/aprice/freenote/users"
 	"github.com/aprice/freenote/web"
 )
@@ -27,6 +32,11 @@ type Server struct {
 	sanitizer *bluemonday.Policy
 	svr       *http.Server
 	tlsSvr    *http.Server
+	oidc      *oidc.Provider
+	proxies   trustedProxies
+	dav       *dav.Handler
+	titles    *suggest.Index
+	mail      *mail.Sender
 }
 
 // New creates a new HTTP Server with the given configuration.
@@ -34,7 +44,22 @@ func New(conf config.Config) (*Server, error) {
 	s := &Server{
 		conf:      conf,
 		fs:        web.GetEmbeddedContent(),
-		sanitizer: bluemonday.UGCPolicy(),
+		sanitizer: newSanitizer(),
+		dav:       dav.NewHandler(),
+		titles:    suggest.NewIndex(),
+		mail:      mail.NewSender(conf.MailServer),
+	}
+	var err error
+	if s.proxies, err = parseTrustedProxies(conf.TrustedProxies); err != nil {
+		return nil, err
+	}
+	if conf.OIDC.Issuer != "" {
+		s.oidc = oidc.NewProvider(oidc.Config{
+			Issuer:       conf.OIDC.Issuer,
+			ClientID:     conf.OIDC.ClientID,
+			ClientSecret: conf.OIDC.ClientSecret,
+			Scopes:       conf.OIDC.Scopes,
+		}, nil)
 	}
 	s.sanitizer.AllowAttrs("class").Matching(regexp.MustCompile("^language-[a-zA-Z0-9]+$")).OnElements("code")
 	s.svr = &http.Server{
@@ -119,14 +144,26 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		path = path[:idx]
 	}
 	switch path {
-	case "session", "users":
-		rh, err := newRequestHandler(r, s.conf, s.sanitizer)
+	case "session", "users", "groups", "audit", "dav":
+		proxied := s.proxies.trusts(r)
+		if ip := s.proxies.forwardedFor(r); ip != "" {
+			// Sessions and audit entries record the client, not the proxy.
+			r = r.WithContext(r.Context())
+			r.RemoteAddr = net.JoinHostPort(ip, "0")
+		}
+		rh, err := newRequestHandler(r, s.conf, s.sanitizer, proxied)
 		if err != nil {
 			if handleError(w, err) {
 				return
 			}
 		}
 		defer rh.close()
+		rh.oidc = s.oidc
+		rh.dav = s.dav
+		rh.titles = s.titles
+		rh.mail = s.mail
+		// Note changes go through the title index to keep it up to date.
+		rh.db = s.titles.Session(rh.db)
 		rh.handle(w, r)
 	case "debug":
 		doDebug(w, r)
@@ -137,7 +174,7 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 func (s *Server) upgrade(w http.ResponseWriter, r *http.Request) bool {
 	// Prefer HTTPS but not HTTPS?
-	if s.conf.CanonicalHTTPS && r.TLS == nil && r.Header.Get("X-Forwarded-Proto") != "https" {
+	if s.conf.CanonicalHTTPS && r.TLS == nil && forwardedProto(r, s.proxies.trusts(r)) != "https" {
 		u := s.conf.BaseURI + r.URL.Path
 		// Upgrade-Insecure-Requests -> 307 + Vary
 		if r.Header.Get("Upgrade-Insecure-Requests") == "1" {
@@ -164,12 +201,29 @@ func handleError(w http.ResponseWriter, err error) bool {
 		statusResponse(w, http.StatusNotFound)
 		return true
 	}
-	if err == users.ErrAuthenticationFailed {
+	if err == store.ErrConflict {
+		statusResponse(w, http.StatusPreconditionFailed)
+		return true
+	}
+	if err == users.ErrAuthenticationFailed || err == errAuthFailed {
 		http.Error(w, "Authentication Failed", http.StatusUnauthorized)
 		return true
 	}
+	if err == errChallengeInvalid {
+		http.Error(w, "Authentication Failed", http.StatusUnauthorized)
+		return true
+	}
+	if err == errTokenRequired {
+		http.Error(w, "Unauthorized: API Token Required", http.StatusUnauthorized)
+		return true
+	}
+	if err == users.ErrAccountDisabled {
+		http.Error(w, "Account Disabled", http.StatusForbidden)
+		return true
+	}
 	if err == errUnauthorized {
 		statusResponse(w, http.StatusForbidden)
+		return true
 	}
 	if err != nil {
 		log.Printf("%T: %[1]q", err)
@@ -0,0 +1,129 @@
+package server
+
+import (
+	"net/http"
+
+	uuid "github.com/satori/go.uuid"
+
+	"github.com/aprice/freenote/audit"
+	"github.com/aprice/freenote/ids"
+	"github.com/aprice/freenote/rest"
+	"github.com/aprice/freenote/stats"
+	"github.com/aprice/freenote/users"
+)
+
+// currentSession returns the ID of the requesting user's cookie session, if
+// the session belongs to the given user.
+func currentSession(r *http.Request, user users.User) uuid.UUID {
+	sess, err := parseSessionCookie(r)
+	if err != nil || sess.UserID != user.ID {
+		return uuid.Nil
+	}
+	return sess.ID
+}
+
+// users/{id}/sessions/?.*
+func (rh *requestHandler) doSessions(w http.ResponseWriter, r *http.Request) {
+	if len(rh.path) > 1 {
+		rh.doUserSession(w, r)
+		return
+	}
+	defer stats.Measure("req", "sessions", r.Method)()
+	switch r.Method {
+	case http.MethodOptions:
+		rh.preflight(w, r, nil, http.MethodGet, http.MethodDelete)
+		return
+	case http.MethodGet:
+		if !authorizeUser(rh.user, rh.owner) {
+			statusResponse(w, http.StatusForbidden)
+			return
+		}
+		rh.owner.CleanSessions()
+		sendResponse(w, r, rest.DecorateSessions(rh.owner, currentSession(r, rh.owner), rh.baseURI), http.StatusOK)
+	case http.MethodDelete:
+		if !authorizeUser(rh.user, rh.owner) {
+			statusResponse(w, http.StatusForbidden)
+			return
+		}
+		entry := audit.NewEntry(audit.ActionSessionRevoke, audit.OutcomeSuccess)
+		entry.Target = rh.owner.ID
+		if r.URL.Query().Get("others") == "true" {
+			rh.owner.RevokeSessions(currentSession(r, rh.owner))
+			entry.Detail = "all other sessions"
+		} else {
+			rh.owner.RevokeSessions()
+			entry.Detail = "all sessions"
+			if currentSession(r, rh.owner) != uuid.Nil {
+				deleteSessionCookie(w)
+			}
+		}
+		if err := rh.db.UserStore().SaveUser(&rh.owner); handleError(w, err) {
+			return
+		}
+		recordAudit(rh.db, r, rh.user, entry)
+		statusResponse(w, http.StatusNoContent)
+	default:
+		w.Header().Add("Allow", "GET, DELETE")
+		statusResponse(w, http.StatusMethodNotAllowed)
+	}
+}
+
+// users/{id}/sessions/{id}
+func (rh *requestHandler) doUserSession(w http.ResponseWriter, r *http.Request) {
+	sessID, err := ids.ParseID(rh.popSegment())
+	if badRequest(w, err) {
+		return
+	}
+	if !authorizeUser(rh.user, rh.owner) {
+		statusResponse(w, http.StatusForbidden)
+		return
+	}
+	sess := rh.owner.Session(sessID)
+	if sess == nil {
+		statusResponse(w, http.StatusNotFound)
+		return
+	}
+	defer stats.Measure("req", "usersession", r.Method)()
+	switch r.Method {
+	case http.MethodOptions:
+		rh.preflight(w, r, nil, http.MethodGet, http.MethodPut, http.MethodPatch, http.MethodDelete)
+		return
+	case http.MethodGet:
+		current := currentSession(r, rh.owner) == sess.ID
+		sendResponse(w, r, rest.DecorateSession(rh.owner, *sess, current, rh.baseURI), http.StatusOK)
+	case http.MethodPut, http.MethodPatch:
+		// Only the session's user labels it.
+		if rh.user.ID != rh.owner.ID {
+			statusResponse(w, http.StatusForbidden)
+			return
+		}
+		var payload struct{ Label string }
+		if err = parseRequest(r, &payload); badRequest(w, err) {
+			return
+		}
+		if err = sess.SetLabel(payload.Label); badRequest(w, err) {
+			return
+		}
+		if err = rh.db.UserStore().SaveUser(&rh.owner); handleError(w, err) {
+			return
+		}
+		current := currentSession(r, rh.owner) == sess.ID
+		sendResponse(w, r, rest.DecorateSession(rh.owner, *sess, current, rh.baseURI), http.StatusOK)
+	case http.MethodDelete:
+		rh.owner.RemoveSession(sessID)
+		if err = rh.db.UserStore().SaveUser(&rh.owner); handleError(w, err) {
+			return
+		}
+		if currentSession(r, rh.owner) == sessID {
+			deleteSessionCookie(w)
+		}
+		entry := audit.NewEntry(audit.ActionSessionRevoke, audit.OutcomeSuccess)
+		entry.Target = rh.owner.ID
+		entry.Detail = sessID.String()
+		recordAudit(rh.db, r, rh.user, entry)
+		statusResponse(w, http.StatusNoContent)
+	default:
+		w.Header().Add("Allow", "GET, PUT, PATCH, DELETE")
+		statusResponse(w, http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,53 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/aprice/freenote/rest"
+	"github.com/aprice/freenote/stats"
+)
+
+// DefaultSuggestions and MaxSuggestions are the default and greatest number of
+// notes suggested for a typed title.
+const (
+	DefaultSuggestions = 10
+	MaxSuggestions     = 50
+)
+
+// users/{id}/notes/suggest
+// groups/{id}/notes/suggest
+func (rh *requestHandler) doSuggest(w http.ResponseWriter, r *http.Request) {
+	defer stats.Measure("req", "suggest", r.Method)()
+	switch r.Method {
+	case http.MethodOptions:
+		rh.preflight(w, r, nil, http.MethodGet)
+	case http.MethodGet:
+		if !rh.authorizeNotes(false) {
+			statusResponse(w, http.StatusForbidden)
+			return
+		}
+		limit := DefaultSuggestions
+		if raw := r.URL.Query().Get("limit"); raw != "" {
+			var err error
+			if limit, err = strconv.Atoi(raw); badRequest(w, err) {
+				return
+			}
+			if limit < 1 {
+				limit = 1
+			} else if limit > MaxSuggestions {
+				limit = MaxSuggestions
+			}
+		}
+		prefix := r.URL.Query().Get("prefix")
+		list, err := rh.titles.Suggest(rh.db, rh.ownerID(), prefix, limit, time.Now())
+		if handleError(w, err) {
+			return
+		}
+		sendResponse(w, r, rest.DecorateSuggestions(prefix, list, rh.ownerURI()), http.StatusOK)
+	default:
+		w.Header().Add("Allow", http.MethodGet)
+		statusResponse(w, http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,118 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/aprice/freenote/notes"
+	"github.com/aprice/freenote/page"
+	"github.com/aprice/freenote/rest"
+	"github.com/aprice/freenote/stats"
+	"github.com/aprice/freenote/store"
+)
+
+// users/{id}/tasks
+func (rh *requestHandler) doTasks(w http.ResponseWriter, r *http.Request) {
+	if rh.popSegment() != "" {
+		statusResponse(w, http.StatusNotFound)
+		return
+	}
+	defer stats.Measure("req", "tasks", r.Method)()
+	switch r.Method {
+	case http.MethodOptions:
+		rh.preflight(w, r, nil, http.MethodGet)
+	case http.MethodGet:
+		if !authorizeUser(rh.user, rh.owner) {
+			statusResponse(w, http.StatusForbidden)
+			return
+		}
+		query, err := parseTaskQuery(r)
+		if badRequest(w, err) {
+			return
+		}
+		query.Owner = rh.owner.ID
+		list, total, err := rh.db.TaskStore().QueryTasks(query)
+		if handleError(w, err) {
+			return
+		}
+		query.Page.HasMore = total > (query.Page.Start + query.Page.Length)
+		filter := url.Values{}
+		for _, k := range []string{"state", "dueBefore", "tag", "folder"} {
+			if v := r.URL.Query().Get(k); v != "" {
+				filter.Set(k, v)
+			}
+		}
+		base := rh.baseURI + "/users/" + rh.owner.ID.String() + "/tasks"
+		sendResponse(w, r, rest.DecorateTasks(list, base, filter.Encode(), query.Page, true, rh.baseURI), http.StatusOK)
+	default:
+		w.Header().Add("Allow", http.MethodGet)
+		statusResponse(w, http.StatusMethodNotAllowed)
+	}
+}
+
+var errTaskState = errors.New("state must be open or done")
+
+func parseTaskQuery(r *http.Request) (store.TaskQuery, error) {
+	var err error
+	pageReq := page.Page{
+		Length: 50,
+		SortBy: "due",
+	}
+	pageReq.FromQueryString(r.URL, []string{"due", "text"})
+	query := store.TaskQuery{
+		Page:   pageReq,
+		State:  r.URL.Query().Get("state"),
+		Tag:    r.URL.Query().Get("tag"),
+		Folder: r.URL.Query().Get("folder"),
+	}
+	if query.State != "" && query.State != store.TaskOpen && query.State != store.TaskDone {
+		return query, errTaskState
+	}
+	if raw := r.URL.Query().Get("dueBefore"); raw != "" {
+		if query.DueBefore, err = time.Parse(notes.DueFormat, raw); err != nil {
+			return query, err
+		}
+	}
+	return query, nil
+}
+
+// users/{id}/notes/{id}/tasks/{id}/toggle
+// groups/{id}/notes/{id}/tasks/{id}/toggle
+func (rh *requestHandler) doTask(w http.ResponseWriter, r *http.Request, note notes.Note) {
+	taskID := rh.popSegment()
+	if taskID == "" || rh.popSegment() != "toggle" || rh.popSegment() != "" {
+		statusResponse(w, http.StatusNotFound)
+		return
+	}
+	defer stats.Measure("req", "tasktoggle", r.Method)()
+	switch r.Method {
+	case http.MethodOptions:
+		rh.preflight(w, r, nil, http.MethodPost)
+	case http.MethodPost:
+		if !authorizeNoteWrite(rh.user, note, rh.group) {
+			statusResponse(w, http.StatusForbidden)
+			return
+		}
+		if !ifMatch(r, note, true) {
+			statusResponse(w, http.StatusPreconditionFailed)
+			return
+		}
+		body, _, err := notes.ToggleTask(note.Body, taskID)
+		if err == notes.ErrTaskNotFound {
+			http.Error(w, "Not Found: no such task", http.StatusNotFound)
+			return
+		}
+		note.Body, note.HTMLBody, note.Modified = body, "", time.Now()
+		if err = rh.db.NoteStore().UpdateNote(&note); handleError(w, err) {
+			return
+		}
+		ensureHTMLBody(&note, rh.sanitizer)
+		w.Header().Set("ETag", note.ETag())
+		sendResponse(w, r, rest.DecorateNote(note, true, rh.ownerURI()), http.StatusOK)
+	default:
+		w.Header().Add("Allow", http.MethodPost)
+		statusResponse(w, http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,108 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/aprice/freenote/audit"
+	"github.com/aprice/freenote/ids"
+	"github.com/aprice/freenote/rest"
+	"github.com/aprice/freenote/stats"
+)
+
+var errTokenName = errors.New("token name required")
+
+// users/{id}/tokens/?.*
+func (rh *requestHandler) doTokens(w http.ResponseWriter, r *http.Request) {
+	if len(rh.path) > 1 {
+		rh.doToken(w, r)
+		return
+	}
+	defer stats.Measure("req", "tokens", r.Method)()
+	if !authorizeUser(rh.user, rh.owner) {
+		statusResponse(w, http.StatusForbidden)
+		return
+	}
+	self := rh.user.ID == rh.owner.ID
+	switch r.Method {
+	case http.MethodOptions:
+		rh.preflight(w, r, nil, http.MethodGet, http.MethodPost)
+		return
+	case http.MethodGet:
+		sendResponse(w, r, rest.DecorateTokens(rh.owner, self, rh.baseURI), http.StatusOK)
+	case http.MethodPost:
+		// Tokens grant full access as their owner, so only the owner may
+		// create them.
+		if !self {
+			statusResponse(w, http.StatusForbidden)
+			return
+		}
+		var payload struct{ Name string }
+		if err := parseRequest(r, &payload); badRequest(w, err) {
+			return
+		}
+		payload.Name = strings.TrimSpace(payload.Name)
+		if payload.Name == "" {
+			badRequest(w, errTokenName)
+			return
+		}
+		tok, secret, err := rh.owner.NewToken(payload.Name)
+		if handleError(w, err) {
+			return
+		}
+		if err = rh.db.UserStore().SaveUser(&rh.owner); handleError(w, err) {
+			return
+		}
+		entry := audit.NewEntry(audit.ActionTokenCreate, audit.OutcomeSuccess)
+		entry.Target = rh.owner.ID
+		entry.Detail = tok.ID.String()
+		recordAudit(rh.db, r, rh.user, entry)
+		decorated := rest.DecorateToken(rh.owner, tok, rh.baseURI)
+		decorated.Token = encodeAPIToken(rh.owner.ID, tok.ID, secret)
+		w.Header().Add("Location", fmt.Sprintf("%s/users/%s/tokens/%s", rh.baseURI, rh.owner.ID, tok.ID))
+		sendResponse(w, r, decorated, http.StatusCreated)
+	default:
+		w.Header().Add("Allow", "GET, POST")
+		statusResponse(w, http.StatusMethodNotAllowed)
+	}
+}
+
+// users/{id}/tokens/{id}
+func (rh *requestHandler) doToken(w http.ResponseWriter, r *http.Request) {
+	tokID, err := ids.ParseID(rh.popSegment())
+	if badRequest(w, err) {
+		return
+	}
+	if !authorizeUser(rh.user, rh.owner) {
+		statusResponse(w, http.StatusForbidden)
+		return
+	}
+	tok := rh.owner.Token(tokID)
+	if tok == nil {
+		statusResponse(w, http.StatusNotFound)
+		return
+	}
+	defer stats.Measure("req", "token", r.Method)()
+	switch r.Method {
+	case http.MethodOptions:
+		rh.preflight(w, r, nil, http.MethodGet, http.MethodDelete)
+		return
+	case http.MethodGet:
+		sendResponse(w, r, rest.DecorateToken(rh.owner, *tok, rh.baseURI), http.StatusOK)
+	case http.MethodDelete:
+		rh.owner.RemoveToken(tokID)
+		if err = rh.db.UserStore().SaveUser(&rh.owner); handleError(w, err) {
+			return
+		}
+		entry := audit.NewEntry(audit.ActionTokenRevoke, audit.OutcomeSuccess)
+		entry.Target = rh.owner.ID
+		entry.Detail = tokID.String()
+		recordAudit(rh.db, r, rh.user, entry)
+		statusResponse(w, http.StatusNoContent)
+	default:
+		w.Header().Add("Allow", "GET, DELETE")
+		statusResponse(w, http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,219 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+
+	"github.com/aprice/freenote/audit"
+	"github.com/aprice/freenote/rest"
+	"github.com/aprice/freenote/stats"
+	"github.com/aprice/freenote/users"
+)
+
+// twoFactorIssuer identifies the service in authenticator apps.
+const twoFactorIssuer = "Freenote"
+
+var errTwoFactorEnabled = errors.New("two-factor authentication already enabled")
+var errTwoFactorOthers = errors.New("can't manage another user's two-factor authentication")
+
+// issueTwoFactorChallenge responds to a valid password login by a user with
+// two-factor authentication, with a challenge to be answered with a code.
+func (rh *requestHandler) issueTwoFactorChallenge(w http.ResponseWriter, r *http.Request, user users.User) {
+	secret, err := user.NewTwoFactorChallenge(time.Now())
+	if handleError(w, err) {
+		return
+	}
+	if err = rh.db.UserStore().SaveUser(&user); handleError(w, err) {
+		return
+	}
+	challenge := encodeCredential(user.ID, uuid.Nil, secret)
+	w.Header().Set("X-Freenote-Two-Factor", "required")
+	sendResponse(w, r, rest.DecorateTwoFactorChallenge(challenge, user.TwoFactor.ChallengeExpires, rh.baseURI), http.StatusUnauthorized)
+}
+
+// answerTwoFactorChallenge completes a two-factor login, returning the user if
+// the code answers the challenge.
+func (rh *requestHandler) answerTwoFactorChallenge(r *http.Request, challenge, code string) (users.User, error) {
+	userID, _, secret, ok := decodeCredential(challenge)
+	if !ok {
+		return users.User{}, errChallengeInvalid
+	}
+	user, err := rh.db.UserStore().UserByID(userID)
+	if err != nil {
+		return users.User{}, errChallengeInvalid
+	}
+	if user.Disabled {
+		auditFailedLogin(rh.db, r, user, users.ErrAccountDisabled.Error())
+		return users.User{}, users.ErrAccountDisabled
+	}
+	now := time.Now()
+	ok = user.AnswerTwoFactorChallenge(secret, code, now)
+	if err = rh.db.UserStore().SaveUser(&user); err != nil {
+		return users.User{}, err
+	}
+	if !ok {
+		auditFailedLogin(rh.db, r, user, twoFactorFailure(user, now))
+		time.Sleep(failedAuthDelay)
+		return users.User{}, errChallengeInvalid
+	}
+	return user, nil
+}
+
+// twoFactorFailure describes a failed two-factor login for the audit log.
+func twoFactorFailure(user users.User, now time.Time) string {
+	if user.TwoFactorLocked(now) {
+		return users.ErrTwoFactorLocked.Error()
+	}
+	return users.ErrTwoFactorCodeInvalid.Error()
+}
+
+// twoFactorCode reads a two-factor code from the query string or request body.
+func twoFactorCode(r *http.Request) (string, error) {
+	if code := r.URL.Query().Get("code"); code != "" {
+		return code, nil
+	}
+	var payload struct{ Code string }
+	if r.ContentLength == 0 {
+		return "", nil
+	}
+	err := parseRequest(r, &payload)
+	return payload.Code, err
+}
+
+// users/{id}/twofactor/?.*
+func (rh *requestHandler) doTwoFactor(w http.ResponseWriter, r *http.Request) {
+	if next := rh.popSegment(); next == "recoverycodes" {
+		rh.doRecoveryCodes(w, r)
+		return
+	} else if next != "" {
+		statusResponse(w, http.StatusNotFound)
+		return
+	}
+	defer stats.Measure("req", "twofactor", r.Method)()
+	if !authorizeUser(rh.user, rh.owner) {
+		statusResponse(w, http.StatusForbidden)
+		return
+	}
+	self := rh.user.ID == rh.owner.ID
+	switch r.Method {
+	case http.MethodOptions:
+		rh.preflight(w, r, nil, http.MethodGet, http.MethodPost, http.MethodPut, http.MethodDelete)
+		return
+	case http.MethodGet:
+		sendResponse(w, r, rest.DecorateTwoFactor(rh.owner, rh.baseURI), http.StatusOK)
+	case http.MethodPost:
+		if !self {
+			badRequest(w, errTwoFactorOthers)
+			return
+		}
+		if rh.owner.TwoFactorEnabled() {
+			http.Error(w, "Conflict: "+errTwoFactorEnabled.Error(), http.StatusConflict)
+			return
+		}
+		secret, uri, err := rh.owner.BeginTwoFactor(twoFactorIssuer)
+		if handleError(w, err) {
+			return
+		}
+		if err = rh.db.UserStore().SaveUser(&rh.owner); handleError(w, err) {
+			return
+		}
+		sendResponse(w, r, rest.DecorateTwoFactorEnrolment(rh.owner, secret, uri, rh.baseURI), http.StatusOK)
+	case http.MethodPut:
+		if !self {
+			badRequest(w, errTwoFactorOthers)
+			return
+		}
+		code, err := twoFactorCode(r)
+		if badRequest(w, err) {
+			return
+		}
+		codes, err := rh.owner.ConfirmTwoFactor(code, time.Now())
+		if err == users.ErrTwoFactorNotPending {
+			http.Error(w, "Conflict: "+err.Error(), http.StatusConflict)
+			return
+		} else if badRequest(w, err) {
+			return
+		}
+		if err = rh.db.UserStore().SaveUser(&rh.owner); handleError(w, err) {
+			return
+		}
+		entry := audit.NewEntry(audit.ActionTwoFactorEnable, audit.OutcomeSuccess)
+		entry.Target = rh.owner.ID
+		recordAudit(rh.db, r, rh.user, entry)
+		sendResponse(w, r, rest.DecorateRecoveryCodes(rh.owner, codes, rh.baseURI), http.StatusOK)
+	case http.MethodDelete:
+		// Admins can reset other users' two-factor, e.g. for a lost device.
+		// Users must prove they still hold it.
+		if self || rh.user.Access < users.LevelAdmin {
+			code, err := twoFactorCode(r)
+			if badRequest(w, err) {
+				return
+			}
+			if rh.owner.TwoFactorEnabled() && !rh.owner.VerifyTwoFactor(code, time.Now()) {
+				entry := audit.NewEntry(audit.ActionTwoFactorDisable, audit.OutcomeFailure)
+				entry.Target = rh.owner.ID
+				entry.Detail = users.ErrTwoFactorCodeInvalid.Error()
+				recordAudit(rh.db, r, rh.user, entry)
+				badRequest(w, users.ErrTwoFactorCodeInvalid)
+				return
+			}
+		}
+		if rh.owner.TwoFactor != nil {
+			wasEnabled := rh.owner.TwoFactorEnabled()
+			rh.owner.ResetTwoFactor()
+			if err := rh.db.UserStore().SaveUser(&rh.owner); handleError(w, err) {
+				return
+			}
+			if wasEnabled {
+				entry := audit.NewEntry(audit.ActionTwoFactorDisable, audit.OutcomeSuccess)
+				entry.Target = rh.owner.ID
+				recordAudit(rh.db, r, rh.user, entry)
+			}
+		}
+		statusResponse(w, http.StatusNoContent)
+	default:
+		w.Header().Add("Allow", "GET, POST, PUT, DELETE")
+		statusResponse(w, http.StatusMethodNotAllowed)
+	}
+}
+
+// users/{id}/twofactor/recoverycodes
+func (rh *requestHandler) doRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	defer stats.Measure("req", "recoverycodes", r.Method)()
+	switch r.Method {
+	case http.MethodOptions:
+		rh.preflight(w, r, nil, http.MethodPost)
+		return
+	case http.MethodPost:
+		if rh.user.ID != rh.owner.ID {
+			statusResponse(w, http.StatusForbidden)
+			return
+		}
+		if !rh.owner.TwoFactorEnabled() {
+			http.Error(w, "Conflict: "+users.ErrTwoFactorNotPending.Error(), http.StatusConflict)
+			return
+		}
+		code, err := twoFactorCode(r)
+		if badRequest(w, err) {
+			return
+		}
+		if !rh.owner.VerifyTwoFactor(code, time.Now()) {
+			badRequest(w, users.ErrTwoFactorCodeInvalid)
+			return
+		}
+		codes, err := rh.owner.NewRecoveryCodes()
+		if handleError(w, err) {
+			return
+		}
+		if err = rh.db.UserStore().SaveUser(&rh.owner); handleError(w, err) {
+			return
+		}
+		sendResponse(w, r, rest.DecorateRecoveryCodes(rh.owner, codes, rh.baseURI), http.StatusOK)
+	default:
+		w.Header().Add("Allow", http.MethodPost)
+		statusResponse(w, http.StatusMethodNotAllowed)
+	}
+}
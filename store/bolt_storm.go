@@ -2,12 +2,15 @@ package store
 
 import (
 	"errors"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/asdine/storm"
 	"github.com/asdine/storm/q"
 	uuid "github.com/satori/go.uuid"
 
+	"github.com/aprice/freenote/audit"
 	"github.com/aprice/freenote/config"
 	"github.com/aprice/freenote/notes"
 	"github.com/aprice/freenote/page"
@@ -30,8 +33,17 @@ type StormStore struct {
 
 // NoteStore returns the NoteStore for this session.
 func (s *StormStore) NoteStore() NoteStore {
-	store := &StormNoteStore{s.db.From("notes")}
+	store := &StormNoteStore{s.db.From("notes"), s.db.From("tasks")}
 	store.db.Init(&notes.Note{})
+	store.tasks.Init(&notes.TaskItem{})
+	return store
+}
+
+// TaskStore returns the TaskStore for this session.
+func (s *StormStore) TaskStore() TaskStore {
+	store := &StormTaskStore{s.db.From("tasks"), s.db.From("notes")}
+	store.db.Init(&notes.TaskItem{})
+	store.notes.Init(&notes.Note{})
 	return store
 }
 
@@ -42,6 +54,20 @@ func (s *StormStore) UserStore() UserStore {
 	return store
 }
 
+// GroupStore returns the GroupStore for this session.
+func (s *StormStore) GroupStore() GroupStore {
+	store := &StormGroupStore{s.db.From("groups")}
+	store.db.Init(&users.Group{})
+	return store
+}
+
+// AuditStore returns the AuditStore for this session.
+func (s *StormStore) AuditStore() AuditStore {
+	store := &StormAuditStore{s.db.From("audit")}
+	store.db.Init(&audit.Entry{})
+	return store
+}
+
 // Close this session.
 func (s *StormStore) Close() error {
 	return s.db.Close()
@@ -49,7 +75,8 @@ func (s *StormStore) Close() error {
 
 // StormNoteStore handles the Storm/Bolt backed Note store.
 type StormNoteStore struct {
-	db storm.Node
+	db    storm.Node
+	tasks storm.Node
 }
 
 // NoteByID retrieves a single note by its unique ID.
@@ -74,11 +101,52 @@ func (tm *tagMatcher) MatchField(v interface{}) (bool, error) {
 	return false, nil
 }
 
+// searchMatcher matches notes against a search query.
+type searchMatcher notes.Query
+
+func (sm *searchMatcher) Match(v interface{}) (bool, error) {
+	switch note := v.(type) {
+	case notes.Note:
+		return notes.Query(*sm).Matches(note), nil
+	case *notes.Note:
+		return notes.Query(*sm).Matches(*note), nil
+	}
+	return false, errors.New("not a notes.Note")
+}
+
+// reminderMatcher matches reminder lists with a pending reminder due before a
+// time, or at any time if it's zero.
+type reminderMatcher time.Time
+
+func (rm *reminderMatcher) MatchField(v interface{}) (bool, error) {
+	reminders, ok := v.([]notes.Reminder)
+	if !ok {
+		return false, errors.New("not a []notes.Reminder")
+	}
+	before := time.Time(*rm)
+	for _, r := range reminders {
+		if !r.Done && (before.IsZero() || r.Time.Before(before)) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// propertyMatcher matches property maps against a property filter.
+type propertyMatcher notes.PropertyFilter
+
+func (pm *propertyMatcher) MatchField(v interface{}) (bool, error) {
+	props, ok := v.(map[string]notes.Property)
+	if !ok {
+		return false, errors.New("not a map[string]notes.Property")
+	}
+	return notes.PropertyFilter(*pm).Matches(props), nil
+}
+
 // QueryNotes queries the collection of notes with the parameters given in query,
 // and returns the requested page of notes, the total notes matching the query
 // (ignoring pagination), and any error encountered.
 func (s *StormNoteStore) QueryNotes(query NoteQuery) ([]notes.Note, int, error) {
-	var result []notes.Note
 	var matchers []q.Matcher
 	if query.Owner != uuid.Nil {
 		matchers = append(matchers, q.Eq("Owner", query.Owner))
@@ -93,37 +161,274 @@ func (s *StormNoteStore) QueryNotes(query NoteQuery) ([]notes.Note, int, error)
 	if query.ModifiedSince.After(epoch) {
 		matchers = append(matchers, q.Gt("Modified", query.ModifiedSince))
 	}
-	if query.Text != "" {
-		//TODO: Full text search
+	if !query.Search.IsZero() {
+		sm := searchMatcher(query.Search)
+		matchers = append(matchers, &sm)
 	}
-	qry := s.db.Select(matchers...)
-
-	total, err := qry.Count(new(notes.Note))
+	if query.Reminders || query.ReminderBefore.After(epoch) {
+		rm := reminderMatcher(query.ReminderBefore)
+		matchers = append(matchers, q.NewFieldMatcher("Reminders", &rm))
+	}
+	for _, f := range query.Properties {
+		pm := propertyMatcher(f)
+		matchers = append(matchers, q.NewFieldMatcher("Properties", &pm))
+	}
+	if query.Pinned {
+		matchers = append(matchers, q.Eq("Pinned", true))
+	}
+	if query.Favorite {
+		matchers = append(matchers, q.Eq("Favorite", true))
+	}
+	// Pinned notes come first, so page through them and then the rest.
+	pinnedQry := s.db.Select(append(matchers[:len(matchers):len(matchers)], q.Eq("Pinned", true))...)
+	otherQry := s.db.Select(append(matchers[:len(matchers):len(matchers)], q.Eq("Pinned", false))...)
+	pinned, err := pinnedQry.Count(new(notes.Note))
 	if err != nil {
 		return nil, -1, err
-	} else if total == 0 {
+	}
+	others, err := otherQry.Count(new(notes.Note))
+	if err != nil {
+		return nil, -1, err
+	}
+	total := pinned + others
+	if total == 0 {
 		return make([]notes.Note, 0), 0, nil
 	}
-	err = applyPage(qry, query.Page).Find(&result)
-	return result, total, stormError(err)
+	if name, ok := propertySort(query.Page); ok {
+		result, err := sortByProperty(pinnedQry, otherQry, name, query.Page)
+		return result, total, err
+	}
+	var result []notes.Note
+	pg := query.Page
+	if pg.Start < pinned {
+		p := pg
+		if p.Length > pinned-p.Start {
+			p.Length = pinned - p.Start
+		}
+		if err = applyPage(pinnedQry, p).Find(&result); err != nil {
+			return nil, total, stormError(err)
+		}
+	}
+	if n := pg.Length - len(result); n > 0 && pg.Start+len(result) < total {
+		p := pg
+		p.Start, p.Length = pg.Start+len(result)-pinned, n
+		var rest []notes.Note
+		if err = applyPage(otherQry, p).Find(&rest); err != nil {
+			return nil, total, stormError(err)
+		}
+		result = append(result, rest...)
+	}
+	if len(result) == 0 {
+		return nil, total, ErrNotFound
+	}
+	return result, total, nil
 }
 
-// SaveNote saves a new or updated note to the data store.
+// sortByProperty returns a page of pinned notes and then other notes, each
+// sorted by a property. Storm can't sort by map values, so notes are sorted
+// in memory.
+func sortByProperty(pinnedQry, otherQry storm.Query, name string, pg page.Page) ([]notes.Note, error) {
+	var result []notes.Note
+	for _, qry := range []storm.Query{pinnedQry, otherQry} {
+		var list []notes.Note
+		if err := qry.Find(&list); err != nil && err != storm.ErrNotFound {
+			return nil, err
+		}
+		sort.SliceStable(list, func(i, j int) bool {
+			c := compareProperties(list[i].Properties, list[j].Properties, name)
+			if pg.SortDescending {
+				return c > 0
+			}
+			return c < 0
+		})
+		result = append(result, list...)
+	}
+	if pg.Start >= len(result) {
+		return nil, ErrNotFound
+	}
+	result = result[pg.Start:]
+	if pg.Length < len(result) {
+		result = result[:pg.Length]
+	}
+	return result, nil
+}
+
+// propertyTypeOrder orders properties of different types.
+var propertyTypeOrder = map[notes.PropertyType]int{
+	notes.PropertyString: 1,
+	notes.PropertyNumber: 2,
+	notes.PropertyDate:   3,
+	notes.PropertyBool:   4,
+}
+
+// compareProperties compares a property of two notes. Notes without the
+// property come first, and properties of different types are grouped by type.
+func compareProperties(a, b map[string]notes.Property, name string) int {
+	pa, oka := a[name]
+	pb, okb := b[name]
+	switch {
+	case !oka && !okb:
+		return 0
+	case !oka:
+		return -1
+	case !okb:
+		return 1
+	}
+	if c, ok := pa.Compare(pb); ok {
+		return c
+	}
+	return propertyTypeOrder[pa.Type] - propertyTypeOrder[pb.Type]
+}
+
+// SaveNote saves a new or updated note to the data store, incrementing its
+// version.
 func (s *StormNoteStore) SaveNote(note *notes.Note) error {
 	h := note.HTMLBody
 	note.HTMLBody = ""
+	note.Version++
 	err := s.db.Save(note)
 	if err == storm.ErrAlreadyExists {
 		err = s.db.Update(note)
 	}
 	note.HTMLBody = h
-	return err
+	if err != nil {
+		note.Version--
+		return err
+	}
+	return s.indexTasks(*note)
+}
+
+// UpdateNote saves an existing note, if it hasn't been saved since it was read
+// at note.Version. The check and save are in one transaction.
+func (s *StormNoteStore) UpdateNote(note *notes.Note) error {
+	tx, err := s.db.Begin(true)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	var current notes.Note
+	err = tx.One("ID", note.ID, &current)
+	if err == storm.ErrNotFound || (err == nil && current.Version != note.Version) {
+		return ErrConflict
+	} else if err != nil {
+		return err
+	}
+	h := note.HTMLBody
+	note.HTMLBody = ""
+	note.Version++
+	err = tx.Save(note)
+	if err == storm.ErrAlreadyExists {
+		err = tx.Update(note)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	note.HTMLBody = h
+	if err != nil {
+		note.Version--
+		return err
+	}
+	return s.indexTasks(*note)
 }
 
 // DeleteNote deletes the note with the given ID from the data store.
 func (s *StormNoteStore) DeleteNote(id uuid.UUID) error {
 	err := s.db.Select(q.Eq("ID", id)).Delete(new(notes.Note))
-	return stormError(err)
+	if err != nil {
+		return stormError(err)
+	}
+	return s.unindexTasks(id)
+}
+
+// indexTasks replaces the indexed tasks of a note with its current tasks.
+func (s *StormNoteStore) indexTasks(note notes.Note) error {
+	if err := s.unindexTasks(note.ID); err != nil {
+		return err
+	}
+	for _, item := range notes.TaskItems(note) {
+		if err := s.tasks.Save(&item); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *StormNoteStore) unindexTasks(id uuid.UUID) error {
+	err := s.tasks.Select(q.Eq("Note", id)).Delete(new(notes.TaskItem))
+	if err == storm.ErrNotFound {
+		return nil
+	}
+	return err
+}
+
+// StormTaskStore handles the Storm/Bolt backed task index.
+type StormTaskStore struct {
+	db    storm.Node
+	notes storm.Node
+}
+
+// tasksIndexedBucket records the owners whose notes' tasks have all been
+// indexed.
+const tasksIndexedBucket = "indexed"
+
+// ensureIndexed indexes the tasks of all of an owner's notes the first time
+// they're queried, so notes saved before the task index existed are included.
+func (s *StormTaskStore) ensureIndexed(owner uuid.UUID) error {
+	var indexed bool
+	err := s.db.Get(tasksIndexedBucket, owner.String(), &indexed)
+	if err == nil && indexed {
+		return nil
+	} else if err != nil && err != storm.ErrNotFound {
+		return err
+	}
+	var list []notes.Note
+	if err = s.notes.Find("Owner", owner, &list); err != nil && err != storm.ErrNotFound {
+		return err
+	}
+	ns := &StormNoteStore{s.notes, s.db}
+	for _, note := range list {
+		if err = ns.indexTasks(note); err != nil {
+			return err
+		}
+	}
+	return s.db.Set(tasksIndexedBucket, owner.String(), true)
+}
+
+// QueryTasks queries the task index with the parameters given in query, and
+// returns the requested page of tasks, the total tasks matching the query
+// (ignoring pagination), and any error encountered.
+func (s *StormTaskStore) QueryTasks(query TaskQuery) ([]notes.TaskItem, int, error) {
+	var result []notes.TaskItem
+	var matchers []q.Matcher
+	if query.Owner != uuid.Nil {
+		if err := s.ensureIndexed(query.Owner); err != nil {
+			return nil, -1, err
+		}
+		matchers = append(matchers, q.Eq("Owner", query.Owner))
+	}
+	if query.State != "" {
+		matchers = append(matchers, q.Eq("Checked", query.State == TaskDone))
+	}
+	if query.DueBefore.After(epoch) {
+		matchers = append(matchers, q.Gt("Due", ""), q.Lt("Due", query.DueBefore.Format(notes.DueFormat)))
+	}
+	if query.Tag != "" {
+		tm := tagMatcher(query.Tag)
+		matchers = append(matchers, q.NewFieldMatcher("Tags", &tm))
+	}
+	if query.Folder != "" {
+		matchers = append(matchers, q.Eq("Folder", query.Folder))
+	}
+	qry := s.db.Select(matchers...)
+
+	total, err := qry.Count(new(notes.TaskItem))
+	if err != nil {
+		return nil, -1, err
+	} else if total == 0 {
+		return make([]notes.TaskItem, 0), 0, nil
+	}
+	err = applyPage(qry, query.Page).Find(&result)
+	return result, total, stormError(err)
 }
 
 // StormUserStore handles the Storm/Bolt backed Note store.
@@ -145,6 +450,25 @@ func (s *StormUserStore) UserByName(username string) (users.User, error) {
 	return result, stormError(err)
 }
 
+// UserByExternalID retrieves a single user by the identity linked from an
+// external identity provider.
+func (s *StormUserStore) UserByExternalID(externalID string) (users.User, error) {
+	var result users.User
+	err := s.db.One("ExternalID", externalID, &result)
+	return result, stormError(err)
+}
+
+// UsersByEmail retrieves all the users with an email address. Addresses
+// aren't unique, as users set their own.
+func (s *StormUserStore) UsersByEmail(email string) ([]users.User, error) {
+	var result []users.User
+	err := s.db.Find("Email", email, &result)
+	if err == storm.ErrNotFound {
+		return make([]users.User, 0), nil
+	}
+	return result, stormError(err)
+}
+
 // Users retrieves a page of users. It returns the page of users and the total
 // number of users.
 func (s *StormUserStore) Users(page page.Page) ([]users.User, int, error) {
@@ -173,6 +497,128 @@ func (s *StormUserStore) DeleteUser(id uuid.UUID) error {
 	return stormError(err)
 }
 
+// StormGroupStore handles the Storm/Bolt backed Group store.
+type StormGroupStore struct {
+	db storm.Node
+}
+
+// memberMatcher matches member lists including a user.
+type memberMatcher uuid.UUID
+
+func (mm *memberMatcher) MatchField(v interface{}) (bool, error) {
+	members, ok := v.([]users.Member)
+	if !ok {
+		return false, errors.New("not a []users.Member")
+	}
+	for _, m := range members {
+		if m.User == uuid.UUID(*mm) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// GroupByID retrieves a single group by its unique ID.
+func (s *StormGroupStore) GroupByID(id uuid.UUID) (users.Group, error) {
+	var result users.Group
+	err := s.db.One("ID", id, &result)
+	return result, stormError(err)
+}
+
+// GroupsByMember retrieves all the groups a user is a member of, in order by
+// name.
+func (s *StormGroupStore) GroupsByMember(userID uuid.UUID) ([]users.Group, error) {
+	var result []users.Group
+	mm := memberMatcher(userID)
+	err := s.db.Select(q.NewFieldMatcher("Members", &mm)).OrderBy("Name").Find(&result)
+	if err == storm.ErrNotFound {
+		return make([]users.Group, 0), nil
+	}
+	return result, stormError(err)
+}
+
+// Groups retrieves a page of groups. It returns the page of groups and the
+// total number of groups.
+func (s *StormGroupStore) Groups(page page.Page) ([]users.Group, int, error) {
+	var result []users.Group
+	qry := s.db.Select()
+	total, err := qry.Count(new(users.Group))
+	if err != nil {
+		return nil, -1, err
+	} else if total == 0 {
+		return make([]users.Group, 0), 0, nil
+	}
+	err = applyPage(qry, page).Find(&result)
+	return result, total, stormError(err)
+}
+
+// SaveGroup saves a new or updated group to the data store.
+func (s *StormGroupStore) SaveGroup(group *users.Group) error {
+	err := s.db.Save(group)
+	if err == storm.ErrAlreadyExists {
+		err = s.db.Update(group)
+	}
+	return err
+}
+
+// DeleteGroup deletes a group with the given ID from the data store.
+func (s *StormGroupStore) DeleteGroup(id uuid.UUID) error {
+	err := s.db.Select(q.Eq("ID", id)).Delete(new(users.Group))
+	return stormError(err)
+}
+
+// StormAuditStore handles the Storm/Bolt backed audit log.
+type StormAuditStore struct {
+	db storm.Node
+}
+
+// AddEntry appends a new entry to the audit log.
+func (s *StormAuditStore) AddEntry(entry *audit.Entry) error {
+	if entry.ID == uuid.Nil {
+		entry.ID = uuid.NewV4()
+	}
+	return s.db.Save(entry)
+}
+
+// QueryEntries queries the audit log with the parameters given in query, and
+// returns the requested page of entries, the total entries matching the query
+// (ignoring pagination), and any error encountered.
+func (s *StormAuditStore) QueryEntries(query AuditQuery) ([]audit.Entry, int, error) {
+	var result []audit.Entry
+	var matchers []q.Matcher
+	if query.User != uuid.Nil {
+		matchers = append(matchers, q.Or(q.Eq("Actor", query.User), q.Eq("Target", query.User)))
+	}
+	if query.Actor != uuid.Nil {
+		matchers = append(matchers, q.Eq("Actor", query.Actor))
+	}
+	if query.Target != uuid.Nil {
+		matchers = append(matchers, q.Eq("Target", query.Target))
+	}
+	if query.Action != "" {
+		matchers = append(matchers, q.Eq("Action", query.Action))
+	}
+	if query.Outcome != "" {
+		matchers = append(matchers, q.Eq("Outcome", query.Outcome))
+	}
+	if query.Since.After(epoch) {
+		matchers = append(matchers, q.Gte("Time", query.Since))
+	}
+	if query.Until.After(epoch) {
+		matchers = append(matchers, q.Lt("Time", query.Until))
+	}
+	qry := s.db.Select(matchers...)
+
+	total, err := qry.Count(new(audit.Entry))
+	if err != nil {
+		return nil, -1, err
+	} else if total == 0 {
+		return make([]audit.Entry, 0), 0, nil
+	}
+	err = applyPage(qry, query.Page).Find(&result)
+	return result, total, stormError(err)
+}
+
 func stormError(err error) error {
 	if err == nil {
 		return nil
@@ -2,11 +2,13 @@ package store
 
 import (
 	"io"
+	"regexp"
 
 	uuid "github.com/satori/go.uuid"
 	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
 
+	"github.com/aprice/freenote/audit"
 	"github.com/aprice/freenote/config"
 	"github.com/aprice/freenote/notes"
 	"github.com/aprice/freenote/page"
@@ -54,7 +56,12 @@ type MongoStore struct {
 
 // NoteStore returns the NoteStore for this session.
 func (s *MongoStore) NoteStore() NoteStore {
-	return &MongoNoteStore{s.db.C("Notes")}
+	return &MongoNoteStore{s.db.C("Notes"), s.db.C("Tasks")}
+}
+
+// TaskStore returns the TaskStore for this session.
+func (s *MongoStore) TaskStore() TaskStore {
+	return &MongoTaskStore{s.db.C("Tasks"), s.db.C("Notes"), s.db.C("TasksIndexed")}
 }
 
 // UserStore returns the UserStore for this session.
@@ -62,6 +69,16 @@ func (s *MongoStore) UserStore() UserStore {
 	return &MongoUserStore{s.db.C("Users")}
 }
 
+// GroupStore returns the GroupStore for this session.
+func (s *MongoStore) GroupStore() GroupStore {
+	return &MongoGroupStore{s.db.C("Groups")}
+}
+
+// AuditStore returns the AuditStore for this session.
+func (s *MongoStore) AuditStore() AuditStore {
+	return &MongoAuditStore{s.db.C("Audit")}
+}
+
 // Close this session.
 func (s *MongoStore) Close() error {
 	s.db.Session.Close()
@@ -70,7 +87,8 @@ func (s *MongoStore) Close() error {
 
 // MongoNoteStore handles the MongoDB-backed Note store.
 type MongoNoteStore struct {
-	c *mgo.Collection
+	c     *mgo.Collection
+	tasks *mgo.Collection
 }
 
 // NoteByID retrieves a single note by its unique ID.
@@ -98,22 +116,133 @@ func (s *MongoNoteStore) QueryNotes(query NoteQuery) ([]notes.Note, int, error)
 	if query.ModifiedSince.After(epoch) {
 		qry["modified"] = bson.M{"$gt": query.ModifiedSince}
 	}
-	if query.Text != "" {
-		//TODO: Full text search
+	if query.Reminders || query.ReminderBefore.After(epoch) {
+		pending := bson.M{"done": bson.M{"$ne": true}}
+		if query.ReminderBefore.After(epoch) {
+			pending["time"] = bson.M{"$lt": query.ReminderBefore}
+		}
+		qry["reminders"] = bson.M{"$elemMatch": pending}
+	}
+	var conds []bson.M
+	if len(query.Properties) > 0 {
+		conds = append(conds, propertyConditions(query.Properties)...)
+	}
+	if !query.Search.IsZero() {
+		conds = append(conds, searchConditions(query.Search)...)
+	}
+	if len(conds) > 0 {
+		qry["$and"] = conds
+	}
+	if query.Pinned {
+		qry["pinned"] = true
+	}
+	if query.Favorite {
+		qry["favorite"] = true
 	}
 	q := s.c.Find(qry)
 	total, err := q.Count()
 	if err != nil {
 		return nil, -1, err
 	}
-	//TODO: Allow controlled sort field & direction
-	err = q.Sort("-modified").Skip(query.Page.Start).Limit(query.Page.Length).All(&result)
+	sort := query.Page.SortBy
+	if sort == "" {
+		sort = "modified"
+	} else if name, ok := propertySort(query.Page); ok {
+		sort = "properties." + name + ".value"
+	}
+	if query.Page.SortDescending {
+		sort = "-" + sort
+	}
+	// Pinned notes come first.
+	err = q.Sort("-pinned", sort).Skip(query.Page.Start).Limit(query.Page.Length).All(&result)
 	if err == nil && len(result) == 0 {
 		err = ErrNotFound
 	}
 	return result, total, mongoError(err)
 }
 
+var mongoOps = map[string]string{
+	notes.OpLess:         "$lt",
+	notes.OpLessEqual:    "$lte",
+	notes.OpGreater:      "$gt",
+	notes.OpGreaterEqual: "$gte",
+}
+
+// propertyConditions returns the query conditions for property filters. A
+// filter's value is compared to properties of each type it can be parsed as.
+func propertyConditions(filters []notes.PropertyFilter) []bson.M {
+	conds := make([]bson.M, 0, len(filters))
+	for _, f := range filters {
+		field := "properties." + f.Name
+		var alts []bson.M
+		for _, prop := range f.Candidates() {
+			var value interface{} = prop.Value
+			if op, ok := mongoOps[f.Op]; ok {
+				value = bson.M{op: prop.Value}
+			}
+			alts = append(alts, bson.M{field + ".type": prop.Type, field + ".value": value})
+		}
+		if f.Op == notes.OpNotEqual {
+			conds = append(conds, bson.M{"$nor": alts})
+		} else {
+			conds = append(conds, bson.M{"$or": alts})
+		}
+	}
+	return conds
+}
+
+// searchConditions returns the query conditions for a search query: one for
+// each of its clauses.
+func searchConditions(search notes.Query) []bson.M {
+	conds := make([]bson.M, 0, len(search.Clauses))
+	for _, clause := range search.Clauses {
+		alts := make([]bson.M, 0, len(clause))
+		for _, term := range clause {
+			cond := termCondition(term)
+			if term.Negate {
+				cond = bson.M{"$nor": []bson.M{cond}}
+			}
+			alts = append(alts, cond)
+		}
+		if len(alts) == 1 {
+			conds = append(conds, alts[0])
+		} else {
+			conds = append(conds, bson.M{"$or": alts})
+		}
+	}
+	return conds
+}
+
+// termCondition returns the query condition for a search term, ignoring
+// negation.
+func termCondition(term notes.SearchTerm) bson.M {
+	switch term.Field {
+	case notes.FieldText:
+		re := bson.RegEx{Pattern: regexp.QuoteMeta(term.Value), Options: "i"}
+		return bson.M{"$or": []bson.M{{"title": re}, {"body": re}}}
+	case notes.FieldTitle:
+		return bson.M{"title": bson.RegEx{Pattern: regexp.QuoteMeta(term.Value), Options: "i"}}
+	case notes.FieldTag:
+		return bson.M{"tags": term.Value}
+	case notes.FieldFolder:
+		if term.Value == "" {
+			return bson.M{"folder": ""}
+		}
+		sub := bson.RegEx{Pattern: "^" + regexp.QuoteMeta(term.Value+"/")}
+		return bson.M{"$or": []bson.M{{"folder": term.Value}, {"folder": sub}}}
+	case notes.FieldCreated, notes.FieldModified:
+		rng := bson.M{}
+		if !term.From.IsZero() {
+			rng["$gte"] = term.From
+		}
+		if !term.Until.IsZero() {
+			rng["$lt"] = term.Until
+		}
+		return bson.M{string(term.Field): rng}
+	}
+	return bson.M{}
+}
+
 // FoldersByFolder returns the list of folders with the given folder prefix.
 func (s *MongoNoteStore) FoldersByFolder(userID uuid.UUID, folder string) ([]string, error) {
 	result := []string{}
@@ -134,21 +263,138 @@ func (s *MongoNoteStore) Tags(userID uuid.UUID) ([]string, error) {
 	return result, mongoError(err)
 }
 
-// SaveNote saves a new or updated note to the data store.
+// SaveNote saves a new or updated note to the data store, incrementing its
+// version.
 func (s *MongoNoteStore) SaveNote(note *notes.Note) error {
 	if note.ID == uuid.Nil {
 		note.ID = uuid.NewV4()
 	}
+	note.Version++
 	_, err := s.c.UpsertId(note.ID, note)
-	return mongoError(err)
+	if err != nil {
+		note.Version--
+		return mongoError(err)
+	}
+	return s.indexTasks(*note)
+}
+
+// UpdateNote saves an existing note, if it hasn't been saved since it was read
+// at note.Version. Notes saved before they had versions are at version 0.
+func (s *MongoNoteStore) UpdateNote(note *notes.Note) error {
+	var version interface{} = note.Version
+	if note.Version == 0 {
+		version = bson.M{"$in": []interface{}{0, nil}}
+	}
+	note.Version++
+	err := s.c.Update(bson.M{"_id": note.ID, "version": version}, note)
+	if err == mgo.ErrNotFound {
+		err = ErrConflict
+	}
+	if err != nil {
+		note.Version--
+		return mongoError(err)
+	}
+	return s.indexTasks(*note)
 }
 
 // DeleteNote deletes the note with the given ID from the data store.
 func (s *MongoNoteStore) DeleteNote(id uuid.UUID) error {
 	err := s.c.Remove(bson.M{"_id": id})
+	if err != nil {
+		return mongoError(err)
+	}
+	_, err = s.tasks.RemoveAll(bson.M{"note": id})
+	return mongoError(err)
+}
+
+// indexTasks replaces the indexed tasks of a note with its current tasks.
+func (s *MongoNoteStore) indexTasks(note notes.Note) error {
+	if _, err := s.tasks.RemoveAll(bson.M{"note": note.ID}); err != nil {
+		return mongoError(err)
+	}
+	items := notes.TaskItems(note)
+	if len(items) == 0 {
+		return nil
+	}
+	docs := make([]interface{}, len(items))
+	for i := range items {
+		docs[i] = items[i]
+	}
+	return mongoError(s.tasks.Insert(docs...))
+}
+
+// MongoTaskStore handles the MongoDB-backed task index.
+type MongoTaskStore struct {
+	c       *mgo.Collection
+	notes   *mgo.Collection
+	indexed *mgo.Collection
+}
+
+// ensureIndexed indexes the tasks of all of an owner's notes the first time
+// they're queried, so notes saved before the task index existed are included.
+func (s *MongoTaskStore) ensureIndexed(owner uuid.UUID) error {
+	n, err := s.indexed.FindId(owner).Count()
+	if err != nil {
+		return mongoError(err)
+	} else if n > 0 {
+		return nil
+	}
+	ns := &MongoNoteStore{s.notes, s.c}
+	iter := s.notes.Find(bson.M{"owner": owner}).Iter()
+	for {
+		var note notes.Note
+		if !iter.Next(&note) {
+			break
+		}
+		if err = ns.indexTasks(note); err != nil {
+			iter.Close()
+			return err
+		}
+	}
+	if err = iter.Close(); err != nil {
+		return mongoError(err)
+	}
+	_, err = s.indexed.UpsertId(owner, bson.M{"_id": owner})
 	return mongoError(err)
 }
 
+// QueryTasks queries the task index with the parameters given in query, and
+// returns the requested page of tasks, the total tasks matching the query
+// (ignoring pagination), and any error encountered.
+func (s *MongoTaskStore) QueryTasks(query TaskQuery) ([]notes.TaskItem, int, error) {
+	result := []notes.TaskItem{}
+	qry := bson.M{}
+	if query.Owner != uuid.Nil {
+		if err := s.ensureIndexed(query.Owner); err != nil {
+			return nil, -1, err
+		}
+		qry["owner"] = query.Owner
+	}
+	if query.State != "" {
+		qry["checked"] = query.State == TaskDone
+	}
+	if query.DueBefore.After(epoch) {
+		qry["due"] = bson.M{"$gt": "", "$lt": query.DueBefore.Format(notes.DueFormat)}
+	}
+	if query.Tag != "" {
+		qry["tags"] = query.Tag
+	}
+	if query.Folder != "" {
+		qry["folder"] = query.Folder
+	}
+	q := s.c.Find(qry)
+	total, err := q.Count()
+	if err != nil {
+		return nil, -1, err
+	}
+	sort := query.Page.SortBy
+	if query.Page.SortDescending {
+		sort = "-" + sort
+	}
+	err = q.Sort(sort).Skip(query.Page.Start).Limit(query.Page.Length).All(&result)
+	return result, total, mongoError(err)
+}
+
 // MongoUserStore handles the MongoDB-backed Note store.
 type MongoUserStore struct {
 	c *mgo.Collection
@@ -168,6 +414,22 @@ func (s *MongoUserStore) UserByName(username string) (users.User, error) {
 	return result, mongoError(err)
 }
 
+// UserByExternalID retrieves a single user by the identity linked from an
+// external identity provider.
+func (s *MongoUserStore) UserByExternalID(externalID string) (users.User, error) {
+	var result users.User
+	err := s.c.Find(bson.M{"externalid": externalID}).One(&result)
+	return result, mongoError(err)
+}
+
+// UsersByEmail retrieves all the users with an email address. Addresses
+// aren't unique, as users set their own.
+func (s *MongoUserStore) UsersByEmail(email string) ([]users.User, error) {
+	result := []users.User{}
+	err := s.c.Find(bson.M{"email": email}).All(&result)
+	return result, mongoError(err)
+}
+
 // Users retrieves a page of users. It returns the page of users and the total
 // number of users.
 func (s *MongoUserStore) Users(page page.Page) ([]users.User, int, error) {
@@ -200,6 +462,111 @@ func (s *MongoUserStore) DeleteUser(id uuid.UUID) error {
 	return mongoError(err)
 }
 
+// MongoGroupStore handles the MongoDB-backed Group store.
+type MongoGroupStore struct {
+	c *mgo.Collection
+}
+
+// GroupByID retrieves a single group by its unique ID.
+func (s *MongoGroupStore) GroupByID(id uuid.UUID) (users.Group, error) {
+	var result users.Group
+	err := s.c.FindId(id).One(&result)
+	return result, mongoError(err)
+}
+
+// GroupsByMember retrieves all the groups a user is a member of, in order by
+// name.
+func (s *MongoGroupStore) GroupsByMember(userID uuid.UUID) ([]users.Group, error) {
+	result := []users.Group{}
+	err := s.c.Find(bson.M{"members.user": userID}).Sort("name").All(&result)
+	return result, mongoError(err)
+}
+
+// Groups retrieves a page of groups. It returns the page of groups and the
+// total number of groups.
+func (s *MongoGroupStore) Groups(page page.Page) ([]users.Group, int, error) {
+	result := []users.Group{}
+	q := s.c.Find(nil)
+	total, err := q.Count()
+	if err != nil {
+		return nil, -1, err
+	}
+	err = q.Sort("name").Skip(page.Start).Limit(page.Length).All(&result)
+	return result, total, mongoError(err)
+}
+
+// SaveGroup saves a new or updated group to the data store.
+func (s *MongoGroupStore) SaveGroup(group *users.Group) error {
+	if group.ID == uuid.Nil {
+		group.ID = uuid.NewV4()
+	}
+	_, err := s.c.UpsertId(group.ID, group)
+	return mongoError(err)
+}
+
+// DeleteGroup deletes a group with the given ID from the data store.
+func (s *MongoGroupStore) DeleteGroup(id uuid.UUID) error {
+	err := s.c.Remove(bson.M{"_id": id})
+	return mongoError(err)
+}
+
+// MongoAuditStore handles the MongoDB-backed audit log.
+type MongoAuditStore struct {
+	c *mgo.Collection
+}
+
+// AddEntry appends a new entry to the audit log.
+func (s *MongoAuditStore) AddEntry(entry *audit.Entry) error {
+	if entry.ID == uuid.Nil {
+		entry.ID = uuid.NewV4()
+	}
+	return mongoError(s.c.Insert(entry))
+}
+
+// QueryEntries queries the audit log with the parameters given in query, and
+// returns the requested page of entries, the total entries matching the query
+// (ignoring pagination), and any error encountered.
+func (s *MongoAuditStore) QueryEntries(query AuditQuery) ([]audit.Entry, int, error) {
+	result := []audit.Entry{}
+	qry := bson.M{}
+	if query.User != uuid.Nil {
+		qry["$or"] = []bson.M{{"actor": query.User}, {"target": query.User}}
+	}
+	if query.Actor != uuid.Nil {
+		qry["actor"] = query.Actor
+	}
+	if query.Target != uuid.Nil {
+		qry["target"] = query.Target
+	}
+	if query.Action != "" {
+		qry["action"] = query.Action
+	}
+	if query.Outcome != "" {
+		qry["outcome"] = query.Outcome
+	}
+	timeRange := bson.M{}
+	if query.Since.After(epoch) {
+		timeRange["$gte"] = query.Since
+	}
+	if query.Until.After(epoch) {
+		timeRange["$lt"] = query.Until
+	}
+	if len(timeRange) > 0 {
+		qry["time"] = timeRange
+	}
+	q := s.c.Find(qry)
+	total, err := q.Count()
+	if err != nil {
+		return nil, -1, err
+	}
+	sort := "time"
+	if query.Page.SortDescending {
+		sort = "-time"
+	}
+	err = q.Sort(sort).Skip(query.Page.Start).Limit(query.Page.Length).All(&result)
+	return result, total, mongoError(err)
+}
+
 func mongoError(err error) error {
 	if err == nil {
 		return nil
@@ -2,10 +2,12 @@ package store
 
 import (
 	"errors"
+	"strings"
 	"time"
 
 	uuid "github.com/satori/go.uuid"
 
+	"github.com/aprice/freenote/audit"
 	"github.com/aprice/freenote/config"
 	"github.com/aprice/freenote/notes"
 	"github.com/aprice/freenote/page"
@@ -16,44 +18,125 @@ import (
 // results. Driver-specific not found errors should never be returned.
 var ErrNotFound = errors.New("requested resource not found")
 
+// ErrConflict should be returned when a conditional save finds the record has
+// changed since it was read.
+var ErrConflict = errors.New("resource changed since it was read")
+
 // Session implementations handle access to the backing store(s) for
-// notes and users for a single session. They may optionally also be an
-// io.Closer, and if they are, they can expect to be closed after each
-// request.
+// notes, tasks, users, groups, and the audit log for a single session. They may
+// optionally also be an io.Closer, and if they are, they can expect to be closed
+// after each request.
 type Session interface {
 	NoteStore() NoteStore
+	TaskStore() TaskStore
 	UserStore() UserStore
+	GroupStore() GroupStore
+	AuditStore() AuditStore
 }
 
 // NoteStore implementations handle access to the backing store for notes.
+// Saving or deleting a note also updates the index of its tasks. UpdateNote
+// saves an existing note only if it's still at the version it was read at,
+// the note's Version, and returns ErrConflict otherwise.
 type NoteStore interface {
 	NoteByID(id uuid.UUID) (notes.Note, error)
 	QueryNotes(query NoteQuery) ([]notes.Note, int, error)
 	//FoldersByFolder(userID uuid.UUID, folder string) ([]string, error)
 	//Tags(userID uuid.UUID) ([]string, error)
 	SaveNote(note *notes.Note) error
+	UpdateNote(note *notes.Note) error
 	DeleteNote(id uuid.UUID) error
 }
 
-// NoteQuery holds parameters for a Note store query.
+// NoteQuery holds parameters for a Note store query. The Owner may be a user or
+// a group, as group-owned notes have the group's ID as their owner. Pinned notes are always
+// sorted before the rest. Notes can also be sorted by a custom property, with
+// a Page.SortBy of PropertySortPrefix and the property name.
 type NoteQuery struct {
 	Owner         uuid.UUID
 	Folder        string
 	Tag           string
-	Text          string
 	Page          page.Page
 	ModifiedSince time.Time
+	// Search matches notes against a parsed search query.
+	Search notes.Query
+	// Properties match notes by their custom properties.
+	Properties []notes.PropertyFilter
+	// Pinned and Favorite match only pinned or favourite notes.
+	Pinned   bool
+	Favorite bool
+	// Reminders matches notes with pending reminders, and ReminderBefore
+	// matches notes with a pending reminder due before it.
+	Reminders      bool
+	ReminderBefore time.Time
+}
+
+// TaskStore implementations handle access to the index of task list items in
+// notes, which is kept up to date by the NoteStore.
+type TaskStore interface {
+	QueryTasks(query TaskQuery) ([]notes.TaskItem, int, error)
+}
+
+// Task states for TaskQuery.
+const (
+	TaskOpen = "open"
+	TaskDone = "done"
+)
+
+// TaskQuery holds parameters for a task index query.
+type TaskQuery struct {
+	Owner uuid.UUID
+	// State is TaskOpen or TaskDone, or empty for both.
+	State string
+	// DueBefore matches tasks with a due date before it.
+	DueBefore time.Time
+	Tag       string
+	Folder    string
+	Page      page.Page
 }
 
 // UserStore implementations handle access to the backing store for users.
 type UserStore interface {
 	UserByID(id uuid.UUID) (users.User, error)
 	UserByName(username string) (users.User, error)
+	UserByExternalID(externalID string) (users.User, error)
+	UsersByEmail(email string) ([]users.User, error)
 	Users(page page.Page) ([]users.User, int, error)
 	SaveUser(user *users.User) error
 	DeleteUser(id uuid.UUID) error
 }
 
+// GroupStore implementations handle access to the backing store for groups.
+type GroupStore interface {
+	GroupByID(id uuid.UUID) (users.Group, error)
+	// GroupsByMember retrieves all the groups a user is a member of, in any
+	// role, in order by name.
+	GroupsByMember(userID uuid.UUID) ([]users.Group, error)
+	Groups(page page.Page) ([]users.Group, int, error)
+	SaveGroup(group *users.Group) error
+	DeleteGroup(id uuid.UUID) error
+}
+
+// AuditStore implementations handle access to the backing store for the audit
+// log. The log is append-only; there is no way to update or delete entries.
+type AuditStore interface {
+	AddEntry(entry *audit.Entry) error
+	QueryEntries(query AuditQuery) ([]audit.Entry, int, error)
+}
+
+// AuditQuery holds parameters for an audit log query.
+type AuditQuery struct {
+	// User matches entries where the user is either the actor or the target.
+	User    uuid.UUID
+	Actor   uuid.UUID
+	Target  uuid.UUID
+	Action  audit.Action
+	Outcome audit.Outcome
+	Since   time.Time
+	Until   time.Time
+	Page    page.Page
+}
+
 // NewSession returns a new database session for the given configuration,
 // including selecting the appropriate database driver.
 func NewSession(conf config.Config) (Session, error) {
@@ -66,3 +149,14 @@ func NewSession(conf config.Config) (Session, error) {
 }
 
 var epoch = time.Time{}
+
+// PropertySortPrefix prefixes the name of a property to sort notes by.
+const PropertySortPrefix = "prop."
+
+// propertySort returns the name of the property to sort by, if any.
+func propertySort(p page.Page) (string, bool) {
+	if !strings.HasPrefix(p.SortBy, PropertySortPrefix) {
+		return "", false
+	}
+	return strings.TrimPrefix(p.SortBy, PropertySortPrefix), true
+}
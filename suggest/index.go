@@ -0,0 +1,333 @@
+// Package suggest keeps an in-memory index of each user's note titles, to
+// suggest notes as a title is typed.
+package suggest
+
+import (
+	"container/list"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	uuid "github.com/satori/go.uuid"
+
+	"github.com/aprice/freenote/notes"
+	"github.com/aprice/freenote/page"
+	"github.com/aprice/freenote/store"
+)
+
+// Suggestion is a note suggested for a typed title.
+type Suggestion struct {
+	ID     uuid.UUID `json:"id" xml:"id,attr"`
+	Title  string    `json:"title"`
+	Folder string    `json:"path" xml:"folder,attr,omitempty"`
+}
+
+type entry struct {
+	Suggestion
+	title    []rune
+	modified time.Time
+}
+
+func newEntry(note notes.Note) *entry {
+	return &entry{
+		Suggestion: Suggestion{ID: note.ID, Title: note.Title, Folder: note.Folder},
+		title:      []rune(strings.ToLower(note.Title)),
+		modified:   note.Modified,
+	}
+}
+
+// userTitles are one user's titles, keyed by note ID.
+type userTitles struct {
+	owner  uuid.UUID
+	titles map[uuid.UUID]*entry
+}
+
+// loadState counts the changes to a user's notes while their titles are being
+// loaded, as titles loaded while they changed may be out of date.
+type loadState struct {
+	loaders int
+	changes int
+}
+
+// DefaultMaxUsers is how many users' titles an index keeps by default.
+const DefaultMaxUsers = 1000
+
+// Index holds the titles of users' notes. A user's titles are loaded from the
+// backing store the first time they're asked for, and kept up to date by the
+// sessions it wraps, so every note store whose changes should be reflected must
+// come from a wrapped session.
+type Index struct {
+	// MaxUsers is how many users' titles to keep. Those of the least recently
+	// used are dropped, and loaded again when next asked for.
+	MaxUsers int
+
+	mu      sync.Mutex
+	users   map[uuid.UUID]*list.Element // of *userTitles, in recent, by owner
+	recent  *list.List                  // most recently used first
+	owners  map[uuid.UUID]uuid.UUID
+	loading map[uuid.UUID]*loadState
+}
+
+// NewIndex creates an empty title index.
+func NewIndex() *Index {
+	return &Index{
+		MaxUsers: DefaultMaxUsers,
+		users:    make(map[uuid.UUID]*list.Element),
+		recent:   list.New(),
+		owners:   make(map[uuid.UUID]uuid.UUID),
+		loading:  make(map[uuid.UUID]*loadState),
+	}
+}
+
+// Suggest returns up to limit of a user's notes whose titles match the typed
+// text, best first. Titles starting with the text match best, then those with
+// a word starting with it, then those containing it, then those containing its
+// characters in order; more recently modified notes are boosted. With no text,
+// it returns the most recently modified notes.
+func (ix *Index) Suggest(db store.Session, owner uuid.UUID, typed string, limit int, now time.Time) ([]Suggestion, error) {
+	titles, err := ix.load(db, owner)
+	if err != nil {
+		return nil, err
+	}
+	type scored struct {
+		*entry
+		score float64
+	}
+	want := []rune(strings.ToLower(strings.TrimSpace(typed)))
+	var matches []scored
+	ix.mu.Lock()
+	for _, e := range titles {
+		if m := match(e.title, want); m > 0 {
+			matches = append(matches, scored{e, m + recency(e.modified, now)})
+		}
+	}
+	ix.mu.Unlock()
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].score != matches[j].score {
+			return matches[i].score > matches[j].score
+		}
+		return matches[i].Title < matches[j].Title
+	})
+	if len(matches) > limit {
+		matches = matches[:limit]
+	}
+	list := make([]Suggestion, len(matches))
+	for i, m := range matches {
+		list[i] = m.Suggestion
+	}
+	return list, nil
+}
+
+// load returns a user's titles, loading them if they haven't been. The index
+// isn't locked while loading; if the user's notes change in the meantime, the
+// loaded titles are returned but not kept, as they may be out of date. The
+// returned titles may only be read with the index locked.
+func (ix *Index) load(db store.Session, owner uuid.UUID) (map[uuid.UUID]*entry, error) {
+	ix.mu.Lock()
+	if el, ok := ix.users[owner]; ok {
+		ix.recent.MoveToFront(el)
+		ix.mu.Unlock()
+		return el.Value.(*userTitles).titles, nil
+	}
+	st, ok := ix.loading[owner]
+	if !ok {
+		st = new(loadState)
+		ix.loading[owner] = st
+	}
+	st.loaders++
+	changes := st.changes
+	ix.mu.Unlock()
+
+	found, _, err := db.NoteStore().QueryNotes(store.NoteQuery{Owner: owner, Page: page.All("modified")})
+	if err == store.ErrNotFound {
+		err = nil
+	}
+	titles := make(map[uuid.UUID]*entry, len(found))
+	for _, note := range found {
+		titles[note.ID] = newEntry(note)
+	}
+
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	if st.loaders--; st.loaders == 0 {
+		delete(ix.loading, owner)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if el, ok := ix.users[owner]; ok {
+		// Loaded by someone else in the meantime.
+		return el.Value.(*userTitles).titles, nil
+	}
+	if st.changes == changes {
+		ix.keep(owner, titles)
+	}
+	return titles, nil
+}
+
+// keep adds a user's loaded titles to the index, dropping the least recently
+// used users' titles if there are too many.
+func (ix *Index) keep(owner uuid.UUID, titles map[uuid.UUID]*entry) {
+	ix.users[owner] = ix.recent.PushFront(&userTitles{owner, titles})
+	for id := range titles {
+		ix.owners[id] = owner
+	}
+	for ix.MaxUsers > 0 && ix.recent.Len() > ix.MaxUsers {
+		oldest := ix.recent.Remove(ix.recent.Back()).(*userTitles)
+		delete(ix.users, oldest.owner)
+		for id := range oldest.titles {
+			delete(ix.owners, id)
+		}
+	}
+}
+
+// changed records a change to a user's notes for any load of their titles in
+// progress.
+func (ix *Index) changed(owner uuid.UUID) {
+	if st, ok := ix.loading[owner]; ok {
+		st.changes++
+	}
+}
+
+// put adds or updates a note's title, if its owner's titles are loaded, and
+// drops it from its previous owner's if that's changed.
+func (ix *Index) put(note notes.Note) {
+	if prev, ok := ix.owners[note.ID]; ok && prev != note.Owner {
+		ix.remove(note.ID)
+	}
+	ix.changed(note.Owner)
+	el, ok := ix.users[note.Owner]
+	if !ok {
+		return
+	}
+	el.Value.(*userTitles).titles[note.ID] = newEntry(note)
+	ix.owners[note.ID] = note.Owner
+}
+
+// remove drops a note's title.
+func (ix *Index) remove(id uuid.UUID) {
+	owner, ok := ix.owners[id]
+	if !ok {
+		// Its owner isn't known, so any load in progress may include it.
+		for _, st := range ix.loading {
+			st.changes++
+		}
+		return
+	}
+	ix.changed(owner)
+	if el, ok := ix.users[owner]; ok {
+		delete(el.Value.(*userTitles).titles, id)
+	}
+	delete(ix.owners, id)
+}
+
+// match scores how well a lowercase title matches lowercase typed text, or
+// returns 0 if it doesn't.
+func match(title, typed []rune) float64 {
+	if len(typed) == 0 {
+		return 1
+	}
+	t, w := string(title), string(typed)
+	if strings.HasPrefix(t, w) {
+		return 4
+	}
+	if strings.Contains(t, w) {
+		for i := range title {
+			if i > 0 && !isWordRune(title[i-1]) && isWordRune(title[i]) && strings.HasPrefix(string(title[i:]), w) {
+				return 3
+			}
+		}
+		return 2
+	}
+	// Fuzzy: the typed characters in order, fewer gaps between them better.
+	gaps, j := 0, 0
+	for i := 0; i < len(title) && j < len(typed); i++ {
+		if title[i] == typed[j] {
+			j++
+		} else if j > 0 {
+			gaps++
+		}
+	}
+	if j < len(typed) {
+		return 0
+	}
+	return 1 / (1 + float64(gaps)/float64(len(typed)))
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// recency boosts recently modified notes, from 1 for now down towards 0 over
+// months.
+func recency(modified, now time.Time) float64 {
+	if modified.IsZero() {
+		return 0
+	}
+	days := now.Sub(modified).Hours() / 24
+	if days < 0 {
+		days = 0
+	}
+	return 1 / (1 + days/30)
+}
+
+// Session wraps a session so saving and deleting notes through it updates the
+// index.
+func (ix *Index) Session(db store.Session) store.Session {
+	return &session{db, ix}
+}
+
+type session struct {
+	store.Session
+	ix *Index
+}
+
+func (s *session) NoteStore() store.NoteStore {
+	return &noteStore{s.Session.NoteStore(), s.ix}
+}
+
+// Close closes the wrapped session, if it's an io.Closer.
+func (s *session) Close() error {
+	if closer, ok := s.Session.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+type noteStore struct {
+	store.NoteStore
+	ix *Index
+}
+
+func (ns *noteStore) SaveNote(note *notes.Note) error {
+	if err := ns.NoteStore.SaveNote(note); err != nil {
+		return err
+	}
+	ns.ix.mu.Lock()
+	ns.ix.put(*note)
+	ns.ix.mu.Unlock()
+	return nil
+}
+
+func (ns *noteStore) UpdateNote(note *notes.Note) error {
+	if err := ns.NoteStore.UpdateNote(note); err != nil {
+		return err
+	}
+	ns.ix.mu.Lock()
+	ns.ix.put(*note)
+	ns.ix.mu.Unlock()
+	return nil
+}
+
+func (ns *noteStore) DeleteNote(id uuid.UUID) error {
+	if err := ns.NoteStore.DeleteNote(id); err != nil {
+		return err
+	}
+	ns.ix.mu.Lock()
+	ns.ix.remove(id)
+	ns.ix.mu.Unlock()
+	return nil
+}
@@ -0,0 +1,177 @@
+package suggest
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+
+	"github.com/aprice/freenote/notes"
+	"github.com/aprice/freenote/store"
+)
+
+// memSession is a session with only a note store, kept in memory.
+type memSession struct {
+	store.Session
+	notes map[uuid.UUID]notes.Note
+	loads int
+	// onLoad, if set, is called while notes are being queried.
+	onLoad func()
+}
+
+func (s *memSession) NoteStore() store.NoteStore {
+	return &memNoteStore{s}
+}
+
+type memNoteStore struct {
+	s *memSession
+}
+
+func (ns *memNoteStore) NoteByID(id uuid.UUID) (notes.Note, error) {
+	return ns.s.notes[id], nil
+}
+
+func (ns *memNoteStore) QueryNotes(query store.NoteQuery) ([]notes.Note, int, error) {
+	ns.s.loads++
+	if onLoad := ns.s.onLoad; onLoad != nil {
+		ns.s.onLoad = nil
+		onLoad()
+	}
+	var list []notes.Note
+	for _, note := range ns.s.notes {
+		if note.Owner == query.Owner {
+			list = append(list, note)
+		}
+	}
+	return list, len(list), nil
+}
+
+func (ns *memNoteStore) SaveNote(note *notes.Note) error {
+	ns.s.notes[note.ID] = *note
+	return nil
+}
+
+func (ns *memNoteStore) UpdateNote(note *notes.Note) error {
+	if ns.s.notes[note.ID].Version != note.Version {
+		return store.ErrConflict
+	}
+	note.Version++
+	ns.s.notes[note.ID] = *note
+	return nil
+}
+
+func (ns *memNoteStore) DeleteNote(id uuid.UUID) error {
+	delete(ns.s.notes, id)
+	return nil
+}
+
+func TestSuggest(t *testing.T) {
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	owner, other := uuid.NewV4(), uuid.NewV4()
+	mem := &memSession{notes: make(map[uuid.UUID]notes.Note)}
+	ix := NewIndex()
+	db := ix.Session(mem)
+	ns := db.NoteStore()
+	ids := make(map[string]uuid.UUID)
+	for _, n := range []struct {
+		title string
+		age   int
+	}{
+		{"Release notes", 300},
+		{"Project release plan", 1},
+		{"Really lengthy essay", 0},
+		{"Groceries", 0},
+		{"Reading list", 20},
+	} {
+		note := notes.Note{ID: uuid.NewV4(), Owner: owner, Title: n.title, Modified: now.AddDate(0, 0, -n.age)}
+		ns.SaveNote(&note)
+		ids[n.title] = note.ID
+	}
+	ns.SaveNote(&notes.Note{ID: uuid.NewV4(), Owner: other, Title: "Release party"})
+
+	suggest := func(typed string, limit int) string {
+		list, err := ix.Suggest(db, owner, typed, limit, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var titles []string
+		for _, s := range list {
+			titles = append(titles, s.Title)
+		}
+		return strings.Join(titles, ", ")
+	}
+	if actual := suggest("rel", 10); actual != "Release notes, Project release plan, Really lengthy essay, Reading list" {
+		t.Errorf("rel suggested %s", actual)
+	}
+	if actual := suggest("", 2); actual != "Groceries, Really lengthy essay" {
+		t.Errorf("Nothing typed suggested %s", actual)
+	}
+	if actual := suggest("xyz", 10); actual != "" {
+		t.Errorf("xyz suggested %s", actual)
+	}
+
+	// Changes through the wrapped session are reflected without reloading.
+	renamed := mem.notes[ids["Groceries"]]
+	renamed.Title = "Relish recipes"
+	ns.SaveNote(&renamed)
+	ns.DeleteNote(ids["Release notes"])
+	if actual := suggest("rel", 10); actual != "Relish recipes, Project release plan, Really lengthy essay, Reading list" {
+		t.Errorf("rel suggested %s after changes", actual)
+	}
+	if mem.loads != 1 {
+		t.Errorf("Titles loaded %d times", mem.loads)
+	}
+}
+
+func TestIndexUpdates(t *testing.T) {
+	now := time.Now()
+	alice, bob := uuid.NewV4(), uuid.NewV4()
+	mem := &memSession{notes: make(map[uuid.UUID]notes.Note)}
+	ix := NewIndex()
+	db := ix.Session(mem)
+	ns := db.NoteStore()
+	note := notes.Note{ID: uuid.NewV4(), Owner: alice, Title: "Plans"}
+	ns.SaveNote(&note)
+	suggest := func(owner uuid.UUID) int {
+		t.Helper()
+		list, err := ix.Suggest(db, owner, "", 10, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return len(list)
+	}
+
+	// A note saved while titles are loading isn't missed, and doesn't
+	// block on the load.
+	mem.onLoad = func() {
+		ns.SaveNote(&notes.Note{ID: uuid.NewV4(), Owner: alice, Title: "Ideas"})
+	}
+	suggest(alice)
+	if n := suggest(alice); n != 2 || mem.loads != 2 {
+		t.Errorf("Suggested %d notes after %d loads, expected 2 after 2", n, mem.loads)
+	}
+
+	// A note given to another user leaves its previous owner's titles.
+	if n := suggest(bob); n != 0 {
+		t.Errorf("Suggested %d of bob's notes", n)
+	}
+	note.Owner = bob
+	ns.SaveNote(&note)
+	if a, b := suggest(alice), suggest(bob); a != 1 || b != 1 {
+		t.Errorf("Suggested %d of alice's and %d of bob's notes after owner change", a, b)
+	}
+
+	// The least recently used users' titles are dropped.
+	ix.MaxUsers = 1
+	loads := mem.loads
+	suggest(uuid.NewV4())
+	suggest(alice)
+	suggest(alice)
+	if n := suggest(bob); n != 1 || mem.loads != loads+3 {
+		t.Errorf("Suggested %d notes after %d loads, expected 1 after 3", n, mem.loads-loads)
+	}
+	if len(ix.users) != 1 || ix.recent.Len() != 1 || len(ix.owners) != 1 {
+		t.Errorf("Index kept %d users, %d notes", len(ix.users), len(ix.owners))
+	}
+}
@@ -0,0 +1,88 @@
+package users
+
+import (
+	"errors"
+	"net/mail"
+	"strings"
+	"time"
+)
+
+// EmailVerificationLifetime is how long a user has to verify their email
+// address after setting it.
+const EmailVerificationLifetime = 24 * time.Hour
+
+const maxEmailVerificationAttempts = 5
+
+// ErrEmailInvalid indicates an email address that isn't a bare address, like
+// user@example.com.
+var ErrEmailInvalid = errors.New("invalid email address")
+
+// EmailVerification is a pending check that a user receives mail at their
+// email address.
+type EmailVerification struct {
+	Code     *Password
+	Expires  time.Time
+	Attempts int
+}
+
+// ValidateEmail checks that an email address is a bare address, without a
+// display name or comments.
+func ValidateEmail(email string) error {
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Name != "" || addr.Address != email || strings.ContainsAny(email, " \r\n") {
+		return ErrEmailInvalid
+	}
+	return nil
+}
+
+// SetEmail changes the user's email address, which must then be verified
+// before mail is sent to it. It returns the code to send to the new address to
+// verify it, or an empty string if the address was removed or hasn't changed.
+func (u *User) SetEmail(email string, now time.Time) (string, error) {
+	if email == u.Email {
+		return "", nil
+	}
+	if email != "" {
+		if err := ValidateEmail(email); err != nil {
+			return "", err
+		}
+	}
+	u.Email = email
+	u.EmailVerified = false
+	u.EmailVerification = nil
+	if email == "" {
+		return "", nil
+	}
+	return u.NewEmailVerification(now)
+}
+
+// NewEmailVerification starts verifying the user's email address, replacing
+// any verification in progress, and returns the code to send to it.
+func (u *User) NewEmailVerification(now time.Time) (string, error) {
+	code, pw, err := RandomPassword(16)
+	if err != nil {
+		return "", err
+	}
+	u.EmailVerification = &EmailVerification{Code: pw, Expires: now.Add(EmailVerificationLifetime)}
+	return code, nil
+}
+
+// VerifyEmail checks a code sent to the user's email address, marking it
+// verified if it's correct. The verification is cleared on success, and after
+// too many failures.
+func (u *User) VerifyEmail(code string, now time.Time) bool {
+	ev := u.EmailVerification
+	if ev == nil || u.Email == "" || now.After(ev.Expires) {
+		return false
+	}
+	if ok, err := ev.Code.Verify(code); ok && err == nil {
+		u.EmailVerified = true
+		u.EmailVerification = nil
+		return true
+	}
+	ev.Attempts++
+	if ev.Attempts >= maxEmailVerificationAttempts {
+		u.EmailVerification = nil
+	}
+	return false
+}
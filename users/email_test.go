@@ -0,0 +1,55 @@
+package users
+
+import (
+	"testing"
+	"time"
+)
+
+func TestValidateEmail(t *testing.T) {
+	tests := map[string]bool{
+		"alice@example.com":                       true,
+		"alice+notes@mail.example.com":            true,
+		"alice":                                   false,
+		"Alice <alice@example.com>":               false,
+		"alice@example.com (work)":                false,
+		"alice@example.com\r\nBcc: x@example.com": false,
+	}
+	for email, valid := range tests {
+		if err := ValidateEmail(email); (err == nil) != valid {
+			t.Errorf("ValidateEmail(%q) returned %v", email, err)
+		}
+	}
+}
+
+func TestEmailVerification(t *testing.T) {
+	u := New("test")
+	now := time.Now()
+	if _, err := u.SetEmail("not an address", now); err != ErrEmailInvalid {
+		t.Errorf("SetEmail with invalid address returned %v", err)
+	}
+	code, err := u.SetEmail("test@example.com", now)
+	if err != nil || code == "" {
+		t.Fatalf("SetEmail returned %q, %v", code, err)
+	}
+	if again, _ := u.SetEmail("test@example.com", now); again != "" {
+		t.Error("Unchanged address sent a new code")
+	}
+	if u.VerifyEmail(code, now.Add(EmailVerificationLifetime+time.Second)) || u.EmailVerified {
+		t.Error("Expired code verified the address")
+	}
+	if !u.VerifyEmail(code, now) || !u.EmailVerified || u.EmailVerification != nil {
+		t.Error("Code didn't verify the address")
+	}
+
+	// Changing the address needs it verified again, and failures are limited.
+	code, _ = u.SetEmail("other@example.com", now)
+	if u.EmailVerified {
+		t.Error("Changed address still verified")
+	}
+	for i := 0; i < maxEmailVerificationAttempts; i++ {
+		u.VerifyEmail("wrong", now)
+	}
+	if u.VerifyEmail(code, now) || u.EmailVerified {
+		t.Error("Code verified the address after too many failures")
+	}
+}
@@ -0,0 +1,166 @@
+package users
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+// ErrGroupName indicates a group without a name.
+var ErrGroupName = errors.New("group name required")
+
+// ErrGroupOwner indicates a group left without any member in the owner role.
+var ErrGroupOwner = errors.New("group must have an owner")
+
+// ErrMemberRole indicates a group member with a role other than owner, editor,
+// or viewer.
+var ErrMemberRole = errors.New("role must be owner, editor, or viewer")
+
+// ErrMemberDuplicate indicates a user listed more than once in a group.
+var ErrMemberDuplicate = errors.New("user is listed as a member more than once")
+
+// Role is a group member's role, which sets what they may do with the group
+// and its notes.
+type Role string
+
+const (
+	// RoleOwner members may read and write the group's notes, and manage the
+	// group and its members.
+	RoleOwner Role = "owner"
+	// RoleEditor members may read and write the group's notes.
+	RoleEditor Role = "editor"
+	// RoleViewer members may only read the group's notes.
+	RoleViewer Role = "viewer"
+)
+
+// Valid reports whether the role is one of the defined roles.
+func (r Role) Valid() bool {
+	return r == RoleOwner || r == RoleEditor || r == RoleViewer
+}
+
+// CanRead reports whether the role may read the group's notes.
+func (r Role) CanRead() bool {
+	return r.Valid()
+}
+
+// CanWrite reports whether the role may create, update, and delete the group's
+// notes.
+func (r Role) CanWrite() bool {
+	return r == RoleOwner || r == RoleEditor
+}
+
+// CanManage reports whether the role may change the group and its members.
+func (r Role) CanManage() bool {
+	return r == RoleOwner
+}
+
+// Member is a user's membership in a group.
+type Member struct {
+	User uuid.UUID `json:"user" xml:"user,attr"`
+	Role Role      `json:"role" xml:"role,attr"`
+}
+
+// Group is a team of users who share the notes it owns. Group-owned notes have
+// the group's ID as their Owner, so group and user IDs share a namespace.
+type Group struct {
+	ID      uuid.UUID `json:"id" xml:"id,attr" bson:"_id"`
+	Name    string    `json:"name"`
+	Members []Member  `json:"members" xml:"Member"`
+	Created time.Time `json:"created"`
+}
+
+// NewGroup creates a new group with the given name, owned by the given user.
+func NewGroup(name string, owner uuid.UUID) Group {
+	return Group{
+		ID:      uuid.NewV4(),
+		Name:    strings.TrimSpace(name),
+		Members: []Member{{User: owner, Role: RoleOwner}},
+		Created: time.Now(),
+	}
+}
+
+// Role returns a user's role in the group, or an empty role if they aren't a
+// member.
+func (g Group) Role(user uuid.UUID) Role {
+	for _, m := range g.Members {
+		if m.User == user {
+			return m.Role
+		}
+	}
+	return ""
+}
+
+// SetMember adds a user to the group with the given role, or changes their
+// role if they're already a member.
+func (g *Group) SetMember(user uuid.UUID, role Role) error {
+	if !role.Valid() {
+		return ErrMemberRole
+	}
+	for i := range g.Members {
+		if g.Members[i].User == user {
+			prev := g.Members[i].Role
+			g.Members[i].Role = role
+			if !g.hasOwner() {
+				g.Members[i].Role = prev
+				return ErrGroupOwner
+			}
+			return nil
+		}
+	}
+	g.Members = append(g.Members, Member{User: user, Role: role})
+	return nil
+}
+
+// RemoveMember removes a user from the group. It returns false if they weren't
+// a member, and ErrGroupOwner if they're its last owner.
+func (g *Group) RemoveMember(user uuid.UUID) (bool, error) {
+	for i, m := range g.Members {
+		if m.User != user {
+			continue
+		}
+		if m.Role == RoleOwner && g.owners() == 1 {
+			return false, ErrGroupOwner
+		}
+		g.Members = append(g.Members[:i], g.Members[i+1:]...)
+		return true, nil
+	}
+	return false, nil
+}
+
+// Validate checks that the group has a name and at least one owner, and that
+// each member is listed once with a valid role.
+func (g Group) Validate() error {
+	if strings.TrimSpace(g.Name) == "" {
+		return ErrGroupName
+	}
+	seen := make(map[uuid.UUID]bool, len(g.Members))
+	for _, m := range g.Members {
+		if !m.Role.Valid() {
+			return ErrMemberRole
+		}
+		if seen[m.User] {
+			return ErrMemberDuplicate
+		}
+		seen[m.User] = true
+	}
+	if !g.hasOwner() {
+		return ErrGroupOwner
+	}
+	return nil
+}
+
+func (g Group) hasOwner() bool {
+	return g.owners() > 0
+}
+
+func (g Group) owners() int {
+	n := 0
+	for _, m := range g.Members {
+		if m.Role == RoleOwner {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,61 @@
+package users
+
+import (
+	"testing"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+func TestGroupMembers(t *testing.T) {
+	owner, editor := uuid.NewV4(), uuid.NewV4()
+	g := NewGroup(" Team ", owner)
+	if g.Name != "Team" || g.Role(owner) != RoleOwner {
+		t.Fatalf("NewGroup made %+v", g)
+	}
+	if err := g.SetMember(editor, "boss"); err != ErrMemberRole {
+		t.Errorf("SetMember with invalid role returned %v", err)
+	}
+	if err := g.SetMember(editor, RoleEditor); err != nil {
+		t.Fatal(err)
+	}
+	if r := g.Role(editor); !r.CanWrite() || r.CanManage() {
+		t.Errorf("Editor role %q", r)
+	}
+	if err := g.SetMember(owner, RoleViewer); err != ErrGroupOwner {
+		t.Errorf("Demoting last owner returned %v", err)
+	}
+	if g.Role(owner) != RoleOwner {
+		t.Error("Last owner demoted")
+	}
+	if _, err := g.RemoveMember(owner); err != ErrGroupOwner {
+		t.Errorf("Removing last owner returned %v", err)
+	}
+	if removed, err := g.RemoveMember(editor); !removed || err != nil {
+		t.Errorf("RemoveMember returned %v, %v", removed, err)
+	}
+	if r := g.Role(editor); r.CanRead() {
+		t.Errorf("Removed member has role %q", r)
+	}
+	if removed, _ := g.RemoveMember(editor); removed {
+		t.Error("RemoveMember returned true for non-member")
+	}
+}
+
+func TestGroupValidate(t *testing.T) {
+	owner := uuid.NewV4()
+	tests := map[string]struct {
+		group Group
+		err   error
+	}{
+		"valid":     {NewGroup("Team", owner), nil},
+		"no name":   {Group{Name: " ", Members: []Member{{owner, RoleOwner}}}, ErrGroupName},
+		"no owner":  {Group{Name: "Team", Members: []Member{{owner, RoleEditor}}}, ErrGroupOwner},
+		"bad role":  {Group{Name: "Team", Members: []Member{{owner, "boss"}}}, ErrMemberRole},
+		"duplicate": {Group{Name: "Team", Members: []Member{{owner, RoleOwner}, {owner, RoleViewer}}}, ErrMemberDuplicate},
+	}
+	for name, test := range tests {
+		if err := test.group.Validate(); err != test.err {
+			t.Errorf("%s: Validate returned %v, expected %v", name, err, test.err)
+		}
+	}
+}
@@ -6,34 +6,91 @@ import (
 	"crypto/sha512"
 	"encoding/base64"
 	"fmt"
+	"sync"
 
+	"golang.org/x/crypto/argon2"
 	"golang.org/x/crypto/pbkdf2"
+
+	"github.com/aprice/freenote/config"
 )
 
-const currentPasswordVersion uint8 = 1
+const currentPasswordVersion uint8 = 2
 const maxVerifiablePasswordLen = 128 // greatest length ever allowed by maxPasswordLength
 
+// Random secrets (session keys, tokens, etc.) are high-entropy, so gain nothing
+// from a memory-hard hash, and are verified far more often than passwords.
+const randomPasswordVersion uint8 = 1
+
+// PasswordCost holds the tunable cost parameters for password schemes that
+// support them. Memory is in KiB.
+type PasswordCost struct {
+	Time    uint32
+	Memory  uint32
+	Threads uint8
+}
+
+// DefaultPasswordCost is the Argon2id cost used unless configured otherwise,
+// per OWASP recommendations for 2021.
+var DefaultPasswordCost = PasswordCost{Time: 2, Memory: 19 * 1024, Threads: 1}
+
+var (
+	costLock    sync.RWMutex
+	currentCost = DefaultPasswordCost
+)
+
 // Password encapsulates all of the data necessary to hash
 // and validate passwords securely.
 type Password struct {
 	Version uint8
 	Hash    []byte
 	Salt    []byte
+	Cost    PasswordCost
+}
+
+// InitPasswordCost sets the cost of new password hashes from the configuration.
+// Unset values keep their defaults.
+func InitPasswordCost(conf config.Config) {
+	cost := DefaultPasswordCost
+	if conf.PasswordTime > 0 {
+		cost.Time = conf.PasswordTime
+	}
+	if conf.PasswordMemory > 0 {
+		cost.Memory = conf.PasswordMemory
+	}
+	if conf.PasswordThreads > 0 {
+		cost.Threads = conf.PasswordThreads
+	}
+	costLock.Lock()
+	currentCost = cost
+	costLock.Unlock()
+}
+
+func passwordCost() PasswordCost {
+	costLock.RLock()
+	defer costLock.RUnlock()
+	return currentCost
 }
 
 // NewPassword creates a new salt and hash for the given password, using the
 // current latest password version.
 func NewPassword(password string) (*Password, error) {
-	scheme := schemes[currentPasswordVersion]
+	return newPassword(password, currentPasswordVersion)
+}
+
+func newPassword(password string, version uint8) (*Password, error) {
+	scheme := schemes[version]
 	salt, err := scheme.Salt()
 	if err != nil {
 		return nil, err
 	}
 	pwd := &Password{
-		Version: currentPasswordVersion,
-		Hash:    scheme.Hash([]byte(password), salt),
+		Version: version,
 		Salt:    salt,
 	}
+	if scheme.GetInfo().Tunable {
+		pwd.Cost = passwordCost()
+	}
+	pwd.Hash = scheme.Hash([]byte(password), salt, pwd.Cost)
 	return pwd, nil
 }
 
@@ -51,7 +108,7 @@ func RandomPassword(length int) (string, *Password, error) {
 	}
 	passString := base64.RawStdEncoding.EncodeToString(passRaw)
 	passString = passString[:length]
-	pw, err := NewPassword(passString)
+	pw, err := newPassword(passString, randomPasswordVersion)
 	return passString, pw, err
 }
 
@@ -69,16 +126,19 @@ func (p Password) Verify(input string) (bool, error) {
 	if len(input) > maxVerifiablePasswordLen {
 		return false, fmt.Errorf("invalid password, too long")
 	}
-	provided := schemes[p.Version].Hash([]byte(input), p.Salt)
+	if si.Tunable && (p.Cost.Time == 0 || p.Cost.Memory == 0 || p.Cost.Threads == 0) {
+		return false, fmt.Errorf("invalid password, missing cost parameters")
+	}
+	provided := schemes[p.Version].Hash([]byte(input), p.Salt, p.Cost)
 	return bytes.Equal(provided, p.Hash), nil
 }
 
-// NeedsUpdate returns true if the password scheme is out of date
+// NeedsUpdate returns true if the password scheme or its cost is out of date
 // and needs updating. Note that this cannot be done automatically,
 // because we can't get the plaintext password from the old hash to
-// generate a new one.
+// generate a new one; see User.UpgradePassword.
 func (p Password) NeedsUpdate() bool {
-	return p.Version < currentPasswordVersion
+	return p.Version < currentPasswordVersion || (p.Version == currentPasswordVersion && p.Cost != passwordCost())
 }
 
 // Password schemes, internal use only
@@ -87,8 +147,9 @@ func (p Password) NeedsUpdate() bool {
 type passwordScheme interface {
 	// Salt generates the user's unique password salt
 	Salt() ([]byte, error)
-	// Hash generates a secure hash from a password and salt
-	Hash(password, salt []byte) []byte
+	// Hash generates a secure hash from a password and salt, at the given cost
+	// if the scheme is tunable
+	Hash(password, salt []byte, cost PasswordCost) []byte
 	// GetInfo returns metadata about this password scheme
 	GetInfo() schemeInfo
 }
@@ -98,12 +159,14 @@ type schemeInfo struct {
 	Version uint8
 	SaltLen int
 	HashLen int
+	Tunable bool
 }
 
 // Any scheme used should be registered here.
 var schemes = []passwordScheme{
 	nil,
 	(*passwordV1)(nil),
+	(*passwordV2)(nil),
 }
 
 // Password Version 1
@@ -120,10 +183,32 @@ func (p *passwordV1) Salt() ([]byte, error) {
 	return salt, err
 }
 
-func (p *passwordV1) Hash(password, salt []byte) []byte {
+func (p *passwordV1) Hash(password, salt []byte, _ PasswordCost) []byte {
 	return pbkdf2.Key(password, salt, 5000, p.GetInfo().HashLen, sha512.New)
 }
 
 func (p *passwordV1) GetInfo() schemeInfo {
 	return schemeInfo{Version: 1, SaltLen: 16, HashLen: 32}
 }
+
+// Password Version 2
+// - Argon2id
+// - 16 byte salt
+// - Time, memory, and parallelism stored with each hash
+// - 32 byte hash
+// - Based on RFC 9106 and OWASP recommendations for 2021
+type passwordV2 struct{}
+
+func (p *passwordV2) Salt() ([]byte, error) {
+	salt := make([]byte, p.GetInfo().SaltLen)
+	_, err := rand.Read(salt)
+	return salt, err
+}
+
+func (p *passwordV2) Hash(password, salt []byte, cost PasswordCost) []byte {
+	return argon2.IDKey(password, salt, cost.Time, cost.Memory, cost.Threads, uint32(p.GetInfo().HashLen))
+}
+
+func (p *passwordV2) GetInfo() schemeInfo {
+	return schemeInfo{Version: 2, SaltLen: 16, HashLen: 32, Tunable: true}
+}
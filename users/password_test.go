@@ -1,6 +1,7 @@
 package users
 
 import (
+	"bytes"
 	"crypto/sha256"
 	"crypto/sha512"
 	"hash"
@@ -8,6 +9,8 @@ import (
 
 	"golang.org/x/crypto/pbkdf2"
 	"golang.org/x/crypto/sha3"
+
+	"github.com/aprice/freenote/config"
 )
 
 func TestNewPassword(t *testing.T) {
@@ -64,7 +67,7 @@ func TestV1(t *testing.T) {
 	if len(salt) != v1.GetInfo().SaltLen {
 		t.Error("incorrect salt length")
 	}
-	h := v1.Hash([]byte("swordfish"), salt)
+	h := v1.Hash([]byte("swordfish"), salt, PasswordCost{})
 	if len(h) != v1.GetInfo().HashLen {
 		t.Error("incorrect hash length")
 	}
@@ -80,7 +83,7 @@ func BenchmarkV1(b *testing.B) {
 	pass := []byte("swordfish")
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		h = v1.Hash(pass, salt)
+		h = v1.Hash(pass, salt, PasswordCost{})
 	}
 	if len(h) < 32 {
 		b.Error("incorrect output hash length")
@@ -126,3 +129,105 @@ func BenchmarkHashAlgos(b *testing.B) {
 		})
 	}
 }
+
+func TestV2(t *testing.T) {
+	v2 := (*passwordV2)(nil)
+	salt, err := v2.Salt()
+	if err != nil {
+		t.Error(err)
+	}
+	if len(salt) != v2.GetInfo().SaltLen {
+		t.Error("incorrect salt length")
+	}
+	h := v2.Hash([]byte("swordfish"), salt, DefaultPasswordCost)
+	if len(h) != v2.GetInfo().HashLen {
+		t.Error("incorrect hash length")
+	}
+	cheaper := DefaultPasswordCost
+	cheaper.Time = 1
+	if bytes.Equal(h, v2.Hash([]byte("swordfish"), salt, cheaper)) {
+		t.Error("hash doesn't depend on cost")
+	}
+}
+
+func TestUpgradePassword(t *testing.T) {
+	u := New("test")
+	var err error
+	if u.Password, err = newPassword("swordfish", 1); err != nil {
+		t.Fatal(err)
+	}
+	if !u.Password.NeedsUpdate() {
+		t.Fatal("v1 password doesn't need update")
+	}
+	if changed, err := u.UpgradePassword("swordfish"); err != nil || !changed {
+		t.Fatalf("UpgradePassword returned %v, %v", changed, err)
+	}
+	if u.Password.Version != currentPasswordVersion || u.Password.NeedsUpdate() {
+		t.Errorf("password not upgraded: %+v", u.Password)
+	}
+	if ok, err := u.Password.Verify("swordfish"); !ok || err != nil {
+		t.Errorf("upgraded password not accepted: %v", err)
+	}
+	if changed, _ := u.UpgradePassword("swordfish"); changed {
+		t.Error("current password upgraded again")
+	}
+
+	// Changing the configured cost requires a rehash
+	InitPasswordCost(config.Config{PasswordTime: DefaultPasswordCost.Time + 1})
+	defer InitPasswordCost(config.Config{})
+	if !u.Password.NeedsUpdate() {
+		t.Error("password with old cost doesn't need update")
+	}
+	if ok, err := u.Password.Verify("swordfish"); !ok || err != nil {
+		t.Errorf("password with old cost not accepted: %v", err)
+	}
+}
+
+func BenchmarkV2(b *testing.B) {
+	var h []byte
+	v2 := (*passwordV2)(nil)
+	salt, err := v2.Salt()
+	if err != nil {
+		b.Error(err)
+	}
+	pass := []byte("swordfish")
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		h = v2.Hash(pass, salt, DefaultPasswordCost)
+	}
+	if len(h) < 32 {
+		b.Error("incorrect output hash length")
+	}
+}
+
+func BenchmarkArgon2Cost(b *testing.B) {
+	// Benchmark Argon2id costs to choose PasswordTime, PasswordMemory and
+	// PasswordThreads for the server's hardware. Target ~50ms or less per hash,
+	// bearing in mind memory use multiplies with concurrent logins.
+	testCases := []struct {
+		name string
+		cost PasswordCost
+	}{
+		{"t1-m47Mi-p1", PasswordCost{1, 47 * 1024, 1}},
+		{"t2-m19Mi-p1", PasswordCost{2, 19 * 1024, 1}},
+		{"t3-m12Mi-p1", PasswordCost{3, 12 * 1024, 1}},
+		{"t4-m9Mi-p1", PasswordCost{4, 9 * 1024, 1}},
+		{"t5-m7Mi-p1", PasswordCost{5, 7 * 1024, 1}},
+		{"t1-m64Mi-p4", PasswordCost{1, 64 * 1024, 4}},
+		{"t3-m64Mi-p4", PasswordCost{3, 64 * 1024, 4}},
+	}
+	v2 := (*passwordV2)(nil)
+	for _, tc := range testCases {
+		password := []byte("swordfish")
+		salt := []byte("NaClNaClNaClNaCl")
+		b.Run(tc.name, func(bb *testing.B) {
+			var h []byte
+			for i := 0; i < bb.N; i++ {
+				h = v2.Hash(password, salt, tc.cost)
+			}
+			if len(h) < 32 {
+				bb.Error("incorrect output hash length")
+			}
+		})
+	}
+}
@@ -0,0 +1,101 @@
+package users
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+// ErrSearchName indicates a saved search without a name.
+var ErrSearchName = errors.New("search name required")
+
+// ErrSearchNameTaken indicates a saved search named the same as another of the
+// user's searches.
+var ErrSearchNameTaken = errors.New("search name already in use")
+
+// Search is a saved note search, which lists the notes matching its query like
+// a folder.
+type Search struct {
+	ID   uuid.UUID `json:"id"`
+	Name string
+	// Query holds the notes collection's filter and sort parameters as a query
+	// string, such as tag=work&sort=title.
+	Query   string
+	Created time.Time
+}
+
+// NewSearch saves a search for this user with the given name and query.
+func (u *User) NewSearch(name, query string) (Search, error) {
+	search := Search{
+		ID:      uuid.NewV4(),
+		Created: time.Now(),
+	}
+	if err := u.checkSearchName(search.ID, name); err != nil {
+		return Search{}, err
+	}
+	search.Name, search.Query = strings.TrimSpace(name), query
+	u.Searches = append(u.Searches, &search)
+	return search, nil
+}
+
+// UpdateSearch renames the saved search with the given ID and replaces its
+// query. It returns nil if there is no such search.
+func (u *User) UpdateSearch(id uuid.UUID, name, query string) (*Search, error) {
+	search := u.Search(id)
+	if search == nil {
+		return nil, nil
+	}
+	if err := u.checkSearchName(id, name); err != nil {
+		return nil, err
+	}
+	search.Name, search.Query = strings.TrimSpace(name), query
+	return search, nil
+}
+
+// checkSearchName checks that a search name isn't blank, and isn't used by
+// another of the user's searches, ignoring case.
+func (u *User) checkSearchName(id uuid.UUID, name string) error {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return ErrSearchName
+	}
+	if other := u.SearchByName(name); other != nil && other.ID != id {
+		return ErrSearchNameTaken
+	}
+	return nil
+}
+
+// Search returns the saved search with the given ID, or nil if there is none.
+func (u *User) Search(id uuid.UUID) *Search {
+	for _, search := range u.Searches {
+		if search.ID == id {
+			return search
+		}
+	}
+	return nil
+}
+
+// SearchByName returns the saved search with the given name, ignoring case, or
+// nil if there is none.
+func (u *User) SearchByName(name string) *Search {
+	for _, search := range u.Searches {
+		if strings.EqualFold(search.Name, name) {
+			return search
+		}
+	}
+	return nil
+}
+
+// RemoveSearch deletes the saved search with the given ID. It returns false if
+// there was no such search.
+func (u *User) RemoveSearch(id uuid.UUID) bool {
+	for i, search := range u.Searches {
+		if search.ID == id {
+			u.Searches = append(u.Searches[:i], u.Searches[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,72 @@
+package users
+
+import (
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+// Token is a personal API token, used in place of a password for HTTP Basic
+// authentication. Users with two-factor authentication must use a token for
+// API access.
+type Token struct {
+	ID       uuid.UUID `json:"id"`
+	Name     string
+	Created  time.Time
+	LastUsed time.Time
+	Key      *Password
+}
+
+// NewToken creates a new API token for this user with the given descriptive
+// name. It returns the token and its secret, which can't be retrieved again.
+func (u *User) NewToken(name string) (Token, string, error) {
+	secret, pw, err := RandomPassword(32)
+	if err != nil {
+		return Token{}, "", err
+	}
+	tok := Token{
+		ID:      uuid.NewV4(),
+		Name:    name,
+		Created: time.Now(),
+		Key:     pw,
+	}
+	u.Tokens = append(u.Tokens, &tok)
+	return tok, secret, nil
+}
+
+// Token returns the API token with the given ID, or nil if there is none.
+func (u *User) Token(id uuid.UUID) *Token {
+	for _, tok := range u.Tokens {
+		if tok.ID == id {
+			return tok
+		}
+	}
+	return nil
+}
+
+// RemoveToken revokes the API token with the given ID. It returns false if
+// there was no such token.
+func (u *User) RemoveToken(id uuid.UUID) bool {
+	for i, tok := range u.Tokens {
+		if tok.ID == id {
+			u.Tokens = append(u.Tokens[:i], u.Tokens[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Verify that the given secret matches this token.
+func (t *Token) Verify(secret string) bool {
+	ok, err := t.Key.Verify(secret)
+	return ok && err == nil
+}
+
+// Touch records a use of this token. It returns true if the token changed
+// enough to need saving.
+func (t *Token) Touch() bool {
+	now := time.Now()
+	changed := now.Sub(t.LastUsed) > SessionTouchInterval
+	t.LastUsed = now
+	return changed
+}
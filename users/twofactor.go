@@ -0,0 +1,267 @@
+package users
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1" // nolint: gas
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// TOTP parameters, per RFC 6238 defaults as supported by common authenticator
+// apps.
+const (
+	totpPeriod    = 30
+	totpDigits    = 6
+	totpSkew      = 1
+	totpSecretLen = 20
+)
+
+const recoveryCodeCount = 10
+const recoveryCodeLen = 10
+const recoveryCodeAlphabet = "abcdefghjkmnpqrstuvwxyz23456789"
+
+// TwoFactorChallengeLifetime is how long a user has to supply a two-factor code
+// after supplying a valid password.
+const TwoFactorChallengeLifetime = 5 * time.Minute
+
+const maxChallengeAttempts = 5
+
+// TwoFactorLockout is how long two-factor logins are refused after too many
+// invalid codes.
+const TwoFactorLockout = 15 * time.Minute
+
+const maxTwoFactorFailures = 5
+
+// ErrTwoFactorNotPending indicates an attempt to confirm two-factor enrolment
+// that was never started or is already complete.
+var ErrTwoFactorNotPending = errors.New("two-factor enrolment not started")
+
+// ErrTwoFactorCodeInvalid indicates an incorrect or reused two-factor code.
+var ErrTwoFactorCodeInvalid = errors.New("invalid two-factor code")
+
+// ErrTwoFactorLocked indicates a two-factor login refused because of too many
+// recent invalid codes.
+var ErrTwoFactorLocked = errors.New("too many invalid two-factor codes")
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// TwoFactor holds a user's TOTP two-factor authentication settings.
+type TwoFactor struct {
+	Secret            string
+	Enabled           bool
+	LastCounter       uint64
+	RecoveryCodes     []*Password
+	Challenge         *Password
+	ChallengeExpires  time.Time
+	ChallengeAttempts int
+	// FailedAttempts counts invalid login codes since the last valid one or
+	// lockout, across challenges.
+	FailedAttempts int
+	LockedUntil    time.Time
+}
+
+// TwoFactorEnabled returns true if this user must supply a two-factor code to
+// log in.
+func (u *User) TwoFactorEnabled() bool {
+	return u.TwoFactor != nil && u.TwoFactor.Enabled
+}
+
+// BeginTwoFactor starts two-factor enrolment, generating a new TOTP secret. It
+// returns the secret and an otpauth URI for display as a QR code. Enrolment is
+// not complete until confirmed with ConfirmTwoFactor.
+func (u *User) BeginTwoFactor(issuer string) (secret, uri string, err error) {
+	raw := make([]byte, totpSecretLen)
+	if _, err = rand.Read(raw); err != nil {
+		return "", "", err
+	}
+	secret = totpEncoding.EncodeToString(raw)
+	u.TwoFactor = &TwoFactor{Secret: secret}
+	label := url.PathEscape(issuer + ":" + u.Username)
+	q := url.Values{}
+	q.Set("secret", secret)
+	q.Set("issuer", issuer)
+	q.Set("algorithm", "SHA1")
+	q.Set("digits", fmt.Sprint(totpDigits))
+	q.Set("period", fmt.Sprint(totpPeriod))
+	uri = "otpauth://totp/" + label + "?" + q.Encode()
+	return secret, uri, nil
+}
+
+// ConfirmTwoFactor completes two-factor enrolment given a valid code from the
+// user's authenticator. It returns the user's new recovery codes.
+func (u *User) ConfirmTwoFactor(code string, now time.Time) ([]string, error) {
+	if u.TwoFactor == nil || u.TwoFactor.Enabled {
+		return nil, ErrTwoFactorNotPending
+	}
+	if !u.TwoFactor.verifyTOTP(code, now) {
+		return nil, ErrTwoFactorCodeInvalid
+	}
+	u.TwoFactor.Enabled = true
+	return u.NewRecoveryCodes()
+}
+
+// ResetTwoFactor removes two-factor authentication from this user.
+func (u *User) ResetTwoFactor() {
+	u.TwoFactor = nil
+}
+
+// NewRecoveryCodes replaces this user's recovery codes with a new set, and
+// returns them. Only hashes are stored, so they can't be retrieved again.
+func (u *User) NewRecoveryCodes() ([]string, error) {
+	if u.TwoFactor == nil {
+		return nil, ErrTwoFactorNotPending
+	}
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]*Password, recoveryCodeCount)
+	raw := make([]byte, recoveryCodeLen)
+	for i := range codes {
+		if _, err := rand.Read(raw); err != nil {
+			return nil, err
+		}
+		code := make([]byte, recoveryCodeLen)
+		for j, b := range raw {
+			code[j] = recoveryCodeAlphabet[int(b)%len(recoveryCodeAlphabet)]
+		}
+		codes[i] = string(code[:5]) + "-" + string(code[5:])
+		pw, err := NewPassword(string(code))
+		if err != nil {
+			return nil, err
+		}
+		hashes[i] = pw
+	}
+	u.TwoFactor.RecoveryCodes = hashes
+	return codes, nil
+}
+
+// VerifyTwoFactor checks a TOTP code or single-use recovery code. TOTP codes
+// can't be reused, and recovery codes are removed once used.
+func (u *User) VerifyTwoFactor(code string, now time.Time) bool {
+	if !u.TwoFactorEnabled() {
+		return false
+	}
+	code = strings.Map(func(r rune) rune {
+		if r == ' ' || r == '-' {
+			return -1
+		}
+		return r
+	}, strings.ToLower(code))
+	if len(code) == totpDigits {
+		return u.TwoFactor.verifyTOTP(code, now)
+	}
+	for i, rc := range u.TwoFactor.RecoveryCodes {
+		if ok, err := rc.Verify(code); ok && err == nil {
+			u.TwoFactor.RecoveryCodes = append(u.TwoFactor.RecoveryCodes[:i], u.TwoFactor.RecoveryCodes[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// TwoFactorLocked returns true if two-factor logins are locked out after too
+// many invalid codes.
+func (u *User) TwoFactorLocked(now time.Time) bool {
+	return u.TwoFactor != nil && now.Before(u.TwoFactor.LockedUntil)
+}
+
+// LoginTwoFactor checks a two-factor code supplied to log in, whether with a
+// password or answering a challenge. After too many invalid codes, all codes
+// are refused until the lockout ends; new challenges don't reset the count.
+func (u *User) LoginTwoFactor(code string, now time.Time) bool {
+	if !u.TwoFactorEnabled() || u.TwoFactorLocked(now) {
+		return false
+	}
+	if u.VerifyTwoFactor(code, now) {
+		u.TwoFactor.FailedAttempts = 0
+		return true
+	}
+	u.TwoFactor.FailedAttempts++
+	if u.TwoFactor.FailedAttempts >= maxTwoFactorFailures {
+		u.TwoFactor.FailedAttempts = 0
+		u.TwoFactor.LockedUntil = now.Add(TwoFactorLockout)
+	}
+	return false
+}
+
+// NewTwoFactorChallenge creates a pending two-factor challenge, issued after a
+// user supplies a valid password, and returns its secret.
+func (u *User) NewTwoFactorChallenge(now time.Time) (string, error) {
+	secret, pw, err := RandomPassword(16)
+	if err != nil {
+		return "", err
+	}
+	u.TwoFactor.Challenge = pw
+	u.TwoFactor.ChallengeExpires = now.Add(TwoFactorChallengeLifetime)
+	u.TwoFactor.ChallengeAttempts = 0
+	return secret, nil
+}
+
+// AnswerTwoFactorChallenge checks a two-factor code against a pending
+// challenge. The challenge is cleared on success, and after too many failures.
+func (u *User) AnswerTwoFactorChallenge(secret, code string, now time.Time) bool {
+	if !u.TwoFactorEnabled() || u.TwoFactor.Challenge == nil || now.After(u.TwoFactor.ChallengeExpires) {
+		return false
+	}
+	if ok, err := u.TwoFactor.Challenge.Verify(secret); !ok || err != nil {
+		return false
+	}
+	if u.LoginTwoFactor(code, now) {
+		u.TwoFactor.Challenge = nil
+		return true
+	}
+	u.TwoFactor.ChallengeAttempts++
+	if u.TwoFactor.ChallengeAttempts >= maxChallengeAttempts {
+		u.TwoFactor.Challenge = nil
+	}
+	return false
+}
+
+func (tf *TwoFactor) verifyTOTP(code string, now time.Time) bool {
+	secret, err := totpEncoding.DecodeString(strings.ToUpper(tf.Secret))
+	if err != nil || len(code) != totpDigits {
+		return false
+	}
+	counter := now.Unix() / totpPeriod
+	for i := int64(-totpSkew); i <= totpSkew; i++ {
+		c := uint64(counter + i)
+		if c <= tf.LastCounter {
+			continue
+		}
+		if hmac.Equal([]byte(totpCode(secret, c, totpDigits)), []byte(code)) {
+			tf.LastCounter = c
+			return true
+		}
+	}
+	return false
+}
+
+// TOTPCode generates the current TOTP code for a base32-encoded secret, as an
+// authenticator app would.
+func TOTPCode(secret string, now time.Time) (string, error) {
+	raw, err := totpEncoding.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return "", err
+	}
+	return totpCode(raw, uint64(now.Unix()/totpPeriod), totpDigits), nil
+}
+
+// totpCode generates an HOTP code (RFC 4226) for the given counter.
+func totpCode(secret []byte, counter uint64, digits int) string {
+	msg := make([]byte, 8)
+	binary.BigEndian.PutUint64(msg, counter)
+	mac := hmac.New(sha1.New, secret)
+	mac.Write(msg)
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	mod := uint32(1)
+	for i := 0; i < digits; i++ {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", digits, value%mod)
+}
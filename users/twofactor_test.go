@@ -0,0 +1,155 @@
+package users
+
+import (
+	"testing"
+	"time"
+)
+
+// Test vectors from RFC 6238 appendix B (SHA1).
+func TestTOTPCode(t *testing.T) {
+	secret := []byte("12345678901234567890")
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "94287082"},
+		{1111111109, "07081804"},
+		{1234567890, "89005924"},
+		{2000000000, "69279037"},
+	}
+	for _, tt := range tests {
+		if code := totpCode(secret, uint64(tt.unix/totpPeriod), 8); code != tt.code {
+			t.Errorf("at %d expected %s, got %s", tt.unix, tt.code, code)
+		}
+	}
+	code, err := TOTPCode(totpEncoding.EncodeToString(secret), time.Unix(59, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code != "287082" {
+		t.Errorf("expected 287082, got %s", code)
+	}
+}
+
+func TestTwoFactorEnrolment(t *testing.T) {
+	u := New("test")
+	now := time.Now()
+	secret, _, err := u.BeginTwoFactor("Test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.TwoFactorEnabled() {
+		t.Fatal("two-factor enabled before confirmation")
+	}
+	if _, err = u.ConfirmTwoFactor("000000", now.Add(-time.Hour)); err != ErrTwoFactorCodeInvalid {
+		t.Fatalf("expected invalid code, got %v", err)
+	}
+	code, _ := TOTPCode(secret, now)
+	codes, err := u.ConfirmTwoFactor(code, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !u.TwoFactorEnabled() || len(codes) != recoveryCodeCount {
+		t.Fatalf("enrolment incomplete: enabled %v, %d codes", u.TwoFactorEnabled(), len(codes))
+	}
+
+	if u.VerifyTwoFactor(code, now) {
+		t.Error("TOTP code accepted twice")
+	}
+	next, _ := TOTPCode(secret, now.Add(totpPeriod*time.Second))
+	if !u.VerifyTwoFactor(next, now.Add(totpPeriod*time.Second)) {
+		t.Error("next TOTP code rejected")
+	}
+
+	if !u.VerifyTwoFactor(codes[0], now) {
+		t.Error("recovery code rejected")
+	}
+	if u.VerifyTwoFactor(codes[0], now) {
+		t.Error("recovery code accepted twice")
+	}
+	if len(u.TwoFactor.RecoveryCodes) != recoveryCodeCount-1 {
+		t.Errorf("expected %d recovery codes left, got %d", recoveryCodeCount-1, len(u.TwoFactor.RecoveryCodes))
+	}
+}
+
+func TestTwoFactorChallenge(t *testing.T) {
+	u := New("test")
+	now := time.Now()
+	secret, _, _ := u.BeginTwoFactor("Test")
+	code, _ := TOTPCode(secret, now)
+	codes, err := u.ConfirmTwoFactor(code, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	challenge, err := u.NewTwoFactorChallenge(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.AnswerTwoFactorChallenge("wrong", codes[0], now) {
+		t.Error("challenge answered with wrong secret")
+	}
+	for i := 0; i < maxChallengeAttempts; i++ {
+		if u.AnswerTwoFactorChallenge(challenge, "zzzzzzzzzz", now) {
+			t.Fatal("challenge answered with wrong code")
+		}
+	}
+	if u.AnswerTwoFactorChallenge(challenge, codes[0], now) {
+		t.Error("challenge still valid after too many attempts")
+	}
+
+	// The failures also locked out two-factor logins, which a new challenge
+	// doesn't undo.
+	challenge, _ = u.NewTwoFactorChallenge(now)
+	if u.AnswerTwoFactorChallenge(challenge, codes[0], now) {
+		t.Error("challenge answered while locked out")
+	}
+	now = now.Add(TwoFactorLockout)
+	challenge, _ = u.NewTwoFactorChallenge(now)
+	if u.AnswerTwoFactorChallenge(challenge, codes[0], now.Add(TwoFactorChallengeLifetime+time.Second)) {
+		t.Error("expired challenge answered")
+	}
+	if !u.AnswerTwoFactorChallenge(challenge, codes[0], now) {
+		t.Error("valid challenge answer rejected")
+	}
+	if u.AnswerTwoFactorChallenge(challenge, codes[1], now) {
+		t.Error("challenge answered twice")
+	}
+}
+
+func TestTwoFactorLockout(t *testing.T) {
+	u := New("test")
+	now := time.Now()
+	secret, _, _ := u.BeginTwoFactor("Test")
+	code, _ := TOTPCode(secret, now)
+	codes, err := u.ConfirmTwoFactor(code, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A valid code resets the count.
+	for i := 0; i < maxTwoFactorFailures-1; i++ {
+		u.LoginTwoFactor("zzzzzzzzzz", now)
+	}
+	if !u.LoginTwoFactor(codes[0], now) {
+		t.Fatal("valid code rejected")
+	}
+	// Failures count across challenges and codes supplied with a password.
+	for i := 0; i < maxTwoFactorFailures-1; i++ {
+		challenge, _ := u.NewTwoFactorChallenge(now)
+		u.AnswerTwoFactorChallenge(challenge, "zzzzzzzzzz", now)
+	}
+	if u.TwoFactorLocked(now) {
+		t.Fatal("locked out too soon")
+	}
+	u.LoginTwoFactor("zzzzzzzzzz", now)
+	if !u.TwoFactorLocked(now) {
+		t.Fatal("not locked out after too many failures")
+	}
+	if u.LoginTwoFactor(codes[1], now.Add(TwoFactorLockout-time.Second)) {
+		t.Error("valid code accepted while locked out")
+	}
+	if !u.LoginTwoFactor(codes[1], now.Add(TwoFactorLockout)) {
+		t.Error("valid code rejected after lockout")
+	}
+}
@@ -3,7 +3,9 @@ package users
 import (
 	"errors"
 	"regexp"
+	"strings"
 	"time"
+	"unicode/utf8"
 
 	uuid "github.com/satori/go.uuid"
 )
@@ -11,6 +13,10 @@ import (
 // ErrAuthenticationFailed indicates authentication failed.
 var ErrAuthenticationFailed = errors.New("authentication failed, incorrect username or password")
 
+// ErrAccountDisabled indicates the user's account has been disabled by an
+// administrator.
+var ErrAccountDisabled = errors.New("account disabled")
+
 // ErrUsernameTooShort indicates a username failed validation for minimum length.
 var ErrUsernameTooShort = errors.New("username too short")
 
@@ -23,14 +29,28 @@ var ErrUsernameInvalid = errors.New("invalid username")
 // SessionLifetime is the duration that a user session will be valid.
 const SessionLifetime = 90 * 24 * time.Hour
 
+// SessionTouchInterval is how long a session may go between recorded uses;
+// more frequent use doesn't need to be saved.
+const SessionTouchInterval = 5 * time.Minute
+
 // User represents a credentialed user in the system.
 type User struct {
-	ID          uuid.UUID   `json:"id" xml:"id,attr" bson:"_id"`
-	Username    string      `json:"username" storm:"unique"`
-	DisplayName string      `json:"name"`
-	Password    *Password   `json:"password,omitempty" xml:"-"`
-	Access      AccessLevel `json:"access"`
-	Sessions    []*Session  `json:"sessions,omitempty" xml:"-"`
+	ID          uuid.UUID `json:"id" xml:"id,attr" bson:"_id"`
+	Username    string    `json:"username" storm:"unique"`
+	DisplayName string    `json:"name"`
+	Email       string    `json:"email,omitempty" xml:",omitempty"`
+	// EmailVerified is set once the user has shown they receive mail at
+	// Email; only verified addresses are sent mail or used to link accounts.
+	EmailVerified     bool               `json:"emailVerified,omitempty" xml:",omitempty"`
+	EmailVerification *EmailVerification `json:"emailVerification,omitempty" xml:"-"`
+	Password          *Password          `json:"password,omitempty" xml:"-"`
+	Access            AccessLevel        `json:"access"`
+	Disabled          bool               `json:"disabled,omitempty" xml:"disabled,attr,omitempty"`
+	Sessions          []*Session         `json:"sessions,omitempty" xml:"-"`
+	TwoFactor         *TwoFactor         `json:"twoFactor,omitempty" xml:"-"`
+	Tokens            []*Token           `json:"tokens,omitempty" xml:"-"`
+	Searches          []*Search          `json:"searches,omitempty" xml:"-"`
+	ExternalID        string             `json:"externalID,omitempty" xml:"-" storm:"index"`
 }
 
 // New creates a new user with the given username and default access.
@@ -43,6 +63,22 @@ func New(username string) User {
 	}
 }
 
+// UpgradePassword rehashes this user's password with the current scheme and
+// cost if it is out of date. It must only be called with the password that was
+// just verified. It returns true if the password changed and the user needs
+// saving.
+func (u *User) UpgradePassword(password string) (bool, error) {
+	if u.Password == nil || !u.Password.NeedsUpdate() {
+		return false, nil
+	}
+	pw, err := NewPassword(password)
+	if err != nil {
+		return false, err
+	}
+	u.Password = pw
+	return true, nil
+}
+
 // ValidateSession checks the validity of a user session.
 func (u *User) ValidateSession(sessID uuid.UUID, key string) bool {
 	if u.Sessions == nil || len(u.Sessions) == 0 {
@@ -59,24 +95,67 @@ func (u *User) ValidateSession(sessID uuid.UUID, key string) bool {
 	return false
 }
 
-// NewSession creates a new session for this user.
-func (u *User) NewSession() (session Session, err error) {
+// NewSession creates a new session for this user, for a client with the given
+// user agent and IP address.
+func (u *User) NewSession(userAgent, ip string) (session Session, err error) {
 	key, pw, err := RandomPassword(16)
 	if err != nil {
 		return Session{}, err
 	}
 	sid := uuid.NewV4()
+	now := time.Now()
 	sess := Session{
-		ID:      sid,
-		UserID:  u.ID,
-		Expires: time.Now().Add(SessionLifetime),
-		Key:     pw,
-		Secret:  key,
+		ID:        sid,
+		UserID:    u.ID,
+		Created:   now,
+		LastUsed:  now,
+		Expires:   now.Add(SessionLifetime),
+		UserAgent: userAgent,
+		IP:        ip,
+		Key:       pw,
+		Secret:    key,
 	}
 	u.Sessions = append(u.Sessions, &sess)
 	return sess, nil
 }
 
+// Session returns the session with the given ID, or nil if there is none.
+func (u *User) Session(sessID uuid.UUID) *Session {
+	for _, sess := range u.Sessions {
+		if sess.ID == sessID {
+			return sess
+		}
+	}
+	return nil
+}
+
+// RemoveSession ends the session with the given ID. It returns false if there
+// was no such session.
+func (u *User) RemoveSession(sessID uuid.UUID) bool {
+	for i, sess := range u.Sessions {
+		if sess.ID == sessID {
+			u.Sessions = append(u.Sessions[:i], u.Sessions[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// RevokeSessions ends all sessions for this user, except those with the given
+// IDs.
+func (u *User) RevokeSessions(keep ...uuid.UUID) {
+	s := make([]*Session, 0, len(keep))
+	for _, sess := range u.Sessions {
+		for _, id := range keep {
+			if sess.ID == id {
+				s = append(s, sess)
+				break
+			}
+		}
+	}
+	u.Sessions = s
+}
+
 // CleanSessions removes expired sessions for this user.
 func (u *User) CleanSessions() {
 	if u.Sessions == nil || len(u.Sessions) == 0 {
@@ -93,11 +172,43 @@ func (u *User) CleanSessions() {
 
 // Session represents a session for this user
 type Session struct {
-	ID      uuid.UUID `json:"id"`
-	UserID  uuid.UUID `json:"-"`
-	Expires time.Time
-	Key     *Password
-	Secret  string `json:"-"`
+	ID        uuid.UUID `json:"id"`
+	UserID    uuid.UUID `json:"-"`
+	Created   time.Time
+	LastUsed  time.Time
+	Expires   time.Time
+	UserAgent string
+	IP        string
+	Label     string
+	Key       *Password
+	Secret    string `json:"-"`
+}
+
+// MaxSessionLabelLength is the most characters in a session label.
+const MaxSessionLabelLength = 64
+
+// ErrSessionLabelTooLong indicates a session label over MaxSessionLabelLength.
+var ErrSessionLabelTooLong = errors.New("session label too long")
+
+// SetLabel names this session, trimming surrounding space.
+func (s *Session) SetLabel(label string) error {
+	label = strings.TrimSpace(label)
+	if utf8.RuneCountInString(label) > MaxSessionLabelLength {
+		return ErrSessionLabelTooLong
+	}
+	s.Label = label
+	return nil
+}
+
+// Touch records a use of this session by a client with the given user agent and
+// IP address. It returns true if the session changed enough to need saving.
+func (s *Session) Touch(userAgent, ip string) bool {
+	now := time.Now()
+	changed := now.Sub(s.LastUsed) > SessionTouchInterval || s.UserAgent != userAgent || s.IP != ip
+	s.LastUsed = now
+	s.UserAgent = userAgent
+	s.IP = ip
+	return changed
 }
 
 // AccessLevel indicates a user's permissions.
@@ -0,0 +1,51 @@
+package users
+
+import (
+	"testing"
+)
+
+func TestRemoveSession(t *testing.T) {
+	u := New("test")
+	var sessions []Session
+	for i := 0; i < 3; i++ {
+		sess, err := u.NewSession("test-agent", "127.0.0.1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		sessions = append(sessions, sess)
+	}
+	if !u.RemoveSession(sessions[1].ID) {
+		t.Fatal("RemoveSession returned false for existing session")
+	}
+	if len(u.Sessions) != 2 || u.Session(sessions[1].ID) != nil {
+		t.Errorf("session not removed, %d sessions remain", len(u.Sessions))
+	}
+	if u.Session(sessions[0].ID) == nil || u.Session(sessions[2].ID) == nil {
+		t.Error("wrong session removed")
+	}
+	if u.RemoveSession(sessions[1].ID) {
+		t.Error("RemoveSession returned true for removed session")
+	}
+	if !u.ValidateSession(sessions[2].ID, sessions[2].Secret) {
+		t.Error("remaining session not valid")
+	}
+}
+
+func TestRevokeSessions(t *testing.T) {
+	u := New("test")
+	keep, err := u.NewSession("test-agent", "127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = u.NewSession("other-agent", "127.0.0.2"); err != nil {
+		t.Fatal(err)
+	}
+	u.RevokeSessions(keep.ID)
+	if len(u.Sessions) != 1 || u.Sessions[0].ID != keep.ID {
+		t.Errorf("expected only session %s to remain, got %d sessions", keep.ID, len(u.Sessions))
+	}
+	u.RevokeSessions()
+	if len(u.Sessions) != 0 {
+		t.Errorf("expected no sessions to remain, got %d", len(u.Sessions))
+	}
+}